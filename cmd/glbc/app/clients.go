@@ -24,6 +24,7 @@ import (
 	"os"
 	"time"
 
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	cloudprovider "k8s.io/cloud-provider"
@@ -35,6 +36,7 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 
 	"k8s.io/ingress-gce/pkg/flags"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/ingress-gce/pkg/ratelimit"
 	"k8s.io/ingress-gce/pkg/utils"
 )
@@ -88,11 +90,21 @@ func NewGCEClient() *gce.Cloud {
 		if err == nil {
 			cloud := provider.(*gce.Cloud)
 			// Configure GCE rate limiting
-			rl, err := ratelimit.NewGCERateLimiter(flags.F.GCERateLimit.Values(), flags.F.GCEOperationPollInterval)
-			if err != nil {
-				klog.Fatalf("Error configuring rate limiting: %v", err)
+			if flags.F.GCEAdaptiveRateLimit {
+				config := ratelimit.DefaultAdaptiveConfig(flags.F.GCEAdaptiveRateLimitQPS, flags.F.GCEAdaptiveRateLimitBurst)
+				rl, err := ratelimit.NewAdaptiveRateLimiter(flags.F.GCERateLimit.Values(), config, flags.F.GCEOperationPollInterval)
+				if err != nil {
+					klog.Fatalf("Error configuring adaptive rate limiting: %v", err)
+				}
+				ratelimit.SetObserver(rl)
+				cloud.SetRateLimiter(rl)
+			} else {
+				rl, err := ratelimit.NewGCERateLimiter(flags.F.GCERateLimit.Values(), flags.F.GCEOperationPollInterval)
+				if err != nil {
+					klog.Fatalf("Error configuring rate limiting: %v", err)
+				}
+				cloud.SetRateLimiter(rl)
 			}
-			cloud.SetRateLimiter(rl)
 			// If this controller is scheduled on a node without compute/rw
 			// it won't be allowed to list backends. We can assume that the
 			// user has no need for Ingress in this case. If they grant
@@ -110,6 +122,23 @@ func NewGCEClient() *gce.Cloud {
 	}
 }
 
+// EndpointSlicesServed returns true if the API server serves the
+// EndpointSlices read by the NEG controller.
+func EndpointSlicesServed(kubeClient kubernetes.Interface) bool {
+	gv := negtypes.EndpointSliceGVR.GroupVersion().String()
+	resources, err := kubeClient.Discovery().ServerResourcesForGroupVersion(gv)
+	if err != nil {
+		klog.Warningf("Failed to discover resources of %v: %v", gv, err)
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == negtypes.EndpointSliceGVR.Resource {
+			return true
+		}
+	}
+	return false
+}
+
 type readerFunc func() io.Reader
 
 func generateConfigReaderFunc(config []byte) readerFunc {
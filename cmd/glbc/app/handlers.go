@@ -31,16 +31,23 @@ import (
 
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/controller"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/version"
 )
 
 // RunHTTPServer starts an HTTP server. `healthChecker` returns a mapping of component/controller
-// name to the result of its healthcheck.
-func RunHTTPServer(healthChecker func() context.HealthCheckResults) {
+// name to the result of its healthcheck. `auditor` serves the last drift report, `negOrphans`
+// the orphan NEGs found by the last NEG garbage collection, `negReadiness` the pods waiting
+// on NEG readiness and `negSyncers` the internal states of the NEG syncers.
+func RunHTTPServer(healthChecker func() context.HealthCheckResults, auditor *drift.Auditor, negOrphans, negReadiness, negSyncers http.Handler) {
 	http.HandleFunc("/healthz", healthCheckHandler(healthChecker))
 	http.HandleFunc("/flag", flagHandler)
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/debug/drift", auditor)
+	http.Handle("/debug/neg-orphans", negOrphans)
+	http.Handle("/debug/neg-readiness", negReadiness)
+	http.Handle("/debug/neg-syncers", negSyncers)
 
 	klog.V(0).Infof("Running http server on :%v", flags.F.HealthzPort)
 	klog.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", flags.F.HealthzPort), nil))
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
 	flag "github.com/spf13/pflag"
@@ -37,21 +38,32 @@ import (
 	"k8s.io/client-go/tools/record"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned"
 	frontendconfigclient "k8s.io/ingress-gce/pkg/frontendconfig/client/clientset/versioned"
+	svcnegclient "k8s.io/ingress-gce/pkg/svcneg/client/clientset/versioned"
 
 	ingctx "k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/controller"
+	"k8s.io/ingress-gce/pkg/controller/translator"
 	"k8s.io/ingress-gce/pkg/neg"
+	"k8s.io/ingress-gce/pkg/neg/readiness"
+	"k8s.io/ingress-gce/pkg/neg/sharding"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 
 	"k8s.io/ingress-gce/cmd/glbc/app"
 	"k8s.io/ingress-gce/pkg/backendconfig"
 	"k8s.io/ingress-gce/pkg/crd"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/firewalls"
 	"k8s.io/ingress-gce/pkg/flags"
 	_ "k8s.io/ingress-gce/pkg/klog"
+	"k8s.io/ingress-gce/pkg/svcneg"
 	"k8s.io/ingress-gce/pkg/version"
+	// Register the workqueue depth and latency metrics.
+	_ "k8s.io/kubernetes/pkg/util/workqueue/prometheus"
 )
 
+// negShardLeasePrefix is the name prefix of the Leases of NEG shards.
+const negShardLeasePrefix = "ingress-gce-neg-shard"
+
 func main() {
 	flags.Register()
 	rand.Seed(time.Now().UTC().UnixNano())
@@ -79,8 +91,12 @@ func main() {
 	if err != nil {
 		klog.Fatalf("Failed to create kubernetes client: %v", err)
 	}
+	if flags.F.EnableEndpointSlices && !app.EndpointSlicesServed(kubeClient) {
+		klog.Warningf("EndpointSlices are not served by the API server, NEG syncers will read Endpoints")
+		flags.F.EnableEndpointSlices = false
+	}
 	var dynamicClient dynamic.Interface
-	if flags.F.EnableCSM {
+	if flags.F.EnableCSM || flags.F.EnableEndpointSlices {
 		dynamicClient, err = dynamic.NewForConfig(kubeConfig)
 		if err != nil {
 			klog.Fatalf("Failed to create kubernetes dynamic client: %v", err)
@@ -122,6 +138,18 @@ func main() {
 		}
 	}
 
+	var svcNegClient svcnegclient.Interface
+	if flags.F.EnableNegCrd {
+		if _, err := crdHandler.EnsureCRD(svcneg.CRDMeta()); err != nil {
+			klog.Fatalf("Failed to ensure ServiceNetworkEndpointGroup CRD: %v", err)
+		}
+
+		svcNegClient, err = svcnegclient.NewForConfig(kubeConfig)
+		if err != nil {
+			klog.Fatalf("Failed to create ServiceNetworkEndpointGroup client: %v", err)
+		}
+	}
+
 	namer, err := app.NewNamer(kubeClient, flags.F.ClusterName, firewalls.DefaultFirewallName)
 	if err != nil {
 		klog.Fatalf("app.NewNamer(ctx.KubeClient, %q, %q) = %v", flags.F.ClusterName, firewalls.DefaultFirewallName, err)
@@ -140,17 +168,38 @@ func main() {
 		DefaultBackendHealthCheckPath: flags.F.DefaultSvcHealthCheckPath,
 		FrontendConfigEnabled:         flags.F.EnableFrontendConfig,
 		EnableCSM:                     flags.F.EnableCSM,
+		EnableEndpointSlices:          flags.F.EnableEndpointSlices,
+	}
+	ctx := ingctx.NewControllerContext(kubeClient, dynamicClient, backendConfigClient, frontendConfigClient, svcNegClient, cloud, namer, ctxConfig)
+	auditor := drift.NewAuditor(ctx)
+	negOrphans := neg.NewOrphanReporter()
+	negReadiness := readiness.NewWaitingPodsHandler()
+	negSyncers := neg.NewSyncerStatesHandler()
+	go app.RunHTTPServer(ctx.HealthCheck, auditor, negOrphans, negReadiness, negSyncers)
+
+	stopCh := make(chan struct{})
+	if flags.F.NegShards > 0 {
+		// Every replica syncs the NEGs of the shards it holds, whether it is the leader or not.
+		id, err := identity()
+		if err != nil {
+			klog.Fatalf("%v", err)
+		}
+		// Lease names may not contain underscores.
+		elector := sharding.NewElector(leaderElectKubeClient, flags.F.LeaderElection.LockObjectNamespace, negShardLeasePrefix, strings.Replace(id, "_", "-", -1), flags.F.NegShards,
+			flags.F.LeaderElection.LeaseDuration.Duration, flags.F.LeaderElection.RenewDeadline.Duration, flags.F.LeaderElection.RetryPeriod.Duration)
+		negController := newNegController(ctx, translator.NewTranslator(ctx), elector, negOrphans, negReadiness, negSyncers)
+		go negController.Run(stopCh)
+		klog.V(0).Infof("negController started with %d shards", flags.F.NegShards)
+		ctx.Start(stopCh)
 	}
-	ctx := ingctx.NewControllerContext(kubeClient, dynamicClient, backendConfigClient, frontendConfigClient, cloud, namer, ctxConfig)
-	go app.RunHTTPServer(ctx.HealthCheck)
 
 	if !flags.F.LeaderElection.LeaderElect {
-		runControllers(ctx)
+		runControllers(ctx, auditor, negOrphans, negReadiness, negSyncers, stopCh)
 		return
 	}
 
 	electionConfig, err := makeLeaderElectionConfig(leaderElectKubeClient, ctx.Recorder(flags.F.LeaderElection.LockObjectNamespace), func() {
-		runControllers(ctx)
+		runControllers(ctx, auditor, negOrphans, negReadiness, negSyncers, stopCh)
 	})
 	if err != nil {
 		klog.Fatalf("%v", err)
@@ -161,12 +210,10 @@ func main() {
 // makeLeaderElectionConfig builds a leader election configuration. It will
 // create a new resource lock associated with the configuration.
 func makeLeaderElectionConfig(client clientset.Interface, recorder record.EventRecorder, run func()) (*leaderelection.LeaderElectionConfig, error) {
-	hostname, err := os.Hostname()
+	id, err := identity()
 	if err != nil {
-		return nil, fmt.Errorf("unable to get hostname: %v", err)
+		return nil, err
 	}
-	// add a uniquifier so that two processes on the same host don't accidentally both become active
-	id := fmt.Sprintf("%v_%x", hostname, rand.Intn(1e6))
 	rl, err := resourcelock.New(resourcelock.ConfigMapsResourceLock,
 		flags.F.LeaderElection.LockObjectNamespace,
 		flags.F.LeaderElection.LockObjectName,
@@ -198,24 +245,53 @@ func makeLeaderElectionConfig(client clientset.Interface, recorder record.EventR
 	}, nil
 }
 
-func runControllers(ctx *ingctx.ControllerContext) {
-	stopCh := make(chan struct{})
+// identity returns the identity of the replica in leader election.
+func identity() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("unable to get hostname: %v", err)
+	}
+	// add a uniquifier so that two processes on the same host don't accidentally both become active
+	return fmt.Sprintf("%v_%x", hostname, rand.Intn(1e6)), nil
+}
+
+// newNegController returns the NEG controller. If elector is not nil, it only syncs the NEGs of the shards elected.
+func newNegController(ctx *ingctx.ControllerContext, zoneGetter negtypes.ZoneGetter, elector *sharding.Elector, negOrphans *neg.OrphanReporter, negReadiness *readiness.WaitingPodsHandler, negSyncers *neg.SyncerStatesHandler) *neg.Controller {
+	// TODO: Refactor NEG to use cloud mocks so ctx.Cloud can be referenced within NewController.
+	negCloud := negtypes.NewAdapter(ctx.Cloud)
+	if flags.F.NegOperationZoneConcurrency > 0 {
+		negCloud = negtypes.NewOperationScheduler(negCloud, flags.F.NegOperationZoneConcurrency)
+	}
+	return neg.NewController(negCloud, ctx, zoneGetter, ctx.ClusterNamer, flags.F.ResyncPeriod, flags.F.NegGCPeriod, neg.NegSyncerType(flags.F.NegSyncerType), flags.F.EnableReadinessReflector, flags.F.EnableNegDrainCondition, flags.F.NegCheckpointConfigMap, flags.F.EnableCSM, flags.F.CSMServiceNEGSkipNamespaces, flags.F.HybridNegZone, elector, flags.F.NegGCDryRun, flags.F.NegGCMinAge, negOrphans, negReadiness, negSyncers)
+}
+
+func runControllers(ctx *ingctx.ControllerContext, auditor *drift.Auditor, negOrphans *neg.OrphanReporter, negReadiness *readiness.WaitingPodsHandler, negSyncers *neg.SyncerStatesHandler, stopCh chan struct{}) {
 	lbc := controller.NewLoadBalancerController(ctx, stopCh)
 
 	fwc := firewalls.NewFirewallController(ctx, flags.F.NodePortRanges.Values())
 
-	// TODO: Refactor NEG to use cloud mocks so ctx.Cloud can be referenced within NewController.
-	negController := neg.NewController(negtypes.NewAdapter(ctx.Cloud), ctx, lbc.Translator, ctx.ClusterNamer, flags.F.ResyncPeriod, flags.F.NegGCPeriod, neg.NegSyncerType(flags.F.NegSyncerType), flags.F.EnableReadinessReflector, flags.F.EnableCSM, flags.F.CSMServiceNEGSkipNamespaces)
-
-	go negController.Run(stopCh)
-	klog.V(0).Infof("negController started")
+	// Sharded NEG controllers run in every replica, not only in the leader.
+	if flags.F.NegShards == 0 {
+		negController := newNegController(ctx, lbc.Translator, nil, negOrphans, negReadiness, negSyncers)
+		go negController.Run(stopCh)
+		klog.V(0).Infof("negController started")
+	}
 
 	go app.RunSIGTERMHandler(lbc, flags.F.DeleteAllOnQuit)
 
 	go fwc.Run()
 	klog.V(0).Infof("firewall controller started")
 
-	ctx.Start(stopCh)
+	if flags.F.DriftAuditPeriod > 0 {
+		auditor.AddSource("loadbalancer", lbc)
+		auditor.AddSource("firewall", fwc)
+		go auditor.Run(flags.F.DriftAuditPeriod, stopCh)
+	}
+
+	// Informers are already started with sharded NEG controllers.
+	if flags.F.NegShards == 0 {
+		ctx.Start(stopCh)
+	}
 	lbc.Init()
 	lbc.Run()
 
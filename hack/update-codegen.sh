@@ -62,3 +62,10 @@ ${GOPATH}/bin/openapi-gen \
   --input-dirs k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1\
   --output-package k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1 \
   --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.go.txt
+
+echo "Performing code generation for ServiceNetworkEndpointGroup CRD"
+${CODEGEN_PKG}/generate-groups.sh \
+  "deepcopy,client,informer,lister" \
+  k8s.io/ingress-gce/pkg/svcneg/client k8s.io/ingress-gce/pkg/apis \
+  svcneg:v1beta1 \
+  --go-header-file ${SCRIPT_ROOT}/hack/boilerplate.go.txt
@@ -17,6 +17,8 @@ limitations under the License.
 package annotations
 
 import (
+	"encoding/json"
+	"fmt"
 	"strconv"
 
 	"k8s.io/api/networking/v1beta1"
@@ -41,6 +43,61 @@ const (
 	// responsibility to create/delete it.
 	StaticIPNameKey = "kubernetes.io/ingress.global-static-ip-name"
 
+	// ManagedStaticIPKey tells the Ingress controller to reserve a static ip
+	// for the Ingress and own it. Unlike StaticIPNameKey, the controller
+	// creates and deletes the ip itself, subject to StaticIPReclaimPolicyKey.
+	ManagedStaticIPKey = "networking.gke.io/managed-static-ip"
+
+	// ImportStaticIPKey is the name of an existing static ip which the
+	// Ingress controller should take ownership of. Setting this implies
+	// ManagedStaticIPKey. For L7-ILB the ip must be a regional address.
+	ImportStaticIPKey = "networking.gke.io/import-static-ip"
+
+	// StaticIPReclaimPolicyKey determines what happens to a static ip owned
+	// by the Ingress controller when the Ingress is deleted. Valid values are
+	// StaticIPReclaimDelete (default) and StaticIPReclaimRetain. A retained
+	// ip is reused if an Ingress with the same namespace/name is created.
+	StaticIPReclaimPolicyKey = "networking.gke.io/static-ip-reclaim-policy"
+	StaticIPReclaimDelete    = "Delete"
+	StaticIPReclaimRetain    = "Retain"
+
+	// EnableIPv6Key tells the Ingress controller to create IPv6 forwarding
+	// rules alongside the IPv4 ones, sharing the same target proxies. Only
+	// supported for external Ingresses.
+	EnableIPv6Key = "networking.gke.io/enable-ipv6"
+
+	// StaticIPv6NameKey tells the Ingress controller to use a specific GCE
+	// global static IPv6 address for its IPv6 forwarding rules. Setting this
+	// implies EnableIPv6Key. Like StaticIPNameKey, the controller *does not*
+	// manage this address.
+	StaticIPv6NameKey = "networking.gke.io/global-static-ipv6-name"
+
+	// ILBSubnetKey is the name of the subnet in which the L7-ILB forwarding
+	// rules are created. It may also be given as a subnetwork URL, which must
+	// be in the region of the cluster. If unset, the subnet of the cluster is
+	// used.
+	ILBSubnetKey = "networking.gke.io/internal-load-balancer-subnet"
+
+	// ILBIPKey is a specific internal ip address for the L7-ILB forwarding
+	// rules. The address must be free in the subnet of the load balancer.
+	ILBIPKey = "networking.gke.io/internal-load-balancer-ip"
+
+	// ILBAllowGlobalAccessKey tells the Ingress controller to allow clients
+	// from any region to reach the L7-ILB.
+	ILBAllowGlobalAccessKey = "networking.gke.io/internal-load-balancer-allow-global-access"
+
+	// AdoptResourcesKey tells the Ingress controller to adopt existing GCE
+	// load balancer resources instead of creating its own, so that a hand
+	// built load balancer keeps its VIP when it is migrated to an Ingress.
+	// The value is a JSON object naming the resources to adopt, any of which
+	// may be omitted. Adopted resources are updated like the ones created by
+	// the controller, but are released instead of deleted when the Ingress
+	// is deleted or they are removed from the annotation.
+	// Examples:
+	// - annotations:
+	//     networking.gke.io/adopt-resources: '{"urlMap": "my-map", "targetHttpProxy": "my-proxy", "forwardingRule": "my-rule", "staticIP": "my-ip"}'
+	AdoptResourcesKey = "networking.gke.io/adopt-resources"
+
 	// PreSharedCertKey represents the specific pre-shared SSL
 	// certicate for the Ingress controller to use. The controller *does not*
 	// manage this certificate, it is the users responsibility to create/delete it.
@@ -59,6 +116,9 @@ const (
 	// Label key to denote which GCE zone a Kubernetes node is in.
 	ZoneKey     = "failure-domain.beta.kubernetes.io/zone"
 	DefaultZone = ""
+	// TopologyZoneKey is the GA label key to denote which GCE zone a Kubernetes
+	// node is in. It takes precedence over ZoneKey.
+	TopologyZoneKey = "topology.kubernetes.io/zone"
 
 	// InstanceGroupsAnnotationKey is the annotation key used by controller to
 	// specify the name and zone of instance groups created for the ingress.
@@ -79,6 +139,18 @@ const (
 	FrontendConfigKey = "networking.gke.io/v1beta1.FrontendConfig"
 )
 
+// AdoptedResources names the existing GCE resources to adopt for an Ingress.
+type AdoptedResources struct {
+	UrlMap              string `json:"urlMap,omitempty"`
+	TargetHttpProxy     string `json:"targetHttpProxy,omitempty"`
+	TargetHttpsProxy    string `json:"targetHttpsProxy,omitempty"`
+	ForwardingRule      string `json:"forwardingRule,omitempty"`
+	HttpsForwardingRule string `json:"httpsForwardingRule,omitempty"`
+	// StaticIP is the address used by the forwarding rules. Like the ip
+	// named by StaticIPNameKey, it is never deleted by the controller.
+	StaticIP string `json:"staticIP,omitempty"`
+}
+
 // Ingress represents ingress annotations.
 type Ingress struct {
 	v map[string]string
@@ -120,6 +192,116 @@ func (ing *Ingress) StaticIPName() string {
 	return val
 }
 
+// EnableIPv6 returns true if IPv6 forwarding rules should be created.
+// False by default.
+func (ing *Ingress) EnableIPv6() bool {
+	if ing.StaticIPv6Name() != "" {
+		return true
+	}
+	val, ok := ing.v[EnableIPv6Key]
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+	return v
+}
+
+// StaticIPv6Name returns the name of the global static IPv6 address to use.
+// Empty by default.
+func (ing *Ingress) StaticIPv6Name() string {
+	val, ok := ing.v[StaticIPv6NameKey]
+	if !ok {
+		return ""
+	}
+	return val
+}
+
+// ManagedStaticIP returns true if the controller should reserve and own a
+// static ip for the Ingress. False by default.
+func (ing *Ingress) ManagedStaticIP() bool {
+	if ing.ImportStaticIPName() != "" {
+		return true
+	}
+	val, ok := ing.v[ManagedStaticIPKey]
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+	return v
+}
+
+// ImportStaticIPName returns the name of an existing static ip to take
+// ownership of. Empty by default.
+func (ing *Ingress) ImportStaticIPName() string {
+	val, ok := ing.v[ImportStaticIPKey]
+	if !ok {
+		return ""
+	}
+	return val
+}
+
+// RetainStaticIP returns true if a controller owned static ip should be kept
+// when the Ingress is deleted. False by default.
+func (ing *Ingress) RetainStaticIP() bool {
+	return ing.v[StaticIPReclaimPolicyKey] == StaticIPReclaimRetain
+}
+
+// AdoptedResources returns the existing GCE resources to adopt, nil if none.
+func (ing *Ingress) AdoptedResources() (*AdoptedResources, error) {
+	val, ok := ing.v[AdoptResourcesKey]
+	if !ok {
+		return nil, nil
+	}
+	res := &AdoptedResources{}
+	if err := json.Unmarshal([]byte(val), res); err != nil {
+		return nil, fmt.Errorf("invalid %v annotation: %v", AdoptResourcesKey, err)
+	}
+	if *res == (AdoptedResources{}) {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// ILBSubnet returns the subnet for the L7-ILB forwarding rules. Empty by
+// default.
+func (ing *Ingress) ILBSubnet() string {
+	val, ok := ing.v[ILBSubnetKey]
+	if !ok {
+		return ""
+	}
+	return val
+}
+
+// ILBIP returns the internal ip address for the L7-ILB forwarding rules.
+// Empty by default.
+func (ing *Ingress) ILBIP() string {
+	val, ok := ing.v[ILBIPKey]
+	if !ok {
+		return ""
+	}
+	return val
+}
+
+// ILBAllowGlobalAccess returns true if the L7-ILB should be reachable from
+// all regions. False by default.
+func (ing *Ingress) ILBAllowGlobalAccess() bool {
+	val, ok := ing.v[ILBAllowGlobalAccessKey]
+	if !ok {
+		return false
+	}
+	v, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+	return v
+}
+
 func (ing *Ingress) IngressClass() string {
 	val, ok := ing.v[IngressClassKey]
 	if !ok {
@@ -17,6 +17,7 @@ limitations under the License.
 package annotations
 
 import (
+	"reflect"
 	"testing"
 
 	"k8s.io/api/networking/v1beta1"
@@ -30,6 +31,14 @@ func TestIngress(t *testing.T) {
 		useNamedTLS  string
 		staticIPName string
 		ingressClass string
+		managedIP    bool
+		importIP     string
+		retainIP     bool
+		enableIPv6   bool
+		staticIPv6   string
+		ilbSubnet    string
+		ilbIP        string
+		globalAccess bool
 	}{
 		{
 			ing:       &v1beta1.Ingress{},
@@ -51,6 +60,59 @@ func TestIngress(t *testing.T) {
 			staticIPName: "1.2.3.4",
 			ingressClass: "gce",
 		},
+		{
+			ing: &v1beta1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						ManagedStaticIPKey:       "true",
+						StaticIPReclaimPolicyKey: StaticIPReclaimRetain,
+					},
+				},
+			},
+			allowHTTP: true,
+			managedIP: true,
+			retainIP:  true,
+		},
+		{
+			ing: &v1beta1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						ImportStaticIPKey:        "my-ip",
+						StaticIPReclaimPolicyKey: StaticIPReclaimDelete,
+					},
+				},
+			},
+			allowHTTP: true,
+			managedIP: true,
+			importIP:  "my-ip",
+		},
+		{
+			ing: &v1beta1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						StaticIPv6NameKey: "my-ipv6",
+					},
+				},
+			},
+			allowHTTP:  true,
+			enableIPv6: true,
+			staticIPv6: "my-ipv6",
+		},
+		{
+			ing: &v1beta1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						ILBSubnetKey:            "my-subnet",
+						ILBIPKey:                "10.1.2.3",
+						ILBAllowGlobalAccessKey: "true",
+					},
+				},
+			},
+			allowHTTP:    true,
+			ilbSubnet:    "my-subnet",
+			ilbIP:        "10.1.2.3",
+			globalAccess: true,
+		},
 	} {
 		ing := FromIngress(tc.ing)
 		if x := ing.AllowHTTP(); x != tc.allowHTTP {
@@ -65,5 +127,68 @@ func TestIngress(t *testing.T) {
 		if x := ing.IngressClass(); x != tc.ingressClass {
 			t.Errorf("ingress %+v; IngressClass() = %v, want %v", tc.ing, x, tc.ingressClass)
 		}
+		if x := ing.ManagedStaticIP(); x != tc.managedIP {
+			t.Errorf("ingress %+v; ManagedStaticIP() = %v, want %v", tc.ing, x, tc.managedIP)
+		}
+		if x := ing.ImportStaticIPName(); x != tc.importIP {
+			t.Errorf("ingress %+v; ImportStaticIPName() = %v, want %v", tc.ing, x, tc.importIP)
+		}
+		if x := ing.RetainStaticIP(); x != tc.retainIP {
+			t.Errorf("ingress %+v; RetainStaticIP() = %v, want %v", tc.ing, x, tc.retainIP)
+		}
+		if x := ing.EnableIPv6(); x != tc.enableIPv6 {
+			t.Errorf("ingress %+v; EnableIPv6() = %v, want %v", tc.ing, x, tc.enableIPv6)
+		}
+		if x := ing.StaticIPv6Name(); x != tc.staticIPv6 {
+			t.Errorf("ingress %+v; StaticIPv6Name() = %v, want %v", tc.ing, x, tc.staticIPv6)
+		}
+		if x := ing.ILBSubnet(); x != tc.ilbSubnet {
+			t.Errorf("ingress %+v; ILBSubnet() = %v, want %v", tc.ing, x, tc.ilbSubnet)
+		}
+		if x := ing.ILBIP(); x != tc.ilbIP {
+			t.Errorf("ingress %+v; ILBIP() = %v, want %v", tc.ing, x, tc.ilbIP)
+		}
+		if x := ing.ILBAllowGlobalAccess(); x != tc.globalAccess {
+			t.Errorf("ingress %+v; ILBAllowGlobalAccess() = %v, want %v", tc.ing, x, tc.globalAccess)
+		}
+	}
+}
+
+func TestAdoptedResources(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		val     string
+		want    *AdoptedResources
+		wantErr bool
+	}{
+		{
+			desc: "no annotation",
+		},
+		{
+			desc: "empty",
+			val:  "{}",
+		},
+		{
+			desc: "some resources",
+			val:  `{"urlMap": "my-map", "forwardingRule": "my-rule", "staticIP": "my-ip"}`,
+			want: &AdoptedResources{UrlMap: "my-map", ForwardingRule: "my-rule", StaticIP: "my-ip"},
+		},
+		{
+			desc:    "invalid json",
+			val:     "my-map",
+			wantErr: true,
+		},
+	} {
+		ing := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+		if tc.val != "" {
+			ing.Annotations[AdoptResourcesKey] = tc.val
+		}
+		got, err := FromIngress(ing).AdoptedResources()
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("%s: AdoptedResources() = _, %v, want error %v", tc.desc, err, tc.wantErr)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: AdoptedResources() = %+v, want %+v", tc.desc, got, tc.want)
+		}
 	}
 }
@@ -35,18 +35,28 @@ const (
 
 	// NEGAnnotationKey is the annotation key to enable GCE NEG.
 	// The value of the annotation must be a valid JSON string in the format
-	// specified by type NegAnnotation. To enable, must have either Ingress: true
-	// or a non-empty ExposedPorts map referencing valid ServicePorts.
+	// specified by type NegAnnotation. To enable, must have either Ingress: true,
+	// VmIp: true or a non-empty ExposedPorts map referencing valid ServicePorts.
 	// examples:
 	// - `{"exposed_ports":{"80":{},"443":{}}}`
 	// - `{"ingress":true}`
 	// - `{"ingress": true,"exposed_ports":{"3000":{},"4000":{}}}`
+	// - `{"exposed_ports":{"80":{"name":"my-neg"}}}`
+	// - `{"vm_ip":true}`
 	NEGAnnotationKey = "cloud.google.com/neg"
 
 	// NEGStatusKey is the annotation key whose value is the status of the NEGs
 	// on the Service, and is applied by the NEG Controller.
 	NEGStatusKey = "cloud.google.com/neg-status"
 
+	// NEGReadinessPolicyKey is the annotation key of the policy applied to the
+	// NEG readiness gate of the pods of the service. The value must be a valid
+	// JSON string in the format specified by type NegReadinessPolicy.
+	// examples:
+	// - `{"timeoutSec":300}`
+	// - `{"timeoutSec":600,"onTimeout":"FailClosed"}`
+	NEGReadinessPolicyKey = "cloud.google.com/neg-readiness-policy"
+
 	// BackendConfigKey is a stringified JSON with two fields:
 	// - "ports": a map of port names or port numbers to backendConfig names
 	// - "default": denotes the default backendConfig name for all ports except
@@ -80,13 +90,20 @@ type NegAnnotation struct {
 	// ExposedPorts maps ServicePort to attributes of the NEG that should be
 	// associated with the ServicePort.
 	ExposedPorts map[int32]NegAttributes `json:"exposed_ports,omitempty"`
+	// VmIp indicates whether to maintain GCE_VM_IP NEGs for the service, to be
+	// used as backends of an L4 internal load balancer. The NEG of each zone
+	// contains the nodes hosting the ready pods of the service. It is reported
+	// under service port 0 in the NEG status.
+	VmIp bool `json:"vm_ip,omitempty"`
 }
 
 // NegAttributes houses the attributes of the NEGs that are associated with the
 // service. Future extensions to the Expose NEGs annotation should be added here.
 type NegAttributes struct {
-	// Note - in the future, this will be used for custom naming of NEGs.
-	// Currently has no effect.
+	// Name is the custom name of the NEG. It must be a valid GCE resource
+	// name and unique among the NEGs of the cluster. A NEG with this name is
+	// only adopted if it was created for the service by this cluster.
+	// If empty, the name is generated.
 	Name string `json:"name,omitempty"`
 }
 
@@ -101,9 +118,14 @@ func (n *NegAnnotation) NEGExposed() bool {
 	return len(n.ExposedPorts) > 0
 }
 
+// NEGEnabledForVmIp is true if the service has GCE_VM_IP NEGs
+func (n *NegAnnotation) NEGEnabledForVmIp() bool {
+	return n.VmIp
+}
+
 // NEGExposed is true if the service uses NEG
 func (n *NegAnnotation) NEGEnabled() bool {
-	return n.NEGEnabledForIngress() || n.NEGExposed()
+	return n.NEGEnabledForIngress() || n.NEGExposed() || n.NEGEnabledForVmIp()
 }
 
 func (n *NegAnnotation) String() string {
@@ -111,6 +133,29 @@ func (n *NegAnnotation) String() string {
 	return string(bytes)
 }
 
+// NegReadinessTimeoutAction is what happens to the NEG readiness gate of a
+// pod which did not become healthy in its NEGs before the timeout.
+type NegReadinessTimeoutAction string
+
+const (
+	// NegReadinessFailOpen marks the readiness gate of the pod True.
+	NegReadinessFailOpen NegReadinessTimeoutAction = "FailOpen"
+	// NegReadinessFailClosed keeps the readiness gate of the pod False
+	// until the pod becomes healthy.
+	NegReadinessFailClosed NegReadinessTimeoutAction = "FailClosed"
+)
+
+// NegReadinessPolicy is the format of the annotation associated with the
+// NEGReadinessPolicyKey key.
+type NegReadinessPolicy struct {
+	// TimeoutSec is the time a pod has to become healthy in its NEGs after
+	// it was created. If 0, the default timeout of the controller applies.
+	TimeoutSec int64 `json:"timeoutSec,omitempty"`
+	// OnTimeout is what happens once the timeout is reached. Defaults to
+	// FailOpen.
+	OnTimeout NegReadinessTimeoutAction `json:"onTimeout,omitempty"`
+}
+
 // PortNegMap is the mapping between service port to NEG name
 type PortNegMap map[string]string
 
@@ -197,6 +242,7 @@ var (
 	ErrBackendConfigInvalidJSON       = errors.New("BackendConfig annotation is invalid json")
 	ErrBackendConfigAnnotationMissing = errors.New("BackendConfig annotation is missing")
 	ErrNEGAnnotationInvalid           = errors.New("NEG annotation is invalid.")
+	ErrNEGReadinessPolicyInvalid      = errors.New("NEG readiness policy annotation is invalid.")
 )
 
 // NEGAnnotation returns true if NEG annotation is found.
@@ -216,6 +262,28 @@ func (svc *Service) NEGAnnotation() (*NegAnnotation, bool, error) {
 	return &res, true, nil
 }
 
+// NEGReadinessPolicy returns true if NEG readiness policy annotation is found.
+// If found, it also returns the policy, with OnTimeout defaulted.
+func (svc *Service) NEGReadinessPolicy() (*NegReadinessPolicy, bool, error) {
+	var res NegReadinessPolicy
+	annotation, ok := svc.v[NEGReadinessPolicyKey]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if err := json.Unmarshal([]byte(annotation), &res); err != nil || res.TimeoutSec < 0 {
+		return nil, true, ErrNEGReadinessPolicyInvalid
+	}
+	switch res.OnTimeout {
+	case "":
+		res.OnTimeout = NegReadinessFailOpen
+	case NegReadinessFailOpen, NegReadinessFailClosed:
+	default:
+		return nil, true, ErrNEGReadinessPolicyInvalid
+	}
+	return &res, true, nil
+}
+
 func (svc *Service) NEGStatus() (*NegStatus, bool, error) {
 	var res NegStatus
 	var err error
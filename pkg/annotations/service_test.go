@@ -35,6 +35,7 @@ func TestNEGAnnotation(t *testing.T) {
 		negEnabled          bool
 		ingress             bool
 		exposed             bool
+		vmIp                bool
 	}{
 		{
 			desc:        "NEG annotation not specified",
@@ -135,6 +136,22 @@ func TestNEGAnnotation(t *testing.T) {
 			ingress:    true,
 			exposed:    true,
 		},
+		{
+			desc: "NEG enabled for VM IP",
+			svc: &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						NEGAnnotationKey: `{"vm_ip":true}`,
+					},
+				},
+			},
+			expectFound: true,
+			expectNegAnnotation: &NegAnnotation{
+				VmIp: true,
+			},
+			negEnabled: true,
+			vmIp:       true,
+		},
 	} {
 		negAnnotation, found, err := FromService(tc.svc).NEGAnnotation()
 		if fmt.Sprintf("%q", err) != fmt.Sprintf("%q", tc.expectError) {
@@ -164,6 +181,10 @@ func TestNEGAnnotation(t *testing.T) {
 		if exposed := negAnnotation.NEGExposed(); exposed != tc.exposed {
 			t.Errorf("Test case %q: Expect NEGExposed() = %v; want %v", tc.desc, tc.exposed, exposed)
 		}
+
+		if vmIp := negAnnotation.NEGEnabledForVmIp(); vmIp != tc.vmIp {
+			t.Errorf("Test case %q: Expect NEGEnabledForVmIp() = %v; want %v", tc.desc, tc.vmIp, vmIp)
+		}
 	}
 }
 
@@ -230,6 +251,67 @@ func TestNEGStatus(t *testing.T) {
 	}
 }
 
+func TestNEGReadinessPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		annotation   string
+		expectPolicy *NegReadinessPolicy
+		expectError  error
+		expectFound  bool
+	}{
+		{
+			desc: "No NEG readiness policy",
+		},
+		{
+			desc:         "Timeout with default action",
+			annotation:   `{"timeoutSec":300}`,
+			expectPolicy: &NegReadinessPolicy{TimeoutSec: 300, OnTimeout: NegReadinessFailOpen},
+			expectFound:  true,
+		},
+		{
+			desc:         "Fail closed",
+			annotation:   `{"timeoutSec":600,"onTimeout":"FailClosed"}`,
+			expectPolicy: &NegReadinessPolicy{TimeoutSec: 600, OnTimeout: NegReadinessFailClosed},
+			expectFound:  true,
+		},
+		{
+			desc:        "Unknown action",
+			annotation:  `{"onTimeout":"FailSometimes"}`,
+			expectError: ErrNEGReadinessPolicyInvalid,
+			expectFound: true,
+		},
+		{
+			desc:        "Negative timeout",
+			annotation:  `{"timeoutSec":-1}`,
+			expectError: ErrNEGReadinessPolicyInvalid,
+			expectFound: true,
+		},
+		{
+			desc:        "Invalid JSON",
+			annotation:  `foobar`,
+			expectError: ErrNEGReadinessPolicyInvalid,
+			expectFound: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &v1.Service{}
+			if tc.annotation != "" {
+				svc.Annotations = map[string]string{NEGReadinessPolicyKey: tc.annotation}
+			}
+			policy, found, err := FromService(svc).NEGReadinessPolicy()
+			if err != tc.expectError {
+				t.Errorf("Expect error to be %v, but got %v", tc.expectError, err)
+			}
+			if found != tc.expectFound {
+				t.Errorf("Expect found to be %v, but got %v", tc.expectFound, found)
+			}
+			if !reflect.DeepEqual(policy, tc.expectPolicy) {
+				t.Errorf("Expect policy to be %+v, but got %+v", tc.expectPolicy, policy)
+			}
+		})
+	}
+}
+
 func TestService(t *testing.T) {
 	for _, tc := range []struct {
 		svc             *v1.Service
@@ -37,8 +37,30 @@ type FrontendConfig struct {
 // +k8s:openapi-gen=true
 type FrontendConfigSpec struct {
 	// Add individual features here
+
+	// AdditionalListeners are ports the load balancer serves on in addition
+	// to the default ports 80 (HTTP) and 443 (HTTPS).
+	// +optional
+	AdditionalListeners []Listener `json:"additionalListeners,omitempty"`
+}
+
+// Listener is an additional port the load balancer serves on.
+// +k8s:openapi-gen=true
+type Listener struct {
+	// Protocol is either HTTP or HTTPS. HTTP listeners use the HTTP target
+	// proxy and HTTPS listeners the HTTPS target proxy of the load balancer.
+	Protocol string `json:"protocol"`
+	// Port is the port the load balancer listens on.
+	Port int64 `json:"port"`
 }
 
+const (
+	// ListenerProtocolHTTP serves the listener through the HTTP target proxy.
+	ListenerProtocolHTTP = "HTTP"
+	// ListenerProtocolHTTPS serves the listener through the HTTPS target proxy.
+	ListenerProtocolHTTPS = "HTTPS"
+)
+
 // FrontendConfigStatus is the status for a FrontendConfig resource
 type FrontendConfigStatus struct{}
 
@@ -29,7 +29,7 @@ func (in *FrontendConfig) DeepCopyInto(out *FrontendConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	out.Status = in.Status
 	return
 }
@@ -88,6 +88,11 @@ func (in *FrontendConfigList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FrontendConfigSpec) DeepCopyInto(out *FrontendConfigSpec) {
 	*out = *in
+	if in.AdditionalListeners != nil {
+		in, out := &in.AdditionalListeners, &out.AdditionalListeners
+		*out = make([]Listener, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -116,3 +121,19 @@ func (in *FrontendConfigStatus) DeepCopy() *FrontendConfigStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Listener) DeepCopyInto(out *Listener) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Listener.
+func (in *Listener) DeepCopy() *Listener {
+	if in == nil {
+		return nil
+	}
+	out := new(Listener)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -31,6 +31,7 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 	return map[string]common.OpenAPIDefinition{
 		"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.FrontendConfig":     schema_pkg_apis_frontendconfig_v1beta1_FrontendConfig(ref),
 		"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.FrontendConfigSpec": schema_pkg_apis_frontendconfig_v1beta1_FrontendConfigSpec(ref),
+		"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.Listener":           schema_pkg_apis_frontendconfig_v1beta1_Listener(ref),
 	}
 }
 
@@ -84,6 +85,51 @@ func schema_pkg_apis_frontendconfig_v1beta1_FrontendConfigSpec(ref common.Refere
 			SchemaProps: spec.SchemaProps{
 				Description: "FrontendConfigSpec is the spec for a FrontendConfig resource",
 				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"additionalListeners": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AdditionalListeners are ports the load balancer serves on in addition to the default ports 80 (HTTP) and 443 (HTTPS).",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.Listener"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1.Listener"},
+	}
+}
+
+func schema_pkg_apis_frontendconfig_v1beta1_Listener(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Listener is an additional port the load balancer serves on.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"protocol": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Protocol is either HTTP or HTTPS. HTTP listeners use the HTTP target proxy and HTTPS listeners the HTTPS target proxy of the load balancer.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"port": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Port is the port the load balancer listens on.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+				},
+				Required: []string{"protocol", "port"},
 			},
 		},
 	}
@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceNetworkEndpointGroup reports the status of the NEG of a Service port.
+// It is named after the NEG, owned by the Service and maintained by the NEG
+// controller.
+type ServiceNetworkEndpointGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceNetworkEndpointGroupSpec   `json:"spec,omitempty"`
+	Status ServiceNetworkEndpointGroupStatus `json:"status,omitempty"`
+}
+
+// ServiceNetworkEndpointGroupSpec identifies the Service port of the NEG.
+type ServiceNetworkEndpointGroupSpec struct {
+	// ServiceName is the name of the Service.
+	ServiceName string `json:"serviceName"`
+	// Port is the Service port.
+	Port int32 `json:"port"`
+	// TargetPort is the target port of the endpoints of the NEG.
+	TargetPort string `json:"targetPort,omitempty"`
+	// Subset is the Istio DestinationRule subset of the NEG, if any.
+	// +optional
+	Subset string `json:"subset,omitempty"`
+}
+
+// ServiceNetworkEndpointGroupStatus is the status of the NEG.
+type ServiceNetworkEndpointGroupStatus struct {
+	// NetworkEndpointGroups are the NEG in each zone.
+	// +optional
+	NetworkEndpointGroups []NegObjectReference `json:"networkEndpointGroups,omitempty"`
+	// LastSyncTime is the time the NEG was last synced.
+	// +optional
+	LastSyncTime metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastSyncError is the error of the last sync, empty if it succeeded.
+	// +optional
+	LastSyncError string `json:"lastSyncError,omitempty"`
+}
+
+// NegObjectReference is the NEG in a zone.
+type NegObjectReference struct {
+	// Zone is the zone of the NEG.
+	Zone string `json:"zone"`
+	// SelfLink is the URL of the NEG.
+	// +optional
+	SelfLink string `json:"selfLink,omitempty"`
+	// NetworkEndpointCount is the number of endpoints in the NEG as of the
+	// last sync.
+	NetworkEndpointCount int64 `json:"networkEndpointCount"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceNetworkEndpointGroupList is a list of ServiceNetworkEndpointGroup resources
+type ServiceNetworkEndpointGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ServiceNetworkEndpointGroup `json:"items"`
+}
@@ -36,13 +36,16 @@ const (
 	// FeatureL7ILB defines the feature name of L7 Internal Load Balancer
 	// L7-ILB Resources are currently alpha and regional
 	FeatureL7ILB = "L7ILB"
+	// FeatureTrafficPolicy defines the feature name of the traffic policy of
+	// Istio DestinationRules.
+	FeatureTrafficPolicy = "TrafficPolicy"
 )
 
 var (
 	// versionToFeatures stores the mapping from the required API
 	// version to feature names.
 	versionToFeatures = map[meta.Version][]string{
-		meta.VersionBeta: []string{FeatureSecurityPolicy, FeatureHTTP2, FeatureL7ILB},
+		meta.VersionBeta: []string{FeatureSecurityPolicy, FeatureHTTP2, FeatureL7ILB, FeatureTrafficPolicy},
 	}
 	// TODO: (shance) refactor all scope to be above the serviceport level
 	scopeToFeatures = map[meta.KeyType][]string{
@@ -71,6 +74,9 @@ func featuresFromServicePort(sp *utils.ServicePort) []string {
 	if sp.L7ILBEnabled {
 		features = append(features, FeatureL7ILB)
 	}
+	if hasTrafficPolicy(sp) {
+		features = append(features, FeatureTrafficPolicy)
+	}
 	// Keep feature names sorted to be consistent.
 	sort.Strings(features)
 	return features
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	istioV1alpha3 "istio.io/api/networking/v1alpha3"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -74,6 +75,17 @@ var (
 		ID:         fakeSvcPortID,
 		NEGEnabled: true,
 	}
+
+	svcPortWithTrafficPolicy = utils.ServicePort{
+		ID:            fakeSvcPortID,
+		TrafficPolicy: &istioV1alpha3.TrafficPolicy{},
+	}
+
+	svcPortWithL7ILBTrafficPolicy = utils.ServicePort{
+		ID:            fakeSvcPortID,
+		L7ILBEnabled:  true,
+		TrafficPolicy: &istioV1alpha3.TrafficPolicy{},
+	}
 )
 
 func TestFeaturesFromServicePort(t *testing.T) {
@@ -107,6 +119,16 @@ func TestFeaturesFromServicePort(t *testing.T) {
 			svcPort:          svcPortWithHTTP2SecurityPolicy,
 			expectedFeatures: []string{"HTTP2", "SecurityPolicy"},
 		},
+		{
+			desc:             "TrafficPolicy without L7ILB",
+			svcPort:          svcPortWithTrafficPolicy,
+			expectedFeatures: []string{},
+		},
+		{
+			desc:             "L7ILB + TrafficPolicy",
+			svcPort:          svcPortWithL7ILBTrafficPolicy,
+			expectedFeatures: []string{"L7ILB", "TrafficPolicy"},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package features
+
+import (
+	"reflect"
+	"time"
+
+	gogotypes "github.com/gogo/protobuf/types"
+	istioV1alpha3 "istio.io/api/networking/v1alpha3"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+// localityLbPolicies maps the simple load balancers of Istio to the locality load
+// balancing policies of backend services.
+var localityLbPolicies = map[istioV1alpha3.LoadBalancerSettings_SimpleLB]string{
+	istioV1alpha3.LoadBalancerSettings_ROUND_ROBIN: "ROUND_ROBIN",
+	istioV1alpha3.LoadBalancerSettings_LEAST_CONN:  "LEAST_REQUEST",
+	istioV1alpha3.LoadBalancerSettings_RANDOM:      "RANDOM",
+	istioV1alpha3.LoadBalancerSettings_PASSTHROUGH: "ORIGINAL_DESTINATION",
+}
+
+// hasTrafficPolicy returns true if the traffic policy of the ServicePort applies to
+// its BackendService. Only L7-ILB BackendServices support the settings of traffic
+// policies.
+func hasTrafficPolicy(sp *utils.ServicePort) bool {
+	return sp.TrafficPolicy != nil && sp.L7ILBEnabled
+}
+
+// EnsureTrafficPolicy reads the load balancer, connection pool and outlier detection
+// settings of the ServicePort.TrafficPolicy and applies them to the BackendService.
+// It returns true if there were existing settings on the BackendService that were
+// overwritten.
+func EnsureTrafficPolicy(sp utils.ServicePort, be *composite.BackendService) bool {
+	if sp.TrafficPolicy == nil {
+		return false
+	}
+	if !sp.L7ILBEnabled {
+		// Logged at a high verbosity, as this happens on every sync of the backend service.
+		klog.V(4).Infof("Ignoring DestinationRule traffic policy of service %v/%v, which is only supported by L7-ILB backend services.", sp.ID.Service.Namespace, sp.ID.Service.Name)
+		return false
+	}
+	beTemp := &composite.BackendService{SessionAffinity: be.SessionAffinity}
+	applyTrafficPolicySettings(sp, beTemp)
+	if beTemp.LocalityLbPolicy != be.LocalityLbPolicy ||
+		beTemp.SessionAffinity != be.SessionAffinity ||
+		!reflect.DeepEqual(beTemp.ConsistentHash, be.ConsistentHash) ||
+		!reflect.DeepEqual(beTemp.CircuitBreakers, be.CircuitBreakers) ||
+		!outlierDetectionEqual(beTemp.OutlierDetection, be.OutlierDetection) {
+		applyTrafficPolicySettings(sp, be)
+		klog.V(2).Infof("Updated DestinationRule traffic policy settings for service %v/%v.", sp.ID.Service.Namespace, sp.ID.Service.Name)
+		return true
+	}
+	return false
+}
+
+// applyTrafficPolicySettings applies the traffic policy settings of the ServicePort
+// to the passed in composite.BackendService. A GCE API call still needs to be made
+// to actually persist the changes. The session affinity is only set by consistent
+// hash load balancers, which hash the affinity key.
+func applyTrafficPolicySettings(sp utils.ServicePort, be *composite.BackendService) {
+	policy := sp.TrafficPolicy
+
+	be.LocalityLbPolicy = ""
+	be.ConsistentHash = nil
+	if hash := policy.LoadBalancer.GetConsistentHash(); hash != nil {
+		be.LocalityLbPolicy = "RING_HASH"
+		be.ConsistentHash = &composite.ConsistentHashLoadBalancerSettings{
+			MinimumRingSize: int64(hash.MinimumRingSize),
+		}
+		switch {
+		case hash.GetHttpHeaderName() != "":
+			be.SessionAffinity = "HEADER_FIELD"
+			be.ConsistentHash.HttpHeaderName = hash.GetHttpHeaderName()
+		case hash.GetHttpCookie() != nil:
+			cookie := hash.GetHttpCookie()
+			be.SessionAffinity = "HTTP_COOKIE"
+			be.ConsistentHash.HttpCookie = &composite.ConsistentHashLoadBalancerSettingsHttpCookie{
+				Name: cookie.Name,
+				Path: cookie.Path,
+				Ttl:  stdDuration(cookie.Ttl),
+			}
+		case hash.GetUseSourceIp():
+			be.SessionAffinity = "CLIENT_IP"
+		}
+	} else if policy.LoadBalancer != nil {
+		be.LocalityLbPolicy = localityLbPolicies[policy.LoadBalancer.GetSimple()]
+	}
+
+	be.CircuitBreakers = nil
+	if pool := policy.ConnectionPool; pool != nil {
+		be.CircuitBreakers = &composite.CircuitBreakers{
+			MaxConnections:           int64(pool.GetTcp().GetMaxConnections()),
+			ConnectTimeout:           duration(pool.GetTcp().GetConnectTimeout()),
+			MaxPendingRequests:       int64(pool.GetHttp().GetHttp1MaxPendingRequests()),
+			MaxRequests:              int64(pool.GetHttp().GetHttp2MaxRequests()),
+			MaxRequestsPerConnection: int64(pool.GetHttp().GetMaxRequestsPerConnection()),
+			MaxRetries:               int64(pool.GetHttp().GetMaxRetries()),
+		}
+	}
+
+	be.OutlierDetection = nil
+	if od := policy.OutlierDetection; od != nil {
+		be.OutlierDetection = &composite.OutlierDetection{
+			// Istio counts 502, 503 and 504 responses as consecutive errors, which are
+			// consecutive gateway failures for GCE. Ejections on gateway failures are not
+			// enforced by default, and ejections on any 5xx response are, so both are set.
+			ConsecutiveGatewayFailure:          int64(od.ConsecutiveErrors),
+			EnforcingConsecutiveGatewayFailure: 100,
+			EnforcingConsecutiveErrors:         0,
+			Interval:                           duration(od.Interval),
+			BaseEjectionTime:                   duration(od.BaseEjectionTime),
+			MaxEjectionPercent:                 int64(od.MaxEjectionPercent),
+			ForceSendFields:                    []string{"EnforcingConsecutiveErrors"},
+		}
+	}
+}
+
+// outlierDetectionEqual returns true if both outlier detection settings are equal,
+// regardless of the fields forced to be sent, which are not set on fetched resources.
+func outlierDetectionEqual(a, b *composite.OutlierDetection) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	aCopy, bCopy := *a, *b
+	aCopy.ForceSendFields, bCopy.ForceSendFields = nil, nil
+	return reflect.DeepEqual(aCopy, bCopy)
+}
+
+func duration(d *gogotypes.Duration) *composite.Duration {
+	if d == nil {
+		return nil
+	}
+	return &composite.Duration{Seconds: d.Seconds, Nanos: int64(d.Nanos)}
+}
+
+func stdDuration(d *time.Duration) *composite.Duration {
+	if d == nil {
+		return nil
+	}
+	return &composite.Duration{Seconds: int64(*d / time.Second), Nanos: int64(*d % time.Second)}
+}
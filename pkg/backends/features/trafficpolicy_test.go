@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package features
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gogotypes "github.com/gogo/protobuf/types"
+	istioV1alpha3 "istio.io/api/networking/v1alpha3"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/utils"
+)
+
+func TestEnsureTrafficPolicy(t *testing.T) {
+	cookieTTL := 90 * time.Second
+	connectionPool := &istioV1alpha3.ConnectionPoolSettings{
+		Tcp: &istioV1alpha3.ConnectionPoolSettings_TCPSettings{
+			MaxConnections: 100,
+			ConnectTimeout: &gogotypes.Duration{Seconds: 1, Nanos: 500},
+		},
+		Http: &istioV1alpha3.ConnectionPoolSettings_HTTPSettings{
+			Http1MaxPendingRequests:  10,
+			Http2MaxRequests:         1000,
+			MaxRequestsPerConnection: 5,
+			MaxRetries:               3,
+		},
+	}
+	outlierDetection := &istioV1alpha3.OutlierDetection{
+		ConsecutiveErrors:  7,
+		Interval:           &gogotypes.Duration{Seconds: 300},
+		BaseEjectionTime:   &gogotypes.Duration{Seconds: 900},
+		MaxEjectionPercent: 50,
+	}
+	circuitBreakers := &composite.CircuitBreakers{
+		MaxConnections:           100,
+		ConnectTimeout:           &composite.Duration{Seconds: 1, Nanos: 500},
+		MaxPendingRequests:       10,
+		MaxRequests:              1000,
+		MaxRequestsPerConnection: 5,
+		MaxRetries:               3,
+	}
+	compositeOutlierDetection := &composite.OutlierDetection{
+		ConsecutiveGatewayFailure:          7,
+		EnforcingConsecutiveGatewayFailure: 100,
+		EnforcingConsecutiveErrors:         0,
+		Interval:                           &composite.Duration{Seconds: 300},
+		BaseEjectionTime:                   &composite.Duration{Seconds: 900},
+		MaxEjectionPercent:                 50,
+		ForceSendFields:                    []string{"EnforcingConsecutiveErrors"},
+	}
+	// fetchedOutlierDetection is compositeOutlierDetection as fetched from GCE.
+	fetchedOutlierDetection := *compositeOutlierDetection
+	fetchedOutlierDetection.ForceSendFields = nil
+
+	testCases := []struct {
+		desc           string
+		sp             utils.ServicePort
+		be             *composite.BackendService
+		updateExpected bool
+		expectBe       *composite.BackendService
+	}{
+		{
+			desc:           "no traffic policy, no update needed",
+			sp:             utils.ServicePort{L7ILBEnabled: true},
+			be:             &composite.BackendService{LocalityLbPolicy: "RANDOM"},
+			updateExpected: false,
+			expectBe:       &composite.BackendService{LocalityLbPolicy: "RANDOM"},
+		},
+		{
+			desc: "traffic policy of a non L7-ILB backend service, no update needed",
+			sp: utils.ServicePort{
+				TrafficPolicy: &istioV1alpha3.TrafficPolicy{
+					LoadBalancer: &istioV1alpha3.LoadBalancerSettings{
+						LbPolicy: &istioV1alpha3.LoadBalancerSettings_Simple{Simple: istioV1alpha3.LoadBalancerSettings_LEAST_CONN},
+					},
+				},
+			},
+			be:             &composite.BackendService{},
+			updateExpected: false,
+			expectBe:       &composite.BackendService{},
+		},
+		{
+			desc: "simple load balancer differing, update needed",
+			sp: utils.ServicePort{
+				L7ILBEnabled: true,
+				TrafficPolicy: &istioV1alpha3.TrafficPolicy{
+					LoadBalancer: &istioV1alpha3.LoadBalancerSettings{
+						LbPolicy: &istioV1alpha3.LoadBalancerSettings_Simple{Simple: istioV1alpha3.LoadBalancerSettings_LEAST_CONN},
+					},
+				},
+			},
+			be:             &composite.BackendService{LocalityLbPolicy: "ROUND_ROBIN", SessionAffinity: "NONE"},
+			updateExpected: true,
+			expectBe:       &composite.BackendService{LocalityLbPolicy: "LEAST_REQUEST", SessionAffinity: "NONE"},
+		},
+		{
+			desc: "consistent hash on a cookie, update needed",
+			sp: utils.ServicePort{
+				L7ILBEnabled: true,
+				TrafficPolicy: &istioV1alpha3.TrafficPolicy{
+					LoadBalancer: &istioV1alpha3.LoadBalancerSettings{
+						LbPolicy: &istioV1alpha3.LoadBalancerSettings_ConsistentHash{
+							ConsistentHash: &istioV1alpha3.LoadBalancerSettings_ConsistentHashLB{
+								HashKey: &istioV1alpha3.LoadBalancerSettings_ConsistentHashLB_HttpCookie{
+									HttpCookie: &istioV1alpha3.LoadBalancerSettings_ConsistentHashLB_HTTPCookie{Name: "user", Path: "/", Ttl: &cookieTTL},
+								},
+								MinimumRingSize: 1024,
+							},
+						},
+					},
+				},
+			},
+			be:             &composite.BackendService{SessionAffinity: "NONE"},
+			updateExpected: true,
+			expectBe: &composite.BackendService{
+				LocalityLbPolicy: "RING_HASH",
+				SessionAffinity:  "HTTP_COOKIE",
+				ConsistentHash: &composite.ConsistentHashLoadBalancerSettings{
+					HttpCookie:      &composite.ConsistentHashLoadBalancerSettingsHttpCookie{Name: "user", Path: "/", Ttl: &composite.Duration{Seconds: 90}},
+					MinimumRingSize: 1024,
+				},
+			},
+		},
+		{
+			desc: "consistent hash on a header, update needed",
+			sp: utils.ServicePort{
+				L7ILBEnabled: true,
+				TrafficPolicy: &istioV1alpha3.TrafficPolicy{
+					LoadBalancer: &istioV1alpha3.LoadBalancerSettings{
+						LbPolicy: &istioV1alpha3.LoadBalancerSettings_ConsistentHash{
+							ConsistentHash: &istioV1alpha3.LoadBalancerSettings_ConsistentHashLB{
+								HashKey: &istioV1alpha3.LoadBalancerSettings_ConsistentHashLB_HttpHeaderName{HttpHeaderName: "x-user"},
+							},
+						},
+					},
+				},
+			},
+			be:             &composite.BackendService{},
+			updateExpected: true,
+			expectBe: &composite.BackendService{
+				LocalityLbPolicy: "RING_HASH",
+				SessionAffinity:  "HEADER_FIELD",
+				ConsistentHash:   &composite.ConsistentHashLoadBalancerSettings{HttpHeaderName: "x-user"},
+			},
+		},
+		{
+			desc: "connection pool and outlier detection, update needed",
+			sp: utils.ServicePort{
+				L7ILBEnabled: true,
+				TrafficPolicy: &istioV1alpha3.TrafficPolicy{
+					ConnectionPool:   connectionPool,
+					OutlierDetection: outlierDetection,
+				},
+			},
+			be:             &composite.BackendService{LocalityLbPolicy: "RANDOM"},
+			updateExpected: true,
+			expectBe: &composite.BackendService{
+				CircuitBreakers:  circuitBreakers,
+				OutlierDetection: compositeOutlierDetection,
+			},
+		},
+		{
+			desc: "traffic policy settings identical, no update needed",
+			sp: utils.ServicePort{
+				L7ILBEnabled: true,
+				TrafficPolicy: &istioV1alpha3.TrafficPolicy{
+					ConnectionPool:   connectionPool,
+					OutlierDetection: outlierDetection,
+				},
+			},
+			be: &composite.BackendService{
+				SessionAffinity:  "CLIENT_IP",
+				CircuitBreakers:  circuitBreakers,
+				OutlierDetection: &fetchedOutlierDetection,
+			},
+			updateExpected: false,
+			expectBe: &composite.BackendService{
+				SessionAffinity:  "CLIENT_IP",
+				CircuitBreakers:  circuitBreakers,
+				OutlierDetection: &fetchedOutlierDetection,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result := EnsureTrafficPolicy(tc.sp, tc.be)
+			if result != tc.updateExpected {
+				t.Errorf("%v: expected %v but got %v", tc.desc, tc.updateExpected, result)
+			}
+			if !reflect.DeepEqual(tc.be, tc.expectBe) {
+				t.Errorf("%v: expected backend service %+v but got %+v", tc.desc, tc.expectBe, tc.be)
+			}
+			if od := tc.be.OutlierDetection; od != nil {
+				// Ejections on gateway failures must be enforced, and ejections on any 5xx response must not.
+				if od.EnforcingConsecutiveGatewayFailure != 100 {
+					t.Errorf("%v: expected EnforcingConsecutiveGatewayFailure 100 but got %d", tc.desc, od.EnforcingConsecutiveGatewayFailure)
+				}
+				if od.EnforcingConsecutiveErrors != 0 {
+					t.Errorf("%v: expected EnforcingConsecutiveErrors 0 but got %d", tc.desc, od.EnforcingConsecutiveErrors)
+				}
+				if tc.updateExpected && !reflect.DeepEqual(od.ForceSendFields, []string{"EnforcingConsecutiveErrors"}) {
+					t.Errorf("%v: expected EnforcingConsecutiveErrors to be sent but got ForceSendFields %v", tc.desc, od.ForceSendFields)
+				}
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	compute "google.golang.org/api/compute/v1"
 	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
@@ -57,6 +58,14 @@ type Syncer interface {
 	Sync(svcPorts []utils.ServicePort) error
 	// GC garbage collects unused BackendService's
 	GC(svcPorts []utils.ServicePort) error
+	// DeleteUnused deletes the named BackendService's in the given scope
+	// which are not used by svcPorts. Unlike GC, it does not list all
+	// BackendService's.
+	DeleteUnused(names []string, version meta.Version, scope meta.KeyType, svcPorts []utils.ServicePort) error
+	// Audit returns the differences between the BackendService's and
+	// health checks of svcPorts and those in GCE, as well as the
+	// BackendService's of the cluster which are not used by svcPorts.
+	Audit(svcPorts []utils.ServicePort) ([]drift.Drift, error)
 	// Status returns the status of a BackendService given its name.
 	Status(name string, version meta.Version, scope meta.KeyType) (string, error)
 	// Shutdown cleans up all BackendService's previously synced.
@@ -23,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/backends/features"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/healthchecks"
 	lbfeatures "k8s.io/ingress-gce/pkg/loadbalancers/features"
@@ -122,6 +123,9 @@ func (s *backendSyncer) ensureBackendService(sp utils.ServicePort) error {
 		needUpdate = features.EnsureAffinity(sp, be) || needUpdate
 		needUpdate = features.EnsureCustomRequestHeaders(sp, be) || needUpdate
 	}
+	// DestinationRule traffic policies take precedence over the session affinity of
+	// the BackendConfig.
+	needUpdate = features.EnsureTrafficPolicy(sp, be) || needUpdate
 
 	if needUpdate {
 		if err := s.backendPool.Update(be); err != nil {
@@ -179,6 +183,33 @@ func (s *backendSyncer) GC(svcPorts []utils.ServicePort) error {
 	return nil
 }
 
+// DeleteUnused implements Syncer.
+func (s *backendSyncer) DeleteUnused(names []string, version meta.Version, scope meta.KeyType, svcPorts []utils.ServicePort) error {
+	knownPorts, err := knownPortsFromServicePorts(s.cloud, s.namer, svcPorts)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		key, err := composite.CreateKey(s.cloud, name, scope)
+		if err != nil {
+			return err
+		}
+		if knownPorts.Has(key.String()) {
+			continue
+		}
+
+		klog.V(2).Infof("Deleting unused backendService %s", name)
+		if err := s.backendPool.Delete(name, version, scope); err != nil && !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+			klog.Errorf("backendPool.Delete(%v, %v, %v) = %v", name, version, scope, err)
+			return err
+		}
+		if err := utils.IgnoreHTTPNotFound(s.healthChecker.Delete(name, scope)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // gc deletes the provided backends
 func (s *backendSyncer) gc(backends []*composite.BackendService, knownPorts sets.String) error {
 	for _, be := range backends {
@@ -230,6 +261,132 @@ func knownPortsFromServicePorts(cloud *gce.Cloud, namer *utils.Namer, svcPorts [
 	return knownPorts, nil
 }
 
+// Audit implements Syncer.
+func (s *backendSyncer) Audit(svcPorts []utils.ServicePort) ([]drift.Drift, error) {
+	var drifts []drift.Drift
+	audited := sets.NewString()
+	for _, sp := range svcPorts {
+		beName := sp.BackendName(s.namer)
+		if audited.Has(beName) {
+			continue
+		}
+		audited.Insert(beName)
+		beDrifts, err := s.auditBackendService(sp)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, beDrifts...)
+	}
+
+	orphans, err := s.auditOrphans(svcPorts)
+	if err != nil {
+		return nil, err
+	}
+	return append(drifts, orphans...), nil
+}
+
+// auditBackendService compares the BackendService and health check of a
+// port with the ones which ensureBackendService would create.
+func (s *backendSyncer) auditBackendService(sp utils.ServicePort) ([]drift.Drift, error) {
+	var drifts []drift.Drift
+	beName := sp.BackendName(s.namer)
+
+	hc, err := s.newHealthCheck(sp)
+	if err != nil {
+		return nil, err
+	}
+	exists, fields, err := s.healthChecker.Audit(hc)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		drifts = append(drifts, drift.Drift{Kind: drift.KindHealthCheck, Name: hc.Name, Reason: drift.Missing})
+	} else if len(fields) > 0 {
+		drifts = append(drifts, drift.Drift{Kind: drift.KindHealthCheck, Name: hc.Name, Reason: drift.Modified, Fields: fields})
+	}
+
+	be, err := s.backendPool.Get(beName, features.VersionFromServicePort(&sp), features.ScopeFromServicePort(&sp))
+	if err != nil {
+		if utils.IsNotFoundError(err) {
+			return append(drifts, drift.Drift{Kind: drift.KindBackendService, Name: beName, Reason: drift.Missing}), nil
+		}
+		return nil, err
+	}
+
+	// The ensure functions only modify be, which is discarded.
+	fields = nil
+	if ensureProtocol(be, sp) {
+		fields = append(fields, "protocol")
+	}
+	if hcName, err := utils.KeyName(getHealthCheckLink(be)); err != nil || hcName != hc.Name {
+		fields = append(fields, "healthChecks")
+	}
+	if ensureDescription(be, &sp) {
+		fields = append(fields, "description")
+	}
+	if sp.BackendConfig != nil {
+		if features.EnsureCDN(sp, be) {
+			fields = append(fields, "cdnPolicy")
+		}
+		if features.EnsureIAP(sp, be) {
+			fields = append(fields, "iap")
+		}
+		if features.EnsureTimeout(sp, be) {
+			fields = append(fields, "timeoutSec")
+		}
+		if features.EnsureDraining(sp, be) {
+			fields = append(fields, "connectionDraining")
+		}
+		if features.EnsureAffinity(sp, be) {
+			fields = append(fields, "sessionAffinity")
+		}
+		if features.EnsureCustomRequestHeaders(sp, be) {
+			fields = append(fields, "customRequestHeaders")
+		}
+	}
+	if features.EnsureTrafficPolicy(sp, be) {
+		fields = append(fields, "trafficPolicy")
+	}
+	if len(fields) > 0 {
+		drifts = append(drifts, drift.Drift{Kind: drift.KindBackendService, Name: beName, Reason: drift.Modified, Fields: fields})
+	}
+	return drifts, nil
+}
+
+// auditOrphans returns the BackendService's of the cluster which are not
+// used by svcPorts.
+func (s *backendSyncer) auditOrphans(svcPorts []utils.ServicePort) ([]drift.Drift, error) {
+	knownPorts, err := knownPortsFromServicePorts(s.cloud, s.namer, svcPorts)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := map[meta.KeyType]meta.Version{meta.Global: meta.VersionGA}
+	if flags.F.EnableL7Ilb {
+		scopes[meta.Regional] = lbfeatures.L7ILBVersions().BackendService
+	}
+	var drifts []drift.Drift
+	for scope, version := range scopes {
+		key, err := composite.CreateKey(s.cloud, "", scope)
+		if err != nil {
+			return nil, err
+		}
+		backends, err := s.backendPool.List(key, version)
+		if err != nil {
+			return nil, fmt.Errorf("error listing backends: %v", err)
+		}
+		for _, be := range backends {
+			if key, err = composite.CreateKey(s.cloud, be.Name, scope); err != nil {
+				return nil, err
+			}
+			if !knownPorts.Has(key.String()) {
+				drifts = append(drifts, drift.Drift{Kind: drift.KindBackendService, Name: be.Name, Reason: drift.Orphaned})
+			}
+		}
+	}
+	return drifts, nil
+}
+
 // Status implements Syncer.
 func (s *backendSyncer) Status(name string, version meta.Version, scope meta.KeyType) (string, error) {
 	return s.backendPool.Health(name, version, scope)
@@ -247,19 +404,27 @@ func (s *backendSyncer) ensureHealthCheck(sp utils.ServicePort, hasLegacyHC bool
 	if hasLegacyHC {
 		klog.Errorf("Backend %+v has legacy health check", sp.ID)
 	}
+	hc, err := s.newHealthCheck(sp)
+	if err != nil {
+		return "", err
+	}
+	return s.healthChecker.Sync(hc)
+}
+
+// newHealthCheck returns the expected health check for the given port.
+func (s *backendSyncer) newHealthCheck(sp utils.ServicePort) (*healthchecks.HealthCheck, error) {
 	hc := s.healthChecker.New(sp)
 	if s.prober != nil {
 		probe, err := s.prober.GetProbe(sp)
 		if err != nil {
-			return "", fmt.Errorf("Error getting prober: %v", err)
+			return nil, fmt.Errorf("Error getting prober: %v", err)
 		}
 		if probe != nil {
 			klog.V(4).Infof("Applying httpGet settings of readinessProbe to health check on port %+v", sp)
 			applyProbeSettingsToHC(probe, hc)
 		}
 	}
-
-	return s.healthChecker.Sync(hc)
+	return hc, nil
 }
 
 // getHealthCheckLink gets the Healthcheck link off the BackendService
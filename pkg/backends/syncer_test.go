@@ -35,6 +35,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/backends/features"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/healthchecks"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -287,6 +288,101 @@ func TestSyncUpdateHTTP2(t *testing.T) {
 	}
 }
 
+func TestDeleteUnused(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	syncer := newTestSyncer(fakeGCE)
+
+	svcNodePorts := []utils.ServicePort{
+		{NodePort: 81, Protocol: annotations.ProtocolHTTP},
+		{NodePort: 82, Protocol: annotations.ProtocolHTTPS},
+		{NodePort: 83, Protocol: annotations.ProtocolHTTP},
+	}
+	ps := newPortset(svcNodePorts)
+	if err := ps.add(svcNodePorts); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syncer.Sync(ps.existingPorts()); err != nil {
+		t.Fatalf("syncer.Sync(%+v) = %v, want nil ", ps.existingPorts(), err)
+	}
+
+	// Port 83 is still in use, the last name does not exist.
+	names := []string{svcNodePorts[1].BackendName(defaultNamer), svcNodePorts[2].BackendName(defaultNamer), "k8s-be-84--uid1"}
+	inUse := []utils.ServicePort{svcNodePorts[2]}
+	if err := syncer.DeleteUnused(names, meta.VersionGA, meta.Global, inUse); err != nil {
+		t.Fatalf("syncer.DeleteUnused(%v, _, _, %+v) = %v, want nil", names, inUse, err)
+	}
+
+	if err := ps.del([]utils.ServicePort{svcNodePorts[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.check(fakeGCE); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	syncer := newTestSyncer(fakeGCE)
+
+	svcNodePorts := []utils.ServicePort{
+		{NodePort: 81, Protocol: annotations.ProtocolHTTP},
+		{NodePort: 82, Protocol: annotations.ProtocolHTTP},
+	}
+	if err := syncer.Sync(svcNodePorts); err != nil {
+		t.Fatalf("syncer.Sync(%+v) = %v, want nil ", svcNodePorts, err)
+	}
+
+	drifts, err := syncer.Audit(svcNodePorts)
+	if err != nil {
+		t.Fatalf("syncer.Audit(%+v) = %v, want nil", svcNodePorts, err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("syncer.Audit(%+v) = %+v, want no drift", svcNodePorts, drifts)
+	}
+
+	// Modify the first backend service and delete the health check of the
+	// second one.
+	beName := svcNodePorts[0].BackendName(defaultNamer)
+	be, err := syncer.backendPool.Get(beName, meta.VersionGA, meta.Global)
+	if err != nil {
+		t.Fatal(err)
+	}
+	be.Protocol = string(annotations.ProtocolHTTPS)
+	if err := syncer.backendPool.Update(be); err != nil {
+		t.Fatal(err)
+	}
+	hcName := svcNodePorts[1].BackendName(defaultNamer)
+	if err := fakeGCE.DeleteHealthCheck(hcName); err != nil {
+		t.Fatal(err)
+	}
+
+	drifts, err = syncer.Audit(svcNodePorts)
+	if err != nil {
+		t.Fatalf("syncer.Audit(%+v) = %v, want nil", svcNodePorts, err)
+	}
+	want := []drift.Drift{
+		{Kind: drift.KindBackendService, Name: beName, Reason: drift.Modified, Fields: []string{"protocol"}},
+		{Kind: drift.KindHealthCheck, Name: hcName, Reason: drift.Missing},
+	}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("syncer.Audit(%+v) = %+v, want %+v", svcNodePorts, drifts, want)
+	}
+
+	// The second backend service is no longer used.
+	drifts, err = syncer.Audit(svcNodePorts[:1])
+	if err != nil {
+		t.Fatalf("syncer.Audit(%+v) = %v, want nil", svcNodePorts[:1], err)
+	}
+	want = []drift.Drift{
+		{Kind: drift.KindBackendService, Name: beName, Reason: drift.Modified, Fields: []string{"protocol"}},
+		{Kind: drift.KindBackendService, Name: svcNodePorts[1].BackendName(defaultNamer), Reason: drift.Orphaned},
+	}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("syncer.Audit(%+v) = %+v, want %+v", svcNodePorts[:1], drifts, want)
+	}
+}
+
 // Test GC with both ELB and ILBs
 func TestGC(t *testing.T) {
 	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
@@ -17,9 +17,13 @@ limitations under the License.
 package metrics
 
 import (
+	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-gce/pkg/ratelimit"
 )
 
 const (
@@ -50,6 +54,8 @@ type metricContext struct {
 	// The cardinalities of attributes and metricLabels (defined above) must
 	// match, or prometheus will panic.
 	attributes []string
+	// key is the rate limit key of the API call.
+	key *cloud.RateLimitKey
 }
 
 // Value for an unused label in the metric dimension.
@@ -63,10 +69,11 @@ func (mc *metricContext) Observe(err error) error {
 		apiMetrics.errors.WithLabelValues(mc.attributes...).Inc()
 	}
 
-	return err
+	return ratelimit.Observe(mc.key, err)
 }
 
 func NewMetricContext(prefix, request, region, zone, version string) *metricContext {
+	key := rateLimitKey(prefix, request, region, version)
 	if len(zone) == 0 {
 		zone = unusedMetricLabel
 	}
@@ -76,6 +83,49 @@ func NewMetricContext(prefix, request, region, zone, version string) *metricCont
 	return &metricContext{
 		start:      time.Now(),
 		attributes: []string{prefix + "_" + request, region, zone, version},
+		key:        key,
+	}
+}
+
+// rateLimitOperations maps the requests of the composite API to the
+// operations of the rate limit keys. Requests which are not listed are
+// normalized like the keys of the rate limiter.
+var rateLimitOperations = map[string]string{
+	"create":              "Insert",
+	"get":                 "Get",
+	"update":              "Update",
+	"delete":              "Delete",
+	"list":                "List",
+	"set_url_map":         "SetUrlMap",
+	"set_ssl_certificate": "SetSslCertificates",
+	"set_proxy":           "SetTarget",
+}
+
+// rateLimitKey returns the rate limit key of the GCE API call made by a
+// composite request, e.g. "ga.RegionUrlMaps.Get" for a regional get of an
+// UrlMap.
+func rateLimitKey(prefix, request, region, version string) *cloud.RateLimitKey {
+	service := prefix
+	if strings.HasSuffix(service, "y") {
+		service = strings.TrimSuffix(service, "y") + "ies"
+	} else {
+		service += "s"
+	}
+	switch {
+	case prefix == "ForwardingRule" && region == "":
+		service = "GlobalForwardingRules"
+	case prefix == "ForwardingRule":
+	case region != "":
+		service = "Region" + service
+	}
+	operation, ok := rateLimitOperations[request]
+	if !ok {
+		operation = ratelimit.NormalizeOperation(request)
+	}
+	return &cloud.RateLimitKey{
+		Operation: operation,
+		Version:   meta.Version(version),
+		Service:   service,
 	}
 }
 
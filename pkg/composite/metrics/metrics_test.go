@@ -17,7 +17,10 @@ limitations under the License.
 package metrics
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 )
 
 func TestVerifyMetricLabelCardinality(t *testing.T) {
@@ -26,3 +29,24 @@ func TestVerifyMetricLabelCardinality(t *testing.T) {
 		t.Fatalf("cardinalities of labels and values must match")
 	}
 }
+
+func TestRateLimitKey(t *testing.T) {
+	for _, tc := range []struct {
+		prefix, request, region, version string
+		want                             cloud.RateLimitKey
+	}{
+		{"UrlMap", "get", "", "ga", cloud.RateLimitKey{Operation: "Get", Version: "ga", Service: "UrlMaps"}},
+		{"UrlMap", "update", "us-central1", "beta", cloud.RateLimitKey{Operation: "Update", Version: "beta", Service: "RegionUrlMaps"}},
+		{"TargetHttpProxy", "create", "", "ga", cloud.RateLimitKey{Operation: "Insert", Version: "ga", Service: "TargetHttpProxies"}},
+		{"ForwardingRule", "delete", "", "ga", cloud.RateLimitKey{Operation: "Delete", Version: "ga", Service: "GlobalForwardingRules"}},
+		{"ForwardingRule", "get", "us-central1", "alpha", cloud.RateLimitKey{Operation: "Get", Version: "alpha", Service: "ForwardingRules"}},
+		{"TargetHttpProxy", "set_url_map", "", "ga", cloud.RateLimitKey{Operation: "SetUrlMap", Version: "ga", Service: "TargetHttpProxies"}},
+		{"TargetHttpsProxy", "set_ssl_certificate", "", "ga", cloud.RateLimitKey{Operation: "SetSslCertificates", Version: "ga", Service: "TargetHttpsProxies"}},
+		{"ForwardingRule", "set_proxy", "", "ga", cloud.RateLimitKey{Operation: "SetTarget", Version: "ga", Service: "GlobalForwardingRules"}},
+		{"UrlMap", "invalidateCache", "", "ga", cloud.RateLimitKey{Operation: "InvalidateCache", Version: "ga", Service: "UrlMaps"}},
+	} {
+		if got := rateLimitKey(tc.prefix, tc.request, tc.region, tc.version); !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("rateLimitKey(%q, %q, %q, %q) = %+v, want %+v", tc.prefix, tc.request, tc.region, tc.version, *got, tc.want)
+		}
+	}
+}
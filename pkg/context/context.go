@@ -18,7 +18,6 @@ import (
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	informerv1 "k8s.io/client-go/informers/core/v1"
@@ -31,8 +30,12 @@ import (
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned"
 	informerbackendconfig "k8s.io/ingress-gce/pkg/backendconfig/client/informers/externalversions/backendconfig/v1beta1"
 	"k8s.io/ingress-gce/pkg/common/typed"
+	"k8s.io/ingress-gce/pkg/destinationrule"
 	frontendconfigclient "k8s.io/ingress-gce/pkg/frontendconfig/client/clientset/versioned"
 	informerfrontendconfig "k8s.io/ingress-gce/pkg/frontendconfig/client/informers/externalversions/frontendconfig/v1beta1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	svcnegclient "k8s.io/ingress-gce/pkg/svcneg/client/clientset/versioned"
+	informersvcneg "k8s.io/ingress-gce/pkg/svcneg/client/informers/externalversions/svcneg/v1beta1"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -62,6 +65,14 @@ type ControllerContext struct {
 	NodeInformer            cache.SharedIndexInformer
 	EndpointInformer        cache.SharedIndexInformer
 	DestinationRuleInformer cache.SharedIndexInformer
+	// EndpointSliceInformer is set if EndpointSlices are enabled.
+	EndpointSliceInformer cache.SharedIndexInformer
+	// SvcNegClient and SvcNegInformer are set if ServiceNetworkEndpointGroups are enabled.
+	SvcNegClient   svcnegclient.Interface
+	SvcNegInformer cache.SharedIndexInformer
+
+	// ZoneCache caches the zone of the nodes in NodeInformer.
+	ZoneCache *utils.ZoneCache
 
 	healthChecks map[string]func() error
 
@@ -81,6 +92,7 @@ type ControllerContextConfig struct {
 	DefaultBackendHealthCheckPath string
 	FrontendConfigEnabled         bool
 	EnableCSM                     bool
+	EnableEndpointSlices          bool
 }
 
 // NewControllerContext returns a new shared set of informers.
@@ -89,6 +101,7 @@ func NewControllerContext(
 	dynamicClient dynamic.Interface,
 	backendConfigClient backendconfigclient.Interface,
 	frontendConfigClient frontendconfigclient.Interface,
+	svcNegClient svcnegclient.Interface,
 	cloud *gce.Cloud,
 	namer *utils.Namer,
 	config ControllerContextConfig) *ControllerContext {
@@ -104,13 +117,26 @@ func NewControllerContext(
 		EndpointInformer:        informerv1.NewEndpointsInformer(kubeClient, config.Namespace, config.ResyncPeriod, utils.NewNamespaceIndexer()),
 		PodInformer:             informerv1.NewPodInformer(kubeClient, config.Namespace, config.ResyncPeriod, utils.NewNamespaceIndexer()),
 		NodeInformer:            informerv1.NewNodeInformer(kubeClient, config.ResyncPeriod, utils.NewNamespaceIndexer()),
+		ZoneCache:               utils.NewZoneCache(),
 		recorders:               map[string]record.EventRecorder{},
 		healthChecks:            make(map[string]func() error),
 	}
 
+	context.NodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, cur interface{}) {
+			context.ZoneCache.ForgetIfChanged(old.(*apiv1.Node), cur.(*apiv1.Node))
+		},
+		DeleteFunc: func(obj interface{}) {
+			// Nodes are cluster scoped, so their key is their name.
+			if name, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+				context.ZoneCache.Forget(name)
+			}
+		},
+	})
+
 	if config.EnableCSM && dynamicClient != nil {
-		klog.Warning("The DestinationRule group version is v1alpha3 in group networking.istio.io. Need to update as istio API graduates.")
-		destrinationGVR := schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1alpha3", Resource: "destinationrules"}
+		destrinationGVR := destinationrule.GroupVersionResource(kubeClient.Discovery())
+		klog.Infof("Using DestinationRule group version %s", destrinationGVR.GroupVersion())
 		drDynamicInformer := dynamicinformer.NewFilteredDynamicInformer(dynamicClient, destrinationGVR, config.Namespace, config.ResyncPeriod,
 			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
 			nil)
@@ -118,10 +144,25 @@ func NewControllerContext(
 		context.DestinationRuleClient = dynamicClient.Resource(destrinationGVR)
 	}
 
+	if config.EnableEndpointSlices && dynamicClient != nil {
+		endpointSliceInformer := dynamicinformer.NewFilteredDynamicInformer(dynamicClient, negtypes.EndpointSliceGVR, config.Namespace, config.ResyncPeriod,
+			cache.Indexers{
+				cache.NamespaceIndex:                 cache.MetaNamespaceIndexFunc,
+				negtypes.EndpointSliceByServiceIndex: negtypes.EndpointSliceByServiceIndexFunc,
+			},
+			nil)
+		context.EndpointSliceInformer = endpointSliceInformer.Informer()
+	}
+
 	if config.FrontendConfigEnabled {
 		context.FrontendConfigInformer = informerfrontendconfig.NewFrontendConfigInformer(frontendConfigClient, config.Namespace, config.ResyncPeriod, utils.NewNamespaceIndexer())
 	}
 
+	if svcNegClient != nil {
+		context.SvcNegClient = svcNegClient
+		context.SvcNegInformer = informersvcneg.NewServiceNetworkEndpointGroupInformer(svcNegClient, config.Namespace, config.ResyncPeriod, utils.NewNamespaceIndexer())
+	}
+
 	return context
 }
 
@@ -144,6 +185,14 @@ func (ctx *ControllerContext) HasSynced() bool {
 		funcs = append(funcs, ctx.DestinationRuleInformer.HasSynced)
 	}
 
+	if ctx.SvcNegInformer != nil {
+		funcs = append(funcs, ctx.SvcNegInformer.HasSynced)
+	}
+
+	if ctx.EndpointSliceInformer != nil {
+		funcs = append(funcs, ctx.EndpointSliceInformer.HasSynced)
+	}
+
 	for _, f := range funcs {
 		if !f() {
 			return false
@@ -211,6 +260,12 @@ func (ctx *ControllerContext) Start(stopCh chan struct{}) {
 	if ctx.DestinationRuleInformer != nil {
 		go ctx.DestinationRuleInformer.Run(stopCh)
 	}
+	if ctx.EndpointSliceInformer != nil {
+		go ctx.EndpointSliceInformer.Run(stopCh)
+	}
+	if ctx.SvcNegInformer != nil {
+		go ctx.SvcNegInformer.Run(stopCh)
+	}
 }
 
 // Ingresses returns the store of Ingresses.
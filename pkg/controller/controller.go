@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -28,6 +29,8 @@ import (
 	"k8s.io/api/networking/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	unversionedcore "k8s.io/client-go/kubernetes/typed/core/v1"
 	listers "k8s.io/client-go/listers/core/v1"
@@ -40,12 +43,16 @@ import (
 	"k8s.io/ingress-gce/pkg/common/operator"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/controller/translator"
+	"k8s.io/ingress-gce/pkg/destinationrule"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/frontendconfig"
 	"k8s.io/ingress-gce/pkg/healthchecks"
 	"k8s.io/ingress-gce/pkg/instances"
 	"k8s.io/ingress-gce/pkg/loadbalancers"
+	lbfeatures "k8s.io/ingress-gce/pkg/loadbalancers/features"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/storage"
 	ingsync "k8s.io/ingress-gce/pkg/sync"
 	"k8s.io/ingress-gce/pkg/tls"
 	"k8s.io/ingress-gce/pkg/utils"
@@ -87,6 +94,8 @@ type LoadBalancerController struct {
 
 	// Ingress sync + GC implementation
 	ingSyncer ingsync.Syncer
+	// gcLock serializes garbage collection across the Ingress sync workers.
+	gcLock sync.Mutex
 }
 
 // NewLoadBalancerController creates a controller for gce loadbalancers.
@@ -103,6 +112,8 @@ func NewLoadBalancerController(
 	healthChecker := healthchecks.NewHealthChecker(ctx.Cloud, ctx.HealthCheckPath, ctx.DefaultBackendHealthCheckPath, ctx.ClusterNamer, ctx.DefaultBackendSvcPort.ID.Service)
 	instancePool := instances.NewNodePool(ctx.Cloud, ctx.ClusterNamer)
 	backendPool := backends.NewPool(ctx.Cloud, ctx.ClusterNamer)
+	addresses := storage.NewConfigMapVault(ctx.KubeClient, metav1.NamespaceSystem, loadbalancers.StaticIPConfigMapName)
+	adoptions := storage.NewConfigMapVault(ctx.KubeClient, metav1.NamespaceSystem, loadbalancers.AdoptionConfigMapName)
 
 	lbc := LoadBalancerController{
 		ctx:           ctx,
@@ -113,14 +124,14 @@ func NewLoadBalancerController(
 		hasSynced:     ctx.HasSynced,
 		nodes:         NewNodeController(ctx, instancePool),
 		instancePool:  instancePool,
-		l7Pool:        loadbalancers.NewLoadBalancerPool(ctx.Cloud, ctx.ClusterNamer, ctx),
+		l7Pool:        loadbalancers.NewLoadBalancerPool(ctx.Cloud, ctx.ClusterNamer, ctx, addresses, adoptions),
 		backendSyncer: backends.NewBackendSyncer(backendPool, healthChecker, ctx.ClusterNamer, ctx.Cloud),
 		negLinker:     backends.NewNEGLinker(backendPool, negtypes.NewAdapter(ctx.Cloud), ctx.ClusterNamer, ctx.Cloud),
 		igLinker:      backends.NewInstanceGroupLinker(instancePool, backendPool, ctx.ClusterNamer),
 	}
 	lbc.ingSyncer = ingsync.NewIngressSyncer(&lbc)
 
-	lbc.ingQueue = utils.NewPeriodicTaskQueue("ingress", "ingresses", lbc.sync)
+	lbc.ingQueue = utils.NewPeriodicTaskQueueWithMultipleWorkers("ingress", "ingresses", flags.F.NumIngressWorkers, lbc.sync)
 
 	// Ingress event handlers.
 	ctx.IngressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -239,6 +250,19 @@ func NewLoadBalancerController(
 		})
 	}
 
+	// DestinationRule event handlers.
+	if ctx.DestinationRuleInformer != nil {
+		ctx.DestinationRuleInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: lbc.enqueueIngressesForDestinationRule,
+			UpdateFunc: func(old, cur interface{}) {
+				if !reflect.DeepEqual(old, cur) {
+					lbc.enqueueIngressesForDestinationRule(cur)
+				}
+			},
+			DeleteFunc: lbc.enqueueIngressesForDestinationRule,
+		})
+	}
+
 	// Register health check on controller context.
 	ctx.AddHealthCheck("ingress", func() error {
 		_, err := backendPool.Get("foo", meta.VersionGA, meta.Global)
@@ -258,6 +282,27 @@ func NewLoadBalancerController(
 	return &lbc
 }
 
+// enqueueIngressesForDestinationRule enqueues the Ingresses that reference the
+// service of the Istio DestinationRule obj.
+func (lbc *LoadBalancerController) enqueueIngressesForDestinationRule(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	drus, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		klog.Errorf("Failed to convert informer object to Unstructured object")
+		return
+	}
+	_, svc, err := destinationrule.FromUnstructured(drus)
+	if err != nil {
+		klog.Errorf("Failed to convert informer object to DestinationRule: %v", err)
+		return
+	}
+	svcObj := &apiv1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: svc.Namespace, Name: svc.Name}}
+	ings := operator.Ingresses(lbc.ctx.Ingresses().List()).ReferencesService(svcObj).AsList()
+	lbc.ingQueue.Enqueue(convert(ings)...)
+}
+
 func (lbc *LoadBalancerController) Init() {
 	// TODO(rramkumar): Try to get rid of this "Init".
 	lbc.instancePool.Init(lbc.Translator)
@@ -269,6 +314,17 @@ func (lbc *LoadBalancerController) Run() {
 	klog.Infof("Starting loadbalancer controller")
 	go lbc.ingQueue.Run()
 	go lbc.nodes.Run()
+	go func() {
+		// Syncs only garbage collect the resources of their own Ingress.
+		// Wait for gcPeriod so that all Ingresses are synced before
+		// sweeping resources which are not owned by any Ingress.
+		select {
+		case <-time.After(flags.F.GCPeriod):
+		case <-lbc.stopCh:
+			return
+		}
+		wait.Until(lbc.gc, flags.F.GCPeriod, lbc.stopCh)
+	}()
 
 	<-lbc.stopCh
 	klog.Infof("Shutting down Loadbalancer Controller")
@@ -361,7 +417,7 @@ func (lbc *LoadBalancerController) SyncBackends(state interface{}) error {
 		var linkErr error
 		if sp.NEGEnabled {
 			// Link backend to NEG's if the backend has NEG enabled.
-			linkErr = lbc.negLinker.Link(sp, groupKeys)
+			linkErr = lbc.negLinker.Link(sp, lbc.negGroupKeys(sp, groupKeys))
 		} else {
 			// Otherwise, link backend to IG's.
 			linkErr = lbc.igLinker.Link(sp, groupKeys)
@@ -374,6 +430,30 @@ func (lbc *LoadBalancerController) SyncBackends(state interface{}) error {
 	return nil
 }
 
+// negGroupKeys returns the NEGs of the service port as reported in the NEG status
+// annotation of its service, as NEGs may have custom names and NON_GCP_PRIVATE_IP_PORT
+// NEGs are in a single zone. If the service port is not in the NEG status, the NEGs are
+// assumed to have the default name and to be in every zone of groupKeys.
+func (lbc *LoadBalancerController) negGroupKeys(sp utils.ServicePort, groupKeys []backends.GroupKey) []backends.GroupKey {
+	svc, exists, err := lbc.ctx.Services().GetByKey(sp.ID.Service.String())
+	if err != nil || !exists {
+		return groupKeys
+	}
+	negStatus, found, err := annotations.FromService(svc).NEGStatus()
+	if err != nil || !found {
+		return groupKeys
+	}
+	negName, ok := negStatus.NetworkEndpointGroups[strconv.Itoa(int(sp.Port))]
+	if !ok || len(negStatus.Zones) == 0 {
+		return groupKeys
+	}
+	var negGroupKeys []backends.GroupKey
+	for _, zone := range negStatus.Zones {
+		negGroupKeys = append(negGroupKeys, backends.GroupKey{Zone: zone, Name: negName})
+	}
+	return negGroupKeys
+}
+
 // GCBackends implements Controller.
 func (lbc *LoadBalancerController) GCBackends(toKeep []*v1beta1.Ingress) error {
 	svcPortsToKeep := lbc.ToSvcPorts(toKeep)
@@ -391,6 +471,28 @@ func (lbc *LoadBalancerController) GCBackends(toKeep []*v1beta1.Ingress) error {
 	return nil
 }
 
+// GCIngressBackends implements Controller.
+func (lbc *LoadBalancerController) GCIngressBackends(ing *v1beta1.Ingress, toKeep []*v1beta1.Ingress) error {
+	// The instance group is only deleted along with the last Ingress, which
+	// is rare enough to afford listing all backends.
+	if len(toKeep) == 0 {
+		return lbc.GCBackends(toKeep)
+	}
+	// The backends of an Ingress which is gone are unknown, they are left
+	// to the periodic garbage collection.
+	if ing == nil {
+		return nil
+	}
+	// Backends used by the last synced version of the Ingress are recorded
+	// in its status.
+	names := backendsInStatus(ing.Annotations)
+	if len(names) == 0 {
+		return nil
+	}
+	version := lbfeatures.VersionsFromIngress(ing).BackendService
+	return lbc.backendSyncer.DeleteUnused(names, version, lbfeatures.ScopeFromIngress(ing), lbc.ToSvcPorts(toKeep))
+}
+
 // SyncLoadBalancer implements Controller.
 func (lbc *LoadBalancerController) SyncLoadBalancer(state interface{}) error {
 	// We expect state to be a syncState
@@ -419,6 +521,16 @@ func (lbc *LoadBalancerController) GCLoadBalancers(toKeep []*v1beta1.Ingress) er
 	return lbc.l7Pool.GC(toLbNames(toKeep))
 }
 
+// GCLoadBalancer implements Controller.
+func (lbc *LoadBalancerController) GCLoadBalancer(key string, ing *v1beta1.Ingress) error {
+	// Skip Ingresses which never had a load balancer, e.g. those of other
+	// classes.
+	if ing != nil && loadbalancers.GCEResourceName(ing.Annotations, "url-map") == "" && !utils.HasFinalizer(ing.ObjectMeta, utils.FinalizerKey) {
+		return nil
+	}
+	return lbc.l7Pool.GCOne(key)
+}
+
 // MaybeRemoveFinalizers cleans up Finalizers if needed.
 func (lbc *LoadBalancerController) MaybeRemoveFinalizers(toCleanup []*v1beta1.Ingress) error {
 	if !flags.F.FinalizerRemove {
@@ -460,12 +572,13 @@ func (lbc *LoadBalancerController) sync(key string) error {
 		return fmt.Errorf("error getting Ingress for key %s: %v", key, err)
 	}
 
-	// Snapshot of list of ingresses.
-	allIngresses := lbc.ctx.Ingresses().List()
 	// Determine if the ingress needs to be GCed.
 	if !ingExists || utils.NeedsCleanup(ing) {
+		if !ingExists {
+			ing = nil
+		}
 		// GC will find GCE resources that were used for this ingress and delete them.
-		return lbc.ingSyncer.GC(allIngresses)
+		return lbc.garbageCollect(key, ing)
 	}
 
 	// Get ingress and DeepCopy for assurance that we don't pollute other goroutines with changes.
@@ -497,13 +610,89 @@ func (lbc *LoadBalancerController) sync(key string) error {
 	// Garbage collection will occur regardless of an error occurring. If an error occurred,
 	// it could have been caused by quota issues; therefore, garbage collecting now may
 	// free up enough quota for the next sync to pass.
-	if gcErr := lbc.ingSyncer.GC(allIngresses); gcErr != nil {
+	if gcErr := lbc.garbageCollect(key, ing); gcErr != nil {
 		return fmt.Errorf("error during sync %v, error during GC %v", syncErr, gcErr)
 	}
 
 	return syncErr
 }
 
+// Audit implements drift.Source. It audits the url maps, backend services
+// and health checks of all Ingresses.
+func (lbc *LoadBalancerController) Audit() ([]drift.Drift, error) {
+	if !lbc.hasSynced() {
+		return nil, fmt.Errorf("waiting for stores to sync")
+	}
+	_, toKeep := operator.Ingresses(lbc.ctx.Ingresses().List()).Partition(utils.NeedsCleanup)
+
+	var ris []*loadbalancers.L7RuntimeInfo
+	var svcPorts []utils.ServicePort
+	// Backends and health checks may be shared by several Ingresses.
+	ingressesByBackend := map[string][]string{}
+	for _, ing := range toKeep.AsList() {
+		// Multi-cluster Ingresses have no load balancer of their own.
+		if !utils.IsGCEIngress(ing) {
+			continue
+		}
+		// Invalid Ingresses are reported by sync.
+		urlMap, errs := lbc.Translator.TranslateIngress(ing, lbc.ctx.DefaultBackendSvcPort.ID)
+		if errs != nil {
+			continue
+		}
+		key := utils.IngressKeyFunc(ing)
+		ris = append(ris, &loadbalancers.L7RuntimeInfo{Name: key, UrlMap: urlMap, Ingress: ing})
+		for _, sp := range uniq(urlMap.AllServicePorts()) {
+			beName := sp.BackendName(lbc.ctx.ClusterNamer)
+			ingressesByBackend[beName] = append(ingressesByBackend[beName], key)
+			svcPorts = append(svcPorts, sp)
+		}
+	}
+
+	drifts, err := lbc.l7Pool.Audit(ris)
+	if err != nil {
+		return nil, err
+	}
+	beDrifts, err := lbc.backendSyncer.Audit(svcPorts)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range beDrifts {
+		keys := ingressesByBackend[d.Name]
+		if len(keys) == 0 {
+			drifts = append(drifts, d)
+			continue
+		}
+		for _, key := range keys {
+			d.Ingress = key
+			drifts = append(drifts, d)
+		}
+	}
+	return drifts, nil
+}
+
+// garbageCollect runs GC for the Ingress with the given key against a
+// snapshot of all Ingresses. The snapshot is taken under gcLock so that it
+// includes any Ingress which another worker may be syncing, whose resources
+// would otherwise be considered unused.
+func (lbc *LoadBalancerController) garbageCollect(key string, ing *v1beta1.Ingress) error {
+	lbc.gcLock.Lock()
+	defer lbc.gcLock.Unlock()
+	return lbc.ingSyncer.GCIngress(key, ing, lbc.ctx.Ingresses().List())
+}
+
+// gc garbage collects the resources of all Ingresses, including those left
+// behind by Ingresses which were deleted without a finalizer.
+func (lbc *LoadBalancerController) gc() {
+	if !lbc.hasSynced() {
+		return
+	}
+	lbc.gcLock.Lock()
+	defer lbc.gcLock.Unlock()
+	if err := lbc.ingSyncer.GC(lbc.ctx.Ingresses().List()); err != nil {
+		klog.Errorf("Error during garbage collection: %v", err)
+	}
+}
+
 // updateIngressStatus updates the IP and annotations of a loadbalancer.
 // The annotations are parsed by kubectl describe.
 func (lbc *LoadBalancerController) updateIngressStatus(l7 *loadbalancers.L7, ing *v1beta1.Ingress) error {
@@ -515,23 +704,28 @@ func (lbc *LoadBalancerController) updateIngressStatus(l7 *loadbalancers.L7, ing
 	if err != nil {
 		return err
 	}
+	lbIngress := []apiv1.LoadBalancerIngress{{IP: ip}}
+	// Dual-stack load balancers report the IPv6 address after the IPv4 one.
+	if ipv6 := l7.GetIPv6(); ipv6 != "" {
+		lbIngress = append(lbIngress, apiv1.LoadBalancerIngress{IP: ipv6})
+	}
 	currIng.Status = v1beta1.IngressStatus{
 		LoadBalancer: apiv1.LoadBalancerStatus{
-			Ingress: []apiv1.LoadBalancerIngress{
-				{IP: ip},
-			},
+			Ingress: lbIngress,
 		},
 	}
 	if ip != "" {
 		lbIPs := ing.Status.LoadBalancer.Ingress
-		if len(lbIPs) == 0 || lbIPs[0].IP != ip {
+		if !reflect.DeepEqual(lbIPs, lbIngress) {
 			// TODO: If this update fails it's probably resource version related,
 			// which means it's advantageous to retry right away vs requeuing.
-			klog.Infof("Updating loadbalancer %v/%v with IP %v", ing.Namespace, ing.Name, ip)
+			klog.Infof("Updating loadbalancer %v/%v with IP %v", ing.Namespace, ing.Name, lbIngress)
 			if _, err := ingClient.UpdateStatus(currIng); err != nil {
 				return err
 			}
-			lbc.ctx.Recorder(ing.Namespace).Eventf(currIng, apiv1.EventTypeNormal, "CREATE", "ip: %v", ip)
+			for _, lbIP := range lbIngress {
+				lbc.ctx.Recorder(ing.Namespace).Eventf(currIng, apiv1.EventTypeNormal, "CREATE", "ip: %v", lbIP.IP)
+			}
 		}
 	}
 	annotations, err := loadbalancers.GetLBAnnotations(l7, currIng.Annotations, lbc.backendSyncer)
@@ -578,15 +772,35 @@ func (lbc *LoadBalancerController) toRuntimeInfo(ing *v1beta1.Ingress, urlMap *u
 		feConfig = feConfig.DeepCopy()
 	}
 
+	adopted, err := annotations.AdoptedResources()
+	if err != nil {
+		return nil, err
+	}
+
+	var managedIP *loadbalancers.ManagedStaticIP
+	if annotations.ManagedStaticIP() {
+		managedIP = &loadbalancers.ManagedStaticIP{
+			ImportName: annotations.ImportStaticIPName(),
+			Retain:     annotations.RetainStaticIP(),
+		}
+	}
+
 	return &loadbalancers.L7RuntimeInfo{
-		Name:           k,
-		TLS:            tls,
-		TLSName:        annotations.UseNamedTLS(),
-		Ingress:        ing,
-		AllowHTTP:      annotations.AllowHTTP(),
-		StaticIPName:   annotations.StaticIPName(),
-		UrlMap:         urlMap,
-		FrontendConfig: feConfig,
+		Name:                 k,
+		TLS:                  tls,
+		TLSName:              annotations.UseNamedTLS(),
+		Ingress:              ing,
+		AllowHTTP:            annotations.AllowHTTP(),
+		StaticIPName:         annotations.StaticIPName(),
+		IPv6:                 annotations.EnableIPv6(),
+		StaticIPv6Name:       annotations.StaticIPv6Name(),
+		ManagedStaticIP:      managedIP,
+		ILBSubnet:            annotations.ILBSubnet(),
+		ILBIP:                annotations.ILBIP(),
+		ILBAllowGlobalAccess: annotations.ILBAllowGlobalAccess(),
+		AdoptedResources:     adopted,
+		UrlMap:               urlMap,
+		FrontendConfig:       feConfig,
 	}, nil
 }
 
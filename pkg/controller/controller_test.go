@@ -34,11 +34,13 @@ import (
 
 	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	"k8s.io/ingress-gce/pkg/backends"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/events"
 	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/instances"
 	"k8s.io/ingress-gce/pkg/loadbalancers"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/test"
 	"k8s.io/ingress-gce/pkg/tls"
 	"k8s.io/ingress-gce/pkg/utils"
@@ -80,11 +82,11 @@ func newLoadBalancerController() *LoadBalancerController {
 		HealthCheckPath:               "/",
 		DefaultBackendHealthCheckPath: "/healthz",
 	}
-	ctx := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, fakeGCE, namer, ctxConfig)
+	ctx := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, fakeGCE, namer, ctxConfig)
 	lbc := NewLoadBalancerController(ctx, stopCh)
 	// TODO(rramkumar): Fix this so we don't have to override with our fake
 	lbc.instancePool = instances.NewNodePool(instances.NewFakeInstanceGroups(sets.NewString(), namer), namer)
-	lbc.l7Pool = loadbalancers.NewLoadBalancerPool(fakeGCE, namer, events.RecorderProducerMock{})
+	lbc.l7Pool = loadbalancers.NewLoadBalancerPool(fakeGCE, namer, events.RecorderProducerMock{}, storage.NewFakeConfigMapVault(meta_v1.NamespaceSystem, loadbalancers.StaticIPConfigMapName), storage.NewFakeConfigMapVault(meta_v1.NamespaceSystem, loadbalancers.AdoptionConfigMapName))
 	lbc.instancePool.Init(&instances.FakeZoneLister{Zones: []string{"zone-a"}})
 
 	lbc.hasSynced = func() bool { return true }
@@ -632,6 +634,71 @@ func TestMCIngressIG(t *testing.T) {
 	}
 }
 
+// TestIngressUpdateGCBackends asserts that a sync deletes the backends which
+// the Ingress stopped using, unless another Ingress uses them.
+func TestIngressUpdateGCBackends(t *testing.T) {
+	lbc := newLoadBalancerController()
+
+	var nodePorts []int64
+	for _, name := range []string{"svc-a", "svc-b", "svc-c"} {
+		svc := test.NewService(types.NamespacedName{Name: name, Namespace: "default"}, api_v1.ServiceSpec{
+			Type:  api_v1.ServiceTypeNodePort,
+			Ports: []api_v1.ServicePort{{Port: 80}},
+		})
+		addService(lbc, svc)
+		nodePorts = append(nodePorts, int64(svc.Spec.Ports[0].NodePort))
+	}
+
+	backendA := backend("svc-a", intstr.FromInt(80))
+	backendB := backend("svc-b", intstr.FromInt(80))
+	backendC := backend("svc-c", intstr.FromInt(80))
+	ing := test.NewIngress(types.NamespacedName{Name: "my-ingress", Namespace: "default"},
+		v1beta1.IngressSpec{
+			Backend: &backendA,
+			Rules: []v1beta1.IngressRule{{
+				Host: "foo.bar",
+				IngressRuleValue: v1beta1.IngressRuleValue{
+					HTTP: &v1beta1.HTTPIngressRuleValue{
+						Paths: []v1beta1.HTTPIngressPath{{Path: "/b", Backend: backendB}},
+					},
+				},
+			}},
+		})
+	otherIng := test.NewIngress(types.NamespacedName{Name: "other-ingress", Namespace: "default"},
+		v1beta1.IngressSpec{
+			Backend: &backendB,
+		})
+	addIngress(lbc, ing)
+	addIngress(lbc, otherIng)
+
+	ingStoreKey := getKey(ing, t)
+	otherIngStoreKey := getKey(otherIng, t)
+	for _, key := range []string{ingStoreKey, otherIngStoreKey} {
+		if err := lbc.sync(key); err != nil {
+			t.Fatalf("lbc.sync(%v) = %v, want nil", key, err)
+		}
+	}
+
+	// Switch the Ingress from svc-a and svc-b to svc-c.
+	updatedIng, err := lbc.ctx.KubeClient.NetworkingV1beta1().Ingresses(ing.Namespace).Get(ing.Name, meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get(%v) = %v, want nil", ingStoreKey, err)
+	}
+	updatedIng.Spec = v1beta1.IngressSpec{Backend: &backendC}
+	updateIngress(lbc, updatedIng)
+	if err := lbc.sync(ingStoreKey); err != nil {
+		t.Fatalf("lbc.sync(%v) = %v, want nil", ingStoreKey, err)
+	}
+
+	for i, wantExists := range []bool{false, true, true} {
+		beName := lbc.ctx.ClusterNamer.IGBackend(nodePorts[i])
+		_, err := lbc.ctx.Cloud.GetGlobalBackendService(beName)
+		if exists := err == nil; exists != wantExists {
+			t.Errorf("GetGlobalBackendService(%q) = %v, want exists = %v", beName, err, wantExists)
+		}
+	}
+}
+
 // TestToRuntimeInfoCerts asserts that both pre-shared and secret-based certs
 // are included in the RuntimeInfo.
 func TestToRuntimeInfoCerts(t *testing.T) {
@@ -664,3 +731,37 @@ func TestToRuntimeInfoCerts(t *testing.T) {
 		t.Errorf("lbInfo.TLS = %v, want %v", lbInfo.TLS, tlsCerts)
 	}
 }
+
+func TestNegGroupKeys(t *testing.T) {
+	lbc := newLoadBalancerController()
+	groupKeys := []backends.GroupKey{{Zone: "zone1"}, {Zone: "zone2"}}
+	svc := test.NewService(types.NamespacedName{Name: "my-service", Namespace: "default"}, api_v1.ServiceSpec{
+		Ports: []api_v1.ServicePort{{Port: 80}, {Port: 443}},
+	})
+	svc.Annotations = map[string]string{annotations.NEGStatusKey: `{"network_endpoint_groups":{"80":"custom-neg"},"zones":["zone1"]}`}
+	addService(lbc, svc)
+
+	for _, tc := range []struct {
+		desc            string
+		port            int32
+		expectGroupKeys []backends.GroupKey
+	}{
+		{
+			desc:            "port in NEG status",
+			port:            80,
+			expectGroupKeys: []backends.GroupKey{{Zone: "zone1", Name: "custom-neg"}},
+		},
+		{
+			desc:            "port not in NEG status",
+			port:            443,
+			expectGroupKeys: groupKeys,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			sp := utils.ServicePort{ID: utils.ServicePortID{Service: types.NamespacedName{Name: "my-service", Namespace: "default"}}, Port: tc.port}
+			if diff := cmp.Diff(tc.expectGroupKeys, lbc.negGroupKeys(sp, groupKeys)); diff != "" {
+				t.Errorf("negGroupKeys() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
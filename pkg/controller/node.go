@@ -21,6 +21,7 @@ import (
 	listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/instances"
 	"k8s.io/ingress-gce/pkg/utils"
 )
@@ -42,7 +43,7 @@ func NewNodeController(ctx *context.ControllerContext, instancePool instances.No
 		lister:       ctx.NodeInformer.GetIndexer(),
 		instancePool: instancePool,
 	}
-	c.queue = utils.NewPeriodicTaskQueue("", "nodes", c.sync)
+	c.queue = utils.NewPeriodicTaskQueueWithMultipleWorkers("nodes", "nodes", flags.F.NumNodeWorkers, c.sync)
 
 	ctx.NodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
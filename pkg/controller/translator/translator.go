@@ -36,6 +36,7 @@ import (
 	"k8s.io/ingress-gce/pkg/backendconfig"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/controller/errors"
+	"k8s.io/ingress-gce/pkg/destinationrule"
 	"k8s.io/ingress-gce/pkg/loadbalancers"
 	"k8s.io/ingress-gce/pkg/utils"
 )
@@ -140,6 +141,16 @@ func (t *Translator) maybeEnableBackendConfig(sp *utils.ServicePort, svc *api_v1
 	return nil
 }
 
+// maybeSetTrafficPolicy sets the traffic policy of the Istio DestinationRules of the
+// service on the service port if CSM is enabled.
+func (t *Translator) maybeSetTrafficPolicy(sp *utils.ServicePort) {
+	if t.ctx.DestinationRuleInformer == nil {
+		return
+	}
+	drs := destinationrule.ForService(t.ctx.DestinationRuleInformer.GetIndexer(), sp.ID.Service)
+	sp.TrafficPolicy = destinationrule.TrafficPolicyForServicePort(drs, sp.ID.Service, sp.Port)
+}
+
 // getServicePort looks in the svc store for a matching service:port,
 // and returns the nodeport.
 func (t *Translator) getServicePort(id utils.ServicePortID, params *getServicePortParams) (*utils.ServicePort, error) {
@@ -176,6 +187,8 @@ func (t *Translator) getServicePort(id utils.ServicePortID, params *getServicePo
 		return svcPort, err
 	}
 
+	t.maybeSetTrafficPolicy(svcPort)
+
 	return svcPort, nil
 }
 
@@ -237,29 +250,17 @@ func (t *Translator) TranslateIngress(ing *v1beta1.Ingress, systemDefaultBackend
 	return urlMap, errs
 }
 
-func getZone(n *api_v1.Node) string {
-	zone, ok := n.Labels[annotations.ZoneKey]
-	if !ok {
-		return annotations.DefaultZone
-	}
-	return zone
-}
-
-// GetZoneForNode returns the zone for a given node by looking up its zone label.
+// GetZoneForNode returns the zone for a given node by looking up its zone labels,
+// or its provider ID if it has none.
 func (t *Translator) GetZoneForNode(name string) (string, error) {
-	nodeLister := t.ctx.NodeInformer.GetIndexer()
-	nodes, err := listers.NewNodeLister(nodeLister).List(labels.Everything())
+	obj, exists, err := t.ctx.NodeInformer.GetIndexer().GetByKey(name)
 	if err != nil {
 		return "", err
 	}
-	for _, n := range nodes {
-		if n.Name == name {
-			// TODO: Make this more resilient to label changes by listing
-			// cloud nodes and figuring out zone.
-			return getZone(n), nil
-		}
+	if !exists {
+		return "", fmt.Errorf("node not found %v", name)
 	}
-	return "", fmt.Errorf("node not found %v", name)
+	return t.ctx.ZoneCache.GetZone(obj.(*api_v1.Node))
 }
 
 // ListZones returns a list of zones this Kubernetes cluster spans.
@@ -271,7 +272,12 @@ func (t *Translator) ListZones() ([]string, error) {
 		return zones.List(), err
 	}
 	for _, n := range readyNodes {
-		zones.Insert(getZone(n))
+		zone, err := t.ctx.ZoneCache.GetZone(n)
+		if err != nil {
+			klog.Warningf("Skipping node %q without zone: %v", n.Name, err)
+			continue
+		}
+		zones.Insert(zone)
 	}
 	return zones.List(), nil
 }
@@ -23,13 +23,16 @@ import (
 	"testing"
 	"time"
 
+	istioV1alpha3 "istio.io/api/networking/v1alpha3"
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfig "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
@@ -64,7 +67,7 @@ func fakeTranslator() *Translator {
 		HealthCheckPath:               "/",
 		DefaultBackendHealthCheckPath: "/healthz",
 	}
-	ctx := context.NewControllerContext(client, nil, backendConfigClient, nil, nil, namer, ctxConfig)
+	ctx := context.NewControllerContext(client, nil, backendConfigClient, nil, nil, nil, namer, ctxConfig)
 	gce := &Translator{
 		ctx: ctx,
 	}
@@ -328,6 +331,47 @@ func TestGetServicePortWithBackendConfigEnabled(t *testing.T) {
 	}
 }
 
+func TestGetServicePortWithTrafficPolicy(t *testing.T) {
+	translator := fakeTranslator()
+	translator.ctx.DestinationRuleInformer = cache.NewSharedIndexInformer(nil, &unstructured.Unstructured{}, 0, cache.Indexers{})
+	svcName := types.NamespacedName{Name: "foo", Namespace: "default"}
+	translator.ctx.ServiceInformer.GetIndexer().Add(test.NewService(svcName, apiv1.ServiceSpec{
+		Type:  apiv1.ServiceTypeNodePort,
+		Ports: []apiv1.ServicePort{{Name: "http", Port: 80}, {Name: "https", Port: 443}},
+	}))
+	dr := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"host": "foo",
+			"trafficPolicy": map[string]interface{}{
+				"loadBalancer": map[string]interface{}{"simple": "LEAST_CONN"},
+				"portLevelSettings": []interface{}{
+					map[string]interface{}{
+						"port":         map[string]interface{}{"number": int64(443)},
+						"loadBalancer": map[string]interface{}{"simple": "RANDOM"},
+					},
+				},
+			},
+		},
+	}}
+	dr.SetNamespace("default")
+	dr.SetName("foo")
+	translator.ctx.DestinationRuleInformer.GetIndexer().Add(dr)
+
+	for port, expectLb := range map[string]istioV1alpha3.LoadBalancerSettings_SimpleLB{
+		"http":  istioV1alpha3.LoadBalancerSettings_LEAST_CONN,
+		"https": istioV1alpha3.LoadBalancerSettings_RANDOM,
+	} {
+		id := utils.ServicePortID{Service: svcName, Port: intstr.FromString(port)}
+		sp, err := translator.getServicePort(id, &getServicePortParams{isL7ILB: true})
+		if err != nil {
+			t.Fatalf("translator.getServicePort(%+v) = _, %v, want nil", id, err)
+		}
+		if lb := sp.TrafficPolicy.GetLoadBalancer().GetSimple(); lb != expectLb {
+			t.Errorf("translator.getServicePort(%+v) load balancer = %v, want %v", id, lb, expectLb)
+		}
+	}
+}
+
 func TestGetProbe(t *testing.T) {
 	translator := fakeTranslator()
 	nodePortToHealthCheck := map[utils.ServicePort]string{
@@ -541,8 +585,7 @@ func TestGetZoneForNode(t *testing.T) {
 	translator := fakeTranslator()
 	translator.ctx.NodeInformer.GetIndexer().Add(&apiv1.Node{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: "ns",
-			Name:      nodeName,
+			Name: nodeName,
 			Labels: map[string]string{
 				annotations.ZoneKey: zone,
 			},
@@ -570,6 +613,56 @@ func TestGetZoneForNode(t *testing.T) {
 	}
 }
 
+func TestGetZoneForNodeWithoutFailureDomainLabel(t *testing.T) {
+	translator := fakeTranslator()
+	nodeIndexer := translator.ctx.NodeInformer.GetIndexer()
+	readyStatus := apiv1.NodeStatus{
+		Conditions: []apiv1.NodeCondition{{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue}},
+	}
+	nodeIndexer.Add(&apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "topology-node",
+			Labels: map[string]string{annotations.TopologyZoneKey: "us-central1-a"},
+		},
+		Status: readyStatus,
+	})
+	nodeIndexer.Add(&apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "unlabelled-node"},
+		Spec:       apiv1.NodeSpec{ProviderID: "gce://project/us-central1-b/unlabelled-node"},
+		Status:     readyStatus,
+	})
+	nodeIndexer.Add(&apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "unknown-node"},
+		Status:     readyStatus,
+	})
+
+	for node, expectZone := range map[string]string{
+		"topology-node":   "us-central1-a",
+		"unlabelled-node": "us-central1-b",
+	} {
+		zone, err := translator.GetZoneForNode(node)
+		if err != nil {
+			t.Errorf("GetZoneForNode(%q) = _, %v, want nil", node, err)
+		}
+		if zone != expectZone {
+			t.Errorf("GetZoneForNode(%q) = %q, want %q", node, zone, expectZone)
+		}
+	}
+	for _, node := range []string{"unknown-node", "missing-node"} {
+		if zone, err := translator.GetZoneForNode(node); err == nil {
+			t.Errorf("GetZoneForNode(%q) = %q, nil, want error", node, zone)
+		}
+	}
+
+	zones, err := translator.ListZones()
+	if err != nil {
+		t.Fatalf("ListZones() = _, %v, want nil", err)
+	}
+	if expectZones := []string{"us-central1-a", "us-central1-b"}; !sets.NewString(zones...).Equal(sets.NewString(expectZones...)) {
+		t.Errorf("ListZones() = %v, want %v", zones, expectZones)
+	}
+}
+
 func newDefaultEndpoint(name string) *apiv1.Endpoints {
 	return &apiv1.Endpoints{
 		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
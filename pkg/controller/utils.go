@@ -19,6 +19,7 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	compute "google.golang.org/api/compute/v1"
 	api_v1 "k8s.io/api/core/v1"
@@ -58,6 +59,25 @@ func uniq(svcPorts []utils.ServicePort) []utils.ServicePort {
 	return svcPorts
 }
 
+// backendsInStatus returns the sorted names of the backend services recorded
+// in the status annotations of an Ingress.
+func backendsInStatus(ingAnnotations map[string]string) []string {
+	val, ok := ingAnnotations[fmt.Sprintf("%v/backends", annotations.StatusPrefix)]
+	if !ok {
+		return nil
+	}
+	backendState := map[string]string{}
+	if err := json.Unmarshal([]byte(val), &backendState); err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(backendState))
+	for name := range backendState {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func nodeStatusChanged(old, cur *api_v1.Node) bool {
 	if old.Spec.Unschedulable != cur.Spec.Unschedulable {
 		return true
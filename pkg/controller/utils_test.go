@@ -158,6 +158,36 @@ func TestAddInstanceGroupsAnnotation(t *testing.T) {
 	}
 }
 
+func TestBackendsInStatus(t *testing.T) {
+	key := "ingress.kubernetes.io/backends"
+	testCases := []struct {
+		desc        string
+		annotations map[string]string
+		want        []string
+	}{
+		{
+			desc: "no annotation",
+		},
+		{
+			desc:        "unknown state",
+			annotations: map[string]string{key: "Unknown"},
+		},
+		{
+			desc:        "backends",
+			annotations: map[string]string{key: `{"k8s-be-30002--uid1":"HEALTHY","k8s-be-30001--uid1":"Unknown"}`},
+			want:        []string{"k8s-be-30001--uid1", "k8s-be-30002--uid1"},
+		},
+	}
+	for _, tc := range testCases {
+		got := backendsInStatus(tc.annotations)
+		if len(got) != 0 || len(tc.want) != 0 {
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: backendsInStatus(%v) = %v, want %v", tc.desc, tc.annotations, got, tc.want)
+			}
+		}
+	}
+}
+
 func TestNodeStatusChanged(t *testing.T) {
 	testCases := []struct {
 		desc   string
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package destinationrule reads Istio DestinationRules, which configure the NEGs
+// and backend services of the services they refer to in CSM mode.
+package destinationrule
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/jsonpb"
+	istioV1alpha3 "istio.io/api/networking/v1alpha3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const (
+	// Group is the API group of DestinationRules.
+	Group = "networking.istio.io"
+	// Resource is the resource name of DestinationRules.
+	Resource = "destinationrules"
+	// V1alpha3 is the first API version of DestinationRules.
+	V1alpha3 = "v1alpha3"
+	// V1beta1 is the API version of DestinationRules since Istio 1.5, which is
+	// preferred over V1alpha3 when the API server serves both.
+	V1beta1 = "v1beta1"
+)
+
+// GroupVersionResource returns the DestinationRule resource of the latest API
+// version served by the API server. It falls back to V1alpha3 if the served
+// versions cannot be discovered.
+func GroupVersionResource(client discovery.DiscoveryInterface) schema.GroupVersionResource {
+	gvr := schema.GroupVersionResource{Group: Group, Version: V1alpha3, Resource: Resource}
+	if client == nil {
+		return gvr
+	}
+	resources, err := client.ServerResourcesForGroupVersion(schema.GroupVersion{Group: Group, Version: V1beta1}.String())
+	if err != nil {
+		klog.V(2).Infof("DestinationRule API version %s is not served, using %s: %v", V1beta1, V1alpha3, err)
+		return gvr
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == Resource {
+			gvr.Version = V1beta1
+			break
+		}
+	}
+	return gvr
+}
+
+// FromUnstructured converts an Unstructured DestinationRule of any supported API
+// version to a DestinationRule, and returns the service it refers to. The schema of
+// V1beta1 DestinationRules is the one of V1alpha3.
+func FromUnstructured(obj *unstructured.Unstructured) (*istioV1alpha3.DestinationRule, types.NamespacedName, error) {
+	spec, err := json.Marshal(obj.Object["spec"])
+	if err != nil {
+		return nil, types.NamespacedName{}, err
+	}
+	dr := &istioV1alpha3.DestinationRule{}
+	unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := unmarshaler.Unmarshal(strings.NewReader(string(spec)), dr); err != nil {
+		return nil, types.NamespacedName{}, fmt.Errorf("failed to parse DestinationRule %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	svc := types.NamespacedName{Namespace: obj.GetNamespace(), Name: dr.Host}
+	if strings.Contains(dr.Host, ".") {
+		// If the Host is using a full service name, Istio will ignore the destination rule
+		// namespace and use the namespace in the full name. (e.g. "reviews"
+		// instead of "reviews.default.svc.cluster.local")
+		// For more info, please go to https://github.com/istio/api/blob/1.2.4/networking/v1alpha3/destination_rule.pb.go#L186
+		rsl := strings.Split(dr.Host, ".")
+		svc = types.NamespacedName{Namespace: rsl[1], Name: rsl[0]}
+	}
+	return dr, svc, nil
+}
+
+// ForService returns all DestinationRules in store that refer to the service, keyed
+// by the namespace and name of the DestinationRule.
+// Please notice that a DestinationRule can point to a service in a different namespace.
+func ForService(store cache.Store, svc types.NamespacedName) map[types.NamespacedName]*istioV1alpha3.DestinationRule {
+	drs := make(map[types.NamespacedName]*istioV1alpha3.DestinationRule)
+	for _, obj := range store.List() {
+		drus, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		dr, target, err := FromUnstructured(drus)
+		if err != nil {
+			klog.Errorf("Failed to cast Unstructured DestinationRule to DestinationRule: %v", err)
+			continue
+		}
+		if target == svc {
+			drs[types.NamespacedName{Namespace: drus.GetNamespace(), Name: drus.GetName()}] = dr
+		}
+	}
+	return drs
+}
+
+// TrafficPolicyForServicePort returns the traffic policy that the DestinationRules of
+// a service apply to its port, nil if none does. When several DestinationRules define
+// a traffic policy, the one in the namespace of the service is used, and otherwise the
+// first one in namespace/name order.
+func TrafficPolicyForServicePort(drs map[types.NamespacedName]*istioV1alpha3.DestinationRule, svc types.NamespacedName, port int32) *istioV1alpha3.TrafficPolicy {
+	var keys []types.NamespacedName
+	for key, dr := range drs {
+		if dr.TrafficPolicy != nil {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if iLocal, jLocal := keys[i].Namespace == svc.Namespace, keys[j].Namespace == svc.Namespace; iLocal != jLocal {
+			return iLocal
+		}
+		return keys[i].String() < keys[j].String()
+	})
+	if len(keys) > 1 {
+		klog.Warningf("DestinationRules %v define a traffic policy for service %s, using the one of %s", keys, svc, keys[0])
+	}
+	return TrafficPolicyForPort(drs[keys[0]].TrafficPolicy, port)
+}
+
+// TrafficPolicyForPort returns the traffic policy applied to the port. Like Istio,
+// each setting of the port level settings of the port overrides the one of the
+// destination.
+func TrafficPolicyForPort(policy *istioV1alpha3.TrafficPolicy, port int32) *istioV1alpha3.TrafficPolicy {
+	if policy == nil {
+		return nil
+	}
+	ret := &istioV1alpha3.TrafficPolicy{
+		LoadBalancer:     policy.LoadBalancer,
+		ConnectionPool:   policy.ConnectionPool,
+		OutlierDetection: policy.OutlierDetection,
+		Tls:              policy.Tls,
+	}
+	for _, portPolicy := range policy.PortLevelSettings {
+		if portPolicy.Port.GetNumber() != uint32(port) {
+			continue
+		}
+		if portPolicy.LoadBalancer != nil {
+			ret.LoadBalancer = portPolicy.LoadBalancer
+		}
+		if portPolicy.ConnectionPool != nil {
+			ret.ConnectionPool = portPolicy.ConnectionPool
+		}
+		if portPolicy.OutlierDetection != nil {
+			ret.OutlierDetection = portPolicy.OutlierDetection
+		}
+		if portPolicy.Tls != nil {
+			ret.Tls = portPolicy.Tls
+		}
+	}
+	return ret
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package destinationrule
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	istioV1alpha3 "istio.io/api/networking/v1alpha3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testDestinationRuleSpec = `{
+	"host": "reviews.ns2.svc.cluster.local",
+	"exportTo": ["*"],
+	"trafficPolicy": {
+		"loadBalancer": {"consistentHash": {"httpCookie": {"name": "user", "ttl": "10s"}}},
+		"connectionPool": {"tcp": {"maxConnections": 100, "connectTimeout": "1.5s"}},
+		"outlierDetection": {"consecutiveErrors": 7, "interval": "5m"},
+		"portLevelSettings": [{
+			"port": {"number": 9080},
+			"loadBalancer": {"simple": "LEAST_CONN"}
+		}]
+	},
+	"subsets": [{"name": "v1", "labels": {"version": "v1"}}]
+}`
+
+func newTestDestinationRule(t *testing.T, namespace, name, spec string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	var specObj map[string]interface{}
+	if err := json.Unmarshal([]byte(spec), &specObj); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	obj.Object["spec"] = specObj
+	obj.SetAPIVersion(Group + "/" + V1beta1)
+	obj.SetKind("DestinationRule")
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestFromUnstructured(t *testing.T) {
+	dr, svc, err := FromUnstructured(newTestDestinationRule(t, "ns1", "dr", testDestinationRuleSpec))
+	if err != nil {
+		t.Fatalf("FromUnstructured() = _, _, %v, want nil", err)
+	}
+	if expectSvc := (types.NamespacedName{Namespace: "ns2", Name: "reviews"}); svc != expectSvc {
+		t.Errorf("FromUnstructured() service = %v, want %v", svc, expectSvc)
+	}
+	if len(dr.Subsets) != 1 || dr.Subsets[0].Name != "v1" {
+		t.Errorf("FromUnstructured() subsets = %v, want subset v1", dr.Subsets)
+	}
+	policy := dr.TrafficPolicy
+	if policy == nil {
+		t.Fatalf("FromUnstructured() traffic policy = nil")
+	}
+	if cookie := policy.LoadBalancer.GetConsistentHash().GetHttpCookie(); cookie == nil || cookie.Name != "user" || cookie.Ttl == nil || *cookie.Ttl != 10*time.Second {
+		t.Errorf("FromUnstructured() http cookie = %+v, want user with 10s TTL", cookie)
+	}
+	if tcp := policy.ConnectionPool.GetTcp(); tcp.GetMaxConnections() != 100 || tcp.GetConnectTimeout().GetSeconds() != 1 || tcp.GetConnectTimeout().GetNanos() != 5e8 {
+		t.Errorf("FromUnstructured() tcp settings = %+v, want 100 connections and 1.5s connect timeout", tcp)
+	}
+	if od := policy.OutlierDetection; od.GetConsecutiveErrors() != 7 || od.GetInterval().GetSeconds() != 300 {
+		t.Errorf("FromUnstructured() outlier detection = %+v, want 7 consecutive errors and 5m interval", od)
+	}
+
+	if _, _, err := FromUnstructured(newTestDestinationRule(t, "ns1", "dr", `{"host": "reviews", "trafficPolicy": {"loadBalancer": {"simple": "UNKNOWN"}}}`)); err == nil {
+		t.Errorf("FromUnstructured() = _, _, nil, want error for an unknown load balancer")
+	}
+}
+
+func TestForService(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(newTestDestinationRule(t, "ns1", "dr1", testDestinationRuleSpec))
+	store.Add(newTestDestinationRule(t, "ns2", "dr2", `{"host": "reviews"}`))
+	store.Add(newTestDestinationRule(t, "ns2", "dr3", `{"host": "ratings"}`))
+	store.Add(newTestDestinationRule(t, "ns1", "dr4", `{"host": "reviews"}`))
+
+	drs := ForService(store, types.NamespacedName{Namespace: "ns2", Name: "reviews"})
+	var keys []types.NamespacedName
+	for key := range drs {
+		keys = append(keys, key)
+	}
+	if len(keys) != 2 || drs[types.NamespacedName{Namespace: "ns1", Name: "dr1"}] == nil || drs[types.NamespacedName{Namespace: "ns2", Name: "dr2"}] == nil {
+		t.Errorf("ForService() = %v, want ns1/dr1 and ns2/dr2", keys)
+	}
+}
+
+func TestTrafficPolicyForServicePort(t *testing.T) {
+	svc := types.NamespacedName{Namespace: "ns2", Name: "reviews"}
+	dr, _, err := FromUnstructured(newTestDestinationRule(t, "ns1", "dr1", testDestinationRuleSpec))
+	if err != nil {
+		t.Fatalf("FromUnstructured() = _, _, %v, want nil", err)
+	}
+	local := &istioV1alpha3.DestinationRule{
+		Host:          "reviews",
+		TrafficPolicy: &istioV1alpha3.TrafficPolicy{OutlierDetection: &istioV1alpha3.OutlierDetection{ConsecutiveErrors: 3}},
+	}
+
+	drs := map[types.NamespacedName]*istioV1alpha3.DestinationRule{{Namespace: "ns1", Name: "dr1"}: dr}
+	if policy := TrafficPolicyForServicePort(drs, svc, 80); !reflect.DeepEqual(policy.LoadBalancer, dr.TrafficPolicy.LoadBalancer) || policy.ConnectionPool != dr.TrafficPolicy.ConnectionPool {
+		t.Errorf("TrafficPolicyForServicePort(80) = %+v, want the destination level settings", policy)
+	}
+	policy := TrafficPolicyForServicePort(drs, svc, 9080)
+	if policy.LoadBalancer.GetSimple() != istioV1alpha3.LoadBalancerSettings_LEAST_CONN || policy.LoadBalancer.GetConsistentHash() != nil {
+		t.Errorf("TrafficPolicyForServicePort(9080) load balancer = %+v, want the port level LEAST_CONN", policy.LoadBalancer)
+	}
+	if policy.ConnectionPool != dr.TrafficPolicy.ConnectionPool {
+		t.Errorf("TrafficPolicyForServicePort(9080) connection pool = %+v, want the destination level settings", policy.ConnectionPool)
+	}
+
+	// The DestinationRule in the namespace of the service takes precedence.
+	drs[types.NamespacedName{Namespace: "ns2", Name: "dr2"}] = local
+	if policy := TrafficPolicyForServicePort(drs, svc, 80); policy.OutlierDetection.GetConsecutiveErrors() != 3 {
+		t.Errorf("TrafficPolicyForServicePort(80) = %+v, want the traffic policy of ns2/dr2", policy)
+	}
+
+	if policy := TrafficPolicyForServicePort(map[types.NamespacedName]*istioV1alpha3.DestinationRule{{Namespace: "ns2", Name: "dr2"}: {Host: "reviews"}}, svc, 80); policy != nil {
+		t.Errorf("TrafficPolicyForServicePort(80) = %+v, want nil", policy)
+	}
+}
+
+func TestGroupVersionResource(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	if gvr := GroupVersionResource(client.Discovery()); gvr.Version != V1alpha3 {
+		t.Errorf("GroupVersionResource() = %v, want version %s", gvr, V1alpha3)
+	}
+
+	client.Resources = []*metav1.APIResourceList{{
+		GroupVersion: schema.GroupVersion{Group: Group, Version: V1beta1}.String(),
+		APIResources: []metav1.APIResource{{Name: Resource, Kind: "DestinationRule", Namespaced: true}},
+	}}
+	expectGVR := schema.GroupVersionResource{Group: Group, Version: V1beta1, Resource: Resource}
+	if gvr := GroupVersionResource(client.Discovery()); gvr != expectGVR {
+		t.Errorf("GroupVersionResource() = %v, want %v", gvr, expectGVR)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/klog"
+)
+
+// Auditor periodically audits the GCE resources of all registered sources.
+// Drift is reported as events on the affected Ingresses, as metrics and
+// through ServeHTTP.
+type Auditor struct {
+	ctx *context.ControllerContext
+
+	lock    sync.Mutex
+	sources map[string]Source
+	// report is the result of the last audit, nil if none has run yet.
+	report *Report
+}
+
+// NewAuditor returns a new Auditor without sources.
+func NewAuditor(ctx *context.ControllerContext) *Auditor {
+	RegisterMetrics()
+	return &Auditor{
+		ctx:     ctx,
+		sources: map[string]Source{},
+	}
+}
+
+// AddSource registers a source to audit under the given name.
+func (a *Auditor) AddSource(name string, s Source) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.sources[name] = s
+}
+
+// Run audits all sources every period until stopCh is closed.
+func (a *Auditor) Run(period time.Duration, stopCh <-chan struct{}) {
+	klog.V(0).Infof("Auditing GCE resources every %v", period)
+	wait.Until(func() { a.Audit() }, period, stopCh)
+}
+
+// Audit audits all sources and returns the resulting report.
+func (a *Auditor) Audit() *Report {
+	a.lock.Lock()
+	sources := make(map[string]Source, len(a.sources))
+	for name, s := range a.sources {
+		sources[name] = s
+	}
+	previous := a.report
+	a.lock.Unlock()
+
+	report := &Report{Time: time.Now(), Drifts: []Drift{}}
+	for name, s := range sources {
+		drifts, err := s.Audit()
+		if err != nil {
+			klog.Errorf("Error auditing %v: %v", name, err)
+			if report.Errors == nil {
+				report.Errors = map[string]string{}
+			}
+			report.Errors[name] = err.Error()
+		}
+		report.Drifts = append(report.Drifts, drifts...)
+	}
+	sort.Slice(report.Drifts, func(i, j int) bool {
+		return report.Drifts[i].id() < report.Drifts[j].id()
+	})
+
+	a.recordEvents(previous, report)
+	observeReport(report)
+
+	a.lock.Lock()
+	a.report = report
+	a.lock.Unlock()
+	return report
+}
+
+// recordEvents raises an event on the Ingress of every drift which was not
+// already found by the previous audit.
+func (a *Auditor) recordEvents(previous, report *Report) {
+	known := map[string]bool{}
+	if previous != nil {
+		for _, d := range previous.Drifts {
+			known[d.id()] = true
+		}
+	}
+	for _, d := range report.Drifts {
+		if d.Ingress == "" || known[d.id()] {
+			continue
+		}
+		klog.V(2).Infof("Ingress %v: %v", d.Ingress, d)
+		ing, exists, err := a.ctx.Ingresses().GetByKey(d.Ingress)
+		if err != nil || !exists {
+			continue
+		}
+		a.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeWarning, "Drift", d.String())
+	}
+}
+
+// Report returns the result of the last audit, nil if none has run yet.
+func (a *Auditor) Report() *Report {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.report
+}
+
+// ServeHTTP writes the last report as JSON.
+func (a *Auditor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := a.Report()
+	if report == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("No audit has run yet"))
+		return
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/legacy-cloud-providers/gce"
+)
+
+type fakeSource struct {
+	drifts []Drift
+	err    error
+}
+
+func (f *fakeSource) Audit() ([]Drift, error) {
+	return f.drifts, f.err
+}
+
+func newTestAuditor() *Auditor {
+	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
+	ctxConfig := context.ControllerContextConfig{
+		Namespace:    api_v1.NamespaceAll,
+		ResyncPeriod: 1 * time.Minute,
+	}
+	ctx := context.NewControllerContext(fake.NewSimpleClientset(), nil, nil, nil, nil, fakeGCE, utils.NewNamer("uid1", ""), ctxConfig)
+	return NewAuditor(ctx)
+}
+
+func TestAudit(t *testing.T) {
+	a := newTestAuditor()
+	a.AddSource("lb", &fakeSource{drifts: []Drift{
+		{Kind: KindUrlMap, Name: "um2", Reason: Modified, Ingress: "ns/ing", Fields: []string{"defaultService"}},
+		{Kind: KindBackendService, Name: "be1", Reason: Orphaned},
+	}})
+	a.AddSource("fw", &fakeSource{
+		drifts: []Drift{{Kind: KindFirewall, Name: "fw1", Reason: Missing}},
+	})
+	a.AddSource("broken", &fakeSource{err: fmt.Errorf("not synced")})
+
+	report := a.Audit()
+	if a.Report() != report {
+		t.Errorf("Report() = %v, want the last audit %v", a.Report(), report)
+	}
+	var got []string
+	for _, d := range report.Drifts {
+		got = append(got, d.Kind+"/"+d.Name)
+	}
+	want := []string{"BackendService/be1", "Firewall/fw1", "UrlMap/um2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Audit() drifts = %v, want %v", got, want)
+	}
+	wantErrors := map[string]string{"broken": "not synced"}
+	if !reflect.DeepEqual(report.Errors, wantErrors) {
+		t.Errorf("Audit() errors = %v, want %v", report.Errors, wantErrors)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	a := newTestAuditor()
+
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/drift", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeHTTP() before any audit = %v, want %v", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	d := Drift{Kind: KindHealthCheck, Name: "hc1", Reason: Modified, Fields: []string{"requestPath"}}
+	a.AddSource("lb", &fakeSource{drifts: []Drift{d}})
+	a.Audit()
+
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/drift", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() = %v, want %v", rec.Code, http.StatusOK)
+	}
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if !reflect.DeepEqual(report.Drifts, []Drift{d}) {
+		t.Errorf("ServeHTTP() drifts = %v, want %v", report.Drifts, []Drift{d})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drift
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-gce/pkg/metrics"
+)
+
+const (
+	driftSubsystem        = "drift"
+	driftResourcesKey     = "resources"
+	lastAuditTimestampKey = "audit_timestamp"
+)
+
+var (
+	// DriftResources is the number of resources found to drift in the last
+	// audit.
+	DriftResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: driftSubsystem,
+			Name:      driftResourcesKey,
+			Help:      "Number of GCE resources which differ from the state expected by the controller",
+		},
+		[]string{
+			"kind",   // The kind of GCE resource.
+			"reason", // How the resource differs.
+		},
+	)
+
+	// LastAuditTimestamp is the time of the last audit.
+	LastAuditTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: driftSubsystem,
+			Name:      lastAuditTimestampKey,
+			Help:      "The timestamp of the last audit of GCE resources.",
+		},
+	)
+)
+
+var register sync.Once
+
+// RegisterMetrics registers the drift metrics.
+func RegisterMetrics() {
+	register.Do(func() {
+		prometheus.MustRegister(DriftResources)
+		prometheus.MustRegister(LastAuditTimestamp)
+	})
+}
+
+// observeReport publishes the metrics of a report.
+func observeReport(report *Report) {
+	DriftResources.Reset()
+	// Resources shared by several Ingresses are only counted once.
+	seen := map[string]bool{}
+	for _, d := range report.Drifts {
+		key := d.Kind + "/" + d.Name + "/" + string(d.Reason)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		DriftResources.WithLabelValues(d.Kind, string(d.Reason)).Inc()
+	}
+	LastAuditTimestamp.Set(float64(report.Time.Unix()))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package drift detects differences between the GCE resources the controller
+// would create and those which actually exist, such as load balancers edited
+// by hand in the cloud console.
+package drift
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reason describes how a GCE resource differs from the expected state.
+type Reason string
+
+const (
+	// Modified resources exist but differ from what the controller expects.
+	Modified Reason = "Modified"
+	// Missing resources are expected to exist but do not.
+	Missing Reason = "Missing"
+	// Orphaned resources belong to the cluster but are not used by any
+	// Ingress.
+	Orphaned Reason = "Orphaned"
+)
+
+// Resource kinds reported by the auditor.
+const (
+	KindUrlMap         = "UrlMap"
+	KindBackendService = "BackendService"
+	KindHealthCheck    = "HealthCheck"
+	KindFirewall       = "Firewall"
+)
+
+// Drift is a single difference between the expected and the actual state of
+// a GCE resource.
+type Drift struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Reason Reason `json:"reason"`
+	// Ingress is the key of the Ingress using the resource, if any.
+	Ingress string `json:"ingress,omitempty"`
+	// Fields lists the fields which differ for modified resources.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// String returns a human readable description of the drift.
+func (d Drift) String() string {
+	if len(d.Fields) == 0 {
+		return fmt.Sprintf("%v %v is %v", d.Kind, d.Name, strings.ToLower(string(d.Reason)))
+	}
+	return fmt.Sprintf("%v %v is %v: %v", d.Kind, d.Name, strings.ToLower(string(d.Reason)), strings.Join(d.Fields, ", "))
+}
+
+// id uniquely identifies the drift of a resource used by an Ingress.
+func (d Drift) id() string {
+	return fmt.Sprintf("%v/%v/%v/%v/%v", d.Kind, d.Name, d.Reason, d.Ingress, strings.Join(d.Fields, ","))
+}
+
+// Source is a set of GCE resources which can be audited.
+type Source interface {
+	// Audit returns the differences between the expected and the actual
+	// state of the resources.
+	Audit() ([]Drift, error)
+}
+
+// Report is the result of an audit of all sources.
+type Report struct {
+	Time   time.Time `json:"time"`
+	Drifts []Drift   `json:"drifts"`
+	// Errors maps the name of a source to the error auditing it.
+	Errors map[string]string `json:"errors,omitempty"`
+}
@@ -32,6 +32,8 @@ import (
 	"k8s.io/ingress-gce/pkg/common/operator"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/controller/translator"
+	"k8s.io/ingress-gce/pkg/drift"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -52,6 +54,12 @@ type FirewallController struct {
 	translator   *translator.Translator
 	nodeLister   cache.Indexer
 	hasSynced    func() bool
+	// xpnTracker records firewall changes required from the network admin.
+	// Nil if XPN firewall tracking is disabled.
+	xpnTracker *xpnTracker
+	// xpnScriptMode raises events only when the pending changes are modified,
+	// pointing at the consolidated script rather than at a single command.
+	xpnScriptMode bool
 }
 
 // NewFirewallController returns a new firewall controller.
@@ -68,7 +76,12 @@ func NewFirewallController(
 		hasSynced:    ctx.HasSynced,
 	}
 
-	fwc.queue = utils.NewPeriodicTaskQueue("", "firewall", fwc.sync)
+	if flags.F.EnableXPNFirewallTracking {
+		fwc.xpnTracker = newXPNTracker(storage.NewConfigMapVault(ctx.KubeClient, metav1.NamespaceSystem, XPNConfigMapName))
+		fwc.xpnScriptMode = flags.F.XPNFirewallScript
+	}
+
+	fwc.queue = utils.NewPeriodicTaskQueueWithMultipleWorkers("firewall", "firewall", flags.F.NumFirewallWorkers, fwc.sync)
 
 	// Ingress event handlers.
 	ctx.IngressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -148,50 +161,126 @@ func (fwc *FirewallController) sync(key string) error {
 	}
 	klog.V(3).Infof("Syncing firewall")
 
-	gceIngresses := operator.Ingresses(fwc.ctx.Ingresses().List()).Filter(func(ing *v1beta1.Ingress) bool {
-		return utils.IsGCEIngress(ing)
-	}).AsList()
+	gceIngresses := fwc.gceIngresses()
 
 	// If there are no more ingresses, then delete the firewall rule.
 	if len(gceIngresses) == 0 {
-		fwc.firewallPool.GC()
+		if err := fwc.firewallPool.GC(); err != nil {
+			if fwErr, ok := err.(*FirewallXPNError); ok {
+				fwc.recordXPNError(fwErr)
+			}
+			return nil
+		}
+		fwc.resolveXPNError()
 		return nil
 	}
 
-	// gceSvcPorts contains the ServicePorts used by only single-cluster ingress.
-	gceSvcPorts := fwc.ToSvcPorts(gceIngresses)
-	nodeNames, err := utils.GetReadyNodeNames(listers.NewNodeLister(fwc.nodeLister))
+	nodeNames, negPorts, additionalRanges, err := fwc.firewallParams(gceIngresses)
 	if err != nil {
 		return err
 	}
-	negPorts := fwc.translator.GatherEndpointPorts(gceSvcPorts)
-
-	var additionalRanges []string
-	if flags.F.EnableL7Ilb {
-		ilbRange, err := fwc.ilbFirewallSrcRange(gceIngresses)
-		if err != nil {
-			return err
-		}
-		additionalRanges = append(additionalRanges, ilbRange)
-	}
 
 	// Ensure firewall rule for the cluster and pass any NEG endpoint ports.
 	if err := fwc.firewallPool.Sync(nodeNames, negPorts, additionalRanges); err != nil {
 		if fwErr, ok := err.(*FirewallXPNError); ok {
+			changed := fwc.recordXPNError(fwErr)
+			if fwc.xpnScriptMode && !changed {
+				// The network admin has already been notified of this change.
+				return nil
+			}
+			message := fwErr.Message
+			if fwc.xpnScriptMode {
+				message = fmt.Sprintf("Firewall change required by network admin: run the script stored under key %q of ConfigMap %v/%v", XPNScriptKey, metav1.NamespaceSystem, XPNConfigMapName)
+			}
 			// XPN: Raise an event on each ingress
 			for _, ing := range gceIngresses {
 				if annotations.FromIngress(ing).SuppressFirewallXPNError() {
 					continue
 				}
-				fwc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeNormal, "XPN", fwErr.Message)
+				fwc.ctx.Recorder(ing.Namespace).Eventf(ing, apiv1.EventTypeNormal, "XPN", message)
 			}
 		} else {
 			return err
 		}
+		return nil
 	}
+	fwc.resolveXPNError()
 	return nil
 }
 
+// Audit implements drift.Source.
+func (fwc *FirewallController) Audit() ([]drift.Drift, error) {
+	if !fwc.hasSynced() {
+		return nil, fmt.Errorf("waiting for stores to sync")
+	}
+	gceIngresses := fwc.gceIngresses()
+	if len(gceIngresses) == 0 {
+		return fwc.firewallPool.AuditUnused()
+	}
+	nodeNames, negPorts, additionalRanges, err := fwc.firewallParams(gceIngresses)
+	if err != nil {
+		return nil, err
+	}
+	return fwc.firewallPool.Audit(nodeNames, negPorts, additionalRanges)
+}
+
+// gceIngresses returns the Ingresses which need the firewall rule.
+func (fwc *FirewallController) gceIngresses() []*v1beta1.Ingress {
+	return operator.Ingresses(fwc.ctx.Ingresses().List()).Filter(func(ing *v1beta1.Ingress) bool {
+		return utils.IsGCEIngress(ing)
+	}).AsList()
+}
+
+// firewallParams returns the nodes, NEG endpoint ports and additional
+// source ranges of the firewall rule for the given Ingresses.
+func (fwc *FirewallController) firewallParams(gceIngresses []*v1beta1.Ingress) (nodeNames, negPorts, additionalRanges []string, err error) {
+	// gceSvcPorts contains the ServicePorts used by only single-cluster ingress.
+	gceSvcPorts := fwc.ToSvcPorts(gceIngresses)
+	nodeNames, err = utils.GetReadyNodeNames(listers.NewNodeLister(fwc.nodeLister))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	negPorts = fwc.translator.GatherEndpointPorts(gceSvcPorts)
+
+	if flags.F.EnableL7Ilb {
+		ilbRange, err := fwc.ilbFirewallSrcRange(gceIngresses)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		additionalRanges = append(additionalRanges, ilbRange)
+	}
+	return nodeNames, negPorts, additionalRanges, nil
+}
+
+// recordXPNError persists the firewall change required by fwErr if XPN
+// firewall tracking is enabled. Returns true if the change was not already
+// pending.
+func (fwc *FirewallController) recordXPNError(fwErr *FirewallXPNError) bool {
+	if fwc.xpnTracker == nil {
+		return true
+	}
+	changed, err := fwc.xpnTracker.record(fwErr)
+	if err != nil {
+		klog.Errorf("Failed to record pending XPN firewall change for %q: %v", fwErr.Name, err)
+		return true
+	}
+	return changed
+}
+
+// resolveXPNError clears any pending change for the cluster firewall rule,
+// since the rule has been observed to be in the desired state.
+func (fwc *FirewallController) resolveXPNError() {
+	if fwc.xpnTracker == nil {
+		return
+	}
+	name := fwc.ctx.ClusterNamer.FirewallRule()
+	if resolved, err := fwc.xpnTracker.resolve(name); err != nil {
+		klog.Errorf("Failed to clear pending XPN firewall change for %q: %v", name, err)
+	} else if resolved {
+		klog.Infof("Firewall change for %q was applied by the network admin", name)
+	}
+}
+
 func (fwc *FirewallController) ilbFirewallSrcRange(gceIngresses []*v1beta1.Ingress) (string, error) {
 	ilbEnabled := false
 	for _, ing := range gceIngresses {
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 
 	"k8s.io/klog"
 
@@ -28,6 +29,7 @@ import (
 	"k8s.io/legacy-cloud-providers/gce"
 	netset "k8s.io/utils/net"
 
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
@@ -45,6 +47,8 @@ type FirewallRules struct {
 	// TODO(rramkumar): Eliminate this variable. We should just pass in
 	// all the port ranges to open with each call to Sync()
 	portRanges []string
+	// lock serializes changes to the cluster firewall rule.
+	lock sync.Mutex
 }
 
 // NewFirewallPool creates a new firewall rule manager.
@@ -65,25 +69,101 @@ func NewFirewallPool(cloud Firewall, namer *utils.Namer, l7SrcRanges []string, n
 
 // Sync firewall rules with the cloud.
 func (fr *FirewallRules) Sync(nodeNames, additionalPorts, additionalRanges []string) error {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
 	klog.V(4).Infof("Sync(%v)", nodeNames)
 	name := fr.namer.FirewallRule()
 	existingFirewall, _ := fr.cloud.GetFirewall(name)
 
+	expectedFirewall, err := fr.expectedFirewall(nodeNames, additionalPorts, additionalRanges)
+	if err != nil {
+		return err
+	}
+
+	if existingFirewall == nil {
+		klog.V(3).Infof("Creating firewall rule %q", name)
+		return fr.createFirewall(expectedFirewall)
+	}
+
+	// Early return if an update is not required.
+	if equal(expectedFirewall, existingFirewall) {
+		klog.V(4).Info("Firewall does not need update of ports or source ranges")
+		return nil
+	}
+
+	klog.V(3).Infof("Updating firewall rule %q", name)
+	return fr.updateFirewall(expectedFirewall)
+}
+
+// Audit returns the difference between the firewall rule in GCE and the
+// one Sync would create for the given arguments. Without nodes, the target
+// tags of the rule are unknown, so it is not audited.
+func (fr *FirewallRules) Audit(nodeNames, additionalPorts, additionalRanges []string) ([]drift.Drift, error) {
+	if len(nodeNames) == 0 {
+		klog.V(3).Infof("No ready nodes, skipping audit of firewall rule %q", fr.namer.FirewallRule())
+		return nil, nil
+	}
+	name := fr.namer.FirewallRule()
+	existingFirewall, exists, err := fr.getFirewall(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []drift.Drift{{Kind: drift.KindFirewall, Name: name, Reason: drift.Missing}}, nil
+	}
+
+	expectedFirewall, err := fr.expectedFirewall(nodeNames, additionalPorts, additionalRanges)
+	if err != nil {
+		return nil, err
+	}
+	if fields := diff(expectedFirewall, existingFirewall); len(fields) > 0 {
+		return []drift.Drift{{Kind: drift.KindFirewall, Name: name, Reason: drift.Modified, Fields: fields}}, nil
+	}
+	return nil, nil
+}
+
+// AuditUnused returns the firewall rule as orphaned if it exists, for when
+// no Ingress needs it.
+func (fr *FirewallRules) AuditUnused() ([]drift.Drift, error) {
+	name := fr.namer.FirewallRule()
+	_, exists, err := fr.getFirewall(name)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return []drift.Drift{{Kind: drift.KindFirewall, Name: name, Reason: drift.Orphaned}}, nil
+}
+
+// getFirewall returns the firewall rule and whether it exists.
+func (fr *FirewallRules) getFirewall(name string) (*compute.Firewall, bool, error) {
+	fw, err := fr.cloud.GetFirewall(name)
+	if err != nil {
+		if utils.IsNotFoundError(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return fw, fw != nil, nil
+}
+
+// expectedFirewall returns the firewall rule for L7 traffic to the given
+// nodes.
+func (fr *FirewallRules) expectedFirewall(nodeNames, additionalPorts, additionalRanges []string) (*compute.Firewall, error) {
 	// Retrieve list of target tags from node names. This may be configured in
 	// gce.conf or computed by the GCE cloudprovider package.
 	targetTags, err := fr.cloud.GetNodeTags(nodeNames)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	sort.Strings(targetTags)
 
 	ports := sets.NewString(additionalPorts...)
-	fr.srcRanges = append(fr.srcRanges, additionalRanges...)
 	ports.Insert(fr.portRanges...)
-	expectedFirewall := &compute.Firewall{
-		Name:         name,
+	srcRanges := append(append([]string{}, fr.srcRanges...), additionalRanges...)
+	return &compute.Firewall{
+		Name:         fr.namer.FirewallRule(),
 		Description:  "GCE L7 firewall rule",
-		SourceRanges: fr.srcRanges,
+		SourceRanges: srcRanges,
 		Network:      fr.cloud.NetworkURL(),
 		Allowed: []*compute.FirewallAllowed{
 			{
@@ -92,25 +172,14 @@ func (fr *FirewallRules) Sync(nodeNames, additionalPorts, additionalRanges []str
 			},
 		},
 		TargetTags: targetTags,
-	}
-
-	if existingFirewall == nil {
-		klog.V(3).Infof("Creating firewall rule %q", name)
-		return fr.createFirewall(expectedFirewall)
-	}
-
-	// Early return if an update is not required.
-	if equal(expectedFirewall, existingFirewall) {
-		klog.V(4).Info("Firewall does not need update of ports or source ranges")
-		return nil
-	}
-
-	klog.V(3).Infof("Updating firewall rule %q", name)
-	return fr.updateFirewall(expectedFirewall)
+	}, nil
 }
 
 // GC deletes the firewall rule.
 func (fr *FirewallRules) GC() error {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
 	name := fr.namer.FirewallRule()
 	klog.V(3).Infof("Deleting firewall %q", name)
 	return fr.deleteFirewall(name)
@@ -128,7 +197,7 @@ func (fr *FirewallRules) createFirewall(f *compute.Firewall) error {
 	if utils.IsForbiddenError(err) && fr.cloud.OnXPN() {
 		gcloudCmd := gce.FirewallToGCloudCreateCmd(f, fr.cloud.NetworkProjectID())
 		klog.V(3).Infof("Could not create L7 firewall on XPN cluster: %v. Raising event for cmd: %q", err, gcloudCmd)
-		return newFirewallXPNError(err, gcloudCmd)
+		return newFirewallXPNError(err, f.Name, gcloudCmd)
 	}
 	return err
 }
@@ -138,7 +207,7 @@ func (fr *FirewallRules) updateFirewall(f *compute.Firewall) error {
 	if utils.IsForbiddenError(err) && fr.cloud.OnXPN() {
 		gcloudCmd := gce.FirewallToGCloudUpdateCmd(f, fr.cloud.NetworkProjectID())
 		klog.V(3).Infof("Could not update L7 firewall on XPN cluster: %v. Raising event for cmd: %q", err, gcloudCmd)
-		return newFirewallXPNError(err, gcloudCmd)
+		return newFirewallXPNError(err, f.Name, gcloudCmd)
 	}
 	return err
 }
@@ -151,21 +220,29 @@ func (fr *FirewallRules) deleteFirewall(name string) error {
 	} else if utils.IsForbiddenError(err) && fr.cloud.OnXPN() {
 		gcloudCmd := gce.FirewallToGCloudDeleteCmd(name, fr.cloud.NetworkProjectID())
 		klog.V(3).Infof("Could not attempt delete of L7 firewall on XPN cluster: %v. %q needs to be ran.", err, gcloudCmd)
-		return newFirewallXPNError(err, gcloudCmd)
+		return newFirewallXPNError(err, name, gcloudCmd)
 	}
 	return err
 }
 
-func newFirewallXPNError(internal error, cmd string) *FirewallXPNError {
+func newFirewallXPNError(internal error, name, cmd string) *FirewallXPNError {
 	return &FirewallXPNError{
 		Internal: internal,
+		Name:     name,
+		Command:  cmd,
 		Message:  fmt.Sprintf("Firewall change required by network admin: `%v`", cmd),
 	}
 }
 
+// FirewallXPNError is returned when a firewall change could not be applied
+// because the controller lacks permissions in the XPN host project.
 type FirewallXPNError struct {
 	Internal error
-	Message  string
+	// Name is the name of the firewall rule which needs to be changed.
+	Name string
+	// Command is the gcloud command the network admin needs to run.
+	Command string
+	Message string
 }
 
 func (f *FirewallXPNError) Error() string {
@@ -173,25 +250,32 @@ func (f *FirewallXPNError) Error() string {
 }
 
 func equal(expected *compute.Firewall, existing *compute.Firewall) bool {
+	return len(diff(expected, existing)) == 0
+}
+
+// diff returns the fields of the existing firewall rule which differ from the
+// expected one.
+func diff(expected *compute.Firewall, existing *compute.Firewall) []string {
+	var fields []string
 	if !sets.NewString(expected.TargetTags...).Equal(sets.NewString(existing.TargetTags...)) {
 		klog.V(5).Infof("Expected target tags %v, actually %v", expected.TargetTags, existing.TargetTags)
-		return false
+		fields = append(fields, "targetTags")
 	}
 
 	expectedAllowed := allowedToStrings(expected.Allowed)
 	existingAllowed := allowedToStrings(existing.Allowed)
 	if !sets.NewString(expectedAllowed...).Equal(sets.NewString(existingAllowed...)) {
 		klog.V(5).Infof("Expected allowed rules %v, actually %v", expectedAllowed, existingAllowed)
-		return false
+		fields = append(fields, "allowed")
 	}
 
 	if !sets.NewString(expected.SourceRanges...).Equal(sets.NewString(existing.SourceRanges...)) {
 		klog.V(5).Infof("Expected source ranges %v, actually %v", expected.SourceRanges, existing.SourceRanges)
-		return false
+		fields = append(fields, "sourceRanges")
 	}
 
 	// Ignore other firewall properties as the controller does not set them.
-	return true
+	return fields
 }
 
 func allowedToStrings(allowed []*compute.FirewallAllowed) []string {
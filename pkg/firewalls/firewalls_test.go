@@ -17,11 +17,13 @@ limitations under the License.
 package firewalls
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
 	compute "google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/utils"
 )
 
@@ -92,6 +94,24 @@ func TestFirewallPoolSyncSrcRanges(t *testing.T) {
 	verifyFirewallRule(fwp, ruleName, nodes, srcRanges, portRanges(), t)
 }
 
+func TestFirewallPoolSyncAdditionalRanges(t *testing.T) {
+	fwp := NewFakeFirewallsProvider(false, false)
+	fp := NewFirewallPool(fwp, namer, srcRanges, portRanges())
+	nodes := []string{"node-a", "node-b", "node-c"}
+
+	additionalRanges := []string{"3.3.3.3/32"}
+	if err := fp.Sync(nodes, nil, additionalRanges); err != nil {
+		t.Fatal(err)
+	}
+	verifyFirewallRule(fwp, ruleName, nodes, append(append([]string{}, srcRanges...), additionalRanges...), portRanges(), t)
+
+	// Additional ranges which are no longer needed are removed.
+	if err := fp.Sync(nodes, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	verifyFirewallRule(fwp, ruleName, nodes, srcRanges, portRanges(), t)
+}
+
 func TestFirewallPoolSyncPorts(t *testing.T) {
 	fwp := NewFakeFirewallsProvider(false, false)
 	fp := NewFirewallPool(fwp, namer, srcRanges, portRanges())
@@ -178,6 +198,79 @@ func TestFirewallPoolGC(t *testing.T) {
 	}
 }
 
+func TestFirewallPoolAudit(t *testing.T) {
+	fwp := NewFakeFirewallsProvider(false, false)
+	fp := NewFirewallPool(fwp, namer, srcRanges, portRanges())
+	nodes := []string{"node-a", "node-b", "node-c"}
+
+	drifts, err := fp.Audit(nodes, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []drift.Drift{{Kind: drift.KindFirewall, Name: ruleName, Reason: drift.Missing}}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("fp.Audit() = %+v, want %+v", drifts, want)
+	}
+
+	if err := fp.Sync(nodes, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	drifts, err = fp.Audit(nodes, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("fp.Audit() = %+v, want no drift", drifts)
+	}
+
+	// Open another source range by hand.
+	fw, err := fwp.GetFirewall(ruleName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.SourceRanges = append(fw.SourceRanges, "0.0.0.0/0")
+	if err := fwp.UpdateFirewall(fw); err != nil {
+		t.Fatal(err)
+	}
+	drifts, err = fp.Audit(nodes, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []drift.Drift{{Kind: drift.KindFirewall, Name: ruleName, Reason: drift.Modified, Fields: []string{"sourceRanges"}}}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("fp.Audit() = %+v, want %+v", drifts, want)
+	}
+
+	// The firewall rule is not audited without ready nodes.
+	drifts, err = fp.Audit(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("fp.Audit() = %+v, want no drift", drifts)
+	}
+
+	// The firewall rule is orphaned if no Ingress needs it.
+	drifts, err = fp.AuditUnused()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []drift.Drift{{Kind: drift.KindFirewall, Name: ruleName, Reason: drift.Orphaned}}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("fp.AuditUnused() = %+v, want %+v", drifts, want)
+	}
+	if err := fp.GC(); err != nil {
+		t.Fatal(err)
+	}
+	drifts, err = fp.AuditUnused()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("fp.AuditUnused() = %+v, want no drift", drifts)
+	}
+}
+
 // TestSyncOnXPNWithPermission tests that firwall sync continues to work when OnXPN=true
 func TestSyncOnXPNWithPermission(t *testing.T) {
 	// Fake XPN cluster with permission
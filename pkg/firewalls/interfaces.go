@@ -18,6 +18,7 @@ package firewalls
 
 import (
 	compute "google.golang.org/api/compute/v1"
+	"k8s.io/ingress-gce/pkg/drift"
 )
 
 // SingleFirewallPool syncs the firewall rule for L7 traffic.
@@ -25,6 +26,12 @@ type SingleFirewallPool interface {
 	// Sync syncs firewall rules with the cloud
 	Sync(nodeNames, additionalPorts, additionalRanges []string) error
 	GC() error
+	// Audit returns the difference between the firewall rule in GCE and
+	// the one Sync would create. The rule is not audited without nodes.
+	Audit(nodeNames, additionalPorts, additionalRanges []string) ([]drift.Drift, error)
+	// AuditUnused returns the firewall rule as orphaned if it exists, for
+	// when no Ingress needs it.
+	AuditUnused() ([]drift.Drift, error)
 }
 
 // Firewall interfaces with the GCE firewall api.
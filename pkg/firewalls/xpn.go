@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalls
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"k8s.io/ingress-gce/pkg/storage"
+)
+
+const (
+	// XPNConfigMapName is the name of the config map in kube-system which
+	// tracks firewall changes that must be applied by the network admin.
+	XPNConfigMapName = "ingress-gce-xpn-firewall"
+	// XPNScriptKey is the config map key holding the consolidated script of
+	// all pending firewall changes of this cluster. Other clusters sharing the
+	// XPN host project maintain their own script in their own config map.
+	XPNScriptKey = "remediation.sh"
+)
+
+// pendingFirewallChange is a firewall change which could not be applied by
+// the controller on an XPN cluster.
+type pendingFirewallChange struct {
+	Command string `json:"command"`
+	// Since is when the change was first recorded.
+	Since time.Time `json:"since"`
+}
+
+// xpnTracker persists pending XPN firewall changes in a config map so that
+// they survive controller restarts and can be collected by the network admin.
+type xpnTracker struct {
+	vault *storage.ConfigMapVault
+}
+
+func newXPNTracker(vault *storage.ConfigMapVault) *xpnTracker {
+	return &xpnTracker{vault: vault}
+}
+
+// record stores the firewall change required by fwErr. Returns true if the
+// set of pending changes was modified.
+func (t *xpnTracker) record(fwErr *FirewallXPNError) (bool, error) {
+	existing, err := t.get(fwErr.Name)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil && existing.Command == fwErr.Command {
+		return false, nil
+	}
+
+	change := pendingFirewallChange{Command: fwErr.Command, Since: time.Now().UTC()}
+	data, err := json.Marshal(change)
+	if err != nil {
+		return false, err
+	}
+	if err := t.vault.Put(fwErr.Name, string(data)); err != nil {
+		return false, err
+	}
+	klog.V(2).Infof("Recorded pending XPN firewall change for %q: %q", fwErr.Name, fwErr.Command)
+	return true, t.updateScript()
+}
+
+// resolve removes the pending change for the given firewall rule, if any.
+// It should be called once the rule is observed to be in the desired state.
+// Returns true if a pending change was removed.
+func (t *xpnTracker) resolve(name string) (bool, error) {
+	existing, err := t.get(name)
+	if err != nil || existing == nil {
+		return false, err
+	}
+	if err := t.vault.Remove(name); err != nil {
+		return false, err
+	}
+	klog.V(2).Infof("Pending XPN firewall change for %q has been applied (pending since %v)", name, existing.Since)
+	return true, t.updateScript()
+}
+
+// pending returns all pending firewall changes keyed by firewall rule name.
+func (t *xpnTracker) pending() (map[string]*pendingFirewallChange, error) {
+	all, err := t.vault.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[string]*pendingFirewallChange)
+	for name, val := range all {
+		if name == XPNScriptKey {
+			continue
+		}
+		change := &pendingFirewallChange{}
+		if err := json.Unmarshal([]byte(val), change); err != nil {
+			klog.Warningf("Ignoring malformed pending XPN firewall change for %q: %v", name, err)
+			continue
+		}
+		changes[name] = change
+	}
+	return changes, nil
+}
+
+// script returns a ready-to-run shell script which applies every pending
+// firewall change.
+func (t *xpnTracker) script() (string, error) {
+	changes, err := t.pending()
+	if err != nil {
+		return "", err
+	}
+	return xpnScript(changes), nil
+}
+
+func (t *xpnTracker) get(name string) (*pendingFirewallChange, error) {
+	val, found, err := t.vault.Get(name)
+	if err != nil || !found {
+		return nil, err
+	}
+	change := &pendingFirewallChange{}
+	if err := json.Unmarshal([]byte(val), change); err != nil {
+		klog.Warningf("Ignoring malformed pending XPN firewall change for %q: %v", name, err)
+		return nil, nil
+	}
+	return change, nil
+}
+
+func (t *xpnTracker) updateScript() error {
+	changes, err := t.pending()
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return t.vault.Remove(XPNScriptKey)
+	}
+	return t.vault.Put(XPNScriptKey, xpnScript(changes))
+}
+
+// xpnScript renders the pending changes as a shell script. The output is
+// sorted by firewall name so that it only changes when the pending set does.
+// Only the changes of this cluster are pending in its config map, so the
+// network admin runs the script of every cluster of the host project.
+func xpnScript(changes map[string]*pendingFirewallChange) string {
+	var names []string
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# Firewall changes required by the GCE Ingress controller of this cluster.\n")
+	b.WriteString("# Other clusters sharing the XPN host project have their own script.\n")
+	b.WriteString("# Run this script with credentials for the XPN host project.\n")
+	b.WriteString("set -e\n")
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("\n# %v (pending since %v)\n", name, changes[name].Since.Format(time.RFC3339)))
+		b.WriteString(changes[name].Command + "\n")
+	}
+	return b.String()
+}
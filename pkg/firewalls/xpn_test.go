@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package firewalls
+
+import (
+	"strings"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-gce/pkg/storage"
+)
+
+func TestXPNTrackerRecordAndResolve(t *testing.T) {
+	fwp := NewFakeFirewallsProvider(true, true)
+	fp := NewFirewallPool(fwp, namer, srcRanges, portRanges())
+	tracker := newXPNTracker(storage.NewFakeConfigMapVault(metav1.NamespaceSystem, XPNConfigMapName))
+	nodes := []string{"node-a", "node-b", "node-c"}
+
+	err := fp.Sync(nodes, nil, nil)
+	fwErr, ok := err.(*FirewallXPNError)
+	if !ok {
+		t.Fatalf("fp.Sync() = %v, want *FirewallXPNError", err)
+	}
+	if fwErr.Name != ruleName {
+		t.Errorf("fwErr.Name = %q, want %q", fwErr.Name, ruleName)
+	}
+
+	changed, err := tracker.record(fwErr)
+	if err != nil || !changed {
+		t.Fatalf("tracker.record() = %v, %v, want true, nil", changed, err)
+	}
+	// Recording the same change twice does not modify the pending set.
+	changed, err = tracker.record(fwErr)
+	if err != nil || changed {
+		t.Errorf("tracker.record() = %v, %v, want false, nil", changed, err)
+	}
+
+	script, err := tracker.script()
+	if err != nil {
+		t.Fatalf("tracker.script() = _, %v, want nil", err)
+	}
+	if !strings.Contains(script, fwErr.Command) {
+		t.Errorf("tracker.script() = %q, want it to contain %q", script, fwErr.Command)
+	}
+	stored, found, err := tracker.vault.Get(XPNScriptKey)
+	if err != nil || !found || stored != script {
+		t.Errorf("vault.Get(%q) = %q, %v, %v, want %q, true, nil", XPNScriptKey, stored, found, err, script)
+	}
+
+	// Network admin applies the change.
+	if err := fwp.doCreateFirewall(&compute.Firewall{
+		Name:         ruleName,
+		SourceRanges: srcRanges,
+		Network:      fwp.NetworkURL(),
+		Allowed:      []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: portRanges()}},
+		TargetTags:   nodes,
+	}); err != nil {
+		t.Fatalf("doCreateFirewall() = %v, want nil", err)
+	}
+	if err := fp.Sync(nodes, nil, nil); err != nil {
+		t.Fatalf("fp.Sync() = %v, want nil", err)
+	}
+
+	resolved, err := tracker.resolve(ruleName)
+	if err != nil || !resolved {
+		t.Errorf("tracker.resolve(%q) = %v, %v, want true, nil", ruleName, resolved, err)
+	}
+	pending, err := tracker.pending()
+	if err != nil || len(pending) != 0 {
+		t.Errorf("tracker.pending() = %v, %v, want empty, nil", pending, err)
+	}
+	if _, found, _ := tracker.vault.Get(XPNScriptKey); found {
+		t.Errorf("Found key %q but expected none after all changes were resolved", XPNScriptKey)
+	}
+
+	// Resolving again is a no-op.
+	resolved, err = tracker.resolve(ruleName)
+	if err != nil || resolved {
+		t.Errorf("tracker.resolve(%q) = %v, %v, want false, nil", ruleName, resolved, err)
+	}
+}
+
+func TestXPNScriptConsolidatesChanges(t *testing.T) {
+	tracker := newXPNTracker(storage.NewFakeConfigMapVault(metav1.NamespaceSystem, XPNConfigMapName))
+	for _, fwErr := range []*FirewallXPNError{
+		newFirewallXPNError(nil, "fw-b", "gcloud compute firewall-rules update fw-b"),
+		newFirewallXPNError(nil, "fw-a", "gcloud compute firewall-rules create fw-a"),
+	} {
+		if _, err := tracker.record(fwErr); err != nil {
+			t.Fatalf("tracker.record(%v) = %v, want nil", fwErr.Name, err)
+		}
+	}
+
+	script, err := tracker.script()
+	if err != nil {
+		t.Fatalf("tracker.script() = _, %v, want nil", err)
+	}
+	a := strings.Index(script, "create fw-a")
+	b := strings.Index(script, "update fw-b")
+	if a < 0 || b < 0 || a > b {
+		t.Errorf("tracker.script() = %q, want both commands sorted by firewall name", script)
+	}
+}
@@ -70,23 +70,42 @@ var (
 		EnableFrontendConfig        bool
 		GCERateLimit                RateLimitSpecs
 		GCEOperationPollInterval    time.Duration
+		GCEAdaptiveRateLimit        bool
+		GCEAdaptiveRateLimitQPS     float64
+		GCEAdaptiveRateLimitBurst   int
 		HealthCheckPath             string
 		HealthzPort                 int
 		InCluster                   bool
 		IngressClass                string
 		KubeConfigFile              string
 		ResyncPeriod                time.Duration
+		GCPeriod                    time.Duration
+		DriftAuditPeriod            time.Duration
 		Version                     bool
 		WatchNamespace              string
 		NodePortRanges              PortRanges
 		NegGCPeriod                 time.Duration
 		NegSyncerType               string
+		NegOperationZoneConcurrency int
 		EnableReadinessReflector    bool
+		EnableNegDrainCondition     bool
+		NegCheckpointConfigMap      string
+		EnableNegCrd                bool
+		HybridNegZone               string
+		NegShards                   int
+		NegGCDryRun                 bool
+		NegGCMinAge                 time.Duration
 		FinalizerAdd                bool
 		FinalizerRemove             bool
 		EnableL7Ilb                 bool
 		EnableCSM                   bool
+		EnableEndpointSlices        bool
 		CSMServiceNEGSkipNamespaces []string
+		EnableXPNFirewallTracking   bool
+		XPNFirewallScript           bool
+		NumIngressWorkers           int
+		NumNodeWorkers              int
+		NumFirewallWorkers          int
 
 		LeaderElection LeaderElectionConfiguration
 	}{}
@@ -168,6 +187,17 @@ If you want to still use the default, simply specify it along with your other
 values.`)
 	flag.DurationVar(&F.GCEOperationPollInterval, "gce-operation-poll-interval", time.Second,
 		`Minimum time between polling requests to GCE for checking the status of an operation.`)
+	flag.BoolVar(&F.GCEAdaptiveRateLimit, "gce-adaptive-ratelimit", false,
+		`Optional, if enabled, GCE API calls are rate limited adaptively. The rate of
+a call, and the budget shared by all calls, is backed off when GCE returns a
+rate limit or quota error for it and recovers gradually once the errors stop.
+The rates given by --gce-ratelimit are used as the rates the calls recover to.`)
+	flag.Float64Var(&F.GCEAdaptiveRateLimitQPS, "gce-adaptive-ratelimit-qps", 20,
+		`Maximum qps of the GCE API calls of the controller, shared by all calls,
+if --gce-adaptive-ratelimit is enabled.`)
+	flag.IntVar(&F.GCEAdaptiveRateLimitBurst, "gce-adaptive-ratelimit-burst", 40,
+		`Burst of the GCE API calls of the controller, shared by all calls, if
+--gce-adaptive-ratelimit is enabled.`)
 	flag.StringVar(&F.HealthCheckPath, "health-check-path", "/",
 		`Path used to health-check a backend service. All Services must serve a
 200 page on this path. Currently this is only configurable globally.`)
@@ -180,6 +210,11 @@ the pod secrets for creating a Kubernetes client.`)
 		`Path to kubeconfig file with authorization and master location information.`)
 	flag.DurationVar(&F.ResyncPeriod, "sync-period", 30*time.Second,
 		`Relist and confirm cloud resources this often.`)
+	flag.DurationVar(&F.GCPeriod, "gc-period", 120*time.Second,
+		`Relist and garbage collect load balancer resources of all Ingresses this often.`)
+	flag.DurationVar(&F.DriftAuditPeriod, "drift-audit-period", 0,
+		`If set, compare load balancer resources in GCE with the expected state this often and
+report differences at /debug/drift. Disabled by default.`)
 	flag.StringVar(&F.WatchNamespace, "watch-namespace", v1.NamespaceAll,
 		`Namespace to watch for Ingress/Services/Endpoints.`)
 	flag.BoolVar(&F.Version, "version", false,
@@ -195,7 +230,40 @@ L7 load balancing. CSV values accepted. Example: -node-port-ranges=80,8080,400-5
 	flag.DurationVar(&F.NegGCPeriod, "neg-gc-period", 120*time.Second,
 		`Relist and garbage collect NEGs this often.`)
 	flag.StringVar(&F.NegSyncerType, "neg-syncer-type", "transaction", "Define the NEG syncer type to use. Valid values are \"batch\" and \"transaction\"")
+	flag.IntVar(&F.NegOperationZoneConcurrency, "neg-operation-zone-concurrency", 0,
+		`If set, the maximum number of NEG attach and detach calls running at the same
+time in a zone. Calls for the same NEG which are waiting are coalesced, and detaches
+run before attaches. Disabled by default, so the calls of each syncer run independently.`)
 	flag.BoolVar(&F.EnableReadinessReflector, "enable-readiness-reflector", true, "Enable NEG Readiness Reflector")
+	flag.BoolVar(&F.EnableNegDrainCondition, "enable-neg-drain-condition", false,
+		`Set the "cloud.google.com/load-balancer-neg-drained" condition on terminating
+pods once they were detached from their NEGs and the connection draining timeout
+of their BackendConfig has passed. Requires the NEG Readiness Reflector.`)
+	flag.StringVar(&F.NegCheckpointConfigMap, "neg-checkpoint-configmap", "",
+		`Name of the ConfigMap in kube-system where NEG syncers checkpoint the endpoints
+and in-flight transactions of their NEGs, so that they do not need to list every
+zone after a restart. A ConfigMap is limited to 1MB, so checkpoints larger than
+128KB or which do not fit in the ConfigMap are not stored, and those NEGs are
+listed as usual. If empty, checkpoints are disabled.`)
+	flag.BoolVar(&F.EnableNegCrd, "enable-neg-crd", false,
+		`Optional, if enabled, the NEG controller reports the status of every NEG in a
+ServiceNetworkEndpointGroup resource owned by its service.`)
+	flag.StringVar(&F.HybridNegZone, "hybrid-neg-zone", "",
+		`Optional, if set, NEGs of services without selector are NON_GCP_PRIVATE_IP_PORT
+NEGs in this zone, whose endpoints are taken from the hand-managed Endpoints of the
+services. This lets an Ingress front endpoints outside of GCP reachable over hybrid
+connectivity.`)
+	flag.IntVar(&F.NegShards, "neg-shards", 0,
+		`Optional, if positive, services are spread among this many shards, and the NEG
+controller runs in every replica, each syncing the NEGs of the shards it holds a Lease
+of in the lock object namespace. Leases use the leader election durations. If 0, the
+NEG controller only runs in the leader.`)
+	flag.BoolVar(&F.NegGCDryRun, "neg-gc-dry-run", false,
+		`Optional, if enabled, the NEG garbage collector only reports the orphan NEGs it
+would delete on /debug/neg-orphans, without deleting them.`)
+	flag.DurationVar(&F.NegGCMinAge, "neg-gc-min-age", 0,
+		`Optional, the minimum age of orphan NEGs deleted by the NEG garbage collector.
+Younger orphan NEGs are kept, so are NEGs still used by a backend service.`)
 	flag.BoolVar(&F.FinalizerAdd, "enable-finalizer-add",
 		F.FinalizerAdd, "Enable adding Finalizer to Ingress.")
 	flag.BoolVar(&F.FinalizerRemove, "enable-finalizer-remove",
@@ -203,7 +271,27 @@ L7 load balancing. CSV values accepted. Example: -node-port-ranges=80,8080,400-5
 	flag.BoolVar(&F.EnableL7Ilb, "enable-l7-ilb", false,
 		`Optional, whether or not to enable L7-ILB.`)
 	flag.BoolVar(&F.EnableCSM, "enable-csm", false, "Enable CSM(Istio) support")
+	flag.BoolVar(&F.EnableEndpointSlices, "enable-endpoint-slices", false,
+		`Optional, if enabled, NEG syncers read the endpoints of services from
+EndpointSlices instead of Endpoints, if the API server serves them.`)
 	flag.StringSliceVar(&F.CSMServiceNEGSkipNamespaces, "csm-service-skip-namespaces", []string{}, "Only for CSM mode, skip the NEG creation for Services in the given namespaces.")
+	flag.BoolVar(&F.EnableXPNFirewallTracking, "enable-xpn-firewall-tracking", false,
+		`Optional, on XPN clusters record firewall changes which must be applied
+by the network admin in the kube-system/ingress-gce-xpn-firewall ConfigMap and
+clear them once they are observed to be applied.`)
+	flag.BoolVar(&F.XPNFirewallScript, "xpn-firewall-script", false,
+		`Optional, requires --enable-xpn-firewall-tracking. Instead of raising an
+event on every sync, maintain a consolidated script of all pending firewall
+changes in the XPN ConfigMap and only raise events when it changes. The script
+only covers the changes of this cluster, every cluster sharing the XPN host
+project maintains its own script in its own ConfigMap.`)
+	flag.IntVar(&F.NumIngressWorkers, "ingress-sync-workers", 1,
+		`Number of workers syncing Ingresses in parallel. A given Ingress is only
+synced by one worker at a time.`)
+	flag.IntVar(&F.NumNodeWorkers, "node-sync-workers", 1,
+		`Number of workers syncing nodes to the instance groups in parallel.`)
+	flag.IntVar(&F.NumFirewallWorkers, "firewall-sync-workers", 1,
+		`Number of workers syncing the cluster firewall rule in parallel.`)
 }
 
 type RateLimitSpecs struct {
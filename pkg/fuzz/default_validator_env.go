@@ -17,6 +17,9 @@ limitations under the License.
 package fuzz
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -89,3 +92,22 @@ func (e *DefaultValidatorEnv) Cloud() cloud.Cloud {
 func (e *DefaultValidatorEnv) Namer() *utils.Namer {
 	return e.namer
 }
+
+// Region implements ValidatorEnv. The region is taken from the labels of the
+// cluster nodes.
+func (e *DefaultValidatorEnv) Region() (string, error) {
+	nl, err := e.k8s.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, n := range nl.Items {
+		if region := n.Labels[v1.LabelZoneRegion]; region != "" {
+			return region, nil
+		}
+		// Zones are named <region>-<letter>.
+		if zone := n.Labels[v1.LabelZoneFailureDomain]; strings.Contains(zone, "-") {
+			return zone[:strings.LastIndex(zone, "-")], nil
+		}
+	}
+	return "", fmt.Errorf("no node in the cluster has a region or zone label")
+}
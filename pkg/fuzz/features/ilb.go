@@ -17,9 +17,17 @@ limitations under the License.
 package features
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/api/networking/v1beta1"
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/fuzz"
-	"net/http"
+	"k8s.io/ingress-gce/pkg/utils"
 )
 
 // ILB is an internal load balancer
@@ -38,7 +46,7 @@ func (*ILBFeature) Name() string {
 	return "ILB"
 }
 
-// ILBValidator is an example validator.
+// ILBValidator validates the forwarding rule of an L7-ILB.
 type ILBValidator struct {
 	fuzz.NullValidator
 
@@ -60,6 +68,52 @@ func (v *ILBValidator) ConfigureAttributes(env fuzz.ValidatorEnv, ing *v1beta1.I
 }
 
 // CheckResponse implements fuzz.FeatureValidator.
+// Check that the forwarding rule uses the requested subnet, ip and global
+// access.
 func (v *ILBValidator) CheckResponse(host, path string, resp *http.Response, body []byte) (fuzz.CheckResponseAction, error) {
+	if !utils.IsGCEL7ILBIngress(v.ing) {
+		return fuzz.CheckResponseContinue, nil
+	}
+	anno := annotations.FromIngress(v.ing)
+	subnet, ip, globalAccess := anno.ILBSubnet(), anno.ILBIP(), anno.ILBAllowGlobalAccess()
+	if subnet == "" && ip == "" && !globalAccess {
+		return fuzz.CheckResponseContinue, nil
+	}
+
+	// The L7-ILB lives in the region of the cluster unless the subnet
+	// annotation says otherwise.
+	var region string
+	if id, err := cloud.ParseResourceURL(subnet); err == nil && id.Key.Region != "" {
+		region = id.Key.Region
+	} else if region, err = v.env.Region(); err != nil {
+		return fuzz.CheckResponseContinue, fmt.Errorf("error getting the cluster region: %v", err)
+	}
+	key, err := utils.KeyFunc(v.ing)
+	if err != nil {
+		return fuzz.CheckResponseContinue, err
+	}
+	protocol := utils.HTTPProtocol
+	if !anno.AllowHTTP() {
+		protocol = utils.HTTPSProtocol
+	}
+	frName := v.env.Namer().ForwardingRule(v.env.Namer().LoadBalancer(key), protocol)
+	fr, err := v.env.Cloud().BetaForwardingRules().Get(context.Background(), meta.RegionalKey(frName, region))
+	if err != nil {
+		return fuzz.CheckResponseContinue, fmt.Errorf("error getting forwarding rule %s: %v", frName, err)
+	}
+
+	if subnet != "" {
+		// The annotation is either a subnet name or URL.
+		if strings.Contains(subnet, "/") && !utils.EqualResourceIDs(fr.Subnetwork, subnet) ||
+			!strings.Contains(subnet, "/") && !strings.HasSuffix(fr.Subnetwork, "/subnetworks/"+subnet) {
+			return fuzz.CheckResponseContinue, fmt.Errorf("forwarding rule %s has subnet %q, want %q", frName, fr.Subnetwork, subnet)
+		}
+	}
+	if ip != "" && fr.IPAddress != ip {
+		return fuzz.CheckResponseContinue, fmt.Errorf("forwarding rule %s has IP %q, want %q", frName, fr.IPAddress, ip)
+	}
+	if fr.AllowGlobalAccess != globalAccess {
+		return fuzz.CheckResponseContinue, fmt.Errorf("forwarding rule %s has global access %v, want %v", frName, fr.AllowGlobalAccess, globalAccess)
+	}
 	return fuzz.CheckResponseContinue, nil
 }
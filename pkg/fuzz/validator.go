@@ -43,6 +43,7 @@ type ValidatorEnv interface {
 	Services() (map[string]*v1.Service, error)
 	Cloud() cloud.Cloud
 	Namer() *utils.Namer
+	Region() (string, error)
 }
 
 // MockValidatorEnv is an environment that is used for mock testing.
@@ -51,6 +52,7 @@ type MockValidatorEnv struct {
 	ServicesMap       map[string]*v1.Service
 	MockCloud         *cloud.MockGCE
 	IngressNamer      *utils.Namer
+	ClusterRegion     string
 }
 
 // BackendConfigs implements ValidatorEnv.
@@ -73,6 +75,11 @@ func (e *MockValidatorEnv) Namer() *utils.Namer {
 	return e.IngressNamer
 }
 
+// Region implements ValidatorEnv.
+func (e *MockValidatorEnv) Region() (string, error) {
+	return e.ClusterRegion, nil
+}
+
 // IngressValidatorAttributes are derived attributes governing how the Ingress
 // is validated. Features will use this structure to express changes to the
 // standard checks by modifying this struct.
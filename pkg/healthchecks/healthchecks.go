@@ -113,14 +113,7 @@ func (h *HealthChecks) New(sp utils.ServicePort) *HealthCheck {
 // Sync retrieves a health check based on port, checks type and settings and updates/creates if necessary.
 // Sync is only called by the backends.Add func - it's not a pool like other resources.
 func (h *HealthChecks) Sync(hc *HealthCheck) (string, error) {
-	var scope meta.KeyType
-	// TODO(shance): find a way to remove this
-	if hc.forILB {
-		scope = meta.Regional
-	} else {
-		scope = meta.Global
-	}
-
+	scope := hc.scope()
 	existingHC, err := h.Get(hc.Name, hc.Version(), scope)
 	if err != nil {
 		if !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
@@ -151,6 +144,30 @@ func (h *HealthChecks) Sync(hc *HealthCheck) (string, error) {
 	return existingHC.SelfLink, nil
 }
 
+// Audit implements HealthChecker.
+func (h *HealthChecks) Audit(hc *HealthCheck) (bool, []string, error) {
+	existingHC, err := h.Get(hc.Name, hc.Version(), hc.scope())
+	if err != nil {
+		if utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+
+	var fields []string
+	if existingHC.Protocol() != hc.Protocol() {
+		fields = append(fields, "type")
+	}
+	if existingHC.PortSpecification != hc.PortSpecification {
+		fields = append(fields, "portSpecification")
+	}
+	// Unlike Sync, report a hand modified request path.
+	if existingHC.RequestPath != hc.RequestPath {
+		fields = append(fields, "requestPath")
+	}
+	return true, fields, nil
+}
+
 // TODO(shance): merge with existing hc code
 func (h *HealthChecks) createILB(hc *HealthCheck) error {
 	cloud := h.cloud.(*gce.Cloud)
@@ -570,6 +587,15 @@ func (hc *HealthCheck) Version() meta.Version {
 	return meta.VersionGA
 }
 
+// scope returns the scope of the health check.
+// TODO(shance): find a way to remove this
+func (hc *HealthCheck) scope() meta.KeyType {
+	if hc.forILB {
+		return meta.Regional
+	}
+	return meta.Global
+}
+
 func needToUpdate(old, new *HealthCheck) bool {
 	if old.Protocol() != new.Protocol() {
 		klog.V(2).Infof("Updating health check %v because it has protocol %v but need %v", old.Name, old.Type, new.Type)
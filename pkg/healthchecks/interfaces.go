@@ -51,4 +51,7 @@ type HealthChecker interface {
 	Sync(hc *HealthCheck) (string, error)
 	Delete(name string, scope meta.KeyType) error
 	Get(name string, version meta.Version, scope meta.KeyType) (*HealthCheck, error)
+	// Audit returns the settings in which the existing health check differs
+	// from hc. exists is false if the health check does not exist.
+	Audit(hc *HealthCheck) (exists bool, fields []string, err error)
 }
@@ -19,6 +19,7 @@ package instances
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"k8s.io/klog"
 
@@ -38,6 +39,9 @@ type Instances struct {
 	cloud InstanceGroups
 	ZoneLister
 	namer *utils.Namer
+	// lock serializes changes to the instance groups, which are shared by
+	// all Ingresses and synced by multiple workers.
+	lock sync.Mutex
 }
 
 // NewNodePool creates a new node pool.
@@ -61,6 +65,9 @@ func (i *Instances) Init(zl ZoneLister) {
 // and adds the given ports to it. Returns a list of one instance group per zone,
 // all of which have the exact same named ports.
 func (i *Instances) EnsureInstanceGroupsAndPorts(name string, ports []int64) (igs []*compute.InstanceGroup, err error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
 	zones, err := i.ListZones()
 	if err != nil {
 		return nil, err
@@ -139,6 +146,9 @@ func (i *Instances) ensureInstanceGroupAndPorts(name, zone string, ports []int64
 
 // DeleteInstanceGroup deletes the given IG by name, from all zones.
 func (i *Instances) DeleteInstanceGroup(name string) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
 	errs := []error{}
 
 	zones, err := i.ListZones()
@@ -278,6 +288,9 @@ func (i *Instances) Remove(groupName string, names []string) error {
 
 // Sync syncs kubernetes instances with the instances in the instance group.
 func (i *Instances) Sync(nodes []string) (err error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
 	klog.V(4).Infof("Syncing nodes %v", nodes)
 
 	defer func() {
@@ -17,14 +17,44 @@ limitations under the License.
 package loadbalancers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"google.golang.org/api/compute/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
 
+const (
+	// StaticIPConfigMapName is the name of the config map in kube-system
+	// which records the static ips owned by the controller.
+	StaticIPConfigMapName = "ingress-gce-static-ips"
+)
+
+// ManagedStaticIP describes a static ip reserved and owned by the controller
+// for a single Ingress.
+type ManagedStaticIP struct {
+	// ImportName is the name of an existing address to take ownership of.
+	// If empty, the controller names the address.
+	ImportName string
+	// Retain keeps the address when the Ingress is deleted.
+	Retain bool
+}
+
+// staticIPRecord is the persisted ownership record of a controller owned
+// static ip. It is keyed by the load balancer name so that it outlives
+// the Ingress it was created for.
+type staticIPRecord struct {
+	Name string `json:"name"`
+	// Region is empty for global addresses.
+	Region string `json:"region,omitempty"`
+	Retain bool   `json:"retain"`
+}
+
 // checkStaticIP reserves a static IP allocated to the Forwarding Rule.
 func (l *L7) checkStaticIP() (err error) {
 	if l.fw == nil || l.fw.IPAddress == "" {
@@ -57,3 +87,197 @@ func (l *L7) checkStaticIP() (err error) {
 	l.ip = ip
 	return nil
 }
+
+// ensureManagedStaticIP reserves, or takes ownership of, the static ip for
+// this L7 and records the ownership. The ip is then used by the forwarding
+// rules through getEffectiveIP().
+func (l *L7) ensureManagedStaticIP() error {
+	managed := l.runtimeInfo.ManagedStaticIP
+	if l.runtimeInfo.StaticIPName != "" {
+		klog.Warningf("Ignoring managed static IP for %v since static IP %v is user specified", l.Name, l.runtimeInfo.StaticIPName)
+		return nil
+	}
+	if l.addresses == nil {
+		return fmt.Errorf("managed static IPs are not supported for %v", l.Name)
+	}
+
+	record, err := l.getStaticIPRecord(l.Name)
+	if err != nil {
+		return err
+	}
+	name := l.namer.ForwardingRule(l.Name, utils.HTTPProtocol)
+	switch {
+	case managed.ImportName != "":
+		name = managed.ImportName
+	case record != nil:
+		// Reuse an address retained from a previous incarnation of the Ingress.
+		name = record.Name
+	}
+	if err := l.checkStaticIPOwnership(name); err != nil {
+		return err
+	}
+
+	ip, err := l.getAddress(name)
+	if utils.IgnoreHTTPNotFound(err) != nil {
+		return err
+	}
+	if ip == nil {
+		if managed.ImportName != "" {
+			return fmt.Errorf("static IP %v to import does not exist", managed.ImportName)
+		}
+		description, err := l.description()
+		if err != nil {
+			return err
+		}
+		addr := &compute.Address{Name: name, Description: description, Address: l.currentIP()}
+		if l.Regional() {
+			if addr.Subnetwork, err = l.ilbSubnetworkURL(); err != nil {
+				return err
+			}
+			addr.AddressType = "INTERNAL"
+			if l.runtimeInfo.ILBIP != "" {
+				addr.Address = l.runtimeInfo.ILBIP
+			}
+		}
+		klog.V(3).Infof("Creating managed static ip %v(%v)", name, addr.Address)
+		if err := l.reserveAddress(addr); err != nil {
+			return err
+		}
+		if ip, err = l.getAddress(name); err != nil {
+			return err
+		}
+	} else if err := l.checkAddressUsers(ip); err != nil {
+		return err
+	}
+
+	newRecord := &staticIPRecord{Name: ip.Name, Retain: managed.Retain}
+	if l.Regional() {
+		newRecord.Region = l.cloud.Region()
+	}
+	if record == nil || *record != *newRecord {
+		if managed.ImportName != "" && (record == nil || record.Name != ip.Name) {
+			l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeNormal, "StaticIP", "Imported static IP %v(%v)", ip.Name, ip.Address)
+		}
+		if err := l.putStaticIPRecord(l.Name, newRecord); err != nil {
+			return err
+		}
+	}
+	l.ip = ip
+	return nil
+}
+
+// checkStaticIPOwnership returns an error if the address with the given name
+// is owned by the controller on behalf of another load balancer.
+func (l *L7) checkStaticIPOwnership(name string) error {
+	all, err := l.addresses.GetAll()
+	if err != nil {
+		return err
+	}
+	for lbName, val := range all {
+		if lbName == l.Name {
+			continue
+		}
+		record := &staticIPRecord{}
+		if err := json.Unmarshal([]byte(val), record); err != nil {
+			continue
+		}
+		if record.Name == name {
+			return fmt.Errorf("static IP %v is already owned by load balancer %v", name, lbName)
+		}
+	}
+	return nil
+}
+
+// checkAddressUsers returns an error if the address is in use by anything
+// other than the forwarding rules of this L7.
+func (l *L7) checkAddressUsers(ip *compute.Address) error {
+	ours := map[string]bool{
+		l.adoptedName(adoptForwardingRule, l.namer.ForwardingRule(l.Name, utils.HTTPProtocol)):       true,
+		l.adoptedName(adoptHttpsForwardingRule, l.namer.ForwardingRule(l.Name, utils.HTTPSProtocol)): true,
+	}
+	for _, user := range ip.Users {
+		id, err := cloud.ParseResourceURL(user)
+		if err != nil || !ours[id.Key.Name] && !l.isListenerForwardingRule(id.Key.Name) {
+			return fmt.Errorf("static IP %v is in use by %v", ip.Name, user)
+		}
+	}
+	return nil
+}
+
+// currentIP returns the ip of an existing forwarding rule for this L7, so that
+// an ephemeral ip is kept when it is promoted to a managed static ip.
+func (l *L7) currentIP() string {
+	for _, name := range []string{
+		l.adoptedName(adoptForwardingRule, l.namer.ForwardingRule(l.Name, utils.HTTPProtocol)),
+		l.adoptedName(adoptHttpsForwardingRule, l.namer.ForwardingRule(l.Name, utils.HTTPSProtocol)),
+	} {
+		key, err := l.CreateKey(name)
+		if err != nil {
+			continue
+		}
+		if fw, _ := composite.GetForwardingRule(l.cloud, key, l.Versions().ForwardingRule); fw != nil && fw.IPAddress != "" {
+			return fw.IPAddress
+		}
+	}
+	return ""
+}
+
+// releaseStaticIP deletes the static ip owned by this L7 unless it is to be
+// retained. Returns true if the L7 had a managed static ip.
+func (l *L7) releaseStaticIP() (bool, error) {
+	if l.addresses == nil {
+		return false, nil
+	}
+	record, err := l.getStaticIPRecord(l.Name)
+	if err != nil || record == nil {
+		return false, err
+	}
+	if record.Retain {
+		klog.V(2).Infof("Retaining static IP %v of load balancer %v", record.Name, l.Name)
+		return true, nil
+	}
+	klog.V(2).Infof("Deleting managed static IP %v", record.Name)
+	if record.Region != "" {
+		err = l.cloud.DeleteRegionAddress(record.Name, record.Region)
+	} else {
+		err = l.cloud.DeleteGlobalAddress(record.Name)
+	}
+	if err := utils.IgnoreHTTPNotFound(err); err != nil {
+		return true, err
+	}
+	return true, l.addresses.Remove(l.Name)
+}
+
+func (l *L7) getStaticIPRecord(lbName string) (*staticIPRecord, error) {
+	val, found, err := l.addresses.Get(lbName)
+	if err != nil || !found {
+		return nil, err
+	}
+	record := &staticIPRecord{}
+	if err := json.Unmarshal([]byte(val), record); err != nil {
+		return nil, fmt.Errorf("malformed static IP record for %v: %v", lbName, err)
+	}
+	return record, nil
+}
+
+func (l *L7) putStaticIPRecord(lbName string, record *staticIPRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return l.addresses.Put(lbName, string(data))
+}
+
+func (l *L7) getAddress(name string) (*compute.Address, error) {
+	if l.Regional() {
+		return l.cloud.GetRegionAddress(name, l.cloud.Region())
+	}
+	return l.cloud.GetGlobalAddress(name)
+}
+
+func (l *L7) reserveAddress(addr *compute.Address) error {
+	if l.Regional() {
+		return l.cloud.ReserveRegionAddress(addr, l.cloud.Region())
+	}
+	return l.cloud.ReserveGlobalAddress(addr)
+}
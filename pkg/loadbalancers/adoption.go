@@ -0,0 +1,440 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/loadbalancers/features"
+	"k8s.io/ingress-gce/pkg/storage"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+// Adopted resources are used by an L7 in place of the ones named by the
+// namer. GCE only allows the description of a url map to be updated, so the
+// ownership of the other resources is recorded in the adoption config map
+// alone. The record also keeps the description and references of every
+// resource from before it was adopted, which are restored when the resource
+// is released.
+
+const (
+	// AdoptionConfigMapName is the name of the config map in kube-system
+	// which records the GCE resources adopted by the controller.
+	AdoptionConfigMapName = "ingress-gce-adopted-resources"
+
+	// The roles of adopted resources, as named in the adoption annotation.
+	adoptUrlMap              = "urlMap"
+	adoptTargetHttpProxy     = "targetHttpProxy"
+	adoptTargetHttpsProxy    = "targetHttpsProxy"
+	adoptForwardingRule      = "forwardingRule"
+	adoptHttpsForwardingRule = "httpsForwardingRule"
+	adoptStaticIP            = "staticIP"
+)
+
+// adoptedResource is the persisted state of a GCE resource adopted by an L7.
+type adoptedResource struct {
+	Name string `json:"name"`
+	// Description is the description of the resource before it was adopted.
+	Description string `json:"description,omitempty"`
+	// Target is the url map of a target proxy, or the target proxy of a
+	// forwarding rule, before it was adopted.
+	Target string `json:"target,omitempty"`
+	// SslCertificates are the certificates of a target https proxy before it
+	// was adopted.
+	SslCertificates []string `json:"sslCertificates,omitempty"`
+	// DefaultService, HostRules and PathMatchers are the routing of a url map
+	// before it was adopted.
+	DefaultService string                   `json:"defaultService,omitempty"`
+	HostRules      []*composite.HostRule    `json:"hostRules,omitempty"`
+	PathMatchers   []*composite.PathMatcher `json:"pathMatchers,omitempty"`
+}
+
+// adoptionRecord lists the resources adopted by a load balancer by role. It
+// is keyed by the load balancer name, like staticIPRecord.
+type adoptionRecord struct {
+	// Region is empty for global resources.
+	Region    string                     `json:"region,omitempty"`
+	Resources map[string]adoptedResource `json:"resources"`
+}
+
+// adoptionKind returns the kind of GCE resource adopted for a role. Roles of
+// the same kind share a namespace of names.
+func adoptionKind(role string) string {
+	if role == adoptHttpsForwardingRule {
+		return adoptForwardingRule
+	}
+	return role
+}
+
+// adoptedName returns the name of the resource adopted for the role, or name
+// if there is none.
+func (l *L7) adoptedName(role, name string) string {
+	if r, ok := l.adopted[role]; ok {
+		return r.Name
+	}
+	return name
+}
+
+// isAdoptedForwardingRule returns true if name is an adopted forwarding rule.
+func (l *L7) isAdoptedForwardingRule(name string) bool {
+	for _, role := range []string{adoptForwardingRule, adoptHttpsForwardingRule} {
+		if r, ok := l.adopted[role]; ok && r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// desiredAdoptions returns the names of the resources to adopt by role.
+func (l *L7) desiredAdoptions() map[string]string {
+	result := map[string]string{}
+	a := l.runtimeInfo.AdoptedResources
+	if a == nil {
+		return result
+	}
+	for role, name := range map[string]string{
+		adoptUrlMap:              a.UrlMap,
+		adoptTargetHttpProxy:     a.TargetHttpProxy,
+		adoptTargetHttpsProxy:    a.TargetHttpsProxy,
+		adoptForwardingRule:      a.ForwardingRule,
+		adoptHttpsForwardingRule: a.HttpsForwardingRule,
+		adoptStaticIP:            a.StaticIP,
+	} {
+		if name != "" {
+			result[role] = name
+		}
+	}
+	return result
+}
+
+// ensureAdoption adopts the resources named in the runtime info and releases
+// the ones which were adopted before but are no longer named. The ownership
+// of all new resources is checked before any of them is adopted.
+func (l *L7) ensureAdoption() error {
+	desired := l.desiredAdoptions()
+	if l.adoptions == nil {
+		if len(desired) > 0 {
+			return fmt.Errorf("adopting resources is not supported for %v", l.Name)
+		}
+		return nil
+	}
+
+	record, err := getAdoptionRecord(l.adoptions, l.Name)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		if len(desired) == 0 {
+			return nil
+		}
+		record = &adoptionRecord{Resources: map[string]adoptedResource{}}
+		if l.Regional() {
+			record.Region = l.cloud.Region()
+		}
+	}
+
+	var roles []string
+	for role, name := range desired {
+		if r, ok := record.Resources[role]; !ok || r.Name != name {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	adoptable := map[string]*adoptedResource{}
+	for _, role := range roles {
+		r, err := l.checkAdoptable(role, desired[role])
+		if err != nil {
+			return err
+		}
+		adoptable[role] = r
+	}
+
+	for role, r := range record.Resources {
+		if desired[role] == r.Name {
+			continue
+		}
+		if err := l.releaseResource(role, r, l.Versions()); err != nil {
+			return err
+		}
+		delete(record.Resources, role)
+		if err := l.putAdoptionRecord(l.Name, record); err != nil {
+			return err
+		}
+		l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeNormal, "Release", "Released %v %v", role, r.Name)
+	}
+
+	for _, role := range roles {
+		r := adoptable[role]
+		record.Resources[role] = *r
+		// The record is written before the sync changes the resource, so
+		// that what is restored on release is never lost.
+		if err := l.putAdoptionRecord(l.Name, record); err != nil {
+			return err
+		}
+		klog.V(2).Infof("Load balancer %v adopted %v %v", l.Name, role, r.Name)
+		l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeNormal, "Adopt", "Adopted %v %v", role, r.Name)
+	}
+	l.adopted = record.Resources
+	return nil
+}
+
+// checkAdoptable returns the state of the named resource to record for its
+// adoption, or an error if the resource does not exist or is owned by
+// another load balancer or Ingress.
+func (l *L7) checkAdoptable(role, name string) (*adoptedResource, error) {
+	if l.namer.NameBelongsToCluster(name) {
+		return nil, fmt.Errorf("cannot adopt %v %v since it is managed by the controller", role, name)
+	}
+	all, err := l.adoptions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for lbName, val := range all {
+		if lbName == l.Name {
+			continue
+		}
+		record := &adoptionRecord{}
+		if err := json.Unmarshal([]byte(val), record); err != nil {
+			continue
+		}
+		for otherRole, r := range record.Resources {
+			if adoptionKind(otherRole) == adoptionKind(role) && r.Name == name {
+				return nil, fmt.Errorf("%v %v is already adopted by load balancer %v", role, name, lbName)
+			}
+		}
+	}
+	if role == adoptStaticIP && l.addresses != nil {
+		if err := l.checkStaticIPOwnership(name); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := l.getAdoptedResource(role, name, l.Versions())
+	if err != nil {
+		return nil, fmt.Errorf("cannot adopt %v %v: %v", role, name, err)
+	}
+	description, err := l.description()
+	if err != nil {
+		return nil, err
+	}
+	if owner := ownerIngress(r.Description); owner != "" && owner != ownerIngress(description) {
+		return nil, fmt.Errorf("%v %v is owned by Ingress %v", role, name, owner)
+	}
+	return r, nil
+}
+
+// ownerIngress returns the Ingress recorded in the description of a resource,
+// if any. Resources which were built by hand usually have a free form
+// description.
+func ownerIngress(description string) string {
+	desc := utils.Description{}
+	if err := json.Unmarshal([]byte(description), &desc); err != nil {
+		return ""
+	}
+	return desc.IngressName
+}
+
+// getAdoptedResource returns the current state of the resource adopted for
+// the role.
+func (l *L7) getAdoptedResource(role, name string, versions *features.ResourceVersions) (*adoptedResource, error) {
+	if role == adoptStaticIP {
+		ip, err := l.getAddress(name)
+		if err != nil {
+			return nil, err
+		}
+		return &adoptedResource{Name: name, Description: ip.Description}, nil
+	}
+
+	key, err := l.CreateKey(name)
+	if err != nil {
+		return nil, err
+	}
+	switch role {
+	case adoptUrlMap:
+		um, err := composite.GetUrlMap(l.cloud, key, versions.UrlMap)
+		if err != nil {
+			return nil, err
+		}
+		return &adoptedResource{
+			Name:           name,
+			Description:    um.Description,
+			DefaultService: um.DefaultService,
+			HostRules:      um.HostRules,
+			PathMatchers:   um.PathMatchers,
+		}, nil
+	case adoptTargetHttpProxy:
+		tp, err := composite.GetTargetHttpProxy(l.cloud, key, versions.TargetHttpProxy)
+		if err != nil {
+			return nil, err
+		}
+		return &adoptedResource{Name: name, Description: tp.Description, Target: tp.UrlMap}, nil
+	case adoptTargetHttpsProxy:
+		tps, err := composite.GetTargetHttpsProxy(l.cloud, key, versions.TargetHttpsProxy)
+		if err != nil {
+			return nil, err
+		}
+		return &adoptedResource{Name: name, Description: tps.Description, Target: tps.UrlMap, SslCertificates: tps.SslCertificates}, nil
+	case adoptForwardingRule, adoptHttpsForwardingRule:
+		fw, err := composite.GetForwardingRule(l.cloud, key, versions.ForwardingRule)
+		if err != nil {
+			return nil, err
+		}
+		return &adoptedResource{Name: name, Description: fw.Description, Target: fw.Target}, nil
+	}
+	return nil, fmt.Errorf("unknown role %q", role)
+}
+
+// releaseResource restores the description, references and routing the
+// adopted resource had before it was adopted. The resource itself is never
+// deleted. Failing to restore a reference, e.g. because the original url map was
+// deleted in the meantime, does not prevent the release.
+func (l *L7) releaseResource(role string, r adoptedResource, versions *features.ResourceVersions) error {
+	klog.V(2).Infof("Load balancer %v releasing %v %v", l.Name, role, r.Name)
+	if role == adoptStaticIP {
+		return nil
+	}
+	key, err := l.CreateKey(r.Name)
+	if err != nil {
+		return err
+	}
+
+	switch role {
+	case adoptUrlMap:
+		um, err := composite.GetUrlMap(l.cloud, key, versions.UrlMap)
+		if err != nil {
+			return utils.IgnoreHTTPNotFound(err)
+		}
+		// A url map left pointing at the backends of the controller would
+		// keep them from being garbage collected.
+		restored := *um
+		restored.Description = r.Description
+		restored.DefaultService = r.DefaultService
+		restored.HostRules = r.HostRules
+		restored.PathMatchers = r.PathMatchers
+		if um.Description != restored.Description || !mapsEqual(um, &restored) {
+			if err := composite.UpdateUrlMap(l.cloud, key, &restored); err != nil {
+				return err
+			}
+		}
+	case adoptTargetHttpProxy:
+		tp, err := composite.GetTargetHttpProxy(l.cloud, key, versions.TargetHttpProxy)
+		if err != nil {
+			return utils.IgnoreHTTPNotFound(err)
+		}
+		if r.Target != "" && !utils.EqualResourcePaths(tp.UrlMap, r.Target) {
+			if err := composite.SetUrlMapForTargetHttpProxy(l.cloud, key, tp, r.Target); err != nil {
+				klog.Warningf("Failed to restore url map %v of released target proxy %v: %v", r.Target, r.Name, err)
+			}
+		}
+	case adoptTargetHttpsProxy:
+		tps, err := composite.GetTargetHttpsProxy(l.cloud, key, versions.TargetHttpsProxy)
+		if err != nil {
+			return utils.IgnoreHTTPNotFound(err)
+		}
+		if r.Target != "" && !utils.EqualResourcePaths(tps.UrlMap, r.Target) {
+			if err := composite.SetUrlMapForTargetHttpsProxy(l.cloud, key, tps, r.Target); err != nil {
+				klog.Warningf("Failed to restore url map %v of released target proxy %v: %v", r.Target, r.Name, err)
+			}
+		}
+		if len(r.SslCertificates) > 0 && !sets.NewString(tps.SslCertificates...).Equal(sets.NewString(r.SslCertificates...)) {
+			if err := composite.SetSslCertificateForTargetHttpsProxy(l.cloud, key, tps, r.SslCertificates); err != nil {
+				klog.Warningf("Failed to restore certificates of released target proxy %v: %v", r.Name, err)
+			}
+		}
+	case adoptForwardingRule, adoptHttpsForwardingRule:
+		fw, err := composite.GetForwardingRule(l.cloud, key, versions.ForwardingRule)
+		if err != nil {
+			return utils.IgnoreHTTPNotFound(err)
+		}
+		if r.Target != "" && !utils.EqualResourceIDs(fw.Target, r.Target) {
+			if err := composite.SetProxyForForwardingRule(l.cloud, key, fw, r.Target); err != nil {
+				klog.Warningf("Failed to restore target proxy %v of released forwarding rule %v: %v", r.Target, r.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// releaseAdopted releases all resources adopted by this L7 and removes its
+// adoption record. Forwarding rules are released before the resources they
+// may reference.
+func (l *L7) releaseAdopted(versions *features.ResourceVersions) error {
+	if l.adoptions == nil {
+		return nil
+	}
+	record, err := getAdoptionRecord(l.adoptions, l.Name)
+	if err != nil || record == nil {
+		return err
+	}
+	for _, role := range []string{adoptForwardingRule, adoptHttpsForwardingRule, adoptTargetHttpProxy, adoptTargetHttpsProxy, adoptUrlMap, adoptStaticIP} {
+		r, ok := record.Resources[role]
+		if !ok {
+			continue
+		}
+		if err := l.releaseResource(role, r, versions); err != nil {
+			return err
+		}
+	}
+	l.adopted = nil
+	return l.adoptions.Remove(l.Name)
+}
+
+// loadAdopted loads the resources adopted by this L7 without changing them.
+func (l *L7) loadAdopted() error {
+	if l.adoptions == nil {
+		return nil
+	}
+	record, err := getAdoptionRecord(l.adoptions, l.Name)
+	if err != nil || record == nil {
+		return err
+	}
+	l.adopted = record.Resources
+	return nil
+}
+
+func getAdoptionRecord(adoptions *storage.ConfigMapVault, lbName string) (*adoptionRecord, error) {
+	val, found, err := adoptions.Get(lbName)
+	if err != nil || !found {
+		return nil, err
+	}
+	record := &adoptionRecord{}
+	if err := json.Unmarshal([]byte(val), record); err != nil {
+		return nil, fmt.Errorf("malformed adoption record for %v: %v", lbName, err)
+	}
+	if record.Resources == nil {
+		record.Resources = map[string]adoptedResource{}
+	}
+	return record, nil
+}
+
+// putAdoptionRecord persists the record, or removes it if nothing is adopted.
+func (l *L7) putAdoptionRecord(lbName string, record *adoptionRecord) error {
+	if len(record.Resources) == 0 {
+		return l.adoptions.Remove(lbName)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return l.adoptions.Put(lbName, string(data))
+}
@@ -26,19 +26,26 @@ import (
 const (
 	httpDefaultPortRange  = "80-80"
 	httpsDefaultPortRange = "443-443"
+
+	ipVersionIPv6 = "IPV6"
 )
 
 func (l *L7) checkHttpForwardingRule() (err error) {
 	if l.tp == nil {
 		return fmt.Errorf("cannot create forwarding rule without proxy")
 	}
-	name := l.namer.ForwardingRule(l.Name, utils.HTTPProtocol)
+	name := l.adoptedName(adoptForwardingRule, l.namer.ForwardingRule(l.Name, utils.HTTPProtocol))
 	address, _ := l.getEffectiveIP()
-	fw, err := l.checkForwardingRule(name, l.tp.SelfLink, address, httpDefaultPortRange)
+	fw, err := l.checkForwardingRule(name, l.tp.SelfLink, address, httpDefaultPortRange, "")
 	if err != nil {
 		return err
 	}
 	l.fw = fw
+	fw6, err := l.checkIPv6ForwardingRule(utils.HTTPProtocol, l.tp.SelfLink, httpDefaultPortRange)
+	if err != nil {
+		return err
+	}
+	l.fw6 = fw6
 	return nil
 }
 
@@ -47,23 +54,75 @@ func (l *L7) checkHttpsForwardingRule() (err error) {
 		klog.V(3).Infof("No https target proxy for %v, not created https forwarding rule", l.Name)
 		return nil
 	}
-	name := l.namer.ForwardingRule(l.Name, utils.HTTPSProtocol)
+	name := l.adoptedName(adoptHttpsForwardingRule, l.namer.ForwardingRule(l.Name, utils.HTTPSProtocol))
 	address, _ := l.getEffectiveIP()
-	fws, err := l.checkForwardingRule(name, l.tps.SelfLink, address, httpsDefaultPortRange)
+	fws, err := l.checkForwardingRule(name, l.tps.SelfLink, address, httpsDefaultPortRange, "")
 	if err != nil {
 		return err
 	}
 	l.fws = fws
+	fws6, err := l.checkIPv6ForwardingRule(utils.HTTPSProtocol, l.tps.SelfLink, httpsDefaultPortRange)
+	if err != nil {
+		return err
+	}
+	l.fws6 = fws6
 	return nil
 }
 
-func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *composite.ForwardingRule, err error) {
+// checkIPv6ForwardingRule ensures the IPv6 forwarding rule for the given
+// protocol if IPv6 is enabled. Otherwise, a previously created IPv6
+// forwarding rule is deleted.
+func (l *L7) checkIPv6ForwardingRule(protocol utils.NamerProtocol, proxyLink, portRange string) (*composite.ForwardingRule, error) {
+	name := l.namer.IPv6ForwardingRule(l.Name, protocol)
+	if !l.runtimeInfo.IPv6 || l.Regional() {
+		if l.runtimeInfo.IPv6 {
+			klog.Warningf("IPv6 is not supported for regional load balancer %v, ignoring", l.Name)
+		}
+		// Only the status annotation tells us that a rule was created, which
+		// saves a GCE call for every load balancer without IPv6.
+		if l.runtimeInfo.Ingress == nil || !ipv6RuleInStatus(l.runtimeInfo.Ingress.Annotations, name) {
+			return nil, nil
+		}
+		key, err := l.CreateKey(name)
+		if err != nil {
+			return nil, err
+		}
+		klog.V(2).Infof("Deleting IPv6 forwarding rule %v", name)
+		return nil, utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, key, l.Versions().ForwardingRule))
+	}
+	return l.checkForwardingRule(name, proxyLink, l.getEffectiveIPv6(), portRange, ipVersionIPv6)
+}
+
+// ipv6RuleInStatus returns true if the Ingress status annotations record an
+// IPv6 forwarding rule with the given name.
+func ipv6RuleInStatus(ingAnnotations map[string]string, name string) bool {
+	return GCEResourceName(ingAnnotations, "ipv6-forwarding-rule") == name ||
+		GCEResourceName(ingAnnotations, "ipv6-https-forwarding-rule") == name
+}
+
+func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange, ipVersion string) (fw *composite.ForwardingRule, err error) {
 	key, err := l.CreateKey(name)
 	if err != nil {
 		return nil, err
 	}
 	version := l.Versions().ForwardingRule
+	isL7ILB := utils.IsGCEL7ILBIngress(l.runtimeInfo.Ingress)
+	var subnetwork string
+	if isL7ILB {
+		if subnetwork, err = l.ilbSubnetworkURL(); err != nil {
+			return nil, err
+		}
+	}
 	fw, _ = composite.GetForwardingRule(l.cloud, key, version)
+	// Recreating an adopted forwarding rule could change its VIP.
+	if fw != nil && l.isAdoptedForwardingRule(name) {
+		if ip != "" && fw.IPAddress != ip || fw.PortRange != portRange {
+			return nil, fmt.Errorf("adopted forwarding rule %v has %v(%v), want %v(%v)", name, fw.IPAddress, fw.PortRange, ip, portRange)
+		}
+		if isL7ILB && fw.AllowGlobalAccess != l.runtimeInfo.ILBAllowGlobalAccess {
+			return nil, fmt.Errorf("adopted forwarding rule %v has global access %v, want %v", name, fw.AllowGlobalAccess, l.runtimeInfo.ILBAllowGlobalAccess)
+		}
+	}
 	if fw != nil && (ip != "" && fw.IPAddress != ip || fw.PortRange != portRange) {
 		klog.Warningf("Recreating forwarding rule %v(%v), so it has %v(%v)",
 			fw.IPAddress, fw.PortRange, ip, portRange)
@@ -72,6 +131,19 @@ func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *com
 		}
 		fw = nil
 	}
+	// The subnet and global access of an L7-ILB forwarding rule can only be
+	// changed by recreating it. Only a user specified subnet is compared, so
+	// existing rules are not recreated when the default subnet is resolved
+	// differently.
+	if fw != nil && isL7ILB && (l.runtimeInfo.ILBSubnet != "" && !utils.EqualResourceIDs(fw.Subnetwork, subnetwork) ||
+		fw.AllowGlobalAccess != l.runtimeInfo.ILBAllowGlobalAccess) {
+		klog.Warningf("Recreating forwarding rule %v(subnet %q, global access %v), so it has subnet %q, global access %v",
+			fw.Name, fw.Subnetwork, fw.AllowGlobalAccess, subnetwork, l.runtimeInfo.ILBAllowGlobalAccess)
+		if err = utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, key, version)); err != nil {
+			return nil, err
+		}
+		fw = nil
+	}
 	if fw == nil {
 		klog.V(3).Infof("Creating forwarding rule for proxy %q and ip %v:%v", proxyLink, ip, portRange)
 		description, err := l.description()
@@ -84,13 +156,16 @@ func (l *L7) checkForwardingRule(name, proxyLink, ip, portRange string) (fw *com
 			Target:      proxyLink,
 			PortRange:   portRange,
 			IPProtocol:  "TCP",
+			IpVersion:   ipVersion,
 			Description: description,
 			Version:     version,
 		}
 
 		// Update rule for L7-ILB
-		if utils.IsGCEL7ILBIngress(l.runtimeInfo.Ingress) {
+		if isL7ILB {
 			rule.LoadBalancingScheme = "INTERNAL_MANAGED"
+			rule.Subnetwork = subnetwork
+			rule.AllowGlobalAccess = l.runtimeInfo.ILBAllowGlobalAccess
 		}
 		if err = composite.CreateForwardingRule(l.cloud, key, rule); err != nil {
 			return nil, err
@@ -143,6 +218,17 @@ func (l *L7) getEffectiveIP() (string, bool) {
 	//    or deletes/modifies the Ingress.
 	// TODO: Handle the last case better.
 
+	if l.Regional() && l.runtimeInfo.ILBIP != "" {
+		return l.runtimeInfo.ILBIP, false
+	}
+	// Like a user specified static IP, an adopted one is not managed.
+	if r, ok := l.adopted[adoptStaticIP]; ok {
+		if ip, err := l.getAddress(r.Name); err != nil || ip == nil {
+			klog.Warningf("Adopted static IP %v of %v does not exist, ignoring it: %v", r.Name, l.Name, err)
+		} else {
+			return ip.Address, false
+		}
+	}
 	if l.runtimeInfo.StaticIPName != "" {
 		// Existing static IPs allocated to forwarding rules will get orphaned
 		// till the Ingress is torn down.
@@ -158,3 +244,18 @@ func (l *L7) getEffectiveIP() (string, bool) {
 	}
 	return "", true
 }
+
+// getEffectiveIPv6 returns the IPv6 address to use in the IPv6 forwarding
+// rules. An empty string means an ephemeral address is allocated by GCE.
+func (l *L7) getEffectiveIPv6() string {
+	if l.runtimeInfo.StaticIPv6Name == "" {
+		return ""
+	}
+	ip, err := l.cloud.GetGlobalAddress(l.runtimeInfo.StaticIPv6Name)
+	if err != nil || ip == nil {
+		klog.Warningf("The given static IPv6 name %v doesn't translate to an existing global static IP, ignoring it and allocating a new IP: %v",
+			l.runtimeInfo.StaticIPv6Name, err)
+		return ""
+	}
+	return ip.Address
+}
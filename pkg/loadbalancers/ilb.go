@@ -0,0 +1,72 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+)
+
+// ilbSubnetworkURL returns the subnetwork for the L7-ILB forwarding rules
+// and managed static ips. If no subnet is specified, the subnet of the
+// cluster is used.
+func (l *L7) ilbSubnetworkURL() (string, error) {
+	subnet := l.runtimeInfo.ILBSubnet
+	if subnet == "" {
+		return l.cloud.SubnetworkURL(), nil
+	}
+	if !strings.Contains(subnet, "/") {
+		// Subnets are owned by the network project on XPN clusters.
+		return cloud.SelfLink(meta.VersionGA, l.cloud.NetworkProjectID(), "subnetworks", meta.RegionalKey(subnet, l.cloud.Region())), nil
+	}
+	id, err := cloud.ParseResourceURL(subnet)
+	if err != nil {
+		return "", fmt.Errorf("invalid subnet %q: %v", subnet, err)
+	}
+	if id.Resource != "subnetworks" {
+		return "", fmt.Errorf("invalid subnet %q: not a subnetwork", subnet)
+	}
+	if id.Key.Region != l.cloud.Region() {
+		return "", fmt.Errorf("subnet %q is in region %q, not in region %q of the cluster", subnet, id.Key.Region, l.cloud.Region())
+	}
+	return cloud.SelfLink(meta.VersionGA, id.ProjectID, "subnetworks", id.Key), nil
+}
+
+// validateILBConfig returns an error if the subnet or ip requested for the
+// L7-ILB are invalid.
+func (l *L7) validateILBConfig() error {
+	if _, err := l.ilbSubnetworkURL(); err != nil {
+		return err
+	}
+	if l.runtimeInfo.ILBIP != "" {
+		return validateILBIP(l.runtimeInfo.ILBIP)
+	}
+	return nil
+}
+
+// validateILBIP returns an error if ip is not a valid internal ip address
+// for the L7-ILB forwarding rules.
+func validateILBIP(ip string) error {
+	if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+		return fmt.Errorf("invalid internal IP %q, must be an IPv4 address", ip)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ package loadbalancers
 import (
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
 )
 
@@ -28,6 +29,8 @@ type LoadBalancerPool interface {
 	Ensure(ri *L7RuntimeInfo) (*L7, error)
 	Delete(name string, versions *features.ResourceVersions, scope meta.KeyType) error
 	GC(names []string) error
+	GCOne(name string) error
+	Audit(ris []*L7RuntimeInfo) ([]drift.Drift, error)
 	Shutdown() error
 	List(key *meta.Key, version meta.Version) ([]*composite.UrlMap, error)
 }
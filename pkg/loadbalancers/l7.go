@@ -32,6 +32,7 @@ import (
 	"k8s.io/ingress-gce/pkg/backends"
 	"k8s.io/ingress-gce/pkg/composite"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -65,6 +66,25 @@ type L7RuntimeInfo struct {
 	// The name of a Global Static IP. If specified, the IP associated with
 	// this name is used in the Forwarding Rules for this loadbalancer.
 	StaticIPName string
+	// IPv6 creates IPv6 forwarding rules in addition to the IPv4 ones.
+	IPv6 bool
+	// The name of a Global Static IPv6 address. If specified, the address is
+	// used in the IPv6 Forwarding Rules for this loadbalancer.
+	StaticIPv6Name string
+	// ManagedStaticIP, if set, is the static IP reserved and owned by the
+	// controller for this loadbalancer. Ignored if StaticIPName is set.
+	ManagedStaticIP *ManagedStaticIP
+	// ILBSubnet is the subnet name or URL for the forwarding rules of an
+	// L7-ILB. The subnet of the cluster is used if empty.
+	ILBSubnet string
+	// ILBIP is the internal ip address for the forwarding rules of an L7-ILB.
+	// An address is allocated from the subnet if empty.
+	ILBIP string
+	// ILBAllowGlobalAccess allows clients from all regions to reach an L7-ILB.
+	ILBAllowGlobalAccess bool
+	// AdoptedResources names existing resources to use instead of creating
+	// new ones.
+	AdoptedResources *annotations.AdoptedResources
 	// UrlMap is our internal representation of a url map.
 	UrlMap *utils.GCEURLMap
 	// FrontendConfig is the type which encapsulates features for the load balancer.
@@ -108,6 +128,13 @@ type L7 struct {
 	fw *composite.ForwardingRule
 	// fws is the GlobalForwardingRule that points to the TargetHTTPSProxy.
 	fws *composite.ForwardingRule
+	// fw6 is the IPv6 GlobalForwardingRule that points to the TargetHTTPProxy.
+	fw6 *composite.ForwardingRule
+	// fws6 is the IPv6 GlobalForwardingRule that points to the TargetHTTPSProxy.
+	fws6 *composite.ForwardingRule
+	// listenerRules are the forwarding rules of additional listeners
+	// configured in the FrontendConfig.
+	listenerRules []*composite.ForwardingRule
 	// ip is the static-ip associated with both GlobalForwardingRules.
 	ip *compute.Address
 	// sslCerts is the list of ssl certs associated with the targetHTTPSProxy.
@@ -123,6 +150,12 @@ type L7 struct {
 	recorder record.EventRecorder
 	// resource type stores the KeyType of the resources in the loadbalancer (e.g. Regional)
 	scope meta.KeyType
+	// addresses records the static ips owned by the controller.
+	addresses *storage.ConfigMapVault
+	// adoptions records the resources adopted by the controller.
+	adoptions *storage.ConfigMapVault
+	// adopted are the resources adopted by this L7, by role.
+	adopted map[string]adoptedResource
 }
 
 // Version() returns the struct listing the versions for every resource
@@ -155,9 +188,23 @@ func (l *L7) edgeHop() error {
 	// If user configuration dictates we do not, then we emit an event.
 	willConfigureFrontend := false
 
+	if l.Regional() {
+		if err := l.validateILBConfig(); err != nil {
+			return err
+		}
+	}
+	if err := l.ensureAdoption(); err != nil {
+		return err
+	}
 	if err := l.ensureComputeURLMap(); err != nil {
 		return err
 	}
+	if l.runtimeInfo.ManagedStaticIP != nil {
+		klog.V(3).Infof("checking managed static ip for %v", l.Name)
+		if err := l.ensureManagedStaticIP(); err != nil {
+			return err
+		}
+	}
 	if l.runtimeInfo.AllowHTTP {
 		willConfigureFrontend = true
 		if err := l.edgeHopHttp(); err != nil {
@@ -166,7 +213,9 @@ func (l *L7) edgeHop() error {
 	}
 	// Defer promoting an ephemeral to a static IP until it's really needed.
 	sslConfigured := l.runtimeInfo.TLS != nil || l.runtimeInfo.TLSName != ""
-	if l.runtimeInfo.AllowHTTP && sslConfigured {
+	// Additional listeners share the ip of the default forwarding rules.
+	listenersConfigured := l.runtimeInfo.FrontendConfig != nil && len(l.runtimeInfo.FrontendConfig.Spec.AdditionalListeners) > 0
+	if l.runtimeInfo.ManagedStaticIP == nil && l.runtimeInfo.AllowHTTP && (sslConfigured || listenersConfigured) {
 		klog.V(3).Infof("checking static ip for %v", l.Name)
 		if err := l.checkStaticIP(); err != nil {
 			return err
@@ -179,8 +228,19 @@ func (l *L7) edgeHop() error {
 			return err
 		}
 	}
+	if willConfigureFrontend {
+		if err := l.checkListenerForwardingRules(); err != nil {
+			return err
+		}
+	}
 
 	if !willConfigureFrontend {
+		// Additional listeners are served by the proxies of the default
+		// forwarding rules, so their forwarding rules are torn down too.
+		l.listenerRules = nil
+		if err := l.deleteListenerForwardingRules(l.Versions().ForwardingRule); err != nil {
+			return err
+		}
 		l.recorder.Eventf(l.runtimeInfo.Ingress, corev1.EventTypeNormal, "WillNotConfigureFrontend", "Will not configure frontend based on Ingress specification. Please check your usage of the 'kubernetes.io/ingress.allow-http' annotation.")
 	}
 
@@ -220,13 +280,30 @@ func (l *L7) GetIP() string {
 	return ""
 }
 
+// GetIPv6 returns the IPv6 address associated with the IPv6 forwarding rule
+// for this l7, if any.
+func (l *L7) GetIPv6() string {
+	if l.fw6 != nil {
+		return l.fw6.IPAddress
+	}
+	if l.fws6 != nil {
+		return l.fws6.IPAddress
+	}
+	return ""
+}
+
 // Cleanup deletes resources specific to this l7 in the right order.
 // forwarding rule -> target proxy -> url map
 // This leaves backends and health checks, which are shared across loadbalancers.
+// Adopted resources are released instead of deleted.
 func (l *L7) Cleanup(versions *features.ResourceVersions) error {
 	var key *meta.Key
 	var err error
 
+	if err := l.releaseAdopted(versions); err != nil {
+		return err
+	}
+
 	fwName := l.namer.ForwardingRule(l.Name, utils.HTTPProtocol)
 	klog.V(2).Infof("Deleting global forwarding rule %v", fwName)
 	if key, err = l.CreateKey(fwName); err != nil {
@@ -245,14 +322,37 @@ func (l *L7) Cleanup(versions *features.ResourceVersions) error {
 		return err
 	}
 
-	ip, err := l.cloud.GetGlobalAddress(fwName)
-	if ip != nil && utils.IgnoreHTTPNotFound(err) == nil {
-		klog.V(2).Infof("Deleting static IP %v(%v)", ip.Name, ip.Address)
-		if err := utils.IgnoreHTTPNotFound(l.cloud.DeleteGlobalAddress(ip.Name)); err != nil {
+	for _, protocol := range []utils.NamerProtocol{utils.HTTPProtocol, utils.HTTPSProtocol} {
+		fw6Name := l.namer.IPv6ForwardingRule(l.Name, protocol)
+		klog.V(2).Infof("Deleting IPv6 forwarding rule %v", fw6Name)
+		if key, err = l.CreateKey(fw6Name); err != nil {
+			return err
+		}
+		if err := utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, key, versions.ForwardingRule)); err != nil {
 			return err
 		}
 	}
 
+	if err := l.deleteListenerForwardingRules(versions.ForwardingRule); err != nil {
+		return err
+	}
+
+	managedIP, err := l.releaseStaticIP()
+	if err != nil {
+		return err
+	}
+	// Addresses which are not recorded as managed were promoted from an
+	// ephemeral ip by checkStaticIP().
+	if !managedIP {
+		ip, err := l.cloud.GetGlobalAddress(fwName)
+		if ip != nil && utils.IgnoreHTTPNotFound(err) == nil {
+			klog.V(2).Infof("Deleting static IP %v(%v)", ip.Name, ip.Address)
+			if err := utils.IgnoreHTTPNotFound(l.cloud.DeleteGlobalAddress(ip.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
 	tpName := l.namer.TargetProxy(l.Name, utils.HTTPProtocol)
 	klog.V(2).Infof("Deleting target http proxy %v", tpName)
 	if key, err = l.CreateKey(tpName); err != nil {
@@ -351,6 +451,26 @@ func GetLBAnnotations(l7 *L7, existing map[string]string, backendSyncer backends
 	if l7.tps != nil {
 		existing[fmt.Sprintf("%v/https-target-proxy", annotations.StatusPrefix)] = l7.tps.Name
 	}
+	// IPv6 forwarding rules only exist if IPv6 is enabled. The annotations
+	// are removed otherwise, since they are used to detect rules to delete.
+	ipv6Key := fmt.Sprintf("%v/ipv6-forwarding-rule", annotations.StatusPrefix)
+	if l7.fw6 != nil {
+		existing[ipv6Key] = l7.fw6.Name
+	} else {
+		delete(existing, ipv6Key)
+	}
+	ipv6HTTPSKey := fmt.Sprintf("%v/ipv6-https-forwarding-rule", annotations.StatusPrefix)
+	if l7.fws6 != nil {
+		existing[ipv6HTTPSKey] = l7.fws6.Name
+	} else {
+		delete(existing, ipv6HTTPSKey)
+	}
+	listenerKey := fmt.Sprintf("%v/%v", annotations.StatusPrefix, listenerRulesStatusKey)
+	if len(l7.listenerRules) > 0 {
+		existing[listenerKey] = listenerRuleNames(l7.listenerRules)
+	} else {
+		delete(existing, listenerKey)
+	}
 	if l7.ip != nil {
 		existing[fmt.Sprintf("%v/static-ip", annotations.StatusPrefix)] = l7.ip.Name
 	}
@@ -382,5 +502,5 @@ func (l *L7) description() (string, error) {
 	ingressName := l.runtimeInfo.Ingress.ObjectMeta.Name
 	namespacedName := types.NamespacedName{Name: ingressName, Namespace: namespace}
 
-	return fmt.Sprintf(`{"kubernetes.io/ingress-name": %q}`, namespacedName.String()), nil
+	return utils.Description{IngressName: namespacedName.String()}.String(), nil
 }
@@ -22,9 +22,11 @@ import (
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/events"
 	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -35,6 +37,10 @@ type L7s struct {
 	cloud            *gce.Cloud
 	namer            *utils.Namer
 	recorderProducer events.RecorderProducer
+	// addresses records the static ips owned by the controller.
+	addresses *storage.ConfigMapVault
+	// adoptions records the resources adopted by the controller.
+	adoptions *storage.ConfigMapVault
 }
 
 // Namer returns the namer associated with the L7s.
@@ -45,11 +51,15 @@ func (l *L7s) Namer() *utils.Namer {
 // NewLoadBalancerPool returns a new loadbalancer pool.
 // - cloud: implements LoadBalancers. Used to sync L7 loadbalancer resources
 //	 with the cloud.
-func NewLoadBalancerPool(cloud *gce.Cloud, namer *utils.Namer, recorderProducer events.RecorderProducer) LoadBalancerPool {
+// - addresses: records static ips owned by the controller.
+// - adoptions: records resources adopted by the controller.
+func NewLoadBalancerPool(cloud *gce.Cloud, namer *utils.Namer, recorderProducer events.RecorderProducer, addresses, adoptions *storage.ConfigMapVault) LoadBalancerPool {
 	return &L7s{
 		cloud:            cloud,
 		namer:            namer,
 		recorderProducer: recorderProducer,
+		addresses:        addresses,
+		adoptions:        adoptions,
 	}
 }
 
@@ -63,6 +73,8 @@ func (l *L7s) Ensure(ri *L7RuntimeInfo) (*L7, error) {
 		recorder:    l.recorderProducer.Recorder(ri.Ingress.Namespace),
 		scope:       features.ScopeFromIngress(ri.Ingress),
 		ingress:     *ri.Ingress,
+		addresses:   l.addresses,
+		adoptions:   l.adoptions,
 	}
 
 	if err := lb.edgeHop(); err != nil {
@@ -79,6 +91,8 @@ func (l *L7s) Delete(name string, versions *features.ResourceVersions, scope met
 		cloud:       l.cloud,
 		namer:       l.namer,
 		scope:       scope,
+		addresses:   l.addresses,
+		adoptions:   l.adoptions,
 	}
 
 	klog.V(3).Infof("Deleting lb %v", lb.Name)
@@ -142,9 +156,135 @@ func (l *L7s) GC(names []string) error {
 		return fmt.Errorf("error gcing global LBs: %v", errors)
 	}
 
+	// Loadbalancers which only use an adopted url map are not listed above.
+	if l.adoptions == nil {
+		return nil
+	}
+	records, err := l.adoptions.GetAll()
+	if err != nil {
+		return fmt.Errorf("error listing adoption records: %v", err)
+	}
+	for lbName := range records {
+		if knownLoadBalancers.Has(lbName) {
+			continue
+		}
+		klog.V(2).Infof("GCing loadbalancer %v with adopted resources", lbName)
+		if err := l.gcAdopted(lbName); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// GCOne garbage collects the loadbalancer of the given name in any scope it
+// exists in. Unlike GC, it looks up the url map of this loadbalancer instead
+// of listing those of all loadbalancers.
+func (l *L7s) GCOne(name string) error {
+	umName := l.namer.UrlMap(l.namer.LoadBalancer(name))
+	versionsByScope := map[meta.KeyType]*features.ResourceVersions{
+		meta.Global: features.GAResourceVersions,
+	}
+	if flags.F.EnableL7Ilb {
+		versionsByScope[meta.Regional] = features.L7ILBVersions()
+	}
+
+	for scope, versions := range versionsByScope {
+		key, err := composite.CreateKey(l.cloud, umName, scope)
+		if err != nil {
+			return err
+		}
+		// The url map is deleted last, so its absence means that there is
+		// nothing left to clean up in this scope.
+		if _, err := composite.GetUrlMap(l.cloud, key, versions.UrlMap); err != nil {
+			if utils.IsNotFoundError(err) {
+				continue
+			}
+			return fmt.Errorf("error getting url map %v: %v", umName, err)
+		}
+		klog.V(2).Infof("GCing loadbalancer %v", name)
+		if err := l.Delete(name, versions, scope); err != nil {
+			return fmt.Errorf("error deleting loadbalancer %q: %v", name, err)
+		}
+	}
+	// The url map may have been adopted, in which case it is named by the
+	// adoption record instead.
+	return l.gcAdopted(l.namer.LoadBalancer(name))
+}
+
+// gcAdopted deletes the loadbalancer of the given name if it has an adoption
+// record, which releases the adopted resources.
+func (l *L7s) gcAdopted(lbName string) error {
+	if l.adoptions == nil {
+		return nil
+	}
+	record, err := getAdoptionRecord(l.adoptions, lbName)
+	if err != nil || record == nil {
+		return err
+	}
+	scope, versions := meta.KeyType(meta.Global), features.GAResourceVersions
+	if record.Region != "" {
+		scope, versions = meta.Regional, features.L7ILBVersions()
+	}
+	if err := l.Delete(lbName, versions, scope); err != nil {
+		return fmt.Errorf("error deleting loadbalancer %q: %v", lbName, err)
+	}
+	return nil
+}
+
+// Audit compares the URLMaps of the loadbalancers described by ris with the
+// ones in GCE, and reports URLMaps of the cluster which belong to none of
+// them. Only the Name, UrlMap and Ingress of the runtime infos are used.
+func (l *L7s) Audit(ris []*L7RuntimeInfo) ([]drift.Drift, error) {
+	var drifts []drift.Drift
+	knownLoadBalancers := sets.NewString()
+	for _, ri := range ris {
+		lb := &L7{
+			runtimeInfo: ri,
+			Name:        l.namer.LoadBalancer(ri.Name),
+			cloud:       l.cloud,
+			namer:       l.namer,
+			scope:       features.ScopeFromIngress(ri.Ingress),
+			ingress:     *ri.Ingress,
+			adoptions:   l.adoptions,
+		}
+		knownLoadBalancers.Insert(lb.Name)
+		if err := lb.loadAdopted(); err != nil {
+			return nil, err
+		}
+		d, err := lb.auditURLMap()
+		if err != nil {
+			return nil, fmt.Errorf("error auditing loadbalancer %v: %v", lb.Name, err)
+		}
+		if d != nil {
+			drifts = append(drifts, *d)
+		}
+	}
+
+	versionsByScope := map[meta.KeyType]*features.ResourceVersions{
+		meta.Global: features.GAResourceVersions,
+	}
+	if flags.F.EnableL7Ilb {
+		versionsByScope[meta.Regional] = features.L7ILBVersions()
+	}
+	for scope, versions := range versionsByScope {
+		key, err := composite.CreateKey(l.cloud, "", scope)
+		if err != nil {
+			return nil, err
+		}
+		urlMaps, err := l.List(key, versions.UrlMap)
+		if err != nil {
+			return nil, fmt.Errorf("error listing LBs: %v", err)
+		}
+		for _, um := range urlMaps {
+			l7Name := l.namer.LoadBalancerFromLbName(l.namer.ParseName(um.Name).LbName)
+			if !knownLoadBalancers.Has(l7Name) {
+				drifts = append(drifts, drift.Drift{Kind: drift.KindUrlMap, Name: um.Name, Reason: drift.Orphaned})
+			}
+		}
+	}
+	return drifts, nil
+}
+
 // gc is a helper for GC
 // TODO(shance): get versions from description
 func (l *L7s) gc(urlMaps []*composite.UrlMap, knownLoadBalancers sets.String, versions *features.ResourceVersions) []error {
@@ -27,8 +27,10 @@ import (
 
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/legacy-cloud-providers/gce"
 )
@@ -293,11 +295,43 @@ func TestGCToLeakLB(t *testing.T) {
 	}
 }
 
+func TestGCOne(t *testing.T) {
+	t.Parallel()
+	pool := newTestLoadBalancerPool()
+	l7sPool := pool.(*L7s)
+	namer := l7sPool.namer
+	versions := features.GAResourceVersions
+
+	otherKey := generateKey("other", "ingress")
+	createFakeLoadbalancer(l7sPool.cloud, namer, otherKey, versions, defaultScope)
+
+	// Unlike GC, GCOne does not parse names and so does not leak load
+	// balancers of long Ingress keys.
+	for i := 3; i <= len(longName)*2+1; i++ {
+		key := generateKeyWithLength(i)
+		createFakeLoadbalancer(l7sPool.cloud, namer, key, versions, defaultScope)
+		if err := l7sPool.GCOne(key); err != nil {
+			t.Errorf("GCOne(%q) = %v, want nil", key, err)
+		}
+		if err := checkFakeLoadBalancer(l7sPool.cloud, namer, key, versions, defaultScope, false); err != nil {
+			t.Errorf("For key of length %d, do not expect err: %v", i, err)
+		}
+		// A load balancer which does not exist is ignored.
+		if err := l7sPool.GCOne(key); err != nil {
+			t.Errorf("GCOne(%q) = %v, want nil", key, err)
+		}
+	}
+
+	if err := checkFakeLoadBalancer(l7sPool.cloud, namer, otherKey, versions, defaultScope, true); err != nil {
+		t.Errorf("Load balancer of other Ingress was deleted: %v", err)
+	}
+}
+
 func newTestLoadBalancerPool() LoadBalancerPool {
 	namer := utils.NewNamer(testClusterName, "fw1")
 	fakeGCECloud := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
 	ctx := &context.ControllerContext{}
-	return NewLoadBalancerPool(fakeGCECloud, namer, ctx)
+	return NewLoadBalancerPool(fakeGCECloud, namer, ctx, storage.NewFakeConfigMapVault(metav1.NamespaceSystem, StaticIPConfigMapName), storage.NewFakeConfigMapVault(metav1.NamespaceSystem, AdoptionConfigMapName))
 }
 
 func createFakeLoadbalancer(cloud *gce.Cloud, namer *utils.Namer, lbKey string, versions *features.ResourceVersions, scope meta.KeyType) {
@@ -0,0 +1,189 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loadbalancers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/utils"
+	"k8s.io/klog"
+)
+
+// listenerRulesStatusKey is the status annotation listing the forwarding
+// rules of additional listeners.
+const listenerRulesStatusKey = "listener-forwarding-rules"
+
+// listener is an additional port the load balancer serves on.
+type listener struct {
+	protocol utils.NamerProtocol
+	port     int64
+}
+
+// listeners returns the additional listeners configured in the
+// FrontendConfig of this L7.
+func (l *L7) listeners() ([]listener, error) {
+	if l.runtimeInfo.FrontendConfig == nil {
+		return nil, nil
+	}
+	var result []listener
+	ports := map[int64]bool{}
+	for _, ln := range l.runtimeInfo.FrontendConfig.Spec.AdditionalListeners {
+		var protocol utils.NamerProtocol
+		switch ln.Protocol {
+		case frontendconfigv1beta1.ListenerProtocolHTTP:
+			protocol = utils.HTTPProtocol
+		case frontendconfigv1beta1.ListenerProtocolHTTPS:
+			protocol = utils.HTTPSProtocol
+		default:
+			return nil, fmt.Errorf("invalid protocol %q for listener on port %d, must be %q or %q",
+				ln.Protocol, ln.Port, frontendconfigv1beta1.ListenerProtocolHTTP, frontendconfigv1beta1.ListenerProtocolHTTPS)
+		}
+		if ln.Port < 1 || ln.Port > 65535 {
+			return nil, fmt.Errorf("invalid port %d for listener, must be between 1 and 65535", ln.Port)
+		}
+		// 80 and 443 are served by the default forwarding rules.
+		if ln.Port == 80 || ln.Port == 443 || ports[ln.Port] {
+			return nil, fmt.Errorf("port %d is already used by another listener", ln.Port)
+		}
+		ports[ln.Port] = true
+		result = append(result, listener{protocol: protocol, port: ln.Port})
+	}
+	return result, nil
+}
+
+// checkListenerForwardingRules ensures a forwarding rule for every additional
+// listener, sharing the ip and target proxies of the default forwarding
+// rules. Rules of listeners which were removed are deleted.
+func (l *L7) checkListenerForwardingRules() error {
+	listeners, err := l.listeners()
+	if err != nil {
+		return err
+	}
+
+	var address string
+	if len(listeners) > 0 {
+		// The ip is shared with the default forwarding rules, which is only
+		// possible if it is reserved.
+		if _, manageStaticIP := l.getEffectiveIP(); manageStaticIP && l.ip == nil && !l.runtimeInfo.AllowHTTP {
+			return fmt.Errorf("additional listeners of %v require a static IP when HTTP is disabled", l.Name)
+		}
+		if address = l.GetIP(); address == "" {
+			return fmt.Errorf("cannot create additional listeners of %v without a forwarding rule", l.Name)
+		}
+	}
+
+	var rules []*composite.ForwardingRule
+	desired := sets.NewString()
+	for _, ln := range listeners {
+		var proxyLink string
+		switch {
+		case ln.protocol == utils.HTTPProtocol && l.tp != nil:
+			proxyLink = l.tp.SelfLink
+		case ln.protocol == utils.HTTPSProtocol && l.tps != nil:
+			proxyLink = l.tps.SelfLink
+		default:
+			klog.Warningf("No %v target proxy for %v, not creating forwarding rule for port %d", ln.protocol, l.Name, ln.port)
+			continue
+		}
+		name := l.namer.ListenerForwardingRule(l.Name, ln.protocol, ln.port)
+		portRange := fmt.Sprintf("%d-%d", ln.port, ln.port)
+		fw, err := l.checkForwardingRule(name, proxyLink, address, portRange, "")
+		if err != nil {
+			return err
+		}
+		desired.Insert(name)
+		rules = append(rules, fw)
+	}
+	l.listenerRules = rules
+
+	if l.runtimeInfo.Ingress == nil {
+		return nil
+	}
+	for _, name := range listenerRulesInStatus(l.runtimeInfo.Ingress.Annotations) {
+		if desired.Has(name) {
+			continue
+		}
+		key, err := l.CreateKey(name)
+		if err != nil {
+			return err
+		}
+		klog.V(2).Infof("Deleting forwarding rule %v of removed listener", name)
+		if err := utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, key, l.Versions().ForwardingRule)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteListenerForwardingRules deletes the forwarding rules of all
+// additional listeners of this L7. The rules are listed since the listeners
+// may no longer be known when the load balancer is deleted.
+func (l *L7) deleteListenerForwardingRules(version meta.Version) error {
+	key, err := l.CreateKey("")
+	if err != nil {
+		return err
+	}
+	rules, err := composite.ListForwardingRules(l.cloud, key, version)
+	if err != nil {
+		return err
+	}
+	for _, fw := range rules {
+		if !l.isListenerForwardingRule(fw.Name) {
+			continue
+		}
+		if key, err = l.CreateKey(fw.Name); err != nil {
+			return err
+		}
+		klog.V(2).Infof("Deleting forwarding rule %v", fw.Name)
+		if err := utils.IgnoreHTTPNotFound(composite.DeleteForwardingRule(l.cloud, key, version)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isListenerForwardingRule returns true if name is the forwarding rule of an
+// additional listener of this L7.
+func (l *L7) isListenerForwardingRule(name string) bool {
+	return l.namer.IsListenerForwardingRule(l.Name, name)
+}
+
+// listenerRulesInStatus returns the forwarding rules of additional listeners
+// recorded in the Ingress status annotations.
+func listenerRulesInStatus(ingAnnotations map[string]string) []string {
+	val := GCEResourceName(ingAnnotations, listenerRulesStatusKey)
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, ",")
+}
+
+// listenerRuleNames returns the sorted names of the given forwarding rules.
+func listenerRuleNames(rules []*composite.ForwardingRule) string {
+	var names []string
+	for _, fw := range rules {
+		names = append(names, fw.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
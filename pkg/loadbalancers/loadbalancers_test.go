@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"k8s.io/ingress-gce/pkg/loadbalancers/features"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -30,13 +31,20 @@ import (
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
+	api_v1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/annotations"
+	frontendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/frontendconfig/v1beta1"
+	"k8s.io/ingress-gce/pkg/backends"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/events"
+	"k8s.io/ingress-gce/pkg/healthchecks"
 	"k8s.io/ingress-gce/pkg/instances"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/kubernetes/pkg/util/slice"
 	"k8s.io/legacy-cloud-providers/gce"
@@ -145,7 +153,7 @@ func newFakeLoadBalancerPool(cloud *gce.Cloud, t *testing.T, namer *utils.Namer)
 	nodePool := instances.NewNodePool(fakeIGs, namer)
 	nodePool.Init(&instances.FakeZoneLister{Zones: []string{defaultZone}})
 
-	return NewLoadBalancerPool(cloud, namer, events.RecorderProducerMock{})
+	return NewLoadBalancerPool(cloud, namer, events.RecorderProducerMock{}, storage.NewFakeConfigMapVault(metav1.NamespaceSystem, StaticIPConfigMapName), storage.NewFakeConfigMapVault(metav1.NamespaceSystem, AdoptionConfigMapName))
 }
 
 func newILBIngress() *v1beta1.Ingress {
@@ -1028,6 +1036,61 @@ func TestUrlMapChange(t *testing.T) {
 	verifyURLMap(t, j, l7.UrlMap().Name, um2)
 }
 
+func TestUrlMapKeepsDescription(t *testing.T) {
+	j := newTestJig(t)
+
+	um1 := utils.NewGCEURLMap()
+	um1.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	um2 := utils.NewGCEURLMap()
+	um2.DefaultBackend = &utils.ServicePort{NodePort: 30000}
+	lbInfo := &L7RuntimeInfo{Name: j.namer.LoadBalancer(ingressName), AllowHTTP: true, UrlMap: um1, Ingress: newIngress()}
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = err %v", err)
+	}
+
+	// Set a description by hand.
+	name := l7.UrlMap().Name
+	um, err := j.fakeGCE.GetURLMap(name)
+	if err != nil {
+		t.Fatalf("GetURLMap(%v) = %v, want nil", name, err)
+	}
+	um.Description = "hand-set description"
+	if err := j.fakeGCE.UpdateURLMap(um); err != nil {
+		t.Fatalf("UpdateURLMap(%v) = %v, want nil", name, err)
+	}
+
+	updateCalls := 0
+	j.mock.MockUrlMaps.UpdateHook = func(ctx context.Context, key *meta.Key, obj *compute.UrlMap, m *cloud.MockUrlMaps) error {
+		updateCalls++
+		return mock.UpdateURLMapHook(ctx, key, obj, m)
+	}
+
+	// The description alone does not cause an update, and is kept when the url map changes.
+	for _, tc := range []struct {
+		urlMap       *utils.GCEURLMap
+		expectUpdate int
+	}{
+		{um1, 0},
+		{um2, 1},
+	} {
+		lbInfo.UrlMap = tc.urlMap
+		if _, err := j.pool.Ensure(lbInfo); err != nil {
+			t.Fatalf("pool.Ensure() = err %v", err)
+		}
+		if updateCalls != tc.expectUpdate {
+			t.Errorf("UpdateUrlMap() called %d times, want %d", updateCalls, tc.expectUpdate)
+		}
+		um, err := j.fakeGCE.GetURLMap(name)
+		if err != nil {
+			t.Fatalf("GetURLMap(%v) = %v, want nil", name, err)
+		}
+		if um.Description != "hand-set description" {
+			t.Errorf("Description = %q, want %q", um.Description, "hand-set description")
+		}
+	}
+}
+
 func TestPoolSyncNoChanges(t *testing.T) {
 	j := newTestJig(t)
 
@@ -1484,3 +1547,798 @@ func TestSecretBasedToPreSharedCertUpdateWithErrors(t *testing.T) {
 	}
 	verifyCertAndProxyLink(expectCerts, expectCerts, j, t)
 }
+
+func TestManagedStaticIP(t *testing.T) {
+	j := newTestJig(t)
+	j.mock.MockGlobalAddresses.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.Address, m *cloud.MockGlobalAddresses) (bool, error) {
+		if obj.Address == "" {
+			obj.Address = "1.2.3.4"
+		}
+		return false, nil
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:            lbName,
+		AllowHTTP:       true,
+		UrlMap:          gceUrlMap,
+		Ingress:         newIngress(),
+		ManagedStaticIP: &ManagedStaticIP{Retain: true},
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	ip, err := j.fakeGCE.GetGlobalAddress(j.FWName(lbName, false))
+	if err != nil {
+		t.Fatalf("GetGlobalAddress() = %v, want nil", err)
+	}
+	if l7.GetIP() != ip.Address {
+		t.Errorf("l7.GetIP() = %q, want %q", l7.GetIP(), ip.Address)
+	}
+
+	// A retained ip survives deletion of the load balancer.
+	if err := j.pool.Delete(lbName, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	if _, err := j.fakeGCE.GetGlobalAddress(j.FWName(lbName, false)); err != nil {
+		t.Fatalf("GetGlobalAddress() = %v, want retained address", err)
+	}
+
+	// Recreating the load balancer reuses the retained ip.
+	lbInfo.ManagedStaticIP = &ManagedStaticIP{}
+	l7, err = j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if l7.GetIP() != ip.Address {
+		t.Errorf("l7.GetIP() = %q, want %q", l7.GetIP(), ip.Address)
+	}
+
+	// Without the retain policy the ip is released.
+	if err := j.pool.Delete(lbName, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	if _, err := j.fakeGCE.GetGlobalAddress(j.FWName(lbName, false)); !utils.IsNotFoundError(err) {
+		t.Errorf("GetGlobalAddress() = %v, want not found", err)
+	}
+}
+
+func TestManagedStaticIPGetError(t *testing.T) {
+	j := newTestJig(t)
+	j.mock.MockGlobalAddresses.GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockGlobalAddresses) (bool, *compute.Address, error) {
+		return true, nil, &googleapi.Error{Code: http.StatusInternalServerError}
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:            lbName,
+		AllowHTTP:       true,
+		UrlMap:          gceUrlMap,
+		Ingress:         newIngress(),
+		ManagedStaticIP: &ManagedStaticIP{},
+	}
+
+	// An address which cannot be retrieved is not reserved again.
+	if _, err := j.pool.Ensure(lbInfo); err == nil {
+		t.Errorf("pool.Ensure() = nil, want error")
+	}
+	if len(j.mock.MockGlobalAddresses.Objects) != 0 {
+		t.Errorf("Expect no address to be reserved, got %d", len(j.mock.MockGlobalAddresses.Objects))
+	}
+}
+
+func TestImportStaticIP(t *testing.T) {
+	j := newTestJig(t)
+	importName := "my-ip"
+	if err := j.fakeGCE.ReserveGlobalAddress(&compute.Address{Name: importName, Address: "5.6.7.8"}); err != nil {
+		t.Fatal(err)
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:            lbName,
+		AllowHTTP:       true,
+		UrlMap:          gceUrlMap,
+		Ingress:         newIngress(),
+		ManagedStaticIP: &ManagedStaticIP{ImportName: importName},
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if l7.GetIP() != "5.6.7.8" {
+		t.Errorf("l7.GetIP() = %q, want %q", l7.GetIP(), "5.6.7.8")
+	}
+
+	// Another load balancer cannot import an address which is already owned.
+	otherInfo := &L7RuntimeInfo{
+		Name:            j.namer.LoadBalancer("other"),
+		AllowHTTP:       true,
+		UrlMap:          gceUrlMap,
+		Ingress:         newIngress(),
+		ManagedStaticIP: &ManagedStaticIP{ImportName: importName},
+	}
+	if _, err := j.pool.Ensure(otherInfo); err == nil {
+		t.Errorf("pool.Ensure() = nil, want error for address owned by %v", lbName)
+	}
+
+	// Importing an address which does not exist fails.
+	otherInfo.ManagedStaticIP.ImportName = "does-not-exist"
+	if _, err := j.pool.Ensure(otherInfo); err == nil {
+		t.Errorf("pool.Ensure() = nil, want error for missing address")
+	}
+
+	// The imported address is owned and released with the load balancer.
+	if err := j.pool.Delete(lbName, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	if _, err := j.fakeGCE.GetGlobalAddress(importName); !utils.IsNotFoundError(err) {
+		t.Errorf("GetGlobalAddress(%q) = %v, want not found", importName, err)
+	}
+}
+
+func TestIPv6ForwardingRules(t *testing.T) {
+	j := newTestJig(t)
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:      lbName,
+		AllowHTTP: true,
+		TLS:       []*TLSCerts{{Key: "key", Cert: "cert"}},
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+		IPv6:      true,
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if l7.GetIPv6() == "" {
+		t.Errorf("l7.GetIPv6() = %q, want non-empty", l7.GetIPv6())
+	}
+	for _, tc := range []struct {
+		protocol utils.NamerProtocol
+		proxy    string
+	}{
+		{utils.HTTPProtocol, l7.tp.SelfLink},
+		{utils.HTTPSProtocol, l7.tps.SelfLink},
+	} {
+		key, _ := composite.CreateKey(j.fakeGCE, j.namer.IPv6ForwardingRule(lbName, tc.protocol), defaultScope)
+		fw, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion)
+		if err != nil {
+			t.Fatalf("GetForwardingRule(%v) = %v, want nil", key.Name, err)
+		}
+		if fw.IpVersion != ipVersionIPv6 {
+			t.Errorf("%v: IpVersion = %q, want %q", fw.Name, fw.IpVersion, ipVersionIPv6)
+		}
+		if !utils.EqualResourceIDs(fw.Target, tc.proxy) {
+			t.Errorf("%v: Target = %q, want %q", fw.Name, fw.Target, tc.proxy)
+		}
+	}
+
+	// Disabling IPv6 deletes the rules recorded in the status annotations.
+	lbInfo.Ingress.Annotations = map[string]string{
+		fmt.Sprintf("%v/ipv6-forwarding-rule", annotations.StatusPrefix):       l7.fw6.Name,
+		fmt.Sprintf("%v/ipv6-https-forwarding-rule", annotations.StatusPrefix): l7.fws6.Name,
+	}
+	lbInfo.IPv6 = false
+	if l7, err = j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if l7.GetIPv6() != "" {
+		t.Errorf("l7.GetIPv6() = %q, want empty", l7.GetIPv6())
+	}
+	for _, protocol := range []utils.NamerProtocol{utils.HTTPProtocol, utils.HTTPSProtocol} {
+		key, _ := composite.CreateKey(j.fakeGCE, j.namer.IPv6ForwardingRule(lbName, protocol), defaultScope)
+		if _, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+			t.Errorf("GetForwardingRule(%v) = %v, want not found", key.Name, err)
+		}
+	}
+}
+
+func TestAdditionalListeners(t *testing.T) {
+	j := newTestJig(t)
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:      lbName,
+		AllowHTTP: true,
+		TLS:       []*TLSCerts{{Key: "key", Cert: "cert"}},
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+		FrontendConfig: &frontendconfigv1beta1.FrontendConfig{
+			Spec: frontendconfigv1beta1.FrontendConfigSpec{
+				AdditionalListeners: []frontendconfigv1beta1.Listener{
+					{Protocol: frontendconfigv1beta1.ListenerProtocolHTTP, Port: 8080},
+					{Protocol: frontendconfigv1beta1.ListenerProtocolHTTPS, Port: 8443},
+				},
+			},
+		},
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	httpRule := j.namer.ListenerForwardingRule(lbName, utils.HTTPProtocol, 8080)
+	httpsRule := j.namer.ListenerForwardingRule(lbName, utils.HTTPSProtocol, 8443)
+	for _, tc := range []struct {
+		name      string
+		proxy     string
+		portRange string
+	}{
+		{httpRule, l7.tp.SelfLink, "8080-8080"},
+		{httpsRule, l7.tps.SelfLink, "8443-8443"},
+	} {
+		key, _ := composite.CreateKey(j.fakeGCE, tc.name, defaultScope)
+		fw, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion)
+		if err != nil {
+			t.Fatalf("GetForwardingRule(%v) = %v, want nil", tc.name, err)
+		}
+		if fw.PortRange != tc.portRange {
+			t.Errorf("%v: PortRange = %q, want %q", fw.Name, fw.PortRange, tc.portRange)
+		}
+		if fw.IPAddress != l7.GetIP() {
+			t.Errorf("%v: IPAddress = %q, want %q", fw.Name, fw.IPAddress, l7.GetIP())
+		}
+		if !utils.EqualResourceIDs(fw.Target, tc.proxy) {
+			t.Errorf("%v: Target = %q, want %q", fw.Name, fw.Target, tc.proxy)
+		}
+	}
+
+	// Removing a listener deletes its forwarding rule.
+	lbInfo.Ingress.Annotations = map[string]string{
+		fmt.Sprintf("%v/%v", annotations.StatusPrefix, listenerRulesStatusKey): listenerRuleNames(l7.listenerRules),
+	}
+	lbInfo.FrontendConfig.Spec.AdditionalListeners = lbInfo.FrontendConfig.Spec.AdditionalListeners[1:]
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	key, _ := composite.CreateKey(j.fakeGCE, httpRule, defaultScope)
+	if _, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetForwardingRule(%v) = %v, want not found", httpRule, err)
+	}
+
+	if err := j.pool.Delete(ingressName, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	key, _ = composite.CreateKey(j.fakeGCE, httpsRule, defaultScope)
+	if _, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetForwardingRule(%v) = %v, want not found", httpsRule, err)
+	}
+}
+
+func TestAdditionalListenersDeletedWithFrontend(t *testing.T) {
+	j := newTestJig(t)
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:      lbName,
+		AllowHTTP: true,
+		TLS:       []*TLSCerts{{Key: "key", Cert: "cert"}},
+		UrlMap:    gceUrlMap,
+		Ingress:   newIngress(),
+		FrontendConfig: &frontendconfigv1beta1.FrontendConfig{
+			Spec: frontendconfigv1beta1.FrontendConfigSpec{
+				AdditionalListeners: []frontendconfigv1beta1.Listener{
+					{Protocol: frontendconfigv1beta1.ListenerProtocolHTTP, Port: 8080},
+					{Protocol: frontendconfigv1beta1.ListenerProtocolHTTPS, Port: 8443},
+				},
+			},
+		},
+	}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+
+	// The forwarding rules of the listeners are deleted once the frontend is no longer configured.
+	lbInfo.AllowHTTP = false
+	lbInfo.TLS = nil
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if len(l7.listenerRules) != 0 {
+		t.Errorf("listenerRules = %v, want none", listenerRuleNames(l7.listenerRules))
+	}
+	for _, name := range []string{
+		j.namer.ListenerForwardingRule(lbName, utils.HTTPProtocol, 8080),
+		j.namer.ListenerForwardingRule(lbName, utils.HTTPSProtocol, 8443),
+	} {
+		key, _ := composite.CreateKey(j.fakeGCE, name, defaultScope)
+		if _, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+			t.Errorf("GetForwardingRule(%v) = %v, want not found", name, err)
+		}
+	}
+}
+
+func TestInvalidAdditionalListeners(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		listeners []frontendconfigv1beta1.Listener
+	}{
+		{"invalid protocol", []frontendconfigv1beta1.Listener{{Protocol: "TCP", Port: 8080}}},
+		{"port out of range", []frontendconfigv1beta1.Listener{{Protocol: frontendconfigv1beta1.ListenerProtocolHTTP, Port: 70000}}},
+		{"default port", []frontendconfigv1beta1.Listener{{Protocol: frontendconfigv1beta1.ListenerProtocolHTTP, Port: 443}}},
+		{"duplicate port", []frontendconfigv1beta1.Listener{
+			{Protocol: frontendconfigv1beta1.ListenerProtocolHTTP, Port: 8080},
+			{Protocol: frontendconfigv1beta1.ListenerProtocolHTTPS, Port: 8080},
+		}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			l7 := &L7{runtimeInfo: &L7RuntimeInfo{
+				FrontendConfig: &frontendconfigv1beta1.FrontendConfig{
+					Spec: frontendconfigv1beta1.FrontendConfigSpec{AdditionalListeners: tc.listeners},
+				},
+			}}
+			if _, err := l7.listeners(); err == nil {
+				t.Errorf("l7.listeners() = _, nil, want error")
+			}
+		})
+	}
+}
+
+func TestILBSubnetAndIP(t *testing.T) {
+	j := newTestJig(t)
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:                 lbName,
+		AllowHTTP:            true,
+		UrlMap:               gceUrlMap,
+		Ingress:              newILBIngress(),
+		ILBSubnet:            "my-subnet",
+		ILBIP:                "10.1.2.3",
+		ILBAllowGlobalAccess: true,
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	key, _ := composite.CreateKey(j.fakeGCE, j.FWName(lbName, false), l7.scope)
+	fw, err := composite.GetForwardingRule(j.fakeGCE, key, l7.Versions().ForwardingRule)
+	if err != nil {
+		t.Fatalf("GetForwardingRule(%v) = %v, want nil", key.Name, err)
+	}
+	wantSubnet := cloud.SelfLink(meta.VersionGA, j.fakeGCE.NetworkProjectID(), "subnetworks", meta.RegionalKey("my-subnet", j.fakeGCE.Region()))
+	if !utils.EqualResourceIDs(fw.Subnetwork, wantSubnet) {
+		t.Errorf("fw.Subnetwork = %q, want %q", fw.Subnetwork, wantSubnet)
+	}
+	if fw.IPAddress != "10.1.2.3" {
+		t.Errorf("fw.IPAddress = %q, want %q", fw.IPAddress, "10.1.2.3")
+	}
+	if !fw.AllowGlobalAccess {
+		t.Errorf("fw.AllowGlobalAccess = false, want true")
+	}
+
+	// Changing the subnet recreates the forwarding rule.
+	otherSubnet := cloud.SelfLink(meta.VersionGA, j.fakeGCE.NetworkProjectID(), "subnetworks", meta.RegionalKey("other-subnet", j.fakeGCE.Region()))
+	lbInfo.ILBSubnet = otherSubnet
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if fw, err = composite.GetForwardingRule(j.fakeGCE, key, l7.Versions().ForwardingRule); err != nil {
+		t.Fatalf("GetForwardingRule(%v) = %v, want nil", key.Name, err)
+	}
+	if !utils.EqualResourceIDs(fw.Subnetwork, otherSubnet) {
+		t.Errorf("fw.Subnetwork = %q, want %q", fw.Subnetwork, otherSubnet)
+	}
+}
+
+func TestInvalidILBConfig(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		subnet string
+		ip     string
+	}{
+		{desc: "subnet in other region", subnet: "projects/p/regions/other-region/subnetworks/my-subnet"},
+		{desc: "not a subnet", subnet: "projects/p/global/networks/my-network"},
+		{desc: "invalid ip", ip: "10.1.2"},
+		{desc: "ipv6", ip: "fd00::1"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			j := newTestJig(t)
+			gceUrlMap := utils.NewGCEURLMap()
+			gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+			lbInfo := &L7RuntimeInfo{
+				Name:      j.namer.LoadBalancer(ingressName),
+				AllowHTTP: true,
+				UrlMap:    gceUrlMap,
+				Ingress:   newILBIngress(),
+				ILBSubnet: tc.subnet,
+				ILBIP:     tc.ip,
+			}
+			if _, err := j.pool.Ensure(lbInfo); err == nil {
+				t.Errorf("pool.Ensure() = _, nil, want error")
+			}
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	j := newTestJig(t)
+
+	um1 := utils.NewGCEURLMap()
+	um1.PutPathRulesForHost("bar.example.com", []utils.PathRule{{Path: "/bar", Backend: utils.ServicePort{NodePort: 30000}}})
+	um1.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbInfo := &L7RuntimeInfo{Name: j.namer.LoadBalancer(ingressName), AllowHTTP: true, UrlMap: um1, Ingress: newIngress()}
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("j.pool.Ensure(%v) = %v", lbInfo, err)
+	}
+	umName := l7.um.Name
+
+	// A load balancer as ensured has no drift.
+	drifts, err := j.pool.Audit([]*L7RuntimeInfo{lbInfo})
+	if err != nil {
+		t.Fatalf("j.pool.Audit() = %v, want nil", err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("j.pool.Audit() = %+v, want no drift", drifts)
+	}
+
+	// Another url map is expected than the one in GCE.
+	um2 := utils.NewGCEURLMap()
+	um2.PutPathRulesForHost("foo.example.com", []utils.PathRule{{Path: "/foo", Backend: utils.ServicePort{NodePort: 30001}}})
+	um2.DefaultBackend = &utils.ServicePort{NodePort: 30002}
+	changedInfo := &L7RuntimeInfo{Name: lbInfo.Name, UrlMap: um2, Ingress: newIngress()}
+	drifts, err = j.pool.Audit([]*L7RuntimeInfo{changedInfo})
+	if err != nil {
+		t.Fatalf("j.pool.Audit() = %v, want nil", err)
+	}
+	want := []drift.Drift{{Kind: drift.KindUrlMap, Name: umName, Reason: drift.Modified, Ingress: lbInfo.Name, Fields: []string{"defaultService", "hostRules", "pathMatchers"}}}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("j.pool.Audit() = %+v, want %+v", drifts, want)
+	}
+
+	// The url map belongs to no Ingress.
+	drifts, err = j.pool.Audit(nil)
+	if err != nil {
+		t.Fatalf("j.pool.Audit() = %v, want nil", err)
+	}
+	want = []drift.Drift{{Kind: drift.KindUrlMap, Name: umName, Reason: drift.Orphaned}}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("j.pool.Audit() = %+v, want %+v", drifts, want)
+	}
+
+	// The url map was deleted.
+	key, err := composite.CreateKey(j.fakeGCE, umName, defaultScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := composite.DeleteUrlMap(j.fakeGCE, key, defaultVersion); err != nil {
+		t.Fatal(err)
+	}
+	drifts, err = j.pool.Audit([]*L7RuntimeInfo{lbInfo})
+	if err != nil {
+		t.Fatalf("j.pool.Audit() = %v, want nil", err)
+	}
+	want = []drift.Drift{{Kind: drift.KindUrlMap, Name: umName, Reason: drift.Missing, Ingress: lbInfo.Name}}
+	if !reflect.DeepEqual(drifts, want) {
+		t.Errorf("j.pool.Audit() = %+v, want %+v", drifts, want)
+	}
+}
+
+func TestAdoptResources(t *testing.T) {
+	j := newTestJig(t)
+	key := meta.GlobalKey("")
+
+	// Build a load balancer by hand.
+	key.Name = "my-map"
+	if err := composite.CreateUrlMap(j.fakeGCE, key, &composite.UrlMap{Name: "my-map", Description: "hand built", Version: defaultVersion}); err != nil {
+		t.Fatal(err)
+	}
+	um, err := composite.GetUrlMap(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Name = "my-proxy"
+	if err := composite.CreateTargetHttpProxy(j.fakeGCE, key, &composite.TargetHttpProxy{Name: "my-proxy", UrlMap: um.SelfLink, Version: defaultVersion}); err != nil {
+		t.Fatal(err)
+	}
+	tp, err := composite.GetTargetHttpProxy(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.fakeGCE.ReserveGlobalAddress(&compute.Address{Name: "my-ip", Address: "5.6.7.8"}); err != nil {
+		t.Fatal(err)
+	}
+	key.Name = "my-rule"
+	rule := &composite.ForwardingRule{Name: "my-rule", IPAddress: "5.6.7.8", PortRange: httpDefaultPortRange, Target: tp.SelfLink, Version: defaultVersion}
+	if err := composite.CreateForwardingRule(j.fakeGCE, key, rule); err != nil {
+		t.Fatal(err)
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	adopted := &annotations.AdoptedResources{UrlMap: "my-map", TargetHttpProxy: "my-proxy", ForwardingRule: "my-rule", StaticIP: "my-ip"}
+	lbInfo := &L7RuntimeInfo{
+		Name:             lbName,
+		AllowHTTP:        true,
+		UrlMap:           gceUrlMap,
+		Ingress:          newIngress(),
+		AdoptedResources: adopted,
+	}
+
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if l7.UrlMap().Name != "my-map" || l7.tp.Name != "my-proxy" || l7.fw.Name != "my-rule" {
+		t.Errorf("l7 uses url map %v, proxy %v, rule %v, want the adopted ones", l7.UrlMap().Name, l7.tp.Name, l7.fw.Name)
+	}
+	if l7.GetIP() != "5.6.7.8" {
+		t.Errorf("l7.GetIP() = %q, want %q", l7.GetIP(), "5.6.7.8")
+	}
+	key.Name = "my-map"
+	um, err = composite.GetUrlMap(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ownerIngress(um.Description); got != namespace+"/"+ingressName {
+		t.Errorf("owner of adopted url map = %q, want %q", got, namespace+"/"+ingressName)
+	}
+	key.Name = j.UMName(lbName)
+	if _, err := composite.GetUrlMap(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetUrlMap(%q) = %v, want not found", key.Name, err)
+	}
+	key.Name = j.TPName(lbName, false)
+	if _, err := composite.GetTargetHttpProxy(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetTargetHttpProxy(%q) = %v, want not found", key.Name, err)
+	}
+	key.Name = j.FWName(lbName, false)
+	if _, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetForwardingRule(%q) = %v, want not found", key.Name, err)
+	}
+
+	// Another load balancer cannot adopt the same resources.
+	otherInfo := &L7RuntimeInfo{
+		Name:             j.namer.LoadBalancer("other"),
+		AllowHTTP:        true,
+		UrlMap:           gceUrlMap,
+		Ingress:          newIngress(),
+		AdoptedResources: &annotations.AdoptedResources{UrlMap: "my-map"},
+	}
+	if _, err := j.pool.Ensure(otherInfo); err == nil {
+		t.Errorf("pool.Ensure() = nil, want error for url map adopted by %v", lbName)
+	}
+
+	// Resources of other Ingresses cannot be adopted.
+	key.Name = "their-map"
+	if err := composite.CreateUrlMap(j.fakeGCE, key, &composite.UrlMap{Name: "their-map", Description: utils.Description{IngressName: "other/ingress"}.String(), Version: defaultVersion}); err != nil {
+		t.Fatal(err)
+	}
+	otherInfo.AdoptedResources.UrlMap = "their-map"
+	if _, err := j.pool.Ensure(otherInfo); err == nil {
+		t.Errorf("pool.Ensure() = nil, want error for url map owned by another Ingress")
+	}
+
+	// Deleting the load balancer releases the adopted resources.
+	if err := j.pool.Delete(lbName, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	key.Name = "my-map"
+	um, err = composite.GetUrlMap(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatalf("GetUrlMap(%q) = %v, want nil", key.Name, err)
+	}
+	if um.Description != "hand built" {
+		t.Errorf("description of released url map = %q, want %q", um.Description, "hand built")
+	}
+	key.Name = "my-proxy"
+	if _, err := composite.GetTargetHttpProxy(j.fakeGCE, key, defaultVersion); err != nil {
+		t.Errorf("GetTargetHttpProxy(%q) = %v, want nil", key.Name, err)
+	}
+	key.Name = "my-rule"
+	if _, err := composite.GetForwardingRule(j.fakeGCE, key, defaultVersion); err != nil {
+		t.Errorf("GetForwardingRule(%q) = %v, want nil", key.Name, err)
+	}
+	if _, err := j.fakeGCE.GetGlobalAddress("my-ip"); err != nil {
+		t.Errorf("GetGlobalAddress(%q) = %v, want nil", "my-ip", err)
+	}
+
+	// Released resources can be adopted again.
+	otherInfo.AdoptedResources.UrlMap = "my-map"
+	if _, err := j.pool.Ensure(otherInfo); err != nil {
+		t.Errorf("pool.Ensure() = %v, want nil", err)
+	}
+}
+
+func TestReleaseAdoptedResource(t *testing.T) {
+	j := newTestJig(t)
+	key := meta.GlobalKey("my-map")
+	if err := composite.CreateUrlMap(j.fakeGCE, key, &composite.UrlMap{Name: "my-map", Description: "hand built", Version: defaultVersion}); err != nil {
+		t.Fatal(err)
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:             lbName,
+		AllowHTTP:        true,
+		UrlMap:           gceUrlMap,
+		Ingress:          newIngress(),
+		AdoptedResources: &annotations.AdoptedResources{UrlMap: "my-map"},
+	}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+
+	// Removing the url map from the annotation releases it, and the
+	// controller creates its own.
+	lbInfo.AdoptedResources = nil
+	l7, err := j.pool.Ensure(lbInfo)
+	if err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	if l7.UrlMap().Name != j.UMName(lbName) {
+		t.Errorf("l7.UrlMap().Name = %q, want %q", l7.UrlMap().Name, j.UMName(lbName))
+	}
+	um, err := composite.GetUrlMap(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatalf("GetUrlMap(%q) = %v, want nil", key.Name, err)
+	}
+	if um.Description != "hand built" {
+		t.Errorf("description of released url map = %q, want %q", um.Description, "hand built")
+	}
+}
+
+func TestGCAdoptedResources(t *testing.T) {
+	j := newTestJig(t)
+	key := meta.GlobalKey("my-map")
+	if err := composite.CreateUrlMap(j.fakeGCE, key, &composite.UrlMap{Name: "my-map", Description: "hand built", Version: defaultVersion}); err != nil {
+		t.Fatal(err)
+	}
+
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &utils.ServicePort{NodePort: 31234}
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:             lbName,
+		AllowHTTP:        true,
+		UrlMap:           gceUrlMap,
+		Ingress:          newIngress(),
+		AdoptedResources: &annotations.AdoptedResources{UrlMap: "my-map"},
+	}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+
+	// The load balancer has no url map named by the namer, but is still
+	// found through its adoption record.
+	if err := j.pool.GCOne(lbName); err != nil {
+		t.Fatalf("pool.GCOne(%q) = %v, want nil", lbName, err)
+	}
+	key.Name = j.TPName(lbName, false)
+	if _, err := composite.GetTargetHttpProxy(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetTargetHttpProxy(%q) = %v, want not found", key.Name, err)
+	}
+	key.Name = "my-map"
+	um, err := composite.GetUrlMap(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatalf("GetUrlMap(%q) = %v, want nil", key.Name, err)
+	}
+	if um.Description != "hand built" {
+		t.Errorf("description of released url map = %q, want %q", um.Description, "hand built")
+	}
+	if records, _ := j.pool.(*L7s).adoptions.GetAll(); len(records) != 0 {
+		t.Errorf("adoption records = %v, want none", records)
+	}
+}
+
+func TestReleaseAdoptedUrlMapBeforeBackendGC(t *testing.T) {
+	j := newTestJig(t)
+	backendPool := backends.NewPool(j.fakeGCE, j.namer)
+	healthChecker := healthchecks.NewHealthChecker(j.fakeGCE, "/", "/healthz", j.namer, types.NamespacedName{Namespace: "kube-system", Name: "default-http-backend"})
+	backendSyncer := backends.NewBackendSyncer(backendPool, healthChecker, j.namer, j.fakeGCE)
+	backendSyncer.Init(backends.NewFakeProbeProvider(map[utils.ServicePort]*api_v1.Probe{}))
+	// Like GCE, refuse to delete a backend service referenced by a url map.
+	j.mock.MockBackendServices.DeleteHook = func(ctx context.Context, key *meta.Key, m *cloud.MockBackendServices) (bool, error) {
+		for _, obj := range j.mock.MockUrlMaps.Objects {
+			um := &composite.UrlMap{DefaultService: obj.ToGA().DefaultService}
+			for _, pm := range obj.ToGA().PathMatchers {
+				um.PathMatchers = append(um.PathMatchers, &composite.PathMatcher{DefaultService: pm.DefaultService})
+			}
+			names, err := getBackendNames(um)
+			if err != nil {
+				return true, err
+			}
+			if slice.ContainsString(names, key.Name, nil) {
+				return true, &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("The backend service %v is being used by url map %v", key.Name, obj.ToGA().Name)}
+			}
+		}
+		return false, nil
+	}
+
+	// Build a url map by hand, routing to a backend service of the user.
+	key := meta.GlobalKey("my-backend")
+	if err := composite.CreateBackendService(j.fakeGCE, key, &composite.BackendService{Name: "my-backend", Version: defaultVersion}); err != nil {
+		t.Fatal(err)
+	}
+	be, err := composite.GetBackendService(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Name = "my-map"
+	handBuilt := &composite.UrlMap{
+		Name:           "my-map",
+		Description:    "hand built",
+		DefaultService: be.SelfLink,
+		HostRules:      []*composite.HostRule{{Hosts: []string{"foo.com"}, PathMatcher: "foo"}},
+		PathMatchers:   []*composite.PathMatcher{{Name: "foo", DefaultService: be.SelfLink}},
+		Version:        defaultVersion,
+	}
+	if err := composite.CreateUrlMap(j.fakeGCE, key, handBuilt); err != nil {
+		t.Fatal(err)
+	}
+
+	sp := utils.ServicePort{NodePort: 31234, Protocol: annotations.ProtocolHTTP}
+	if err := backendSyncer.Sync([]utils.ServicePort{sp}); err != nil {
+		t.Fatalf("backendSyncer.Sync() = %v, want nil", err)
+	}
+	gceUrlMap := utils.NewGCEURLMap()
+	gceUrlMap.DefaultBackend = &sp
+	lbName := j.namer.LoadBalancer(ingressName)
+	lbInfo := &L7RuntimeInfo{
+		Name:             lbName,
+		AllowHTTP:        true,
+		UrlMap:           gceUrlMap,
+		Ingress:          newIngress(),
+		AdoptedResources: &annotations.AdoptedResources{UrlMap: "my-map"},
+	}
+	if _, err := j.pool.Ensure(lbInfo); err != nil {
+		t.Fatalf("pool.Ensure() = %v, want nil", err)
+	}
+	um, err := composite.GetUrlMap(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := utils.KeyName(um.DefaultService); name != sp.BackendName(j.namer) {
+		t.Fatalf("default service of adopted url map = %q, want %q", name, sp.BackendName(j.namer))
+	}
+
+	// Releasing the url map restores its routing, so that the backend of the
+	// controller can be garbage collected.
+	if err := j.pool.Delete(lbName, features.GAResourceVersions, defaultScope); err != nil {
+		t.Fatalf("pool.Delete() = %v, want nil", err)
+	}
+	um, err = composite.GetUrlMap(j.fakeGCE, key, defaultVersion)
+	if err != nil {
+		t.Fatalf("GetUrlMap(%q) = %v, want nil", key.Name, err)
+	}
+	if um.Description != "hand built" || !mapsEqual(um, handBuilt) {
+		t.Errorf("released url map = %+v, want %+v", um, handBuilt)
+	}
+	if err := backendSyncer.GC(nil); err != nil {
+		t.Fatalf("backendSyncer.GC() = %v, want nil", err)
+	}
+	key.Name = sp.BackendName(j.namer)
+	if _, err := composite.GetBackendService(j.fakeGCE, key, defaultVersion); !utils.IsNotFoundError(err) {
+		t.Errorf("GetBackendService(%q) = %v, want not found", key.Name, err)
+	}
+	key.Name = "my-backend"
+	if _, err := composite.GetBackendService(j.fakeGCE, key, defaultVersion); err != nil {
+		t.Errorf("GetBackendService(%q) = %v, want nil", key.Name, err)
+	}
+}
@@ -36,7 +36,7 @@ func (l *L7) checkProxy() (err error) {
 	}
 	resourceID := cloud.ResourceID{ProjectID: "", Resource: "urlMaps", Key: key}
 	urlMapLink := resourceID.ResourcePath()
-	proxyName := l.namer.TargetProxy(l.Name, utils.HTTPProtocol)
+	proxyName := l.adoptedName(adoptTargetHttpProxy, l.namer.TargetProxy(l.Name, utils.HTTPProtocol))
 	key, err = l.CreateKey(proxyName)
 	if err != nil {
 		return err
@@ -100,7 +100,7 @@ func (l *L7) checkHttpsProxy() (err error) {
 	}
 	resourceID := cloud.ResourceID{ProjectID: "", Resource: "urlMaps", Key: key}
 	urlMapLink := resourceID.ResourcePath()
-	proxyName := l.namer.TargetProxy(l.Name, utils.HTTPSProtocol)
+	proxyName := l.adoptedName(adoptTargetHttpsProxy, l.namer.TargetProxy(l.Name, utils.HTTPSProtocol))
 	key, err = l.CreateKey(proxyName)
 	if err != nil {
 		return err
@@ -24,6 +24,7 @@ import (
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/composite"
+	"k8s.io/ingress-gce/pkg/drift"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
@@ -48,7 +49,17 @@ func (l *L7) ensureComputeURLMap() error {
 		return err
 	}
 	expectedMap := toCompositeURLMap(l.Name, l.runtimeInfo.UrlMap, l.namer, key)
+	expectedMap.Name = l.adoptedName(adoptUrlMap, expectedMap.Name)
 	key.Name = expectedMap.Name
+	// Only the description of an adopted url map records its owner, since
+	// the ones created by the controller are named after it. The description
+	// of other url maps is left alone.
+	_, adopted := l.adopted[adoptUrlMap]
+	if adopted {
+		if expectedMap.Description, err = l.description(); err != nil {
+			return err
+		}
+	}
 
 	expectedMap.Version = l.Versions().UrlMap
 	currentMap, err := composite.GetUrlMap(l.cloud, key, expectedMap.Version)
@@ -65,7 +76,10 @@ func (l *L7) ensureComputeURLMap() error {
 		return nil
 	}
 
-	if mapsEqual(currentMap, expectedMap) {
+	if !adopted {
+		expectedMap.Description = currentMap.Description
+	}
+	if mapsEqual(currentMap, expectedMap) && currentMap.Description == expectedMap.Description {
 		klog.V(4).Infof("URLMap for %q is unchanged", l.Name)
 		l.um = currentMap
 		return nil
@@ -81,6 +95,43 @@ func (l *L7) ensureComputeURLMap() error {
 	return nil
 }
 
+// auditURLMap compares the URLMap of this L7 with the one ensureComputeURLMap
+// would create. It returns nil if they match.
+func (l *L7) auditURLMap() (*drift.Drift, error) {
+	key, err := l.CreateKey("")
+	if err != nil {
+		return nil, err
+	}
+	expectedMap := toCompositeURLMap(l.Name, l.runtimeInfo.UrlMap, l.namer, key)
+	expectedMap.Name = l.adoptedName(adoptUrlMap, expectedMap.Name)
+	key.Name = expectedMap.Name
+
+	d := &drift.Drift{Kind: drift.KindUrlMap, Name: expectedMap.Name, Ingress: l.runtimeInfo.Name}
+	currentMap, err := composite.GetUrlMap(l.cloud, key, l.Versions().UrlMap)
+	if err != nil {
+		if utils.IsNotFoundError(err) {
+			d.Reason = drift.Missing
+			return d, nil
+		}
+		return nil, err
+	}
+
+	if !utils.EqualResourcePaths(currentMap.DefaultService, expectedMap.DefaultService) {
+		d.Fields = append(d.Fields, "defaultService")
+	}
+	// Compare the rules separately from the default service.
+	rules := *currentMap
+	rules.DefaultService = expectedMap.DefaultService
+	if !mapsEqual(&rules, expectedMap) {
+		d.Fields = append(d.Fields, "hostRules", "pathMatchers")
+	}
+	if len(d.Fields) == 0 {
+		return nil, nil
+	}
+	d.Reason = drift.Modified
+	return d, nil
+}
+
 // getBackendNames returns the names of backends in this L7 urlmap.
 func getBackendNames(computeURLMap *composite.UrlMap) ([]string, error) {
 	beNames := sets.NewString()
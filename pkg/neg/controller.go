@@ -21,13 +21,13 @@ import (
 	"strconv"
 	"time"
 
-	istioV1alpha3 "istio.io/api/networking/v1alpha3"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/dynamic"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	apimachinerytypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -40,14 +40,21 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/destinationrule"
 	"k8s.io/ingress-gce/pkg/flags"
 	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
+	"k8s.io/ingress-gce/pkg/neg/sharding"
+	negsyncer "k8s.io/ingress-gce/pkg/neg/syncers"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
 
+// negCRSyncPeriod is the period at which the status of NEGs is reported in ServiceNetworkEndpointGroups.
+const negCRSyncPeriod = 30 * time.Second
+
 func init() {
 	// register prometheus metrics
 	metrics.RegisterMetrics()
@@ -72,6 +79,12 @@ type Controller struct {
 	destinationRuleClient       dynamic.NamespaceableResourceInterface
 	enableCSM                   bool
 	csmServiceNEGSkipNamespaces []string
+	// hybridNegZone is the zone of NON_GCP_PRIVATE_IP_PORT NEGs of services without selector.
+	// If empty, services without selector do not get NON_GCP_PRIVATE_IP_PORT NEGs.
+	hybridNegZone string
+	// elector elects the shards of services owned by this replica.
+	// If nil, services are not sharded and all of them are owned.
+	elector *sharding.Elector
 
 	// serviceQueue takes service key as work item. Service key with format "namespace/name".
 	serviceQueue workqueue.RateLimitingInterface
@@ -98,8 +111,17 @@ func NewController(
 	gcPeriod time.Duration,
 	negSyncerType NegSyncerType,
 	enableReadinessReflector bool,
+	enableNegDrainCondition bool,
+	checkpointConfigMap string,
 	enableCSM bool,
 	csmServiceNEGSkipNamespaces []string,
+	hybridNegZone string,
+	elector *sharding.Elector,
+	gcDryRun bool,
+	gcMinAge time.Duration,
+	orphanReporter *OrphanReporter,
+	readinessHandler *readiness.WaitingPodsHandler,
+	syncerStatesHandler *SyncerStatesHandler,
 ) *Controller {
 	// init event recorder
 	// TODO: move event recorder initializer to main. Reuse it among controllers.
@@ -111,14 +133,38 @@ func NewController(
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme,
 		apiv1.EventSource{Component: "neg-controller"})
 
-	manager := newSyncerManager(namer, recorder, cloud, zoneGetter, ctx.PodInformer.GetIndexer(), ctx.ServiceInformer.GetIndexer(), ctx.EndpointInformer.GetIndexer(), negSyncerType)
+	var endpointSliceLister cache.Indexer
+	if ctx.EndpointSliceInformer != nil {
+		endpointSliceLister = ctx.EndpointSliceInformer.GetIndexer()
+	}
+	manager := newSyncerManager(namer, recorder, cloud, zoneGetter, ctx.PodInformer.GetIndexer(), ctx.ServiceInformer.GetIndexer(), ctx.EndpointInformer.GetIndexer(), endpointSliceLister, negSyncerType)
 	var reflector readiness.Reflector
 	if enableReadinessReflector {
-		reflector = readiness.NewReadinessReflector(ctx, manager)
+		reflector = readiness.NewReadinessReflector(ctx, manager, enableNegDrainCondition)
 	} else {
 		reflector = &readiness.NoopReflector{}
 	}
 	manager.reflector = reflector
+	if readinessHandler != nil {
+		readinessHandler.SetReflector(reflector)
+	}
+	manager.hybridZone = hybridNegZone
+	if elector != nil {
+		manager.ownsService = elector.Owns
+	}
+	manager.gcDryRun = gcDryRun
+	manager.gcMinAge = gcMinAge
+	manager.orphanReporter = orphanReporter
+	if syncerStatesHandler != nil {
+		syncerStatesHandler.SetManager(manager)
+	}
+	if checkpointConfigMap != "" {
+		manager.checkpoint = negsyncer.NewBatchingCheckpointer(storage.NewConfigMapVault(ctx.KubeClient, metav1.NamespaceSystem, checkpointConfigMap))
+	}
+	if ctx.SvcNegInformer != nil {
+		manager.svcNegClient = ctx.SvcNegClient
+		manager.svcNegLister = ctx.SvcNegInformer.GetIndexer()
+	}
 
 	negController := &Controller{
 		client:                      ctx.KubeClient,
@@ -138,6 +184,8 @@ func NewController(
 		reflector:                   reflector,
 		enableCSM:                   enableCSM,
 		csmServiceNEGSkipNamespaces: csmServiceNEGSkipNamespaces,
+		hybridNegZone:               hybridNegZone,
+		elector:                     elector,
 	}
 
 	ctx.IngressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -180,22 +228,37 @@ func NewController(
 		},
 	})
 
-	ctx.EndpointInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    negController.enqueueEndpoint,
-		DeleteFunc: negController.enqueueEndpoint,
-		UpdateFunc: func(old, cur interface{}) {
-			negController.enqueueEndpoint(cur)
-		},
-	})
+	if ctx.EndpointSliceInformer != nil {
+		// Syncers read EndpointSlices, so changes to Endpoints are ignored.
+		ctx.EndpointSliceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    negController.enqueueEndpointSlice,
+			DeleteFunc: negController.enqueueEndpointSlice,
+			UpdateFunc: func(old, cur interface{}) {
+				negController.enqueueEndpointSlice(cur)
+			},
+		})
+	} else {
+		ctx.EndpointInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    negController.enqueueEndpoint,
+			DeleteFunc: negController.enqueueEndpoint,
+			UpdateFunc: func(old, cur interface{}) {
+				negController.enqueueEndpoint(cur)
+			},
+		})
+	}
 
 	ctx.PodInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			pod := obj.(*apiv1.Pod)
-			negController.reflector.SyncPod(pod)
+			if negController.shouldSyncPod(pod) {
+				negController.reflector.SyncPod(pod)
+			}
 		},
 		UpdateFunc: func(old, cur interface{}) {
 			pod := cur.(*apiv1.Pod)
-			negController.reflector.SyncPod(pod)
+			if negController.shouldSyncPod(pod) {
+				negController.reflector.SyncPod(pod)
+			}
 		},
 	})
 
@@ -235,10 +298,78 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 		time.Sleep(c.gcPeriod)
 		wait.Until(c.gc, c.gcPeriod, stopCh)
 	}()
+	go wait.Until(c.syncNegCRs, negCRSyncPeriod, stopCh)
 	go c.reflector.Run(stopCh)
+	if c.elector != nil {
+		go c.elector.Run(sharding.Callbacks{
+			OnAcquired:  c.shardAcquired,
+			OnReleasing: c.shardReleasing,
+		}, stopCh)
+	}
 	<-stopCh
 }
 
+// shardAcquired enqueues the services of a shard acquired by this replica.
+func (c *Controller) shardAcquired(shard int) {
+	for _, key := range c.serviceLister.ListKeys() {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			continue
+		}
+		if c.elector.ShardOf(namespace, name) == shard {
+			c.serviceQueue.Add(key)
+		}
+	}
+}
+
+// shardReleasing stops the syncers of the services of a shard given up by this replica.
+// It returns true once none of them is syncing anymore.
+func (c *Controller) shardReleasing(shard int) bool {
+	return c.manager.StopSyncers(func(namespace, name string) bool {
+		return c.elector.ShardOf(namespace, name) == shard
+	})
+}
+
+// shouldSyncPod returns true if the readiness of the pod is reflected by this replica.
+// If services are sharded, this is the replica owning the service of the first NEG of the
+// pod in sorted order, or the shard of the pod itself if it is in no NEG, so that its
+// readiness gate is patched by a single replica.
+func (c *Controller) shouldSyncPod(pod *apiv1.Pod) bool {
+	if c.elector == nil {
+		return true
+	}
+	services, err := c.serviceLister.ByIndex(cache.NamespaceIndex, pod.Namespace)
+	if err != nil {
+		klog.Warningf("Failed to list services in namespace %q: %v", pod.Namespace, err)
+		return true
+	}
+	namespace, name := podShardKey(pod, services)
+	return c.elector.Owns(namespace, name)
+}
+
+// podShardKey returns the namespace and name whose shard reflects the readiness of the pod:
+// the service of the first NEG of the pod in sorted order, as found in the NEG status of the
+// services selecting the pod, or the pod itself if it is in no NEG.
+func podShardKey(pod *apiv1.Pod, services []interface{}) (string, string) {
+	firstNeg, namespace, name := "", pod.Namespace, pod.Name
+	for _, obj := range services {
+		service := obj.(*apiv1.Service)
+		if len(service.Spec.Selector) == 0 || !labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		negStatus, found, err := annotations.FromService(service).NEGStatus()
+		if err != nil || !found {
+			continue
+		}
+		for _, negName := range negStatus.NetworkEndpointGroups {
+			if firstNeg == "" || negName < firstNeg {
+				firstNeg, namespace, name = negName, service.Namespace, service.Name
+			}
+		}
+	}
+	return namespace, name
+}
+
 func (c *Controller) IsHealthy() error {
 	// check if last seen service and endpoint processing is more than an hour ago
 	if c.syncTracker.Get().Before(time.Now().Add(-time.Hour)) {
@@ -311,6 +442,11 @@ func (c *Controller) processService(key string) error {
 	if err != nil {
 		return err
 	}
+	if c.elector != nil && !c.elector.Owns(namespace, name) {
+		// The service is in a shard of another replica.
+		c.manager.StopSyncer(namespace, name)
+		return nil
+	}
 
 	obj, exists, err := c.serviceLister.GetByKey(key)
 	if err != nil {
@@ -329,6 +465,17 @@ func (c *Controller) processService(key string) error {
 	if err != nil {
 		return err
 	}
+	// Exposed ports may have NEGs with custom names.
+	namer := c.namer
+	if negAnnotation != nil {
+		names, err := customNegNames(negAnnotation)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			namer = &customNegNamer{NetworkEndpointGroupNamer: c.namer, names: names}
+		}
+	}
 
 	portInfoMap := make(negtypes.PortInfoMap)
 	needNeg := false
@@ -348,11 +495,11 @@ func (c *Controller) processService(key string) error {
 	if c.enableCSM {
 		needNeg = true
 		// Find all destination rules that using this service.
-		destinationRules := getDestinationRulesFromStore(c.destinationRuleLister, service)
+		destinationRules := destinationrule.ForService(c.destinationRuleLister, apimachinerytypes.NamespacedName{Namespace: namespace, Name: name})
 		// Fill all service ports into portinfomap
 		servicePorts := gatherPortMappingFromService(service)
 		for namespacedName, destinationRule := range destinationRules {
-			destinationRulePortInfoMap, err := negtypes.NewPortInfoMapWithDestinationRule(namespace, name, servicePorts, c.namer, true, destinationRule)
+			destinationRulePortInfoMap, err := negtypes.NewPortInfoMapWithDestinationRule(namespace, name, servicePorts, namer, true, destinationRule)
 			if err != nil {
 				klog.Warningf("DestinationRule(%s) contains duplicated subset, creating NEGs for the newer ones. %s", namespacedName.Name, err)
 			}
@@ -370,7 +517,7 @@ func (c *Controller) processService(key string) error {
 			klog.Infof("Skip NEG creation for services in namespace: %s", namespace)
 		} else {
 			needNeg = true
-			servicePortInfoMap := negtypes.NewPortInfoMap(namespace, name, servicePorts, c.namer, true)
+			servicePortInfoMap := negtypes.NewPortInfoMap(namespace, name, servicePorts, namer, true)
 			if err := portInfoMap.Merge(servicePortInfoMap); err != nil {
 				return fmt.Errorf("failed to merge service ports referenced by Istio:DestinationRule (%v): %v", servicePortInfoMap, err)
 			}
@@ -379,9 +526,23 @@ func (c *Controller) processService(key string) error {
 
 	if needNeg {
 		klog.V(2).Infof("Syncing service %q", key)
-		if err := c.mergeIngressPortInfo(negAnnotation, service, types.NamespacedName{Namespace: namespace, Name: name}, &portInfoMap); err != nil {
+		if err := c.mergeIngressPortInfo(negAnnotation, service, types.NamespacedName{Namespace: namespace, Name: name}, namer, &portInfoMap); err != nil {
 			return err
 		}
+		// Endpoints of services without selector are managed by hand and may be outside of GCP.
+		if c.hybridNegZone != "" && len(service.Spec.Selector) == 0 {
+			for key, portInfo := range portInfoMap {
+				portInfo.NegType = negtypes.NonGCPPrivateEndpointType
+				portInfoMap[key] = portInfo
+			}
+		}
+		// handle GCE_VM_IP NEGs used by L4 internal load balancers
+		if negAnnotation != nil && negAnnotation.NEGEnabledForVmIp() {
+			vmIpPortInfoMap := negtypes.NewPortInfoMapForVmIpNEG(namespace, name, c.namer)
+			if err := portInfoMap.Merge(vmIpPortInfoMap); err != nil {
+				return fmt.Errorf("failed to merge GCE_VM_IP NEG (%v): %v", vmIpPortInfoMap, err)
+			}
+		}
 		if err = c.syncNegStatusAnnotation(namespace, name, portInfoMap); err != nil {
 			return err
 		}
@@ -400,13 +561,13 @@ func (c *Controller) processService(key string) error {
 	return c.syncNegStatusAnnotation(namespace, name, make(negtypes.PortInfoMap))
 }
 
-func (c *Controller) mergeIngressPortInfo(negAnnotation *annotations.NegAnnotation, service *apiv1.Service, name types.NamespacedName, portInfoMap *negtypes.PortInfoMap) error {
+func (c *Controller) mergeIngressPortInfo(negAnnotation *annotations.NegAnnotation, service *apiv1.Service, name types.NamespacedName, namer negtypes.NetworkEndpointGroupNamer, portInfoMap *negtypes.PortInfoMap) error {
 	// handle NEGs used by ingress
 	if negAnnotation != nil && negAnnotation.NEGEnabledForIngress() {
 		// Only service ports referenced by ingress are synced for NEG
 		ings := getIngressServicesFromStore(c.ingressLister, service)
 		ingressSvcPorts := gatherPortMappingUsedByIngress(ings, service)
-		ingressPortInfoMap := negtypes.NewPortInfoMap(name.Namespace, name.Name, ingressSvcPorts, c.namer, true)
+		ingressPortInfoMap := negtypes.NewPortInfoMap(name.Namespace, name.Name, ingressSvcPorts, namer, true)
 		if err := portInfoMap.Merge(ingressPortInfoMap); err != nil {
 			return fmt.Errorf("failed to merge service ports referenced by ingress (%v): %v", ingressPortInfoMap, err)
 		}
@@ -424,7 +585,7 @@ func (c *Controller) mergeIngressPortInfo(negAnnotation *annotations.NegAnnotati
 			return err
 		}
 
-		if err := portInfoMap.Merge(negtypes.NewPortInfoMap(name.Namespace, name.Name, exposedNegSvcPort, c.namer, false)); err != nil {
+		if err := portInfoMap.Merge(negtypes.NewPortInfoMap(name.Namespace, name.Name, exposedNegSvcPort, namer, false)); err != nil {
 			return fmt.Errorf("failed to merge service ports exposed as standalone NEGs (%v) into ingress referenced service ports (%v): %v", exposedNegSvcPort, portInfoMap, err)
 		}
 	}
@@ -451,7 +612,7 @@ func (c *Controller) defaultBackendServicePortInfoMap() negtypes.PortInfoMap {
 // syncNegStatusAnnotation syncs the neg status annotation
 // it takes service namespace, name and the expected service ports for NEGs.
 func (c *Controller) syncNegStatusAnnotation(namespace, name string, portMap negtypes.PortInfoMap) error {
-	zones, err := c.zoneGetter.ListZones()
+	zones, err := c.negZones(portMap)
 	if err != nil {
 		return err
 	}
@@ -493,6 +654,16 @@ func (c *Controller) syncNegStatusAnnotation(namespace, name string, portMap neg
 	return err
 }
 
+// negZones returns the zones of the NEGs of the ports. NON_GCP_PRIVATE_IP_PORT NEGs are only in the hybrid NEG zone.
+func (c *Controller) negZones(portMap negtypes.PortInfoMap) ([]string, error) {
+	for _, portInfo := range portMap {
+		if portInfo.NegType == negtypes.NonGCPPrivateEndpointType {
+			return []string{c.hybridNegZone}, nil
+		}
+	}
+	return c.zoneGetter.ListZones()
+}
+
 // syncDestinationRuleNegStatusAnnotation syncs the destinationrule related neg status annotation
 func (c *Controller) syncDestinationRuleNegStatusAnnotation(namespace, destinationRuleName string, portmap negtypes.PortInfoMap) error {
 	zones, err := c.zoneGetter.ListZones()
@@ -557,6 +728,22 @@ func (c *Controller) enqueueEndpoint(obj interface{}) {
 	c.endpointQueue.Add(key)
 }
 
+// enqueueEndpointSlice enqueues the endpoint key of the service of obj, which
+// is the same as the service key.
+func (c *Controller) enqueueEndpointSlice(obj interface{}) {
+	slice, err := negtypes.ToEndpointSlice(obj)
+	if err != nil {
+		klog.Errorf("Failed to convert informer object to EndpointSlice: %v", err)
+		return
+	}
+	key := negtypes.EndpointSliceServiceKey(slice)
+	if key == "" {
+		klog.V(4).Infof("Ignoring EndpointSlice %s/%s without a service", slice.Namespace, slice.Name)
+		return
+	}
+	c.endpointQueue.Add(key)
+}
+
 func (c *Controller) enqueueService(obj interface{}) {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -580,12 +767,12 @@ func (c *Controller) enqueueDestinationRule(obj interface{}) {
 		klog.Errorf("Failed to convert informer object to Unstructured object")
 		return
 	}
-	targetServiceNamespace, drHost, _, err := castToDestinationRule(drus)
+	_, svc, err := destinationrule.FromUnstructured(drus)
 	if err != nil {
-		klog.Errorf("Failed to convert informer object to DestinationRule")
+		klog.Errorf("Failed to convert informer object to DestinationRule: %v", err)
 		return
 	}
-	svcKey := utils.ServiceKeyFunc(targetServiceNamespace, drHost)
+	svcKey := utils.ServiceKeyFunc(svc.Namespace, svc.Name)
 	c.enqueueService(cache.ExplicitKey(svcKey))
 }
 
@@ -595,6 +782,12 @@ func (c *Controller) gc() {
 	}
 }
 
+func (c *Controller) syncNegCRs() {
+	if err := c.manager.SyncNegCRs(); err != nil {
+		klog.Errorf("NEG controller failed to sync ServiceNetworkEndpointGroups: %v", err)
+	}
+}
+
 // gatherPortMappingUsedByIngress returns a map containing port:targetport
 // of all service ports of the service that are referenced by ingresses
 func gatherPortMappingUsedByIngress(ings []v1beta1.Ingress, svc *apiv1.Service) negtypes.SvcPortMap {
@@ -680,23 +873,3 @@ func gatherPortMappingFromService(svc *apiv1.Service) negtypes.SvcPortMap {
 	}
 	return servicePortMap
 }
-
-// getDestinationRulesFromStore returns all DestinationRules that refering service svc.
-// Please notice that a DestionationRule can point to a service in a different namespace.
-func getDestinationRulesFromStore(store cache.Store, svc *apiv1.Service) (drs map[apimachinerytypes.NamespacedName]*istioV1alpha3.DestinationRule) {
-	drs = make(map[apimachinerytypes.NamespacedName]*istioV1alpha3.DestinationRule)
-	for _, obj := range store.List() {
-		drUnstructed := obj.(*unstructured.Unstructured)
-		targetServiceNamespace, drHost, dr, err := castToDestinationRule(drUnstructed)
-		if err != nil {
-			klog.Errorf("Failed to cast Unstructured DestinationRule to DestinationRule.")
-			continue
-		}
-
-		if targetServiceNamespace == svc.Namespace && drHost == svc.Name {
-			// We want to return DestinationRule namespace but not the target service namespace.
-			drs[apimachinerytypes.NamespacedName{Namespace: drUnstructed.GetNamespace(), Name: drUnstructed.GetName()}] = dr
-		}
-	}
-	return
-}
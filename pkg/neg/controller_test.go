@@ -70,7 +70,7 @@ func newTestController(kubeClient kubernetes.Interface) *Controller {
 		ResyncPeriod:          1 * time.Second,
 		DefaultBackendSvcPort: defaultBackend,
 	}
-	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, gce.NewFakeGCECloud(gce.DefaultTestClusterValues()), namer, ctxConfig)
+	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, gce.NewFakeGCECloud(gce.DefaultTestClusterValues()), namer, ctxConfig)
 	controller := NewController(
 		negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network"),
 		context,
@@ -82,6 +82,15 @@ func newTestController(kubeClient kubernetes.Interface) *Controller {
 		// TODO(freehan): enable readiness reflector for unit tests
 		false,
 		false,
+		"",
+		false,
+		nil,
+		"",
+		nil,
+		false,
+		0,
+		nil,
+		nil,
 		nil,
 	)
 	return controller
@@ -215,6 +224,104 @@ func TestNewNEGService(t *testing.T) {
 	}
 }
 
+func TestNewHybridNEGService(t *testing.T) {
+	t.Parallel()
+
+	const hybridZone = "on-prem-zone"
+	for _, tc := range []struct {
+		desc          string
+		selector      map[string]string
+		expectNegType negtypes.NetworkEndpointType
+		expectZones   []string
+	}{
+		{
+			desc:          "service without selector",
+			expectNegType: negtypes.NonGCPPrivateEndpointType,
+			expectZones:   []string{hybridZone},
+		},
+		{
+			desc:          "service with selector",
+			selector:      map[string]string{"app": "test"},
+			expectNegType: negtypes.VmIpPortEndpointType,
+			expectZones:   []string{negtypes.TestZone1, negtypes.TestZone2},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			controller := newTestController(fake.NewSimpleClientset())
+			defer controller.stop()
+			controller.hybridNegZone = hybridZone
+			svc := newTestService(controller, false, []int32{80})
+			svc.Spec.Selector = tc.selector
+			controller.serviceLister.Add(svc)
+
+			if err := controller.processService(utils.ServiceKeyFunc(testServiceNamespace, testServiceName)); err != nil {
+				t.Fatalf("Failed to process service: %v", err)
+			}
+			validateSyncers(t, controller, 1, false)
+			for key := range controller.manager.(*syncerManager).syncerMap {
+				negType := key.NegType
+				if negType == "" {
+					negType = negtypes.VmIpPortEndpointType
+				}
+				if negType != tc.expectNegType {
+					t.Errorf("Expect NEG type of syncer %q to be %q, but got %q", key.String(), tc.expectNegType, negType)
+				}
+			}
+
+			svc, err := controller.client.CoreV1().Services(testServiceNamespace).Get(testServiceName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Failed to get service: %v", err)
+			}
+			negStatus, err := annotations.ParseNegStatus(svc.Annotations[annotations.NEGStatusKey])
+			if err != nil {
+				t.Fatalf("Failed to parse NEG status annotation: %v", err)
+			}
+			if !sets.NewString(negStatus.Zones...).Equal(sets.NewString(tc.expectZones...)) {
+				t.Errorf("Expect zones in NEG status to be %v, but got %v", tc.expectZones, negStatus.Zones)
+			}
+		})
+	}
+}
+
+func TestNewVmIpNEGService(t *testing.T) {
+	t.Parallel()
+
+	controller := newTestController(fake.NewSimpleClientset())
+	defer controller.stop()
+	svc := newTestService(controller, false, []int32{80})
+	svc.Annotations[annotations.NEGAnnotationKey] = `{"exposed_ports":{"80":{}},"vm_ip":true}`
+	svc.Spec.Selector = map[string]string{"app": "test"}
+	controller.serviceLister.Add(svc)
+	controller.client.CoreV1().Services(testServiceNamespace).Update(svc)
+
+	if err := controller.processService(utils.ServiceKeyFunc(testServiceNamespace, testServiceName)); err != nil {
+		t.Fatalf("Failed to process service: %v", err)
+	}
+	validateSyncers(t, controller, 2, false)
+	vmIpNegName := controller.namer.NEG(testServiceNamespace, testServiceName, negtypes.VmIpServicePort)
+	for key := range controller.manager.(*syncerManager).syncerMap {
+		expectNegType := negtypes.NetworkEndpointType("")
+		if key.Port == negtypes.VmIpServicePort {
+			expectNegType = negtypes.VmIpEndpointType
+		}
+		if key.NegType != expectNegType {
+			t.Errorf("Expect NEG type of syncer %q to be %q, but got %q", key.String(), expectNegType, key.NegType)
+		}
+	}
+
+	svc, err := controller.client.CoreV1().Services(testServiceNamespace).Get(testServiceName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	negStatus, err := annotations.ParseNegStatus(svc.Annotations[annotations.NEGStatusKey])
+	if err != nil {
+		t.Fatalf("Failed to parse NEG status annotation: %v", err)
+	}
+	if negName := negStatus.NetworkEndpointGroups["0"]; negName != vmIpNegName {
+		t.Errorf("Expect GCE_VM_IP NEG %q in NEG status, but got %q", vmIpNegName, negName)
+	}
+}
+
 func TestEnableNEGServiceWithIngress(t *testing.T) {
 	t.Parallel()
 
@@ -674,6 +781,58 @@ func generateNegAnnotation(ingress bool, svcPorts []int32) string {
 	return string(formattedAnnotation)
 }
 
+func TestPodShardKey(t *testing.T) {
+	t.Parallel()
+	newService := func(name string, selector map[string]string, negNames ...string) interface{} {
+		svc := &apiv1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: name},
+			Spec:       apiv1.ServiceSpec{Selector: selector},
+		}
+		if len(negNames) > 0 {
+			portNegMap := annotations.PortNegMap{}
+			for i, negName := range negNames {
+				portNegMap[strconv.Itoa(80+i)] = negName
+			}
+			negStatus, _ := annotations.NewNegStatus([]string{negtypes.TestZone1}, portNegMap).Marshal()
+			svc.Annotations = map[string]string{annotations.NEGStatusKey: negStatus}
+		}
+		return svc
+	}
+	pod := &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: "pod", Labels: map[string]string{"app": "test"}}}
+	selector := map[string]string{"app": "test"}
+
+	for _, tc := range []struct {
+		desc         string
+		services     []interface{}
+		expectedName string
+	}{
+		{
+			desc:         "no service",
+			expectedName: "pod",
+		},
+		{
+			desc:         "services without NEGs",
+			services:     []interface{}{newService("svc1", selector), newService("svc2", nil, "neg-a")},
+			expectedName: "pod",
+		},
+		{
+			desc: "service of the first NEG",
+			services: []interface{}{
+				newService("svc1", selector, "neg-b"),
+				newService("svc2", selector, "neg-c", "neg-a"),
+				newService("svc3", map[string]string{"app": "other"}, "neg-0"),
+				newService("svc4", selector),
+			},
+			expectedName: "svc2",
+		},
+	} {
+		namespace, name := podShardKey(pod, tc.services)
+		if namespace != testServiceNamespace || name != tc.expectedName {
+			t.Errorf("%s: podShardKey() = %s/%s, want %s/%s", tc.desc, namespace, name, testServiceNamespace, tc.expectedName)
+		}
+	}
+}
+
 func newTestIngress(name string) *v1beta1.Ingress {
 	return &v1beta1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
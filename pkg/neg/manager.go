@@ -18,17 +18,25 @@ package neg
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/compute/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/annotations"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negsyncer "k8s.io/ingress-gce/pkg/neg/syncers"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	svcnegclient "k8s.io/ingress-gce/pkg/svcneg/client/clientset/versioned"
+	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/klog"
 )
 
@@ -53,6 +61,9 @@ type syncerManager struct {
 	podLister      cache.Indexer
 	serviceLister  cache.Indexer
 	endpointLister cache.Indexer
+	// endpointSliceLister is set if syncers read EndpointSlices instead of
+	// Endpoints.
+	endpointSliceLister cache.Indexer
 
 	// TODO: lock per service instead of global lock
 	mu sync.Mutex
@@ -65,21 +76,39 @@ type syncerManager struct {
 	syncerMap map[negtypes.NegSyncerKey]negtypes.NegSyncer
 	// reflector handles NEG readiness gate and conditions for pods in NEG.
 	reflector readiness.Reflector
+	// checkpoint stores the checkpoints of NEGs for transaction syncers if set.
+	checkpoint negsyncer.Checkpointer
+	// svcNegClient and svcNegLister are set if the status of NEGs is reported
+	// in ServiceNetworkEndpointGroups.
+	svcNegClient svcnegclient.Interface
+	svcNegLister cache.Indexer
+	// hybridZone is the zone of NON_GCP_PRIVATE_IP_PORT NEGs.
+	hybridZone string
+	// ownsService returns true if the service is in a shard owned by this replica.
+	// It is set if services are sharded among the replicas of the controller.
+	ownsService func(namespace, name string) bool
+	// gcDryRun is true if GC only reports orphan NEGs without deleting them.
+	gcDryRun bool
+	// gcMinAge is the minimum age of orphan NEGs deleted by GC.
+	gcMinAge time.Duration
+	// orphanReporter keeps the orphan NEGs found by the last GC if set.
+	orphanReporter *OrphanReporter
 }
 
-func newSyncerManager(namer negtypes.NetworkEndpointGroupNamer, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, serviceLister cache.Indexer, endpointLister cache.Indexer, negSyncerType NegSyncerType) *syncerManager {
+func newSyncerManager(namer negtypes.NetworkEndpointGroupNamer, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, serviceLister cache.Indexer, endpointLister cache.Indexer, endpointSliceLister cache.Indexer, negSyncerType NegSyncerType) *syncerManager {
 	klog.V(2).Infof("NEG controller will use NEG syncer type: %q", negSyncerType)
 	return &syncerManager{
-		negSyncerType:  negSyncerType,
-		namer:          namer,
-		recorder:       recorder,
-		cloud:          cloud,
-		zoneGetter:     zoneGetter,
-		podLister:      podLister,
-		serviceLister:  serviceLister,
-		endpointLister: endpointLister,
-		svcPortMap:     make(map[serviceKey]negtypes.PortInfoMap),
-		syncerMap:      make(map[negtypes.NegSyncerKey]negtypes.NegSyncer),
+		negSyncerType:       negSyncerType,
+		namer:               namer,
+		recorder:            recorder,
+		cloud:               cloud,
+		zoneGetter:          zoneGetter,
+		podLister:           podLister,
+		serviceLister:       serviceLister,
+		endpointLister:      endpointLister,
+		endpointSliceLister: endpointSliceLister,
+		svcPortMap:          make(map[serviceKey]negtypes.PortInfoMap),
+		syncerMap:           make(map[negtypes.NegSyncerKey]negtypes.NegSyncer),
 	}
 }
 
@@ -87,7 +116,14 @@ func newSyncerManager(namer negtypes.NetworkEndpointGroupNamer, recorder record.
 func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts negtypes.PortInfoMap) error {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
+	if !manager.owns(namespace, name) {
+		klog.V(2).Infof("Skip ensuring syncers of service %s/%s, which is not in a shard owned by this replica", namespace, name)
+		return nil
+	}
 	key := getServiceKey(namespace, name)
+	if err := manager.ensureUniqueNegNames(key, newPorts); err != nil {
+		return err
+	}
 	currentPorts, ok := manager.svcPortMap[key]
 	if !ok {
 		currentPorts = make(negtypes.PortInfoMap)
@@ -123,31 +159,50 @@ func (manager *syncerManager) EnsureSyncers(namespace, name string, newPorts neg
 				TargetPort:   portInfo.TargetPort,
 				Subset:       portInfo.Subset,
 				SubsetLabels: portInfo.SubsetLabels,
+				NegType:      portInfo.NegType,
 			}
 
-			if manager.negSyncerType == transactionSyncer {
+			if portInfo.NegType == negtypes.NonGCPPrivateEndpointType {
+				syncer = negsyncer.NewHybridSyncer(
+					syncerKey,
+					portInfo.NegName,
+					manager.hybridZone,
+					manager.namer,
+					manager.recorder,
+					manager.cloud,
+					manager.serviceLister,
+					manager.endpointLister,
+				)
+			} else if manager.negSyncerType == transactionSyncer || portInfo.NegType == negtypes.VmIpEndpointType {
+				// GCE_VM_IP NEGs are only supported by the transaction syncer.
 				syncer = negsyncer.NewTransactionSyncer(
 					syncerKey,
 					portInfo.NegName,
+					manager.namer,
 					manager.recorder,
 					manager.cloud,
 					manager.zoneGetter,
 					manager.podLister,
 					manager.serviceLister,
 					manager.endpointLister,
+					manager.endpointSliceLister,
 					manager.reflector,
+					manager.checkpoint,
 				)
 			} else {
 				// Use batch syncer by default
 				syncer = negsyncer.NewBatchSyncer(
 					syncerKey,
 					portInfo.NegName,
+					manager.namer,
 					manager.recorder,
 					manager.cloud,
 					manager.zoneGetter,
 					manager.serviceLister,
 					manager.endpointLister,
+					manager.endpointSliceLister,
 					manager.podLister,
+					manager.reflector,
 				)
 			}
 
@@ -179,6 +234,29 @@ func (manager *syncerManager) StopSyncer(namespace, name string) {
 	return
 }
 
+// StopSyncers stops the syncers of the services selected by the filter. It returns true once none of them is syncing anymore.
+func (manager *syncerManager) StopSyncers(filter func(namespace, name string) bool) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	for key, ports := range manager.svcPortMap {
+		if !filter(key.namespace, key.name) {
+			continue
+		}
+		for svcPort, portInfo := range ports {
+			if syncer, ok := manager.syncerMap[getSyncerKey(key.namespace, key.name, svcPort, portInfo)]; ok {
+				syncer.Stop()
+			}
+		}
+		delete(manager.svcPortMap, key)
+	}
+	for key, syncer := range manager.syncerMap {
+		if filter(key.Namespace, key.Name) && (!syncer.IsStopped() || syncer.IsShuttingDown()) {
+			return false
+		}
+	}
+	return true
+}
+
 // Sync signals all syncers related to the service to sync.
 func (manager *syncerManager) Sync(namespace, name string) {
 	manager.mu.Lock()
@@ -204,6 +282,25 @@ func (manager *syncerManager) ShutDown() {
 	}
 }
 
+// SyncerStates returns snapshots of the internal states of all syncers, sorted by syncer key.
+func (manager *syncerManager) SyncerStates() []negtypes.NegSyncerState {
+	manager.mu.Lock()
+	syncers := make([]negtypes.NegSyncer, 0, len(manager.syncerMap))
+	for _, syncer := range manager.syncerMap {
+		syncers = append(syncers, syncer)
+	}
+	manager.mu.Unlock()
+
+	states := make([]negtypes.NegSyncerState, 0, len(syncers))
+	for _, syncer := range syncers {
+		states = append(states, syncer.State())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Key.String() < states[j].Key.String()
+	})
+	return states
+}
+
 // GC garbage collects syncers and NEGs.
 func (manager *syncerManager) GC() error {
 	klog.V(2).Infof("Start NEG garbage collection.")
@@ -265,14 +362,41 @@ func (manager *syncerManager) ReadinessGateEnabled(syncerKey negtypes.NegSyncerK
 	return false
 }
 
-// garbageCollectSyncer removes stopped syncer from syncerMap
+// garbageCollectSyncer removes stopped syncer from syncerMap, deletes the metrics of their
+// NEGs which have no syncer left and publishes the number of remaining syncers by state
 func (manager *syncerManager) garbageCollectSyncer() {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
+	counts := map[string]int{}
+	removedNegs := sets.NewString()
+	liveNegs := sets.NewString()
 	for key, syncer := range manager.syncerMap {
 		if syncer.IsStopped() && !syncer.IsShuttingDown() {
 			delete(manager.syncerMap, key)
+			removedNegs.Insert(syncer.State().NegName)
+			continue
 		}
+		liveNegs.Insert(syncer.State().NegName)
+		counts[syncerState(syncer)]++
+	}
+	// Another syncer may sync the same NEG, e.g. once the target port of the service changed.
+	for _, negName := range removedNegs.Difference(liveNegs).List() {
+		metrics.DeleteNegMetrics(negName)
+	}
+	metrics.SetSyncerCounts(counts)
+}
+
+// syncerState returns the state of the syncer reported by the syncer count metrics.
+func syncerState(syncer negtypes.NegSyncer) string {
+	switch {
+	case syncer.IsShuttingDown():
+		return metrics.SyncerStateShuttingDown
+	case syncer.IsStopped():
+		return metrics.SyncerStateStopped
+	case syncer.Status().LastSyncError != nil:
+		return metrics.SyncerStateError
+	default:
+		return metrics.SyncerStateRunning
 	}
 }
 
@@ -284,50 +408,242 @@ func (manager *syncerManager) garbageCollectNEG() error {
 		return fmt.Errorf("failed to retrieve aggregated NEG list: %v", err)
 	}
 
+	negServices := manager.negServices()
 	negNames := sets.String{}
 	for _, list := range zoneNEGList {
 		for _, neg := range list {
-			if manager.namer.IsNEG(neg.Name) {
+			if manager.isClusterNEG(neg) && manager.ownsNEG(neg, negServices) {
 				negNames.Insert(neg.Name)
 			}
 		}
 	}
 
+	desiredNegNames := sets.String{}
 	func() {
 		manager.mu.Lock()
 		defer manager.mu.Unlock()
 		for _, portInfoMap := range manager.svcPortMap {
 			for _, portInfo := range portInfoMap {
-				negNames.Delete(portInfo.NegName)
+				desiredNegNames.Insert(portInfo.NegName)
 			}
 		}
 	}()
+	negNames = negNames.Difference(desiredNegNames)
+	manager.garbageCollectCheckpoints(desiredNegNames, negNames)
+
+	// NEGs which are backends of a backend service are never deleted, whoever created them.
+	inUse, err := manager.negsInUse()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve NEGs in use by backend services: %v", err)
+	}
 
 	// This section includes a potential race condition between deleting neg here and users adds the neg annotation.
 	// The worst outcome of the race condition is that neg is deleted in the end but user actually specifies a neg.
 	// This would be resolved (sync neg) when the next endpoint update or resync arrives.
 	// TODO: avoid race condition here
-	for zone := range zoneNEGList {
-		for _, name := range negNames.List() {
-			if err := manager.ensureDeleteNetworkEndpointGroup(name, zone); err != nil {
-				return fmt.Errorf("failed to delete NEG %q in %q: %v", name, zone, err)
+	report := &OrphanReport{Time: time.Now(), DryRun: manager.gcDryRun, MinAge: manager.gcMinAge.String(), Orphans: []OrphanNEG{}}
+	var errList []error
+	for zone, list := range zoneNEGList {
+		for _, neg := range list {
+			// A NEG with a custom name in another zone may not belong to the cluster.
+			if !negNames.Has(neg.Name) || !manager.isClusterNEG(neg) {
+				continue
 			}
+			orphan := OrphanNEG{Name: neg.Name, Zone: zone, Description: neg.Description, CreationTimestamp: neg.CreationTimestamp}
+			switch {
+			case inUse.Has(negKey(neg.Name, zone)):
+				orphan.Action = OrphanInUse
+			case !manager.oldEnough(neg):
+				orphan.Action = OrphanTooYoung
+			case manager.gcDryRun:
+				orphan.Action = OrphanDryRun
+			default:
+				orphan.Action = OrphanDeleted
+				if err := manager.ensureDeleteNetworkEndpointGroup(neg.Name, zone); err != nil {
+					orphan.Action = OrphanDeleteFailed
+					orphan.Error = err.Error()
+					errList = append(errList, fmt.Errorf("failed to delete NEG %q in %q: %v", neg.Name, zone, err))
+				}
+			}
+			if orphan.Action != OrphanDeleted {
+				klog.V(2).Infof("Keeping orphan NEG %q in %q: %s", neg.Name, zone, orphan.Action)
+			}
+			report.Orphans = append(report.Orphans, orphan)
 		}
 	}
-	return nil
+	if manager.orphanReporter != nil {
+		manager.orphanReporter.setReport(report)
+	}
+	return utilerrors.NewAggregate(errList)
+}
+
+// negsInUse returns the keys of the NEGs which are backends of backend services.
+func (manager *syncerManager) negsInUse() (sets.String, error) {
+	backendServices, err := manager.cloud.ListBackendServices()
+	if err != nil {
+		return nil, err
+	}
+	keys := sets.NewString()
+	for _, bs := range backendServices {
+		for _, backend := range bs.Backends {
+			id, err := cloud.ParseResourceURL(backend.Group)
+			if err != nil || id.Resource != "networkEndpointGroups" {
+				continue
+			}
+			keys.Insert(negKey(id.Key.Name, id.Key.Zone))
+		}
+	}
+	return keys, nil
+}
+
+// oldEnough returns true if the NEG was created at least the minimum GC age ago.
+// The age of a NEG whose creation time can not be parsed is unknown, so it is not old enough.
+func (manager *syncerManager) oldEnough(neg *compute.NetworkEndpointGroup) bool {
+	if manager.gcMinAge <= 0 {
+		return true
+	}
+	created, err := time.Parse(time.RFC3339, neg.CreationTimestamp)
+	if err != nil {
+		return false
+	}
+	return time.Since(created) >= manager.gcMinAge
+}
+
+// garbageCollectCheckpoints removes the checkpoints of NEGs which are not desired by best effort.
+// If services are sharded, the checkpoints are shared with other replicas, and only the ones of
+// the stale NEGs of the owned shards are removed.
+func (manager *syncerManager) garbageCollectCheckpoints(desiredNegNames, staleNegNames sets.String) {
+	if manager.checkpoint == nil {
+		return
+	}
+	checkpoints, err := manager.checkpoint.GetAll()
+	if err != nil {
+		klog.Warningf("Failed to retrieve NEG checkpoints: %v", err)
+		return
+	}
+	for name := range checkpoints {
+		if desiredNegNames.Has(name) || (manager.ownsService != nil && !staleNegNames.Has(name)) {
+			continue
+		}
+		if err := manager.checkpoint.Remove(name); err != nil {
+			klog.Warningf("Failed to remove checkpoint of NEG %q: %v", name, err)
+		}
+	}
+}
+
+// negKey returns the key of a NEG in a zone.
+func negKey(name, zone string) string {
+	return fmt.Sprintf("%s/%s", zone, name)
 }
 
 // ensureDeleteNetworkEndpointGroup ensures neg is delete from zone
 func (manager *syncerManager) ensureDeleteNetworkEndpointGroup(name, zone string) error {
-	_, err := manager.cloud.GetNetworkEndpointGroup(name, zone)
+	neg, err := manager.cloud.GetNetworkEndpointGroup(name, zone)
 	if err != nil {
 		// Assume error is caused by not existing
 		return nil
 	}
+	if !manager.isClusterNEG(neg) {
+		// A NEG with a custom name in another zone may not belong to the cluster.
+		klog.V(4).Infof("Skip deleting NEG %q in %q which was not created by this cluster.", name, zone)
+		return nil
+	}
 	klog.V(2).Infof("Deleting NEG %q in %q.", name, zone)
 	return manager.cloud.DeleteNetworkEndpointGroup(name, zone)
 }
 
+// ensureUniqueNegNames returns an error if a NEG name of the ports is used by another service.
+// Only the services known to this manager are checked, so a NEG name used by a service of another
+// shard or cluster is not caught here. Such NEGs are refused when the syncer ensures the NEG, as
+// their description does not match the service port.
+// It assumes the manager lock is held.
+func (manager *syncerManager) ensureUniqueNegNames(key serviceKey, ports negtypes.PortInfoMap) error {
+	negNames := sets.NewString()
+	for _, portInfo := range ports {
+		negNames.Insert(portInfo.NegName)
+	}
+	for svcKey, portInfoMap := range manager.svcPortMap {
+		if svcKey == key {
+			continue
+		}
+		for _, portInfo := range portInfoMap {
+			if negNames.Has(portInfo.NegName) {
+				return fmt.Errorf("NEG name %q is already used by service %s", portInfo.NegName, svcKey.Key())
+			}
+		}
+	}
+	return nil
+}
+
+// isClusterNEG returns true if the NEG was created by this cluster. NEGs with generated names
+// are recognized by their name, NEGs with custom names by their description. A NEG whose
+// description names another cluster is never recognized, even if its name matches, as the
+// UID of the namer may not be unique in a shared project.
+func (manager *syncerManager) isClusterNEG(neg *compute.NetworkEndpointGroup) bool {
+	uid := manager.namer.UID()
+	descUID := utils.NegDescriptionFromString(neg.Description).ClusterUID
+	if descUID != "" && uid != "" && descUID != uid {
+		return false
+	}
+	if manager.namer.IsNEG(neg.Name) {
+		return true
+	}
+	return uid != "" && descUID == uid
+}
+
+// owns returns true if the service is in a shard owned by this replica, or if services are not sharded.
+func (manager *syncerManager) owns(namespace, name string) bool {
+	return manager.ownsService == nil || manager.ownsService(namespace, name)
+}
+
+// ownsNEG returns true if the NEG is of a service in a shard owned by this replica, as found
+// in its description. The service of a NEG without description is looked up in negServices.
+// NEGs of unknown services are sharded by their name, so that exactly one replica collects them.
+func (manager *syncerManager) ownsNEG(neg *compute.NetworkEndpointGroup, negServices map[string]serviceKey) bool {
+	if manager.ownsService == nil {
+		return true
+	}
+	desc := utils.NegDescriptionFromString(neg.Description)
+	if desc.Namespace == "" || desc.ServiceName == "" {
+		key, ok := negServices[neg.Name]
+		if !ok {
+			return manager.ownsService("", neg.Name)
+		}
+		return manager.ownsService(key.namespace, key.name)
+	}
+	return manager.ownsService(desc.Namespace, desc.ServiceName)
+}
+
+// negServices returns the services of the NEGs by NEG name, from the ports of the services
+// known to the manager and from the NEG status annotation of the services. It is only needed
+// to find the shard of NEGs without description, so it is nil if services are not sharded.
+func (manager *syncerManager) negServices() map[string]serviceKey {
+	if manager.ownsService == nil {
+		return nil
+	}
+	negServices := map[string]serviceKey{}
+	if manager.serviceLister != nil {
+		for _, obj := range manager.serviceLister.List() {
+			svc := obj.(*v1.Service)
+			negStatus, found, err := annotations.FromService(svc).NEGStatus()
+			if err != nil || !found {
+				continue
+			}
+			for _, negName := range negStatus.NetworkEndpointGroups {
+				negServices[negName] = getServiceKey(svc.Namespace, svc.Name)
+			}
+		}
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	for key, portInfoMap := range manager.svcPortMap {
+		for _, portInfo := range portInfoMap {
+			negServices[portInfo.NegName] = key
+		}
+	}
+	return negServices
+}
+
 // getSyncerKey encodes a service namespace, name, service port and targetPort into a string key
 func getSyncerKey(namespace, name string, servicePortKey negtypes.PortInfoMapKey, portInfo negtypes.PortInfo) negtypes.NegSyncerKey {
 	return negtypes.NegSyncerKey{
@@ -337,6 +653,7 @@ func getSyncerKey(namespace, name string, servicePortKey negtypes.PortInfoMapKey
 		TargetPort:   portInfo.TargetPort,
 		Subset:       servicePortKey.Subset,
 		SubsetLabels: portInfo.SubsetLabels,
+		NegType:      portInfo.NegType,
 	}
 }
 
@@ -365,6 +682,9 @@ func removeCommonPorts(p1, p2 negtypes.PortInfoMap) {
 		if portInfo1.SubsetLabels != portInfo2.SubsetLabels {
 			continue
 		}
+		if portInfo1.NegType != portInfo2.NegType {
+			continue
+		}
 
 		delete(p1, port)
 		delete(p2, port)
@@ -22,6 +22,7 @@ import (
 
 	"reflect"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"google.golang.org/api/compute/v1"
 	apiv1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
@@ -31,11 +32,14 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	"k8s.io/ingress-gce/pkg/neg/types"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/storage"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/legacy-cloud-providers/gce"
 )
@@ -71,7 +75,7 @@ func NewTestSyncerManager(kubeClient kubernetes.Interface) *syncerManager {
 		ResyncPeriod:          1 * time.Second,
 		DefaultBackendSvcPort: defaultBackend,
 	}
-	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, gce.NewFakeGCECloud(gce.DefaultTestClusterValues()), namer, ctxConfig)
+	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, gce.NewFakeGCECloud(gce.DefaultTestClusterValues()), namer, ctxConfig)
 
 	manager := newSyncerManager(
 		namer,
@@ -81,9 +85,10 @@ func NewTestSyncerManager(kubeClient kubernetes.Interface) *syncerManager {
 		context.PodInformer.GetIndexer(),
 		context.ServiceInformer.GetIndexer(),
 		context.EndpointInformer.GetIndexer(),
+		nil,
 		transactionSyncer,
 	)
-	manager.reflector = readiness.NewReadinessReflector(context, manager)
+	manager.reflector = readiness.NewReadinessReflector(context, manager, false)
 	return manager
 }
 
@@ -301,6 +306,55 @@ func TestGarbageCollectionSyncer(t *testing.T) {
 	}
 }
 
+func TestGarbageCollectionSyncerKeepsSharedNegMetrics(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	namespace, name := "metrics-ns", "metrics-svc"
+	negName := manager.namer.NEG(namespace, name, port1)
+	endpointCount := func() float64 {
+		return testutil.ToFloat64(metrics.Endpoints.WithLabelValues(negName, negtypes.TestZone1))
+	}
+	ensureSyncers := func(targetPort string) {
+		ports := negtypes.NewPortInfoMap(namespace, name, negtypes.SvcPortMap{port1: targetPort}, manager.namer, false)
+		if err := manager.EnsureSyncers(namespace, name, ports); err != nil {
+			t.Fatalf("Failed to ensure syncers of %s/%s: %v", namespace, name, err)
+		}
+	}
+	waitStopped := func(syncer negtypes.NegSyncer) {
+		if err := wait.PollImmediate(time.Second, 30*time.Second, func() (bool, error) {
+			return !syncer.IsShuttingDown() && syncer.IsStopped(), nil
+		}); err != nil {
+			t.Fatalf("Syncer failed to shutdown: %v", err)
+		}
+	}
+
+	ensureSyncers(targetPort1)
+	oldSyncer := manager.syncerMap[getSyncerKey(namespace, name, negtypes.PortInfoMapKey{ServicePort: port1}, negtypes.PortInfo{TargetPort: targetPort1})]
+	metrics.SetNegEndpoints(negName, map[string]int{negtypes.TestZone1: 3})
+
+	// The target port changes, so a new syncer syncs the same NEG.
+	ensureSyncers(targetPort2)
+	waitStopped(oldSyncer)
+	manager.garbageCollectSyncer()
+	if len(manager.syncerMap) != 1 {
+		t.Fatalf("Expect 1 syncer left, but got %v", len(manager.syncerMap))
+	}
+	if count := endpointCount(); count != 3 {
+		t.Errorf("Expect endpoint count of NEG %q to be kept for its live syncer, but got %v", negName, count)
+	}
+
+	// The metrics of the NEG are deleted once it has no syncer left.
+	manager.StopSyncer(namespace, name)
+	for _, syncer := range manager.syncerMap {
+		waitStopped(syncer)
+	}
+	manager.garbageCollectSyncer()
+	if count := endpointCount(); count != 0 {
+		t.Errorf("Expect endpoint count of NEG %q to be deleted, but got %v", negName, count)
+	}
+}
+
 func TestGarbageCollectionNEG(t *testing.T) {
 	t.Parallel()
 
@@ -309,9 +363,12 @@ func TestGarbageCollectionNEG(t *testing.T) {
 		t.Fatalf("Failed to create endpoint: %v", err)
 	}
 	manager := NewTestSyncerManager(kubeClient)
+	checkpoint := storage.NewFakeConfigMapVault(metav1.NamespaceSystem, "neg-checkpoint")
+	manager.checkpoint = checkpoint
 	svcPort := int32(80)
 	ports := make(types.PortInfoMap)
-	ports[negtypes.PortInfoMapKey{ServicePort: svcPort, Subset: ""}] = types.PortInfo{TargetPort: "namedport", NegName: manager.namer.NEG(testServiceNamespace, testServiceName, svcPort)}
+	desiredNegName := manager.namer.NEG(testServiceNamespace, testServiceName, svcPort)
+	ports[negtypes.PortInfoMapKey{ServicePort: svcPort, Subset: ""}] = types.PortInfo{TargetPort: "namedport", NegName: desiredNegName}
 	if err := manager.EnsureSyncers(testServiceNamespace, testServiceName, ports); err != nil {
 		t.Fatalf("Failed to ensure syncer: %v", err)
 	}
@@ -320,6 +377,8 @@ func TestGarbageCollectionNEG(t *testing.T) {
 	manager.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{
 		Name: negName,
 	}, negtypes.TestZone1)
+	checkpoint.Put(negName, "{}")
+	checkpoint.Put(desiredNegName, "{}")
 
 	if err := manager.GC(); err != nil {
 		t.Fatalf("Failed to GC: %v", err)
@@ -331,11 +390,265 @@ func TestGarbageCollectionNEG(t *testing.T) {
 			t.Errorf("Expect NEG %q to be GCed.", negName)
 		}
 	}
+	checkpoints, _ := checkpoint.GetAll()
+	if _, ok := checkpoints[negName]; ok {
+		t.Errorf("Expect checkpoint of NEG %q to be GCed.", negName)
+	}
+	if _, ok := checkpoints[desiredNegName]; !ok {
+		t.Errorf("Expect checkpoint of NEG %q to be kept.", desiredNegName)
+	}
 
 	// make sure there is no leaking go routine
 	manager.StopSyncer(testServiceNamespace, testServiceName)
 }
 
+func TestGarbageCollectionCustomNamedNEG(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	ownedDescription := utils.NegDescription{ClusterUID: manager.namer.UID(), Namespace: testServiceNamespace, ServiceName: testServiceName, Port: "80"}
+	foreignDescription := utils.NegDescription{ClusterUID: "other-cluster", Namespace: testServiceNamespace, ServiceName: testServiceName, Port: "80"}
+	for _, neg := range []*compute.NetworkEndpointGroup{
+		{Name: "owned-neg", Description: ownedDescription.String()},
+		{Name: "foreign-neg", Description: foreignDescription.String()},
+		{Name: "unknown-neg"},
+	} {
+		manager.cloud.CreateNetworkEndpointGroup(neg, negtypes.TestZone1)
+	}
+	// A NEG with the same name as an owned NEG in another zone is not deleted if it is not owned.
+	manager.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: "owned-neg", Description: foreignDescription.String()}, negtypes.TestZone2)
+
+	if err := manager.GC(); err != nil {
+		t.Fatalf("Failed to GC: %v", err)
+	}
+
+	for zone, expectNegs := range map[string]sets.String{
+		negtypes.TestZone1: sets.NewString("foreign-neg", "unknown-neg"),
+		negtypes.TestZone2: sets.NewString("owned-neg"),
+	} {
+		negs, _ := manager.cloud.ListNetworkEndpointGroup(zone)
+		negNames := sets.NewString()
+		for _, neg := range negs {
+			negNames.Insert(neg.Name)
+		}
+		if !negNames.Equal(expectNegs) {
+			t.Errorf("Expect NEGs in %q to be %v after GC, but got %v", zone, expectNegs.List(), negNames.List())
+		}
+	}
+}
+
+func TestGarbageCollectionShardedNEG(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	checkpoint := storage.NewFakeConfigMapVault(metav1.NamespaceSystem, "neg-checkpoint")
+	manager.checkpoint = checkpoint
+	ownedNegName := manager.namer.NEG(namespace1, name1, port1)
+	otherNegName := manager.namer.NEG(namespace2, name1, port1)
+	// NEGs without description of unknown services are sharded by their name.
+	legacyNegName := manager.namer.NEG(namespace1, name2, port1)
+	ownedUnknownNegName := manager.namer.NEG(namespace2, name2, port1)
+	manager.ownsService = func(namespace, name string) bool {
+		return namespace == namespace1 || namespace == "" && name == ownedUnknownNegName
+	}
+
+	// NEGs without description are found in the NEG status of their service.
+	ownedLegacyNegName := manager.namer.NEG(namespace1, name3, port1)
+	otherLegacyNegName := manager.namer.NEG(namespace2, name3, port1)
+	for _, namespace := range []string{namespace1, namespace2} {
+		negStatus, _ := annotations.NewNegStatus([]string{negtypes.TestZone1}, annotations.PortNegMap{"1000": manager.namer.NEG(namespace, name3, port1)}).Marshal()
+		manager.serviceLister.Add(&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        name3,
+				Annotations: map[string]string{annotations.NEGStatusKey: negStatus},
+			},
+		})
+	}
+	for negName, desc := range map[string]string{
+		ownedNegName:        utils.NegDescription{Namespace: namespace1, ServiceName: name1}.String(),
+		otherNegName:        utils.NegDescription{Namespace: namespace2, ServiceName: name1}.String(),
+		legacyNegName:       "",
+		ownedUnknownNegName: "",
+		ownedLegacyNegName:  "",
+		otherLegacyNegName:  "",
+	} {
+		manager.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName, Description: desc}, negtypes.TestZone1)
+		checkpoint.Put(negName, "{}")
+	}
+
+	if err := manager.GC(); err != nil {
+		t.Fatalf("Failed to GC: %v", err)
+	}
+
+	// Only the NEG of the owned shard is GCed, the other replicas own the rest.
+	negNames := sets.NewString()
+	negs, _ := manager.cloud.ListNetworkEndpointGroup(negtypes.TestZone1)
+	for _, neg := range negs {
+		negNames.Insert(neg.Name)
+	}
+	if expect := sets.NewString(otherNegName, legacyNegName, otherLegacyNegName); !negNames.Equal(expect) {
+		t.Errorf("Expect NEGs %v to be kept, but got %v", expect.List(), negNames.List())
+	}
+	checkpoints, _ := checkpoint.GetAll()
+	checkpointNames := sets.StringKeySet(checkpoints)
+	if expect := sets.NewString(otherNegName, legacyNegName, otherLegacyNegName); !checkpointNames.Equal(expect) {
+		t.Errorf("Expect checkpoints of NEGs %v to be kept, but got %v", expect.List(), checkpointNames.List())
+	}
+}
+
+func TestStopSyncers(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	owned := map[string]bool{namespace1: true, namespace2: true}
+	manager.ownsService = func(namespace, name string) bool {
+		return owned[namespace]
+	}
+	for _, namespace := range []string{namespace1, namespace2} {
+		ports := negtypes.NewPortInfoMap(namespace, name1, negtypes.SvcPortMap{port1: targetPort1}, manager.namer, false)
+		if err := manager.EnsureSyncers(namespace, name1, ports); err != nil {
+			t.Fatalf("Failed to ensure syncers of %s/%s: %v", namespace, name1, err)
+		}
+	}
+
+	// The shard of namespace1 is given up.
+	owned[namespace1] = false
+	inShard := func(namespace, name string) bool { return namespace == namespace1 }
+	if err := wait.PollImmediate(time.Second, 10*time.Second, func() (bool, error) {
+		return manager.StopSyncers(inShard), nil
+	}); err != nil {
+		t.Fatalf("Expect syncers of %s to stop, but got %v", namespace1, err)
+	}
+	for key, syncer := range manager.syncerMap {
+		if stopped := syncer.IsStopped(); stopped != (key.Namespace == namespace1) {
+			t.Errorf("Expect syncer %s to be stopped: %v, but got %v", key.String(), key.Namespace == namespace1, stopped)
+		}
+	}
+	if _, ok := manager.svcPortMap[getServiceKey(namespace1, name1)]; ok {
+		t.Errorf("Expect ports of %s/%s to be removed", namespace1, name1)
+	}
+
+	// Syncers of services not owned are not ensured.
+	ports := negtypes.NewPortInfoMap(namespace1, name2, negtypes.SvcPortMap{port1: targetPort1}, manager.namer, false)
+	if err := manager.EnsureSyncers(namespace1, name2, ports); err != nil {
+		t.Fatalf("Failed to ensure syncers of %s/%s: %v", namespace1, name2, err)
+	}
+	if _, ok := manager.svcPortMap[getServiceKey(namespace1, name2)]; ok {
+		t.Errorf("Expect no syncer for %s/%s, which is not owned", namespace1, name2)
+	}
+
+	// make sure there is no leaking go routine
+	manager.StopSyncer(namespace2, name1)
+}
+
+func TestGarbageCollectionNEGSafety(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	fakeCloud := manager.cloud.(*negtypes.FakeNetworkEndpointGroupCloud)
+	manager.gcMinAge = time.Hour
+	manager.orphanReporter = NewOrphanReporter()
+
+	old := time.Now().Add(-2 * time.Hour).Format(time.RFC3339)
+	young := time.Now().Format(time.RFC3339)
+	orphanNegName := manager.namer.NEG(namespace1, name1, port1)
+	youngNegName := manager.namer.NEG(namespace1, name1, port2)
+	inUseNegName := manager.namer.NEG(namespace1, name1, port3)
+	foreignNegName := manager.namer.NEG(namespace1, name1, port4)
+	for _, neg := range []*compute.NetworkEndpointGroup{
+		{Name: orphanNegName, CreationTimestamp: old},
+		{Name: youngNegName, CreationTimestamp: young},
+		{Name: inUseNegName, CreationTimestamp: old},
+		// The name matches, but the NEG was created by another cluster with the same short UID.
+		{Name: foreignNegName, CreationTimestamp: old, Description: utils.NegDescription{ClusterUID: ClusterID + "-other"}.String()},
+	} {
+		fakeCloud.CreateNetworkEndpointGroup(neg, negtypes.TestZone1)
+	}
+	inUseNEG, _ := fakeCloud.GetNetworkEndpointGroup(inUseNegName, negtypes.TestZone1)
+	fakeCloud.BackendServices = []*compute.BackendService{
+		{Name: "bs", Backends: []*compute.Backend{{Group: inUseNEG.SelfLink}}},
+	}
+
+	for _, tc := range []struct {
+		desc          string
+		dryRun        bool
+		expectNegs    sets.String
+		expectActions map[string]OrphanAction
+	}{
+		{
+			desc:       "dry run",
+			dryRun:     true,
+			expectNegs: sets.NewString(orphanNegName, youngNegName, inUseNegName, foreignNegName),
+			expectActions: map[string]OrphanAction{
+				orphanNegName: OrphanDryRun,
+				youngNegName:  OrphanTooYoung,
+				inUseNegName:  OrphanInUse,
+			},
+		},
+		{
+			desc:       "delete",
+			expectNegs: sets.NewString(youngNegName, inUseNegName, foreignNegName),
+			expectActions: map[string]OrphanAction{
+				orphanNegName: OrphanDeleted,
+				youngNegName:  OrphanTooYoung,
+				inUseNegName:  OrphanInUse,
+			},
+		},
+	} {
+		manager.gcDryRun = tc.dryRun
+		if err := manager.GC(); err != nil {
+			t.Fatalf("%s: failed to GC: %v", tc.desc, err)
+		}
+
+		negNames := sets.NewString()
+		negs, _ := fakeCloud.ListNetworkEndpointGroup(negtypes.TestZone1)
+		for _, neg := range negs {
+			negNames.Insert(neg.Name)
+		}
+		if !negNames.Equal(tc.expectNegs) {
+			t.Errorf("%s: expect NEGs %v, but got %v", tc.desc, tc.expectNegs.List(), negNames.List())
+		}
+
+		report := manager.orphanReporter.Report()
+		if report == nil {
+			t.Fatalf("%s: expect an orphan report", tc.desc)
+		}
+		if report.DryRun != tc.dryRun {
+			t.Errorf("%s: expect report to be dry run: %v, but got %v", tc.desc, tc.dryRun, report.DryRun)
+		}
+		actions := map[string]OrphanAction{}
+		for _, orphan := range report.Orphans {
+			actions[orphan.Name] = orphan.Action
+		}
+		if !reflect.DeepEqual(actions, tc.expectActions) {
+			t.Errorf("%s: expect orphan actions %v, but got %v", tc.desc, tc.expectActions, actions)
+		}
+	}
+}
+
+func TestEnsureSyncersUniqueNegNames(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	ports := negtypes.PortInfoMap{negtypes.PortInfoMapKey{ServicePort: port1}: negtypes.PortInfo{TargetPort: targetPort1, NegName: "custom-neg"}}
+	if err := manager.EnsureSyncers(namespace1, name1, ports); err != nil {
+		t.Fatalf("Failed to ensure syncer: %v", err)
+	}
+	// The same service can keep using its NEG name.
+	if err := manager.EnsureSyncers(namespace1, name1, ports); err != nil {
+		t.Errorf("Expect err to be nil, but got %v", err)
+	}
+	if err := manager.EnsureSyncers(namespace2, name1, ports); err == nil {
+		t.Errorf("Expect error when another service uses NEG name %q", "custom-neg")
+	}
+	if _, ok := manager.svcPortMap[getServiceKey(namespace2, name1)]; ok {
+		t.Errorf("Expect service %s/%s not to be synced", namespace2, name1)
+	}
+
+	manager.StopSyncer(namespace1, name1)
+}
+
 func TestReadinessGateEnabledNegs(t *testing.T) {
 	t.Parallel()
 
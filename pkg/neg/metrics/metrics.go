@@ -17,10 +17,13 @@ limitations under the License.
 package metrics
 
 import (
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-gce/pkg/metrics"
 )
 
@@ -28,12 +31,30 @@ const (
 	negControllerSubsystem = "neg_controller"
 	syncLatencyKey         = "neg_sync_duration_seconds"
 	lastSyncTimestampKey   = "sync_timestamp"
+	operationLatencyKey    = "neg_operation_duration_seconds"
+	operationEndpointsKey  = "neg_operation_endpoints_total"
+	operationErrorsKey     = "neg_operation_errors_total"
+	endpointsKey           = "neg_endpoints"
+	readinessLatencyKey    = "readiness_gate_latency_seconds"
+	syncersKey             = "neg_syncers"
 
 	resultSuccess = "success"
 	resultError   = "error"
 
 	AttachSync = syncType("attach")
 	DetachSync = syncType("detach")
+
+	// Classes of the errors of NEG operations.
+	ErrorQuota     = "quota"
+	ErrorNotFound  = "not-found"
+	ErrorInvalid   = "invalid"
+	ErrorTransient = "transient"
+
+	// States of NEG syncers.
+	SyncerStateRunning      = "running"
+	SyncerStateError        = "error"
+	SyncerStateShuttingDown = "shutting-down"
+	SyncerStateStopped      = "stopped"
 )
 
 type syncType string
@@ -66,15 +87,108 @@ var (
 	)
 )
 
+var (
+	syncTypes    = []syncType{AttachSync, DetachSync}
+	results      = []string{resultSuccess, resultError}
+	syncerStates = []string{SyncerStateRunning, SyncerStateError, SyncerStateShuttingDown, SyncerStateStopped}
+	quotaReasons = sets.NewString("quotaExceeded", "rateLimitExceeded", "userRateLimitExceeded")
+	// The operation metrics are not keyed by NEG, so that their number of series does not grow with the NEGs.
+	operationKeys = []string{
+		"type",   // Type of the operation, attach or detach.
+		"result", // Result of the operation.
+	}
+
+	OperationLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      operationLatencyKey,
+			Help:      "Latency of the attach and detach operations of NEGs",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+		},
+		operationKeys,
+	)
+
+	OperationEndpoints = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      operationEndpointsKey,
+			Help:      "Number of endpoints in the attach and detach operations of NEGs",
+		},
+		operationKeys,
+	)
+
+	// OperationErrors is not keyed by NEG, the errors of a NEG are in its events.
+	OperationErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      operationErrorsKey,
+			Help:      "Number of failed NEG operations by class of error",
+		},
+		[]string{
+			"type",  // Type of the operation, attach or detach.
+			"class", // Class of the error: quota, not-found, invalid or transient.
+		},
+	)
+
+	Endpoints = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      endpointsKey,
+			Help:      "Number of endpoints of a NEG in a zone as of its last sync",
+		},
+		[]string{
+			"key",  // The name of the NEG.
+			"zone", // The zone of the NEG.
+		},
+	)
+
+	ReadinessGateLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      readinessLatencyKey,
+			Help:      "Latency between a pod becoming ready apart from its NEG readiness gate and becoming healthy in a NEG",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+	)
+
+	Syncers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: negControllerSubsystem,
+			Name:      syncersKey,
+			Help:      "Number of NEG syncers by state",
+		},
+		[]string{"state"},
+	)
+)
+
 var register sync.Once
 
 func RegisterMetrics() {
 	register.Do(func() {
 		prometheus.MustRegister(SyncLatency)
 		prometheus.MustRegister(LastSyncTimestamp)
+		prometheus.MustRegister(OperationLatency)
+		prometheus.MustRegister(OperationEndpoints)
+		prometheus.MustRegister(OperationErrors)
+		prometheus.MustRegister(Endpoints)
+		prometheus.MustRegister(ReadinessGateLatency)
+		prometheus.MustRegister(Syncers)
 	})
 }
 
+// endpointZones are the zones of the Endpoints gauges of each NEG, which are deleted
+// when the NEG leaves a zone or its syncer is garbage collected.
+var endpointZones = struct {
+	lock  sync.Mutex
+	zones map[string]sets.String
+}{zones: map[string]sets.String{}}
+
 // ObserveNegSync publish collected metrics for the sync of NEG
 func ObserveNegSync(negName string, syncType syncType, err error, start time.Time) {
 	result := resultSuccess
@@ -83,3 +197,87 @@ func ObserveNegSync(negName string, syncType syncType, err error, start time.Tim
 	}
 	SyncLatency.WithLabelValues(negName, string(syncType), result).Observe(time.Since(start).Seconds())
 }
+
+// ObserveNegOperation publishes the latency and the number of endpoints of a NEG
+// operation, and the class of its error if it failed.
+func ObserveNegOperation(operation syncType, endpoints int, err error, start time.Time) {
+	result := resultSuccess
+	if err != nil {
+		result = resultError
+		OperationErrors.WithLabelValues(string(operation), ClassifyError(err)).Inc()
+	}
+	OperationLatency.WithLabelValues(string(operation), result).Observe(time.Since(start).Seconds())
+	OperationEndpoints.WithLabelValues(string(operation), result).Add(float64(endpoints))
+}
+
+// ClassifyError returns the class of the error of a NEG operation. Errors which are
+// not GCE API errors, like timeouts, and server errors are transient.
+func ClassifyError(err error) string {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return ErrorTransient
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests:
+		return ErrorQuota
+	case apiErr.Code == http.StatusForbidden:
+		for _, item := range apiErr.Errors {
+			if quotaReasons.Has(item.Reason) {
+				return ErrorQuota
+			}
+		}
+		return ErrorInvalid
+	case apiErr.Code == http.StatusNotFound:
+		return ErrorNotFound
+	case apiErr.Code >= 400 && apiErr.Code < 500:
+		return ErrorInvalid
+	default:
+		return ErrorTransient
+	}
+}
+
+// SetNegEndpoints publishes the number of endpoints of a NEG by zone. The gauges of
+// zones without count are deleted.
+func SetNegEndpoints(negName string, counts map[string]int) {
+	endpointZones.lock.Lock()
+	defer endpointZones.lock.Unlock()
+	zones := sets.NewString()
+	for zone, count := range counts {
+		zones.Insert(zone)
+		Endpoints.WithLabelValues(negName, zone).Set(float64(count))
+	}
+	for _, zone := range endpointZones.zones[negName].Difference(zones).List() {
+		Endpoints.DeleteLabelValues(negName, zone)
+	}
+	if zones.Len() == 0 {
+		delete(endpointZones.zones, negName)
+		return
+	}
+	endpointZones.zones[negName] = zones
+}
+
+// ObserveReadinessGateLatency publishes the latency between a pod becoming ready apart
+// from its NEG readiness gate and becoming healthy in a NEG.
+func ObserveReadinessGateLatency(latency time.Duration) {
+	ReadinessGateLatency.Observe(latency.Seconds())
+}
+
+// SetSyncerCounts publishes the number of NEG syncers by state. States without count
+// are set to zero.
+func SetSyncerCounts(counts map[string]int) {
+	for _, state := range syncerStates {
+		Syncers.WithLabelValues(state).Set(float64(counts[state]))
+	}
+}
+
+// DeleteNegMetrics deletes the metrics of a NEG, so that the number of series does not
+// grow with the NEGs ever synced. The series are keyed by NEG name, so this must only be
+// called once no syncer of the NEG is left.
+func DeleteNegMetrics(negName string) {
+	for _, syncType := range syncTypes {
+		for _, result := range results {
+			SyncLatency.DeleteLabelValues(negName, string(syncType), result)
+		}
+	}
+	SetNegEndpoints(negName, nil)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		err         error
+		expectClass string
+	}{
+		{
+			desc:        "rate limited",
+			err:         &googleapi.Error{Code: http.StatusTooManyRequests},
+			expectClass: ErrorQuota,
+		},
+		{
+			desc:        "quota exceeded",
+			err:         &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}},
+			expectClass: ErrorQuota,
+		},
+		{
+			desc:        "forbidden",
+			err:         &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}},
+			expectClass: ErrorInvalid,
+		},
+		{
+			desc:        "not found",
+			err:         &googleapi.Error{Code: http.StatusNotFound},
+			expectClass: ErrorNotFound,
+		},
+		{
+			desc:        "bad request",
+			err:         &googleapi.Error{Code: http.StatusBadRequest},
+			expectClass: ErrorInvalid,
+		},
+		{
+			desc:        "server error",
+			err:         &googleapi.Error{Code: http.StatusServiceUnavailable},
+			expectClass: ErrorTransient,
+		},
+		{
+			desc:        "not an API error",
+			err:         fmt.Errorf("connection reset"),
+			expectClass: ErrorTransient,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if class := ClassifyError(tc.err); class != tc.expectClass {
+				t.Errorf("ClassifyError(%v) = %q, want %q", tc.err, class, tc.expectClass)
+			}
+		})
+	}
+}
+
+func TestSetNegEndpoints(t *testing.T) {
+	zones := func(negName string) []string {
+		endpointZones.lock.Lock()
+		defer endpointZones.lock.Unlock()
+		return endpointZones.zones[negName].List()
+	}
+
+	SetNegEndpoints("neg", map[string]int{"zone1": 3, "zone2": 1})
+	if got, want := zones("neg"), []string{"zone1", "zone2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zones = %v, want %v", got, want)
+	}
+	SetNegEndpoints("neg", map[string]int{"zone2": 2})
+	if got, want := zones("neg"), []string{"zone2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zones = %v, want %v", got, want)
+	}
+	DeleteNegMetrics("neg")
+	if got := zones("neg"); len(got) != 0 {
+		t.Errorf("zones = %v, want none after the metrics of the NEG are deleted", got)
+	}
+}
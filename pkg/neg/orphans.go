@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OrphanAction is what the garbage collector did with an orphan NEG.
+type OrphanAction string
+
+const (
+	// OrphanDeleted means the NEG was deleted.
+	OrphanDeleted = OrphanAction("Deleted")
+	// OrphanDeleteFailed means the NEG could not be deleted.
+	OrphanDeleteFailed = OrphanAction("DeleteFailed")
+	// OrphanDryRun means the NEG would have been deleted, but GC only reports orphans.
+	OrphanDryRun = OrphanAction("DryRun")
+	// OrphanTooYoung means the NEG was created less than the minimum age ago.
+	OrphanTooYoung = OrphanAction("TooYoung")
+	// OrphanInUse means the NEG is a backend of a backend service.
+	OrphanInUse = OrphanAction("InUse")
+)
+
+// OrphanNEG is a NEG of the cluster which no service port needs anymore.
+type OrphanNEG struct {
+	Name              string       `json:"name"`
+	Zone              string       `json:"zone"`
+	Description       string       `json:"description,omitempty"`
+	CreationTimestamp string       `json:"creationTimestamp,omitempty"`
+	Action            OrphanAction `json:"action"`
+	Error             string       `json:"error,omitempty"`
+}
+
+// OrphanReport is the result of a NEG garbage collection.
+type OrphanReport struct {
+	Time    time.Time   `json:"time"`
+	DryRun  bool        `json:"dryRun"`
+	MinAge  string      `json:"minAge"`
+	Orphans []OrphanNEG `json:"orphans"`
+}
+
+// OrphanReporter keeps the report of the last NEG garbage collection, which it serves
+// through ServeHTTP.
+type OrphanReporter struct {
+	lock sync.Mutex
+	// report is the result of the last garbage collection, nil if none has run yet.
+	report *OrphanReport
+}
+
+// NewOrphanReporter returns an OrphanReporter without report.
+func NewOrphanReporter() *OrphanReporter {
+	return &OrphanReporter{}
+}
+
+// Report returns the last report, nil if no garbage collection has run yet.
+func (r *OrphanReporter) Report() *OrphanReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.report
+}
+
+func (r *OrphanReporter) setReport(report *OrphanReport) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.report = report
+}
+
+// ServeHTTP writes the last report as JSON.
+func (r *OrphanReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	report := r.Report()
+	if report == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("No NEG garbage collection has run yet"))
+		return
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
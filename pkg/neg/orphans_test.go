@@ -0,0 +1,52 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrphanReporterServeHTTP(t *testing.T) {
+	r := NewOrphanReporter()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/neg-orphans", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeHTTP() before any GC = %v, want %v", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	orphans := []OrphanNEG{{Name: "neg1", Zone: "zone1", Action: OrphanDryRun}}
+	r.setReport(&OrphanReport{Time: time.Now(), DryRun: true, MinAge: "1h0m0s", Orphans: orphans})
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/neg-orphans", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() = %v, want %v", rec.Code, http.StatusOK)
+	}
+	var report OrphanReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if !report.DryRun || !reflect.DeepEqual(report.Orphans, orphans) {
+		t.Errorf("ServeHTTP() report = %+v, want dry run with orphans %v", report, orphans)
+	}
+}
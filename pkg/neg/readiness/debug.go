@@ -0,0 +1,66 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// WaitingPodsHandler serves the pods waiting on NEG readiness of a Reflector. The
+// handler is registered before the Reflector runs, which is set once it does.
+type WaitingPodsHandler struct {
+	lock      sync.Mutex
+	reflector Reflector
+}
+
+// NewWaitingPodsHandler returns a WaitingPodsHandler without Reflector.
+func NewWaitingPodsHandler() *WaitingPodsHandler {
+	return &WaitingPodsHandler{}
+}
+
+// SetReflector sets the Reflector whose waiting pods are served.
+func (h *WaitingPodsHandler) SetReflector(reflector Reflector) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.reflector = reflector
+}
+
+// ServeHTTP writes the waiting pods as JSON.
+func (h *WaitingPodsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	reflector := h.reflector
+	h.lock.Unlock()
+	if reflector == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("NEG readiness reflector is not running"))
+		return
+	}
+	pods := reflector.WaitingPods()
+	if pods == nil {
+		pods = []WaitingPod{}
+	}
+	b, err := json.MarshalIndent(pods, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
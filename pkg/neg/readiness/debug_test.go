@@ -0,0 +1,44 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWaitingPodsHandlerServeHTTP(t *testing.T) {
+	h := NewWaitingPodsHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/neg-readiness", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeHTTP() without reflector = %v, want %v", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	h.SetReflector(&NoopReflector{})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/neg-readiness", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() = %v, want %v", rec.Code, http.StatusOK)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Errorf("ServeHTTP() body = %q, want %q", body, "[]")
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/backendconfig"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/neg/types/shared"
+	"k8s.io/klog"
+)
+
+// CommitDetachedPods marks the terminating pods among the detached endpoints to be drained
+// once the connection draining timeout of the service port has passed. Pods which are still
+// in other NEGs are drained once they are detached from the last of them.
+func (r *readinessReflector) CommitDetachedPods(syncerKey negtypes.NegSyncerKey, negName string, zone string, endpointMap negtypes.EndpointPodMap) {
+	if !r.enableDrainCondition {
+		return
+	}
+	timeout := r.drainingTimeout(syncerKey)
+	deadline := r.clock.Now().Add(timeout)
+	neg := negMeta{SyncerKey: syncerKey, Name: negName, Zone: zone}
+
+	r.drainLock.Lock()
+	defer r.drainLock.Unlock()
+	for _, namespacedName := range endpointMap {
+		key := namespacedName.String()
+		if negs, ok := r.negPods[key]; ok {
+			delete(negs, neg)
+			if len(negs) == 0 {
+				delete(r.negPods, key)
+			}
+		}
+		pod, exists, err := getPodFromStore(r.podLister, namespacedName.Namespace, namespacedName.Name)
+		if err != nil {
+			klog.Warningf("Failed to retrieve pod %q from store: %v", namespacedName.String(), err)
+			continue
+		}
+		if !exists {
+			delete(r.negPods, key)
+			continue
+		}
+		if pod.DeletionTimestamp == nil {
+			continue
+		}
+		if negs := r.negPods[key]; len(negs) > 0 {
+			klog.V(4).Infof("Pod %q was detached from NEG %q in zone %q, but is still in %d other NEG(s)", key, negName, zone, len(negs))
+			continue
+		}
+		klog.V(4).Infof("Pod %q was detached from NEG %q in zone %q, draining for %v", key, negName, zone, timeout)
+		if current, ok := r.drains[key]; !ok || deadline.After(current) {
+			r.drains[key] = deadline
+		}
+		r.drainQueue.AddAfter(key, timeout)
+	}
+}
+
+// DrainEnabled returns true if terminating pods detached from NEGs are marked as drained.
+func (r *readinessReflector) DrainEnabled() bool {
+	return r.enableDrainCondition
+}
+
+// addNegPods records that the pods of the endpoints are in the NEG.
+func (r *readinessReflector) addNegPods(neg negMeta, endpointMap negtypes.EndpointPodMap) {
+	if !r.enableDrainCondition {
+		return
+	}
+	r.drainLock.Lock()
+	defer r.drainLock.Unlock()
+	for _, namespacedName := range endpointMap {
+		key := namespacedName.String()
+		if r.negPods[key] == nil {
+			r.negPods[key] = map[negMeta]bool{}
+		}
+		r.negPods[key][neg] = true
+	}
+}
+
+// drainingTimeout returns the connection draining timeout of the service port
+// of the syncer, as configured by its BackendConfig.
+func (r *readinessReflector) drainingTimeout(syncerKey negtypes.NegSyncerKey) time.Duration {
+	if r.backendConfigLister == nil {
+		return 0
+	}
+	obj, exists, err := r.serviceLister.GetByKey(keyFunc(syncerKey.Namespace, syncerKey.Name))
+	if err != nil || !exists {
+		return 0
+	}
+	svc := obj.(*v1.Service)
+	for i := range svc.Spec.Ports {
+		svcPort := &svc.Spec.Ports[i]
+		if svcPort.Port != syncerKey.Port {
+			continue
+		}
+		beConfig, err := backendconfig.GetBackendConfigForServicePort(r.backendConfigLister, svc, svcPort)
+		if err != nil || beConfig == nil || beConfig.Spec.ConnectionDraining == nil {
+			return 0
+		}
+		return time.Duration(beConfig.Spec.ConnectionDraining.DrainingTimeoutSec) * time.Second
+	}
+	return 0
+}
+
+func (r *readinessReflector) drainWorker() {
+	for r.processNextDrainItem() {
+	}
+}
+
+func (r *readinessReflector) processNextDrainItem() bool {
+	key, quit := r.drainQueue.Get()
+	if quit {
+		return false
+	}
+	defer r.drainQueue.Done(key)
+
+	err := r.syncDrain(key.(string))
+	if err == nil {
+		r.drainQueue.Forget(key)
+		return true
+	}
+	if r.drainQueue.NumRequeues(key) < maxRetries {
+		klog.V(2).Infof("Error marking pod %q as drained, retrying. Error: %v", key, err)
+		r.drainQueue.AddRateLimited(key)
+		return true
+	}
+	klog.Warningf("Dropping pod %q out of the drain queue: %v", key, err)
+	r.drainQueue.Forget(key)
+	r.drainLock.Lock()
+	delete(r.drains, key.(string))
+	r.drainLock.Unlock()
+	return true
+}
+
+// syncDrain patches the drained condition of the pod if it has been drained.
+func (r *readinessReflector) syncDrain(key string) error {
+	r.drainLock.Lock()
+	deadline, ok := r.drains[key]
+	// The pod may have been committed to a NEG again since it was detached.
+	if ok && len(r.negPods[key]) > 0 {
+		delete(r.drains, key)
+		ok = false
+	}
+	r.drainLock.Unlock()
+	if !ok {
+		return nil
+	}
+	if wait := deadline.Sub(r.clock.Now()); wait > 0 {
+		r.drainQueue.AddAfter(key, wait)
+		return nil
+	}
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	r.podUpdateLock.Lock()
+	defer r.podUpdateLock.Unlock()
+	pod, exists, err := getPodFromStore(r.podLister, namespace, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		expectedCondition := v1.PodCondition{
+			Type:    shared.NegDrainedCondition,
+			Status:  v1.ConditionTrue,
+			Reason:  negDrainedReason,
+			Message: fmt.Sprintf("Pod was detached from its NEG(s) and connections were drained. Marking condition %q to True.", shared.NegDrainedCondition),
+		}
+		if err := r.ensurePodNegCondition(pod.DeepCopy(), expectedCondition); err != nil {
+			return err
+		}
+	}
+
+	r.drainLock.Lock()
+	defer r.drainLock.Unlock()
+	// The pod may have been detached from another NEG in the meantime.
+	if r.drains[key] == deadline {
+		delete(r.drains, key)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/neg/types/shared"
+)
+
+func TestCommitDetachedPods(t *testing.T) {
+	fakeContext := fakeContext()
+	reflector := newTestReadinessReflector(fakeContext)
+	reflector.enableDrainCondition = true
+	reflector.backendConfigLister = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	fakeClock := clock.NewFakeClock(time.Now())
+	reflector.clock = fakeClock
+
+	reflector.serviceLister.Add(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   testNamespace,
+			Name:        "svc",
+			Annotations: map[string]string{annotations.BackendConfigKey: `{"default":"config"}`},
+		},
+		Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Port: 80}}},
+	})
+	reflector.backendConfigLister.Add(&backendconfigv1beta1.BackendConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "config"},
+		Spec: backendconfigv1beta1.BackendConfigSpec{
+			ConnectionDraining: &backendconfigv1beta1.ConnectionDrainingConfig{DrainingTimeoutSec: 30},
+		},
+	})
+
+	terminating := generatePod(testNamespace, "terminating", false, false, false)
+	deletionTimestamp := metav1.NewTime(fakeClock.Now())
+	terminating.DeletionTimestamp = &deletionTimestamp
+	running := generatePod(testNamespace, "running", false, false, false)
+	for _, pod := range []*v1.Pod{terminating, running} {
+		reflector.podLister.Add(pod)
+		fakeContext.KubeClient.CoreV1().Pods(testNamespace).Create(pod)
+	}
+
+	syncerKey := negtypes.NegSyncerKey{Namespace: testNamespace, Name: "svc", Port: 80}
+	terminatingKey := keyFunc(testNamespace, "terminating")
+	endpointMap := negtypes.EndpointPodMap{
+		negtypes.NetworkEndpoint{IP: "10.0.0.1", Port: "80", Node: "node1"}: types.NamespacedName{Namespace: testNamespace, Name: "terminating"},
+		negtypes.NetworkEndpoint{IP: "10.0.0.2", Port: "80", Node: "node1"}: types.NamespacedName{Namespace: testNamespace, Name: "running"},
+	}
+
+	reflector.enableDrainCondition = false
+	reflector.CommitDetachedPods(syncerKey, "neg", negtypes.TestZone1, endpointMap)
+	if len(reflector.drains) != 0 {
+		t.Fatalf("Expect no pod to be drained when the drain condition is disabled, but got %v", reflector.drains)
+	}
+
+	reflector.enableDrainCondition = true
+	reflector.CommitDetachedPods(syncerKey, "neg", negtypes.TestZone1, endpointMap)
+	expectDeadline := fakeClock.Now().Add(30 * time.Second)
+	if len(reflector.drains) != 1 || !reflector.drains[terminatingKey].Equal(expectDeadline) {
+		t.Fatalf("Expect pod %q to be drained at %v, but got %v", terminatingKey, expectDeadline, reflector.drains)
+	}
+
+	// The pod is not marked drained before the draining timeout.
+	if err := reflector.syncDrain(terminatingKey); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if _, ok := podDrainedCondition(t, fakeContext.KubeClient.CoreV1().Pods(testNamespace).Get, "terminating"); ok {
+		t.Errorf("Expect pod %q not to be drained before the draining timeout", terminatingKey)
+	}
+
+	fakeClock.Step(30 * time.Second)
+	if err := reflector.syncDrain(terminatingKey); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	condition, ok := podDrainedCondition(t, fakeContext.KubeClient.CoreV1().Pods(testNamespace).Get, "terminating")
+	if !ok || condition.Status != v1.ConditionTrue || condition.Reason != negDrainedReason {
+		t.Errorf("Expect pod %q to have condition %q set to True, but got %+v", terminatingKey, shared.NegDrainedCondition, condition)
+	}
+	if len(reflector.drains) != 0 {
+		t.Errorf("Expect no pending drain, but got %v", reflector.drains)
+	}
+	if _, ok := podDrainedCondition(t, fakeContext.KubeClient.CoreV1().Pods(testNamespace).Get, "running"); ok {
+		t.Errorf("Expect running pod not to be drained")
+	}
+}
+
+func TestCommitDetachedPodsInSeveralNegs(t *testing.T) {
+	fakeContext := fakeContext()
+	reflector := newTestReadinessReflector(fakeContext)
+	reflector.enableDrainCondition = true
+	fakeClock := clock.NewFakeClock(time.Now())
+	reflector.clock = fakeClock
+
+	pod := generatePod(testNamespace, "terminating", false, false, false)
+	deletionTimestamp := metav1.NewTime(fakeClock.Now())
+	pod.DeletionTimestamp = &deletionTimestamp
+	reflector.podLister.Add(pod)
+	fakeContext.KubeClient.CoreV1().Pods(testNamespace).Create(pod)
+
+	podKey := keyFunc(testNamespace, "terminating")
+	podName := types.NamespacedName{Namespace: testNamespace, Name: "terminating"}
+	httpKey := negtypes.NegSyncerKey{Namespace: testNamespace, Name: "svc", Port: 80}
+	metricsKey := negtypes.NegSyncerKey{Namespace: testNamespace, Name: "svc", Port: 8080}
+	httpEndpoints := negtypes.EndpointPodMap{negtypes.NetworkEndpoint{IP: "10.0.0.1", Port: "80", Node: "node1"}: podName}
+	metricsEndpoints := negtypes.EndpointPodMap{negtypes.NetworkEndpoint{IP: "10.0.0.1", Port: "8080", Node: "node1"}: podName}
+	reflector.CommitPods(httpKey, "http-neg", negtypes.TestZone1, httpEndpoints)
+	reflector.CommitPods(metricsKey, "metrics-neg", negtypes.TestZone1, metricsEndpoints)
+
+	// The pod is still in the metrics NEG.
+	reflector.CommitDetachedPods(httpKey, "http-neg", negtypes.TestZone1, httpEndpoints)
+	if len(reflector.drains) != 0 {
+		t.Fatalf("Expect no pod to be drained while it is in another NEG, but got %v", reflector.drains)
+	}
+
+	// The pod is in no NEG anymore.
+	reflector.CommitDetachedPods(metricsKey, "metrics-neg", negtypes.TestZone1, metricsEndpoints)
+	if _, ok := reflector.drains[podKey]; !ok {
+		t.Fatalf("Expect pod %q to be drained, but got %v", podKey, reflector.drains)
+	}
+
+	// A pod committed to a NEG again before its deadline is not drained.
+	reflector.CommitPods(httpKey, "http-neg", negtypes.TestZone1, httpEndpoints)
+	if err := reflector.syncDrain(podKey); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if _, ok := podDrainedCondition(t, fakeContext.KubeClient.CoreV1().Pods(testNamespace).Get, "terminating"); ok {
+		t.Errorf("Expect pod %q in a NEG not to be drained", podKey)
+	}
+	if len(reflector.drains) != 0 {
+		t.Errorf("Expect no pending drain, but got %v", reflector.drains)
+	}
+}
+
+func podDrainedCondition(t *testing.T, get func(string, metav1.GetOptions) (*v1.Pod, error), name string) (v1.PodCondition, bool) {
+	t.Helper()
+	pod, err := get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	return podConditionStatus(pod, shared.NegDrainedCondition)
+}
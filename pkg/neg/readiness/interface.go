@@ -34,6 +34,15 @@ type Reflector interface {
 	// zone is the corresponding zone of the NEG resource (e.g. us-central1-b)
 	// endpointMap contains mapping from all network endpoints to pods which have been added into the NEG
 	CommitPods(syncerKey negtypes.NegSyncerKey, negName string, zone string, endpointMap negtypes.EndpointPodMap)
+	// CommitDetachedPods signals the reflector that network endpoints have been detached from a NEG.
+	// Terminating pods among them are marked as drained once the connection draining timeout of the
+	// service port has passed.
+	// endpointMap contains mapping from the detached network endpoints to their pods
+	CommitDetachedPods(syncerKey negtypes.NegSyncerKey, negName string, zone string, endpointMap negtypes.EndpointPodMap)
+	// WaitingPods returns the pods waiting to become healthy in a NEG for their readiness gate.
+	WaitingPods() []WaitingPod
+	// DrainEnabled returns true if terminating pods detached from NEGs are marked as drained.
+	DrainEnabled() bool
 }
 
 // NegLookup defines an interface for looking up pod membership.
@@ -51,3 +60,14 @@ func (*NoopReflector) Run(<-chan struct{}) {}
 func (*NoopReflector) SyncPod(*v1.Pod) {}
 
 func (*NoopReflector) CommitPods(negtypes.NegSyncerKey, string, string, negtypes.EndpointPodMap) {}
+
+func (*NoopReflector) CommitDetachedPods(negtypes.NegSyncerKey, string, string, negtypes.EndpointPodMap) {
+}
+
+func (*NoopReflector) WaitingPods() []WaitingPod {
+	return nil
+}
+
+func (*NoopReflector) DrainEnabled() bool {
+	return false
+}
@@ -18,19 +18,24 @@ package readiness
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
 	compute "google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/tools/cache"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/klog"
-	"strconv"
-	"strings"
-	"sync"
 )
 
 const (
 	healthyState = "HEALTHY"
+	// unknownHealthState is the health state of a network endpoint without health status from any backend service.
+	unknownHealthState = "UNKNOWN"
 )
 
 // negMeta references a GCE NEG resource
@@ -62,26 +67,41 @@ type pollTarget struct {
 	polling bool
 }
 
+// observedHealth is the health state of the network endpoint of a pod observed at a time.
+type observedHealth struct {
+	pod   types.NamespacedName
+	state string
+	time  time.Time
+}
+
 // poller tracks the negs and corresponding targets needed to be polled.
 type poller struct {
 	lock sync.Mutex
 	// pollMap contains negs and corresponding targets needed to be polled.
 	// all operations(read, write) to the pollMap are lock protected.
 	pollMap map[negMeta]*pollTarget
+	// healthLock protects healthStates. It is held on its own, so that health states can be
+	// read while pods are patched.
+	healthLock sync.Mutex
+	// healthStates are the health states of the polled network endpoints as last observed.
+	healthStates map[negMeta]map[negtypes.NetworkEndpoint]observedHealth
 
 	podLister cache.Indexer
 	lookup    NegLookup
 	patcher   podStatusPatcher
 	negCloud  negtypes.NetworkEndpointGroupCloud
+	clock     clock.Clock
 }
 
 func NewPoller(podLister cache.Indexer, lookup NegLookup, patcher podStatusPatcher, negCloud negtypes.NetworkEndpointGroupCloud) *poller {
 	return &poller{
-		pollMap:   make(map[negMeta]*pollTarget),
-		podLister: podLister,
-		lookup:    lookup,
-		patcher:   patcher,
-		negCloud:  negCloud,
+		pollMap:      make(map[negMeta]*pollTarget),
+		healthStates: make(map[negMeta]map[negtypes.NetworkEndpoint]observedHealth),
+		podLister:    podLister,
+		lookup:       lookup,
+		patcher:      patcher,
+		negCloud:     negCloud,
+		clock:        clock.RealClock{},
 	}
 }
 
@@ -97,6 +117,7 @@ func (p *poller) RegisterNegEndpoints(key negMeta, endpointMap negtypes.Endpoint
 // Assumes p.lock is held when calling this method.
 func (p *poller) registerNegEndpoints(key negMeta, endpointMap negtypes.EndpointPodMap) bool {
 	endpointsToPoll := needToPoll(key.SyncerKey, endpointMap, p.lookup, p.podLister)
+	p.pruneHealthStates(key, endpointsToPoll)
 	if len(endpointsToPoll) == 0 {
 		delete(p.pollMap, key)
 		return false
@@ -178,26 +199,137 @@ func (p *poller) processHealthStatus(key negMeta, healthStatus *compute.NetworkE
 		return false, nil
 	}
 
-	for _, hs := range healthStatus.Healths {
-		if hs == nil {
+	state := endpointHealthState(healthStatus.Healths)
+	p.observeHealthState(key, ne, podName, state)
+	if state != healthyState {
+		return false, nil
+	}
+	return true, p.patcher.syncPod(keyFunc(podName.Namespace, podName.Name), key.Name)
+}
+
+// endpointHealthState returns the health state of a network endpoint from its health status
+// for each backend service referencing its NEG. The endpoint is healthy if any backend service
+// reports it healthy, as the backend services are not necessarily named after the NEG.
+// Otherwise the first state reported is returned, or unknownHealthState if there is none.
+func endpointHealthState(healths []*compute.HealthStatusForNetworkEndpoint) string {
+	state := unknownHealthState
+	for _, hs := range healths {
+		if hs == nil || hs.HealthState == "" {
 			continue
 		}
-		if hs.BackendService == nil {
-			klog.Warningf("Backend service is nil in health status of network endpoint %v: %v", ne, hs)
-			continue
+		if hs.HealthState == healthyState {
+			return healthyState
+		}
+		if state == unknownHealthState {
+			state = hs.HealthState
 		}
+	}
+	return state
+}
+
+// WaitingPod is a pod waiting to become healthy in a NEG for its NEG readiness gate.
+type WaitingPod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	NEG       string `json:"neg"`
+	Zone      string `json:"zone"`
+	Endpoint  string `json:"endpoint"`
+	// HealthState is the health state of the endpoint last observed in the NEG,
+	// empty if the NEG was not polled yet.
+	HealthState  string     `json:"healthState,omitempty"`
+	LastObserved *time.Time `json:"lastObserved,omitempty"`
+	// Deadline is the time the readiness policy of the pod times out, if known.
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// OnTimeout is what happens once the deadline is reached.
+	OnTimeout string `json:"onTimeout,omitempty"`
+}
 
-		// This assumes the ingress backend service uses the NEG naming scheme. Hence the backend service share the same name as NEG.
-		if strings.Contains(hs.BackendService.BackendService, key.Name) {
-			if hs.HealthState == healthyState {
-				healthy = true
-				err := p.patcher.syncPod(keyFunc(podName.Namespace, podName.Name), key.Name)
-				return healthy, err
+// waitingPods returns the pods whose endpoints are polled, with their last observed health state.
+func (p *poller) waitingPods() []WaitingPod {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.healthLock.Lock()
+	defer p.healthLock.Unlock()
+	ret := []WaitingPod{}
+	for key, target := range p.pollMap {
+		for endpoint, podName := range target.endpointMap {
+			pod := WaitingPod{
+				Namespace: podName.Namespace,
+				Name:      podName.Name,
+				NEG:       key.Name,
+				Zone:      key.Zone,
+				Endpoint:  endpointString(endpoint),
+			}
+			if health, ok := p.healthStates[key][endpoint]; ok {
+				observed := health.time
+				pod.HealthState = health.state
+				pod.LastObserved = &observed
 			}
+			ret = append(ret, pod)
 		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		if ret[i].Name != ret[j].Name {
+			return ret[i].Name < ret[j].Name
+		}
+		return ret[i].NEG+ret[i].Zone < ret[j].NEG+ret[j].Zone
+	})
+	return ret
+}
+
+// lastHealthStates returns the last observed health states of the pod in the NEGs it is polled in.
+// It only holds healthLock, so it may be called while pods are patched.
+func (p *poller) lastHealthStates(namespace, name string) []string {
+	p.healthLock.Lock()
+	defer p.healthLock.Unlock()
+	var ret []string
+	for key, states := range p.healthStates {
+		for _, health := range states {
+			if health.pod.Namespace == namespace && health.pod.Name == name {
+				ret = append(ret, fmt.Sprintf("%s in NEG %q in zone %q", health.state, key.Name, key.Zone))
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// observeHealthState records the health state of the network endpoint of a pod.
+func (p *poller) observeHealthState(key negMeta, endpoint negtypes.NetworkEndpoint, pod types.NamespacedName, state string) {
+	p.healthLock.Lock()
+	defer p.healthLock.Unlock()
+	if _, ok := p.healthStates[key]; !ok {
+		p.healthStates[key] = map[negtypes.NetworkEndpoint]observedHealth{}
+	}
+	p.healthStates[key][endpoint] = observedHealth{pod: pod, state: state, time: p.clock.Now()}
+}
+
+// pruneHealthStates forgets the health states of the network endpoints of the NEG which are not polled anymore.
+func (p *poller) pruneHealthStates(key negMeta, endpointsToPoll negtypes.EndpointPodMap) {
+	p.healthLock.Lock()
+	defer p.healthLock.Unlock()
+	for endpoint := range p.healthStates[key] {
+		if _, ok := endpointsToPoll[endpoint]; !ok {
+			delete(p.healthStates[key], endpoint)
+		}
+	}
+	if len(p.healthStates[key]) == 0 {
+		delete(p.healthStates, key)
+	}
+}
 
+// endpointString returns the address of a network endpoint.
+func endpointString(endpoint negtypes.NetworkEndpoint) string {
+	if endpoint.IP == "" {
+		return endpoint.Node
+	}
+	if endpoint.Port == "" {
+		return endpoint.IP
 	}
-	return false, nil
+	return fmt.Sprintf("%s:%s", endpoint.IP, endpoint.Port)
 }
 
 // getPod returns the namespaced name of a pod corresponds to an endpoint and whether the pod is registered
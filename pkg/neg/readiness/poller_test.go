@@ -375,14 +375,37 @@ func TestPoll(t *testing.T) {
 	if retry != true {
 		t.Errorf("Expect retry = true, but got %v", retry)
 	}
+	expectWaitingPodHealth(t, poller, unknownHealthState)
 
-	// add NE with healthy status
+	// add NE with unhealthy status from a backend service not named after the NEG
+	backendService := "https://www.googleapis.com/compute/v1/projects/mock-project/global/backendServices/custom-backend-service"
 	negtypes.GetNetworkEndpointStore(negCloud).AddNetworkEndpointHealthStatus(*meta.ZonalKey(negName, zone), negtypes.NetworkEndpointEntry{
 		NetworkEndpoint: ne,
 		Healths: []*compute.HealthStatusForNetworkEndpoint{
 			{
 				BackendService: &compute.BackendServiceReference{
-					BackendService: negName,
+					BackendService: backendService,
+				},
+				HealthState: "UNHEALTHY",
+			},
+		},
+	})
+	retry, err = poller.Poll(key)
+	if err != nil {
+		t.Errorf("Does not expect err, but got %v", err)
+	}
+	if retry != true {
+		t.Errorf("Expect retry = true, but got %v", retry)
+	}
+	expectWaitingPodHealth(t, poller, "UNHEALTHY")
+
+	// add NE with healthy status from the same backend service
+	negtypes.GetNetworkEndpointStore(negCloud).AddNetworkEndpointHealthStatus(*meta.ZonalKey(negName, zone), negtypes.NetworkEndpointEntry{
+		NetworkEndpoint: ne,
+		Healths: []*compute.HealthStatusForNetworkEndpoint{
+			{
+				BackendService: &compute.BackendServiceReference{
+					BackendService: backendService,
 				},
 				HealthState: healthyState,
 			},
@@ -395,4 +418,57 @@ func TestPoll(t *testing.T) {
 	if retry != false {
 		t.Errorf("Expect retry = false, but got %v", retry)
 	}
+	expectWaitingPodHealth(t, poller, healthyState)
+}
+
+func TestEndpointHealthState(t *testing.T) {
+	t.Parallel()
+
+	health := func(backendService, state string) *compute.HealthStatusForNetworkEndpoint {
+		return &compute.HealthStatusForNetworkEndpoint{
+			BackendService: &compute.BackendServiceReference{BackendService: backendService},
+			HealthState:    state,
+		}
+	}
+	for _, tc := range []struct {
+		desc    string
+		healths []*compute.HealthStatusForNetworkEndpoint
+		expect  string
+	}{
+		{
+			desc:   "no health status",
+			expect: unknownHealthState,
+		},
+		{
+			desc:    "health status without state",
+			healths: []*compute.HealthStatusForNetworkEndpoint{nil, health("bs1", "")},
+			expect:  unknownHealthState,
+		},
+		{
+			desc:    "unhealthy in a backend service",
+			healths: []*compute.HealthStatusForNetworkEndpoint{health("bs1", "UNHEALTHY")},
+			expect:  "UNHEALTHY",
+		},
+		{
+			desc:    "healthy in one of the backend services",
+			healths: []*compute.HealthStatusForNetworkEndpoint{health("bs1", "UNHEALTHY"), health("bs2", healthyState)},
+			expect:  healthyState,
+		},
+	} {
+		if state := endpointHealthState(tc.healths); state != tc.expect {
+			t.Errorf("For case %q, expect health state %q, but got %q", tc.desc, tc.expect, state)
+		}
+	}
+}
+
+// expectWaitingPodHealth checks that the poller reports a single waiting pod with the health state.
+func expectWaitingPodHealth(t *testing.T, poller *poller, state string) {
+	t.Helper()
+	pods := poller.waitingPods()
+	if len(pods) != 1 {
+		t.Fatalf("Expect 1 waiting pod, but got %v", pods)
+	}
+	if pods[0].HealthState != state || pods[0].LastObserved == nil {
+		t.Errorf("Expect waiting pod to be observed %q, but got %+v", state, pods[0])
+	}
 }
@@ -19,10 +19,12 @@ package readiness
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -31,6 +33,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/context"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/ingress-gce/pkg/neg/types/shared"
@@ -45,6 +48,12 @@ const (
 	negReadyTimedOutReason = "LoadBalancerNegTimeout"
 	// negNotReadyReason is the pod condition reason when pod is not healthy in NEG
 	negNotReadyReason = "LoadBalancerNegNotReady"
+	// negNotReadyTimedOutReason is the pod condition reason when timeout is reached, pod is still not healthy in NEG
+	// and the readiness policy keeps it not ready
+	negNotReadyTimedOutReason = "LoadBalancerNegTimeoutFailClosed"
+	// negDrainedReason is the pod condition reason when a terminating pod was detached from NEGs
+	// and its connections were drained
+	negDrainedReason = "LoadBalancerNegDrained"
 	// unreadyTimeout is the timeout for health status feedback for pod readiness. If load balancer health
 	// check is still not showing as Healthy for long than the time out since the pod is created. Skip wating and mark
 	// the pod as load balancer ready.
@@ -63,16 +72,31 @@ type readinessReflector struct {
 	pollerLock sync.Mutex
 	poller     *poller
 
-	podLister cache.Indexer
-	lookup    NegLookup
+	podLister           cache.Indexer
+	serviceLister       cache.Indexer
+	backendConfigLister cache.Indexer
+	lookup              NegLookup
 
 	eventBroadcaster record.EventBroadcaster
 	eventRecorder    record.EventRecorder
 
 	queue workqueue.RateLimitingInterface
+
+	// enableDrainCondition indicates if terminating pods are marked as drained
+	// after they were detached from NEGs.
+	enableDrainCondition bool
+	// drainLock protects drains and negPods
+	drainLock sync.Mutex
+	// drains maps the keys of terminating pods detached from NEGs to the time
+	// connections to them are drained.
+	drains map[string]time.Time
+	// negPods maps the keys of pods to the NEGs they were committed to and
+	// not detached from yet. A pod is only drained once it is in no NEG.
+	negPods    map[string]map[negMeta]bool
+	drainQueue workqueue.RateLimitingInterface
 }
 
-func NewReadinessReflector(cc *context.ControllerContext, lookup NegLookup) Reflector {
+func NewReadinessReflector(cc *context.ControllerContext, lookup NegLookup, enableDrainCondition bool) Reflector {
 	broadcaster := record.NewBroadcaster()
 	broadcaster.StartLogging(klog.Infof)
 	broadcaster.StartRecordingToSink(&unversionedcore.EventSinkImpl{
@@ -80,13 +104,21 @@ func NewReadinessReflector(cc *context.ControllerContext, lookup NegLookup) Refl
 	})
 	recorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "neg-readiness-reflector"})
 	reflector := &readinessReflector{
-		client:           cc.KubeClient,
-		podLister:        cc.PodInformer.GetIndexer(),
-		clock:            clock.RealClock{},
-		lookup:           lookup,
-		eventBroadcaster: broadcaster,
-		eventRecorder:    recorder,
-		queue:            workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		client:               cc.KubeClient,
+		podLister:            cc.PodInformer.GetIndexer(),
+		serviceLister:        cc.ServiceInformer.GetIndexer(),
+		clock:                clock.RealClock{},
+		lookup:               lookup,
+		eventBroadcaster:     broadcaster,
+		eventRecorder:        recorder,
+		queue:                workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		enableDrainCondition: enableDrainCondition,
+		drains:               map[string]time.Time{},
+		negPods:              map[string]map[negMeta]bool{},
+		drainQueue:           workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	if cc.BackendConfigInformer != nil {
+		reflector.backendConfigLister = cc.BackendConfigInformer.GetIndexer()
 	}
 	poller := NewPoller(cc.PodInformer.GetIndexer(), lookup, reflector, negtypes.NewAdapter(cc.Cloud))
 	reflector.poller = poller
@@ -95,10 +127,12 @@ func NewReadinessReflector(cc *context.ControllerContext, lookup NegLookup) Refl
 
 func (r *readinessReflector) Run(stopCh <-chan struct{}) {
 	defer r.queue.ShutDown()
+	defer r.drainQueue.ShutDown()
 	klog.V(2).Infof("Starting NEG readiness reflector")
 	defer klog.V(2).Infof("Shutting down NEG readiness reflector")
 
 	go wait.Until(r.worker, time.Second, stopCh)
+	go wait.Until(r.drainWorker, time.Second, stopCh)
 	<-stopCh
 }
 
@@ -164,7 +198,71 @@ func (r *readinessReflector) syncPod(key string, neg string) (err error) {
 
 	klog.V(4).Infof("Syncing Pod %q", key)
 	expectedCondition := r.getExpectedNegCondition(pod, neg)
-	return r.ensurePodNegCondition(pod, expectedCondition)
+	if expectedCondition.Reason == negNotReadyReason {
+		// Evaluate the pod again once its readiness policy times out.
+		r.queue.AddAfter(key, pod.CreationTimestamp.Add(r.getReadinessPolicy(pod).timeout).Sub(r.clock.Now()))
+	}
+	condition, _ := NegReadinessConditionStatus(pod)
+	becomesHealthy := len(neg) > 0 && condition.Status != v1.ConditionTrue
+	if err := r.ensurePodNegCondition(pod, expectedCondition); err != nil {
+		return err
+	}
+	if becomesHealthy {
+		observeReadinessGateLatency(pod, r.clock.Now())
+	}
+	return nil
+}
+
+// readinessPolicy is the NEG readiness policy of a pod.
+type readinessPolicy struct {
+	// timeout is the time the pod has to become healthy after its creation.
+	timeout time.Duration
+	// failOpen is true if the pod is marked ready once the timeout is reached.
+	failOpen bool
+	// source describes where the policy comes from.
+	source string
+}
+
+// getReadinessPolicy returns the NEG readiness policy of the pod, as annotated on the services
+// with NEGs which select it. Services without annotation have the default policy. As the pod is
+// ready once it is healthy in any of its NEGs, it fails open once the first service which fails
+// open times out, and only fails closed if every service does.
+func (r *readinessReflector) getReadinessPolicy(pod *v1.Pod) readinessPolicy {
+	defaultPolicy := readinessPolicy{timeout: unreadyTimeout, failOpen: true, source: "default policy"}
+	services, err := r.serviceLister.ByIndex(cache.NamespaceIndex, pod.Namespace)
+	if err != nil {
+		klog.Warningf("Failed to list services in namespace %q: %v", pod.Namespace, err)
+		return defaultPolicy
+	}
+	var ret *readinessPolicy
+	for _, obj := range services {
+		svc := obj.(*v1.Service)
+		if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		svcAnnotations := annotations.FromService(svc)
+		if _, found, _ := svcAnnotations.NEGAnnotation(); !found {
+			continue
+		}
+		policy := defaultPolicy
+		annotation, found, err := svcAnnotations.NEGReadinessPolicy()
+		if err != nil {
+			klog.Warningf("Ignoring NEG readiness policy of service %s/%s: %v", svc.Namespace, svc.Name, err)
+		} else if found {
+			if annotation.TimeoutSec > 0 {
+				policy.timeout = time.Duration(annotation.TimeoutSec) * time.Second
+			}
+			policy.failOpen = annotation.OnTimeout == annotations.NegReadinessFailOpen
+			policy.source = fmt.Sprintf("readiness policy of service %s/%s", svc.Namespace, svc.Name)
+		}
+		if ret == nil || (policy.failOpen && !ret.failOpen) || (policy.failOpen == ret.failOpen && policy.timeout < ret.timeout) {
+			ret = &policy
+		}
+	}
+	if ret == nil {
+		return defaultPolicy
+	}
+	return *ret
 }
 
 // getExpectedCondition returns the expected NEG readiness condition for the given pod
@@ -187,10 +285,20 @@ func (r *readinessReflector) getExpectedNegCondition(pod *v1.Pod, neg string) v1
 	}
 
 	// check if the pod has been waiting for the endpoint to show up as Healthy in NEG for too long
-	if r.clock.Now().After(pod.CreationTimestamp.Add(unreadyTimeout)) {
+	policy := r.getReadinessPolicy(pod)
+	if r.clock.Now().After(pod.CreationTimestamp.Add(policy.timeout)) {
+		health := ""
+		if states := r.poller.lastHealthStates(pod.Namespace, pod.Name); len(states) > 0 {
+			health = fmt.Sprintf(" Last observed health: %s.", strings.Join(states, ", "))
+		}
+		if !policy.failOpen {
+			expectedCondition.Reason = negNotReadyTimedOutReason
+			expectedCondition.Message = fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v after %v (%s). Keeping condition %q until it does.%s", negs, policy.timeout, policy.source, shared.NegReadinessGate, health)
+			return expectedCondition
+		}
 		expectedCondition.Status = v1.ConditionTrue
 		expectedCondition.Reason = negReadyTimedOutReason
-		expectedCondition.Message = fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v. Marking condition %q to True.", negs, shared.NegReadinessGate)
+		expectedCondition.Message = fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v after %v (%s). Marking condition %q to True.%s", negs, policy.timeout, policy.source, shared.NegReadinessGate, health)
 		return expectedCondition
 	}
 
@@ -226,6 +334,27 @@ func (r *readinessReflector) CommitPods(syncerKey negtypes.NegSyncerKey, negName
 	}
 	r.poller.RegisterNegEndpoints(key, endpointMap)
 	r.poll()
+	r.addNegPods(key, endpointMap)
+}
+
+// WaitingPods returns the pods waiting to become healthy in a NEG, with the last observed health
+// state of their endpoint and the deadline of their readiness policy.
+func (r *readinessReflector) WaitingPods() []WaitingPod {
+	pods := r.poller.waitingPods()
+	for i := range pods {
+		pod, exists, err := getPodFromStore(r.podLister, pods[i].Namespace, pods[i].Name)
+		if err != nil || !exists {
+			continue
+		}
+		policy := r.getReadinessPolicy(pod)
+		deadline := pod.CreationTimestamp.Add(policy.timeout)
+		pods[i].Deadline = &deadline
+		pods[i].OnTimeout = string(annotations.NegReadinessFailOpen)
+		if !policy.failOpen {
+			pods[i].OnTimeout = string(annotations.NegReadinessFailClosed)
+		}
+	}
+	return pods
 }
 
 // poll spins off go routines to poll NEGs
@@ -249,24 +378,28 @@ func (r *readinessReflector) pollNeg(key negMeta) {
 	}
 }
 
-// ensurePodNegCondition ensures the pod neg condition is as expected
+// ensurePodNegCondition ensures the pod neg condition of the type of expectedCondition is as expected
 // TODO(freehan): also populate lastTransitionTime in the condition
 func (r *readinessReflector) ensurePodNegCondition(pod *v1.Pod, expectedCondition v1.PodCondition) error {
 	// check if it is necessary to patch
-	condition, ok := NegReadinessConditionStatus(pod)
+	condition, ok := podConditionStatus(pod, expectedCondition.Type)
 	if ok && reflect.DeepEqual(expectedCondition, condition) {
-		klog.V(4).Infof("NEG condition for pod %s/%s is expected, skip patching", pod.Namespace, pod.Name)
+		klog.V(4).Infof("NEG condition %q for pod %s/%s is expected, skip patching", expectedCondition.Type, pod.Namespace, pod.Name)
 		return nil
 	}
 
 	// calculate patch bytes, send patch and record event
 	oldStatus := pod.Status.DeepCopy()
-	SetNegReadinessConditionStatus(pod, expectedCondition)
+	setPodConditionStatus(pod, expectedCondition.Type, expectedCondition)
 	patchBytes, err := preparePatchBytesforPodStatus(*oldStatus, pod.Status)
 	if err != nil {
 		return fmt.Errorf("failed to prepare patch bytes for pod %v: %v", pod, err)
 	}
-	r.eventRecorder.Eventf(pod, v1.EventTypeNormal, expectedCondition.Reason, expectedCondition.Message)
+	eventType := v1.EventTypeNormal
+	if expectedCondition.Reason == negReadyTimedOutReason || expectedCondition.Reason == negNotReadyTimedOutReason {
+		eventType = v1.EventTypeWarning
+	}
+	r.eventRecorder.Eventf(pod, eventType, expectedCondition.Reason, expectedCondition.Message)
 	_, _, err = patchPodStatus(r.client, pod.Namespace, pod.Name, patchBytes)
 	return err
 }
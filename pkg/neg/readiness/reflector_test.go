@@ -27,6 +27,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/context"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/ingress-gce/pkg/neg/types/shared"
@@ -62,12 +63,12 @@ func fakeContext() *context.ControllerContext {
 	}
 	fakeGCE := gce.NewFakeGCECloud(gce.DefaultTestClusterValues())
 	negtypes.MockNetworkEndpointAPIs(fakeGCE)
-	context := context.NewControllerContext(kubeClient, nil, nil, nil, fakeGCE, namer, ctxConfig)
+	context := context.NewControllerContext(kubeClient, nil, nil, nil, nil, fakeGCE, namer, ctxConfig)
 	return context
 }
 
 func newTestReadinessReflector(cc *context.ControllerContext) *readinessReflector {
-	reflector := NewReadinessReflector(cc, &fakeLookUp{})
+	reflector := NewReadinessReflector(cc, &fakeLookUp{}, false)
 	ret := reflector.(*readinessReflector)
 	return ret
 }
@@ -248,7 +249,7 @@ func TestSyncPod(t *testing.T) {
 							Type:    shared.NegReadinessGate,
 							Reason:  negReadyTimedOutReason,
 							Status:  v1.ConditionTrue,
-							Message: fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v. Marking condition %q to True.", []string{"neg1", "neg2"}, shared.NegReadinessGate),
+							Message: fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v after %v (default policy). Marking condition %q to True.", []string{"neg1", "neg2"}, unreadyTimeout, shared.NegReadinessGate),
 						},
 					},
 				},
@@ -275,3 +276,112 @@ func TestSyncPod(t *testing.T) {
 
 	}
 }
+
+func TestSyncPodReadinessPolicy(t *testing.T) {
+	fakeContext := fakeContext()
+	testReadinessReflector := newTestReadinessReflector(fakeContext)
+	client := fakeContext.KubeClient
+	podLister := testReadinessReflector.podLister
+	serviceLister := testReadinessReflector.serviceLister
+	testReadinessReflector.lookup.(*fakeLookUp).readinessGateEnabledNegs = []string{"neg1"}
+	fakeClock := clock.NewFakeClock(time.Now())
+	testReadinessReflector.clock = fakeClock
+	podName := "pod1"
+	negs := []string{"neg1"}
+
+	newService := func(name, policy string) *v1.Service {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   testNamespace,
+				Name:        name,
+				Annotations: map[string]string{annotations.NEGAnnotationKey: `{"ingress":true}`},
+			},
+			Spec: v1.ServiceSpec{Selector: map[string]string{"app": "test"}},
+		}
+		if policy != "" {
+			svc.Annotations[annotations.NEGReadinessPolicyKey] = policy
+		}
+		return svc
+	}
+
+	for _, tc := range []struct {
+		desc            string
+		services        []*v1.Service
+		wait            time.Duration
+		expectCondition v1.PodCondition
+	}{
+		{
+			desc:     "waiting before the timeout of the policy",
+			services: []*v1.Service{newService("svc1", `{"timeoutSec":60}`)},
+			wait:     59 * time.Second,
+			expectCondition: v1.PodCondition{
+				Type:    shared.NegReadinessGate,
+				Reason:  negNotReadyReason,
+				Message: fmt.Sprintf("Waiting for pod to become healthy in at least one of the NEG(s): %v", negs),
+			},
+		},
+		{
+			desc:     "fail open after the timeout of the policy",
+			services: []*v1.Service{newService("svc1", `{"timeoutSec":60}`)},
+			wait:     61 * time.Second,
+			expectCondition: v1.PodCondition{
+				Type:    shared.NegReadinessGate,
+				Status:  v1.ConditionTrue,
+				Reason:  negReadyTimedOutReason,
+				Message: fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v after 1m0s (readiness policy of service %s/svc1). Marking condition %q to True.", negs, testNamespace, shared.NegReadinessGate),
+			},
+		},
+		{
+			desc:     "fail closed after the timeout of the policy",
+			services: []*v1.Service{newService("svc1", `{"timeoutSec":60,"onTimeout":"FailClosed"}`)},
+			wait:     unreadyTimeout + time.Second,
+			expectCondition: v1.PodCondition{
+				Type:    shared.NegReadinessGate,
+				Reason:  negNotReadyTimedOutReason,
+				Message: fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v after 1m0s (readiness policy of service %s/svc1). Keeping condition %q until it does.", negs, testNamespace, shared.NegReadinessGate),
+			},
+		},
+		{
+			desc: "fail open once any service fails open",
+			services: []*v1.Service{
+				newService("svc1", `{"timeoutSec":60,"onTimeout":"FailClosed"}`),
+				newService("svc2", `{"timeoutSec":120}`),
+			},
+			wait: 121 * time.Second,
+			expectCondition: v1.PodCondition{
+				Type:    shared.NegReadinessGate,
+				Status:  v1.ConditionTrue,
+				Reason:  negReadyTimedOutReason,
+				Message: fmt.Sprintf("Timeout waiting for pod to become healthy in at least one of the NEG(s): %v after 2m0s (readiness policy of service %s/svc2). Marking condition %q to True.", negs, testNamespace, shared.NegReadinessGate),
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			for _, obj := range serviceLister.List() {
+				serviceLister.Delete(obj)
+			}
+			for _, svc := range tc.services {
+				serviceLister.Add(svc)
+			}
+			pod := generatePod(testNamespace, podName, true, false, false)
+			pod.Labels = map[string]string{"app": "test"}
+			pod.CreationTimestamp = metav1.NewTime(fakeClock.Now()).Rfc3339Copy()
+			client.CoreV1().Pods(testNamespace).Delete(podName, &metav1.DeleteOptions{})
+			client.CoreV1().Pods(testNamespace).Create(pod)
+			podLister.Add(pod)
+			fakeClock.Step(tc.wait)
+
+			if err := testReadinessReflector.syncPod(keyFunc(testNamespace, podName), ""); err != nil {
+				t.Fatalf("Expect err to be nil, but got %v", err)
+			}
+			pod, err := client.CoreV1().Pods(testNamespace).Get(podName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Expect err to be nil, but got %v", err)
+			}
+			condition, _ := podConditionStatus(pod, shared.NegReadinessGate)
+			if !reflect.DeepEqual(condition, tc.expectCondition) {
+				t.Errorf("Expect condition to be %+v, but got %+v", tc.expectCondition, condition)
+			}
+		})
+	}
+}
@@ -18,11 +18,13 @@ package readiness
 
 import (
 	"fmt"
+	"time"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/ingress-gce/pkg/neg/types/shared"
 	"k8s.io/ingress-gce/pkg/utils"
@@ -31,17 +33,32 @@ import (
 
 // NegReadinessConditionStatus return (cond, true) if neg condition exists, otherwise (_, false)
 func NegReadinessConditionStatus(pod *v1.Pod) (negCondition v1.PodCondition, exists bool) {
+	return podConditionStatus(pod, shared.NegReadinessGate)
+}
+
+// podConditionStatus return (cond, true) if the condition of the type exists, otherwise (_, false)
+func podConditionStatus(pod *v1.Pod, conditionType v1.PodConditionType) (v1.PodCondition, bool) {
 	if pod == nil {
 		return v1.PodCondition{}, false
 	}
 	for _, condition := range pod.Status.Conditions {
-		if condition.Type == shared.NegReadinessGate {
+		if condition.Type == conditionType {
 			return condition, true
 		}
 	}
 	return v1.PodCondition{}, false
 }
 
+// observeReadinessGateLatency publishes the latency between the containers of the pod
+// becoming ready and the pod becoming healthy in a NEG at the given time.
+func observeReadinessGateLatency(pod *v1.Pod, now time.Time) {
+	condition, ok := podConditionStatus(pod, v1.ContainersReady)
+	if !ok || condition.Status != v1.ConditionTrue || condition.LastTransitionTime.IsZero() {
+		return
+	}
+	metrics.ObserveReadinessGateLatency(now.Sub(condition.LastTransitionTime.Time))
+}
+
 // evalNegReadinessGate returns if the pod readiness gate includes the NEG readiness condition and the condition status is true
 func evalNegReadinessGate(pod *v1.Pod) (negReady bool, readinessGateExists bool) {
 	if pod == nil {
@@ -88,11 +105,16 @@ func getPodFromStore(podLister cache.Indexer, namespace, name string) (pod *v1.P
 
 // SetNegReadinessConditionStatus sets the status of the NEG readiness condition
 func SetNegReadinessConditionStatus(pod *v1.Pod, condition v1.PodCondition) {
+	setPodConditionStatus(pod, shared.NegReadinessGate, condition)
+}
+
+// setPodConditionStatus sets the status of the condition of the type
+func setPodConditionStatus(pod *v1.Pod, conditionType v1.PodConditionType, condition v1.PodCondition) {
 	if pod == nil {
 		return
 	}
 	for i, cond := range pod.Status.Conditions {
-		if cond.Type == shared.NegReadinessGate {
+		if cond.Type == conditionType {
 			pod.Status.Conditions[i] = condition
 			return
 		}
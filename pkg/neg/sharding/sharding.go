@@ -0,0 +1,478 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sharding distributes the services of the NEG controller among the
+// replicas of the controller. Services are assigned to a fixed number of
+// shards with consistent hashing, and each shard is owned by at most one
+// replica at a time through a Lease.
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// memberLabelKey is the label of the member Leases of the replicas, whose value is the prefix of the Leases.
+	memberLabelKey = "networking.gke.io/neg-shard-member"
+)
+
+// ShardOf returns the shard of the service among numShards shards. It uses jump consistent
+// hashing, so that changing the number of shards only moves the services of the shards
+// added or removed.
+func ShardOf(namespace, name string, numShards int) int {
+	h := fnv.New64a()
+	h.Write([]byte(namespace + "/" + name))
+	return jumpHash(h.Sum64(), numShards)
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach.
+func jumpHash(key uint64, numBuckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(numBuckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Callbacks are called by the Elector when the ownership of a shard changes.
+type Callbacks struct {
+	// OnAcquired is called once the replica owns the shard.
+	OnAcquired func(shard int)
+	// OnReleasing is called once the replica stops owning the shard. It stops the work on
+	// the services of the shard and returns true once no work is in progress anymore. A shard
+	// which is given up is only released to other replicas once OnReleasing returned true.
+	OnReleasing func(shard int) bool
+}
+
+// shardState is the state of a shard owned by the replica.
+type shardState struct {
+	// renewTime is the last time the Lease of the shard was renewed.
+	renewTime time.Time
+	// releasing is true once the shard is given up and its work is stopping.
+	releasing bool
+}
+
+// observedLease is a Lease as last observed, with the local time of the observation.
+type observedLease struct {
+	holder    string
+	renewTime metav1.MicroTime
+	time      time.Time
+}
+
+// Elector acquires the Leases of the shards of the replica. Each replica holds about the
+// same number of shards, which is computed from the number of live replicas, as seen from
+// their member Leases. The Lease of a shard is only acquired once it is released by its
+// holder, or once it was not renewed for the lease duration, as observed locally.
+type Elector struct {
+	client    kubernetes.Interface
+	namespace string
+	prefix    string
+	identity  string
+	numShards int
+
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+	clock         clock.Clock
+
+	mu sync.Mutex
+	// owned are the shards owned by the replica.
+	owned map[int]*shardState
+	// observed are the Leases of the shards as last observed.
+	observed map[int]observedLease
+	// observedMembers are the member Leases of the replicas as last observed by name.
+	observedMembers map[string]observedLease
+}
+
+// NewElector returns an Elector of the numShards shards whose Leases are named after prefix
+// in the namespace. The identity of the replica must be valid in the name of a Lease. The
+// Lease of an owned shard is renewed every retryPeriod. The replica stops owning the shard
+// if the Lease could not be renewed for renewDeadline, which must be shorter than leaseDuration.
+func NewElector(client kubernetes.Interface, namespace, prefix, identity string, numShards int, leaseDuration, renewDeadline, retryPeriod time.Duration) *Elector {
+	return &Elector{
+		client:        client,
+		namespace:     namespace,
+		prefix:        prefix,
+		identity:      identity,
+		numShards:     numShards,
+		leaseDuration: leaseDuration,
+		renewDeadline: renewDeadline,
+		retryPeriod:   retryPeriod,
+		clock:         clock.RealClock{},
+		owned:         map[int]*shardState{},
+		observed:      map[int]observedLease{},
+
+		observedMembers: map[string]observedLease{},
+	}
+}
+
+// ShardOf returns the shard of the service.
+func (e *Elector) ShardOf(namespace, name string) int {
+	return ShardOf(namespace, name, e.numShards)
+}
+
+// Owns returns true if the replica owns the shard of the service.
+func (e *Elector) Owns(namespace, name string) bool {
+	return e.OwnsShard(e.ShardOf(namespace, name))
+}
+
+// OwnsShard returns true if the replica owns the shard and is not giving it up.
+func (e *Elector) OwnsShard(shard int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state, ok := e.owned[shard]
+	return ok && !state.releasing && e.clock.Since(state.renewTime) < e.renewDeadline
+}
+
+// OwnedShards returns the shards owned by the replica.
+func (e *Elector) OwnedShards() []int {
+	var shards []int
+	for shard := 0; shard < e.numShards; shard++ {
+		if e.OwnsShard(shard) {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+// Run acquires and renews the Leases of the shards of the replica until stopCh is closed.
+// The shards are then released by best effort.
+func (e *Elector) Run(callbacks Callbacks, stopCh <-chan struct{}) {
+	klog.V(2).Infof("Starting NEG shard elector %q with %d shards", e.identity, e.numShards)
+	wait.Until(func() { e.reconcile(callbacks) }, e.retryPeriod, stopCh)
+	e.releaseAll(callbacks)
+}
+
+// reconcile renews the member Lease of the replica, then acquires, renews or releases the
+// Leases of the shards so that the replica holds its share of the shards.
+func (e *Elector) reconcile(callbacks Callbacks) {
+	if err := e.renewMember(); err != nil {
+		klog.Warningf("Failed to renew NEG shard member Lease of %q: %v", e.identity, err)
+	}
+	target := e.targetShards()
+	e.markReleasing(target)
+
+	for shard := 0; shard < e.numShards; shard++ {
+		lease, err := e.getLease(shard)
+		if err != nil {
+			klog.Warningf("Failed to get Lease of NEG shard %d: %v", shard, err)
+			e.checkRenewDeadline(shard, callbacks)
+			continue
+		}
+		holder := holderOf(lease)
+
+		e.mu.Lock()
+		state, owned := e.owned[shard]
+		releasing := owned && state.releasing
+		e.mu.Unlock()
+
+		switch {
+		case owned && holder != e.identity:
+			klog.Warningf("NEG shard %d was taken over by %q", shard, holder)
+			e.lose(shard, callbacks)
+		case releasing:
+			e.release(shard, lease, callbacks)
+		case owned:
+			if err := e.updateLease(lease, e.identity, false); err != nil {
+				klog.Warningf("Failed to renew Lease of NEG shard %d: %v", shard, err)
+				e.checkRenewDeadline(shard, callbacks)
+				continue
+			}
+			e.mu.Lock()
+			state.renewTime = e.clock.Now()
+			e.mu.Unlock()
+		case e.isAvailable(shard, lease) && e.countOwned() < target:
+			if err := e.updateLease(lease, e.identity, true); err != nil {
+				klog.V(2).Infof("Failed to acquire Lease of NEG shard %d: %v", shard, err)
+				continue
+			}
+			klog.V(2).Infof("Acquired NEG shard %d", shard)
+			e.mu.Lock()
+			e.owned[shard] = &shardState{renewTime: e.clock.Now()}
+			e.mu.Unlock()
+			if callbacks.OnAcquired != nil {
+				callbacks.OnAcquired(shard)
+			}
+		}
+	}
+}
+
+// markReleasing gives up the highest shards owned beyond the target number of shards.
+func (e *Elector) markReleasing(target int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var kept []int
+	for shard, state := range e.owned {
+		if !state.releasing {
+			kept = append(kept, shard)
+		}
+	}
+	sort.Ints(kept)
+	for len(kept) > target {
+		shard := kept[len(kept)-1]
+		kept = kept[:len(kept)-1]
+		klog.V(2).Infof("Releasing NEG shard %d to balance %d shards", shard, e.numShards)
+		e.owned[shard].releasing = true
+	}
+}
+
+// release gives up the shard. Its Lease is released once OnReleasing returns true, it is
+// renewed until then.
+func (e *Elector) release(shard int, lease *coordinationv1.Lease, callbacks Callbacks) {
+	e.mu.Lock()
+	state := e.owned[shard]
+	state.releasing = true
+	e.mu.Unlock()
+
+	if callbacks.OnReleasing != nil && !callbacks.OnReleasing(shard) {
+		if err := e.updateLease(lease, e.identity, false); err != nil {
+			klog.Warningf("Failed to renew Lease of releasing NEG shard %d: %v", shard, err)
+			e.checkRenewDeadline(shard, callbacks)
+			return
+		}
+		e.mu.Lock()
+		state.renewTime = e.clock.Now()
+		e.mu.Unlock()
+		return
+	}
+	if err := e.updateLease(lease, "", false); err != nil {
+		klog.Warningf("Failed to release Lease of NEG shard %d: %v", shard, err)
+		e.checkRenewDeadline(shard, callbacks)
+		return
+	}
+	klog.V(2).Infof("Released NEG shard %d", shard)
+	e.mu.Lock()
+	delete(e.owned, shard)
+	e.mu.Unlock()
+}
+
+// checkRenewDeadline gives up the shard if its Lease was not renewed for the renew deadline,
+// as another replica may acquire it once the lease duration passed.
+func (e *Elector) checkRenewDeadline(shard int, callbacks Callbacks) {
+	e.mu.Lock()
+	state, ok := e.owned[shard]
+	expired := ok && e.clock.Since(state.renewTime) >= e.renewDeadline
+	e.mu.Unlock()
+	if expired {
+		klog.Warningf("Lease of NEG shard %d was not renewed for %v", shard, e.renewDeadline)
+		e.lose(shard, callbacks)
+	}
+}
+
+// lose stops the work on a shard which is not owned anymore.
+func (e *Elector) lose(shard int, callbacks Callbacks) {
+	e.mu.Lock()
+	delete(e.owned, shard)
+	e.mu.Unlock()
+	if callbacks.OnReleasing != nil {
+		callbacks.OnReleasing(shard)
+	}
+}
+
+// releaseAll releases the Leases of the shards whose work could be stopped.
+func (e *Elector) releaseAll(callbacks Callbacks) {
+	e.mu.Lock()
+	var shards []int
+	for shard := range e.owned {
+		shards = append(shards, shard)
+	}
+	e.mu.Unlock()
+	sort.Ints(shards)
+	for _, shard := range shards {
+		lease, err := e.getLease(shard)
+		if err != nil {
+			klog.Warningf("Failed to get Lease of NEG shard %d: %v", shard, err)
+			continue
+		}
+		if holderOf(lease) == e.identity {
+			e.release(shard, lease, callbacks)
+		}
+	}
+	if err := e.client.CoordinationV1().Leases(e.namespace).Delete(e.memberName(), &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("Failed to delete NEG shard member Lease of %q: %v", e.identity, err)
+	}
+}
+
+// countOwned returns the number of shards owned by the replica, including the ones being released.
+func (e *Elector) countOwned() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.owned)
+}
+
+// targetShards returns the number of shards the replica should own, which is its share among the live replicas.
+func (e *Elector) targetShards() int {
+	members, err := e.client.CoordinationV1().Leases(e.namespace).List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", memberLabelKey, e.prefix)})
+	if err != nil {
+		klog.Warningf("Failed to list NEG shard member Leases: %v", err)
+		// Keep the shards owned.
+		return e.countOwned()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	live := 0
+	listed := map[string]bool{}
+	for _, member := range members.Items {
+		listed[member.Name] = true
+		if holderOf(&member) == e.identity || !e.memberExpiredLocked(&member) {
+			live++
+		}
+	}
+	for name := range e.observedMembers {
+		if !listed[name] {
+			delete(e.observedMembers, name)
+		}
+	}
+	if live == 0 {
+		live = 1
+	}
+	return int(math.Ceil(float64(e.numShards) / float64(live)))
+}
+
+// isAvailable returns true if the shard Lease is not held, or was not renewed for the lease duration since it was first observed.
+func (e *Elector) isAvailable(shard int, lease *coordinationv1.Lease) bool {
+	holder := holderOf(lease)
+	if holder == "" {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	observed, ok := e.observed[shard]
+	if observeLease(&observed, ok, lease, e.clock.Now()) {
+		e.observed[shard] = observed
+		return false
+	}
+	return e.clock.Since(observed.time) >= e.leaseDuration
+}
+
+// memberExpiredLocked returns true if the member Lease was not renewed for the lease duration since
+// its last renewal was first observed. Renewals are timed with the local clock, so that the clock
+// skew with the replica renewing the Lease does not matter. Must be called with the lock held.
+func (e *Elector) memberExpiredLocked(member *coordinationv1.Lease) bool {
+	observed, ok := e.observedMembers[member.Name]
+	if observeLease(&observed, ok, member, e.clock.Now()) {
+		e.observedMembers[member.Name] = observed
+		return false
+	}
+	return e.clock.Since(observed.time) >= e.leaseDuration
+}
+
+// getLease returns the Lease of the shard, which is created if it does not exist.
+func (e *Elector) getLease(shard int) (*coordinationv1.Lease, error) {
+	leases := e.client.CoordinationV1().Leases(e.namespace)
+	name := e.shardName(shard)
+	lease, err := leases.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return leases.Create(&coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: e.namespace, Name: name}})
+	}
+	return lease, err
+}
+
+// updateLease sets the holder of the Lease and renews it. The update fails if the Lease changed since it was read.
+func (e *Elector) updateLease(lease *coordinationv1.Lease, holder string, acquire bool) error {
+	lease = lease.DeepCopy()
+	now := metav1.NewMicroTime(e.clock.Now())
+	durationSeconds := int32(e.leaseDuration / time.Second)
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+	if acquire {
+		lease.Spec.AcquireTime = &now
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	_, err := e.client.CoordinationV1().Leases(e.namespace).Update(lease)
+	return err
+}
+
+// renewMember renews the member Lease of the replica, which shows that the replica is live.
+func (e *Elector) renewMember() error {
+	leases := e.client.CoordinationV1().Leases(e.namespace)
+	now := metav1.NewMicroTime(e.clock.Now())
+	durationSeconds := int32(e.leaseDuration / time.Second)
+	member, err := leases.Get(e.memberName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: e.namespace,
+				Name:      e.memberName(),
+				Labels:    map[string]string{memberLabelKey: e.prefix},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &e.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	member.Spec.RenewTime = &now
+	_, err = leases.Update(member)
+	return err
+}
+
+func (e *Elector) shardName(shard int) string {
+	return fmt.Sprintf("%s-%d", e.prefix, shard)
+}
+
+func (e *Elector) memberName() string {
+	return fmt.Sprintf("%s-member-%s", e.prefix, e.identity)
+}
+
+// holderOf returns the holder of the Lease, or "" if it is not held.
+func holderOf(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+// observeLease updates observed, which is valid if ok, to the Lease observed at now if its holder
+// or renew time changed. Returns true if it changed.
+func observeLease(observed *observedLease, ok bool, lease *coordinationv1.Lease, now time.Time) bool {
+	holder := holderOf(lease)
+	var renewTime metav1.MicroTime
+	if lease.Spec.RenewTime != nil {
+		renewTime = *lease.Spec.RenewTime
+	}
+	if ok && observed.holder == holder && observed.renewTime.Equal(&renewTime) {
+		return false
+	}
+	*observed = observedLease{holder: holder, renewTime: renewTime, time: now}
+	return true
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace     = "kube-system"
+	testPrefix        = "neg-shard"
+	testNumShards     = 4
+	testLeaseDuration = 15 * time.Second
+	testRenewDeadline = 10 * time.Second
+	testRetryPeriod   = 2 * time.Second
+)
+
+func newTestElector(client kubernetes.Interface, fakeClock clock.Clock, identity string) *Elector {
+	e := NewElector(client, testNamespace, testPrefix, identity, testNumShards, testLeaseDuration, testRenewDeadline, testRetryPeriod)
+	e.clock = fakeClock
+	return e
+}
+
+func TestShardOf(t *testing.T) {
+	t.Parallel()
+
+	counts := make([]int, testNumShards)
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("svc-%d", i)
+		shard := ShardOf("ns", name, testNumShards)
+		if shard < 0 || shard >= testNumShards {
+			t.Fatalf("Expect shard of %q to be in [0, %d), but got %d", name, testNumShards, shard)
+		}
+		if again := ShardOf("ns", name, testNumShards); again != shard {
+			t.Errorf("Expect shard of %q to be stable, but got %d and %d", name, shard, again)
+		}
+		// Adding a shard only moves services to the new shard.
+		if more := ShardOf("ns", name, testNumShards+1); more != shard && more != testNumShards {
+			t.Errorf("Expect shard of %q to stay %d or move to %d, but got %d", name, shard, testNumShards, more)
+		}
+		counts[shard]++
+	}
+	for shard, count := range counts {
+		if count == 0 {
+			t.Errorf("Expect services in shard %d, but got none", shard)
+		}
+	}
+}
+
+func TestElectorBalance(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+	fakeClock := clock.NewFakeClock(time.Now())
+	e1 := newTestElector(client, fakeClock, "replica-1")
+	e2 := newTestElector(client, fakeClock, "replica-2")
+
+	var acquired1, acquired2, released1 []int
+	callbacks1 := Callbacks{
+		OnAcquired:  func(shard int) { acquired1 = append(acquired1, shard) },
+		OnReleasing: func(shard int) bool { released1 = append(released1, shard); return true },
+	}
+	callbacks2 := Callbacks{
+		OnAcquired: func(shard int) { acquired2 = append(acquired2, shard) },
+	}
+
+	// The first replica acquires every shard.
+	e1.reconcile(callbacks1)
+	if shards := e1.OwnedShards(); !reflect.DeepEqual(shards, []int{0, 1, 2, 3}) {
+		t.Errorf("Expect replica-1 to own every shard, but got %v", shards)
+	}
+	if !reflect.DeepEqual(acquired1, []int{0, 1, 2, 3}) {
+		t.Errorf("Expect OnAcquired to be called for every shard, but got %v", acquired1)
+	}
+
+	// The second replica joins, but the shards are held.
+	fakeClock.Step(testRetryPeriod)
+	e2.reconcile(callbacks2)
+	if shards := e2.OwnedShards(); len(shards) != 0 {
+		t.Errorf("Expect replica-2 to own no shard, but got %v", shards)
+	}
+
+	// The first replica releases its share of the shards to the second one.
+	fakeClock.Step(testRetryPeriod)
+	e1.reconcile(callbacks1)
+	if shards := e1.OwnedShards(); !reflect.DeepEqual(shards, []int{0, 1}) {
+		t.Errorf("Expect replica-1 to own shards [0 1], but got %v", shards)
+	}
+	if !reflect.DeepEqual(released1, []int{2, 3}) {
+		t.Errorf("Expect OnReleasing to be called for shards [2 3], but got %v", released1)
+	}
+
+	fakeClock.Step(testRetryPeriod)
+	e2.reconcile(callbacks2)
+	if shards := e2.OwnedShards(); !reflect.DeepEqual(shards, []int{2, 3}) {
+		t.Errorf("Expect replica-2 to own shards [2 3], but got %v", shards)
+	}
+	if !reflect.DeepEqual(acquired2, []int{2, 3}) {
+		t.Errorf("Expect OnAcquired to be called for shards [2 3], but got %v", acquired2)
+	}
+	if e1.Owns("ns", "svc") == e2.Owns("ns", "svc") {
+		t.Errorf("Expect exactly one replica to own service ns/svc")
+	}
+}
+
+func TestElectorReleaseWaitsForStoppedWork(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+	fakeClock := clock.NewFakeClock(time.Now())
+	e1 := newTestElector(client, fakeClock, "replica-1")
+	e2 := newTestElector(client, fakeClock, "replica-2")
+
+	stopped := false
+	callbacks1 := Callbacks{
+		OnReleasing: func(shard int) bool { return stopped },
+	}
+	e1.reconcile(callbacks1)
+	fakeClock.Step(testRetryPeriod)
+	e2.reconcile(Callbacks{})
+
+	// The work on the released shards is still in progress, so their Leases are kept.
+	fakeClock.Step(testRetryPeriod)
+	e1.reconcile(callbacks1)
+	if shards := e1.OwnedShards(); !reflect.DeepEqual(shards, []int{0, 1}) {
+		t.Errorf("Expect replica-1 to own shards [0 1], but got %v", shards)
+	}
+	for i := 0; i < 3; i++ {
+		fakeClock.Step(testRetryPeriod)
+		e2.reconcile(Callbacks{})
+		if shards := e2.OwnedShards(); len(shards) != 0 {
+			t.Fatalf("Expect replica-2 to own no shard while replica-1 releases them, but got %v", shards)
+		}
+		e1.reconcile(callbacks1)
+	}
+
+	stopped = true
+	fakeClock.Step(testRetryPeriod)
+	e1.reconcile(callbacks1)
+	e2.reconcile(Callbacks{})
+	if shards := e2.OwnedShards(); !reflect.DeepEqual(shards, []int{2, 3}) {
+		t.Errorf("Expect replica-2 to own shards [2 3], but got %v", shards)
+	}
+}
+
+func TestElectorTakeOverExpiredShards(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+	fakeClock := clock.NewFakeClock(time.Now())
+	e1 := newTestElector(client, fakeClock, "replica-1")
+	e2 := newTestElector(client, fakeClock, "replica-2")
+
+	e1.reconcile(Callbacks{})
+	// The first replica stops renewing its Leases.
+	e2.reconcile(Callbacks{})
+	fakeClock.Step(testRenewDeadline)
+	if shards := e1.OwnedShards(); len(shards) != 0 {
+		t.Errorf("Expect replica-1 to own no shard past the renew deadline, but got %v", shards)
+	}
+	e2.reconcile(Callbacks{})
+	if shards := e2.OwnedShards(); len(shards) != 0 {
+		t.Errorf("Expect replica-2 to own no shard before the Leases expire, but got %v", shards)
+	}
+
+	fakeClock.Step(testLeaseDuration - testRenewDeadline)
+	e2.reconcile(Callbacks{})
+	if shards := e2.OwnedShards(); !reflect.DeepEqual(shards, []int{0, 1, 2, 3}) {
+		t.Errorf("Expect replica-2 to own every shard, but got %v", shards)
+	}
+}
+
+func TestElectorTargetShardsWithClockSkew(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+	clock1 := clock.NewFakeClock(time.Now())
+	// The clock of the second replica is ahead by more than the lease duration.
+	clock2 := clock.NewFakeClock(clock1.Now().Add(2 * testLeaseDuration))
+	e1 := newTestElector(client, clock1, "replica-1")
+	e2 := newTestElector(client, clock2, "replica-2")
+
+	e1.reconcile(Callbacks{})
+	e2.reconcile(Callbacks{})
+	for i := 0; i < 3; i++ {
+		clock1.Step(testRetryPeriod)
+		clock2.Step(testRetryPeriod)
+		if err := e1.renewMember(); err != nil {
+			t.Fatalf("Failed to renew member Lease of replica-1: %v", err)
+		}
+		if target := e2.targetShards(); target != testNumShards/2 {
+			t.Errorf("Expect replica-2 to target %d shards while replica-1 renews its member Lease, but got %d", testNumShards/2, target)
+		}
+	}
+
+	// The first replica stops renewing its member Lease.
+	clock2.Step(testLeaseDuration)
+	if target := e2.targetShards(); target != testNumShards {
+		t.Errorf("Expect replica-2 to target %d shards once replica-1 stopped renewing, but got %d", testNumShards, target)
+	}
+}
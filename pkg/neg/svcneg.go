@@ -0,0 +1,202 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	svcnegv1beta1 "k8s.io/ingress-gce/pkg/apis/svcneg/v1beta1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/klog"
+)
+
+const (
+	// negCRManagedByKey is the label set on the ServiceNetworkEndpointGroups maintained by the NEG controller.
+	negCRManagedByKey = "networking.gke.io/managed-by"
+	// negCRManagedByValue is the value of negCRManagedByKey.
+	negCRManagedByValue = "neg-controller"
+)
+
+// SyncNegCRs ensures that the status of every NEG is reported in a ServiceNetworkEndpointGroup
+// named after the NEG, and deletes the ServiceNetworkEndpointGroups of NEGs which are not desired.
+// It is a no-op if ServiceNetworkEndpointGroups are disabled.
+func (manager *syncerManager) SyncNegCRs() error {
+	if manager.svcNegClient == nil || manager.svcNegLister == nil {
+		return nil
+	}
+
+	desired := manager.desiredNegCRs()
+	errList := []error{}
+	for key, negCR := range desired {
+		if err := manager.ensureNegCR(key, negCR); err != nil {
+			errList = append(errList, err)
+		}
+	}
+
+	for _, obj := range manager.svcNegLister.List() {
+		negCR := obj.(*svcnegv1beta1.ServiceNetworkEndpointGroup)
+		if negCR.Labels[negCRManagedByKey] != negCRManagedByValue {
+			continue
+		}
+		if _, ok := desired[negCRKey(negCR.Namespace, negCR.Name)]; ok {
+			continue
+		}
+		// ServiceNetworkEndpointGroups of services in shards of other replicas are theirs to delete.
+		if !manager.owns(negCR.Namespace, negCR.Spec.ServiceName) {
+			continue
+		}
+		klog.V(2).Infof("Deleting ServiceNetworkEndpointGroup %s/%s", negCR.Namespace, negCR.Name)
+		if err := manager.svcNegClient.NetworkingV1beta1().ServiceNetworkEndpointGroups(negCR.Namespace).Delete(negCR.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			errList = append(errList, fmt.Errorf("failed to delete ServiceNetworkEndpointGroup %s/%s: %v", negCR.Namespace, negCR.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errList)
+}
+
+// desiredNegCRs returns the ServiceNetworkEndpointGroups of the NEGs of running syncers keyed by namespace/name.
+func (manager *syncerManager) desiredNegCRs() map[string]*svcnegv1beta1.ServiceNetworkEndpointGroup {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	ret := map[string]*svcnegv1beta1.ServiceNetworkEndpointGroup{}
+	for svcKey, portInfoMap := range manager.svcPortMap {
+		obj, exists, err := manager.serviceLister.GetByKey(svcKey.Key())
+		if err != nil || !exists {
+			continue
+		}
+		service := obj.(*v1.Service)
+		for portKey, portInfo := range portInfoMap {
+			syncer, ok := manager.syncerMap[getSyncerKey(svcKey.namespace, svcKey.name, portKey, portInfo)]
+			if !ok || syncer.IsStopped() {
+				continue
+			}
+			ret[negCRKey(svcKey.namespace, portInfo.NegName)] = newNegCR(service, portKey, portInfo, syncer.Status())
+		}
+	}
+	return ret
+}
+
+// ensureNegCR creates or updates the ServiceNetworkEndpointGroup.
+func (manager *syncerManager) ensureNegCR(key string, negCR *svcnegv1beta1.ServiceNetworkEndpointGroup) error {
+	client := manager.svcNegClient.NetworkingV1beta1().ServiceNetworkEndpointGroups(negCR.Namespace)
+	obj, exists, err := manager.svcNegLister.GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve ServiceNetworkEndpointGroup %s from store: %v", key, err)
+	}
+
+	var existing *svcnegv1beta1.ServiceNetworkEndpointGroup
+	if exists {
+		existing = obj.(*svcnegv1beta1.ServiceNetworkEndpointGroup)
+	}
+	manager.populateSelfLinks(negCR, existing)
+
+	if existing == nil {
+		klog.V(2).Infof("Creating ServiceNetworkEndpointGroup %s", key)
+		if _, err := client.Create(negCR); err != nil {
+			return fmt.Errorf("failed to create ServiceNetworkEndpointGroup %s: %v", key, err)
+		}
+		return nil
+	}
+
+	if reflect.DeepEqual(existing.Spec, negCR.Spec) && reflect.DeepEqual(existing.Status, negCR.Status) &&
+		reflect.DeepEqual(existing.OwnerReferences, negCR.OwnerReferences) && existing.Labels[negCRManagedByKey] == negCRManagedByValue {
+		return nil
+	}
+	updated := existing.DeepCopy()
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	updated.Labels[negCRManagedByKey] = negCRManagedByValue
+	updated.OwnerReferences = negCR.OwnerReferences
+	updated.Spec = negCR.Spec
+	updated.Status = negCR.Status
+	klog.V(3).Infof("Updating ServiceNetworkEndpointGroup %s", key)
+	if _, err := client.Update(updated); err != nil {
+		return fmt.Errorf("failed to update ServiceNetworkEndpointGroup %s: %v", key, err)
+	}
+	return nil
+}
+
+// populateSelfLinks fills in the self links of the NEGs, reusing the ones of the existing ServiceNetworkEndpointGroup if possible.
+func (manager *syncerManager) populateSelfLinks(negCR, existing *svcnegv1beta1.ServiceNetworkEndpointGroup) {
+	selfLinks := map[string]string{}
+	if existing != nil {
+		for _, ref := range existing.Status.NetworkEndpointGroups {
+			selfLinks[ref.Zone] = ref.SelfLink
+		}
+	}
+	for i := range negCR.Status.NetworkEndpointGroups {
+		ref := &negCR.Status.NetworkEndpointGroups[i]
+		if selfLink := selfLinks[ref.Zone]; selfLink != "" {
+			ref.SelfLink = selfLink
+			continue
+		}
+		neg, err := manager.cloud.GetNetworkEndpointGroup(negCR.Name, ref.Zone)
+		if err != nil {
+			klog.V(4).Infof("Failed to retrieve NEG %q in %q: %v", negCR.Name, ref.Zone, err)
+			continue
+		}
+		ref.SelfLink = neg.SelfLink
+	}
+}
+
+// newNegCR returns the ServiceNetworkEndpointGroup of the NEG of the service port without self links.
+func newNegCR(service *v1.Service, portKey negtypes.PortInfoMapKey, portInfo negtypes.PortInfo, status negtypes.NegSyncerStatus) *svcnegv1beta1.ServiceNetworkEndpointGroup {
+	negCR := &svcnegv1beta1.ServiceNetworkEndpointGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            portInfo.NegName,
+			Namespace:       service.Namespace,
+			Labels:          map[string]string{negCRManagedByKey: negCRManagedByValue},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(service, v1.SchemeGroupVersion.WithKind("Service"))},
+		},
+		Spec: svcnegv1beta1.ServiceNetworkEndpointGroupSpec{
+			ServiceName: service.Name,
+			Port:        portKey.ServicePort,
+			TargetPort:  portInfo.TargetPort,
+			Subset:      portKey.Subset,
+		},
+	}
+	if !status.LastSyncTime.IsZero() {
+		// The time is stored with second precision.
+		negCR.Status.LastSyncTime = metav1.NewTime(status.LastSyncTime).Rfc3339Copy()
+	}
+	if status.LastSyncError != nil {
+		negCR.Status.LastSyncError = status.LastSyncError.Error()
+	}
+
+	zones := make([]string, 0, len(status.EndpointCounts))
+	for zone := range status.EndpointCounts {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	for _, zone := range zones {
+		negCR.Status.NetworkEndpointGroups = append(negCR.Status.NetworkEndpointGroups, svcnegv1beta1.NegObjectReference{
+			Zone:                 zone,
+			NetworkEndpointCount: int64(status.EndpointCounts[zone]),
+		})
+	}
+	return negCR
+}
+
+func negCRKey(namespace, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
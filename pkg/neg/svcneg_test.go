@@ -0,0 +1,151 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	svcnegv1beta1 "k8s.io/ingress-gce/pkg/apis/svcneg/v1beta1"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	svcnegfake "k8s.io/ingress-gce/pkg/svcneg/client/clientset/versioned/fake"
+)
+
+// fakeStatusSyncer is a running syncer with a fixed status.
+type fakeStatusSyncer struct {
+	negtypes.NegSyncer
+	status negtypes.NegSyncerStatus
+}
+
+func (s *fakeStatusSyncer) IsStopped() bool                  { return false }
+func (s *fakeStatusSyncer) Status() negtypes.NegSyncerStatus { return s.status }
+
+func TestSyncNegCRs(t *testing.T) {
+	t.Parallel()
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	svcNegClient := svcnegfake.NewSimpleClientset()
+	manager.svcNegClient = svcNegClient
+	manager.svcNegLister = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	negCRs := svcNegClient.NetworkingV1beta1().ServiceNetworkEndpointGroups(testServiceNamespace)
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: testServiceName, UID: apitypes.UID("svc-uid")}}
+	manager.serviceLister.Add(service)
+	negName := manager.namer.NEG(testServiceNamespace, testServiceName, 80)
+	portKey := negtypes.PortInfoMapKey{ServicePort: 80}
+	portInfo := negtypes.PortInfo{TargetPort: "8080", NegName: negName}
+	manager.svcPortMap[getServiceKey(testServiceNamespace, testServiceName)] = negtypes.PortInfoMap{portKey: portInfo}
+	manager.cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{Name: negName}, negtypes.TestZone1)
+	neg, _ := manager.cloud.GetNetworkEndpointGroup(negName, negtypes.TestZone1)
+
+	syncTime := time.Now()
+	syncer := &fakeStatusSyncer{status: negtypes.NegSyncerStatus{
+		LastSyncTime:   syncTime,
+		LastSyncError:  fmt.Errorf("sync error"),
+		EndpointCounts: map[string]int{negtypes.TestZone2: 0, negtypes.TestZone1: 3},
+	}}
+	manager.syncerMap[getSyncerKey(testServiceNamespace, testServiceName, portKey, portInfo)] = syncer
+
+	// A stale ServiceNetworkEndpointGroup is deleted, and a ServiceNetworkEndpointGroup
+	// which is not managed by the controller is left alone.
+	stale := &svcnegv1beta1.ServiceNetworkEndpointGroup{ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: "stale", Labels: map[string]string{negCRManagedByKey: negCRManagedByValue}}}
+	unmanaged := &svcnegv1beta1.ServiceNetworkEndpointGroup{ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: "unmanaged"}}
+	for _, negCR := range []*svcnegv1beta1.ServiceNetworkEndpointGroup{stale, unmanaged} {
+		negCRs.Create(negCR)
+	}
+	syncLister(t, manager)
+
+	if err := manager.SyncNegCRs(); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	negCR, err := negCRs.Get(negName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expect ServiceNetworkEndpointGroup %q to be created, but got %v", negName, err)
+	}
+	expectSpec := svcnegv1beta1.ServiceNetworkEndpointGroupSpec{ServiceName: testServiceName, Port: 80, TargetPort: "8080"}
+	if !reflect.DeepEqual(negCR.Spec, expectSpec) {
+		t.Errorf("Expect spec to be %+v, but got %+v", expectSpec, negCR.Spec)
+	}
+	expectStatus := svcnegv1beta1.ServiceNetworkEndpointGroupStatus{
+		NetworkEndpointGroups: []svcnegv1beta1.NegObjectReference{
+			{Zone: negtypes.TestZone1, SelfLink: neg.SelfLink, NetworkEndpointCount: 3},
+			{Zone: negtypes.TestZone2, NetworkEndpointCount: 0},
+		},
+		LastSyncTime:  metav1.NewTime(syncTime).Rfc3339Copy(),
+		LastSyncError: "sync error",
+	}
+	if !reflect.DeepEqual(negCR.Status, expectStatus) {
+		t.Errorf("Expect status to be %+v, but got %+v", expectStatus, negCR.Status)
+	}
+	if len(negCR.OwnerReferences) != 1 || negCR.OwnerReferences[0].UID != service.UID || negCR.OwnerReferences[0].Kind != "Service" {
+		t.Errorf("Expect ServiceNetworkEndpointGroup to be owned by service %s/%s, but got %+v", service.Namespace, service.Name, negCR.OwnerReferences)
+	}
+	if _, err := negCRs.Get(stale.Name, metav1.GetOptions{}); err == nil {
+		t.Errorf("Expect ServiceNetworkEndpointGroup %q to be deleted", stale.Name)
+	}
+	if _, err := negCRs.Get(unmanaged.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("Expect ServiceNetworkEndpointGroup %q to be kept, but got %v", unmanaged.Name, err)
+	}
+
+	// The status is updated after the next sync.
+	syncLister(t, manager)
+	syncer.status.LastSyncError = nil
+	syncer.status.EndpointCounts = map[string]int{negtypes.TestZone1: 5}
+	if err := manager.SyncNegCRs(); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	negCR, _ = negCRs.Get(negName, metav1.GetOptions{})
+	expectStatus.LastSyncError = ""
+	expectStatus.NetworkEndpointGroups = []svcnegv1beta1.NegObjectReference{{Zone: negtypes.TestZone1, SelfLink: neg.SelfLink, NetworkEndpointCount: 5}}
+	if !reflect.DeepEqual(negCR.Status, expectStatus) {
+		t.Errorf("Expect status to be %+v, but got %+v", expectStatus, negCR.Status)
+	}
+
+	// The ServiceNetworkEndpointGroup is deleted once the NEG is not desired anymore.
+	syncLister(t, manager)
+	delete(manager.svcPortMap, getServiceKey(testServiceNamespace, testServiceName))
+	if err := manager.SyncNegCRs(); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if _, err := negCRs.Get(negName, metav1.GetOptions{}); err == nil {
+		t.Errorf("Expect ServiceNetworkEndpointGroup %q to be deleted", negName)
+	}
+}
+
+// syncLister replaces the content of the ServiceNetworkEndpointGroup lister of the manager with the ones of its client.
+func syncLister(t *testing.T, manager *syncerManager) {
+	t.Helper()
+	list, err := manager.svcNegClient.NetworkingV1beta1().ServiceNetworkEndpointGroups(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list ServiceNetworkEndpointGroups: %v", err)
+	}
+	var objs []interface{}
+	for i := range list.Items {
+		objs = append(objs, &list.Items[i])
+	}
+	if err := manager.svcNegLister.Replace(objs, ""); err != nil {
+		t.Fatalf("Failed to replace ServiceNetworkEndpointGroups: %v", err)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/wait"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 )
 
 var ErrRetriesExceeded = fmt.Errorf("maximum retry exceeded")
@@ -32,6 +33,8 @@ type backoffHandler interface {
 	NextRetryDelay() (time.Duration, error)
 	// ResetRetryDelay resets the retry delay
 	ResetRetryDelay()
+	// State returns the retry count and delay of the back off
+	State() negtypes.NegBackoffState
 }
 
 // exponentialBackOffHandler is a backoff handler that returns retry delays semi-exponentially with random jitter within boundary.
@@ -79,3 +82,14 @@ func (handler *exponentialBackOffHandler) ResetRetryDelay() {
 	handler.retryCount = 0
 	handler.lastRetryDelay = time.Duration(0)
 }
+
+// State returns the retry count and the last retry delay.
+func (handler *exponentialBackOffHandler) State() negtypes.NegBackoffState {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	return negtypes.NegBackoffState{
+		RetryCount:     handler.retryCount,
+		MaxRetries:     handler.maxRetries,
+		LastRetryDelay: handler.lastRetryDelay.String(),
+	}
+}
@@ -26,12 +26,14 @@ import (
 	"google.golang.org/api/compute/v1"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/clock"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/ingress-gce/pkg/neg/metrics"
+	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/klog"
 )
@@ -45,37 +47,57 @@ type batchSyncer struct {
 	serviceLister  cache.Indexer
 	endpointLister cache.Indexer
 	podLister      cache.Indexer
+	// endpointSliceLister is set if endpoints are read from EndpointSlices
+	// instead of endpointLister.
+	endpointSliceLister cache.Indexer
 
+	namer      negtypes.NetworkEndpointGroupNamer
 	recorder   record.EventRecorder
 	cloud      negtypes.NetworkEndpointGroupCloud
 	zoneGetter negtypes.ZoneGetter
+	// reflector is signaled which pods are in the NEG and which were
+	// detached from it.
+	reflector readiness.Reflector
 
 	stateLock    sync.Mutex
 	stopped      bool
 	shuttingDown bool
 
-	clock          clock.Clock
-	syncCh         chan interface{}
+	clock  clock.Clock
+	syncCh chan interface{}
+	// lastRetryDelay and retryCount are protected by stateLock since they are
+	// reported by State.
 	lastRetryDelay time.Duration
 	retryCount     int
+	// endpointPods maps the encoded endpoints to their pods, so that the
+	// pods of detached endpoints are known. It is protected by stateLock.
+	endpointPods map[string]types.NamespacedName
+
+	// status of the last sync
+	status syncStatus
 }
 
-func NewBatchSyncer(svcPort negtypes.NegSyncerKey, networkEndpointGroupName string, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, serviceLister cache.Indexer, endpointLister cache.Indexer, podLister cache.Indexer) *batchSyncer {
+func NewBatchSyncer(svcPort negtypes.NegSyncerKey, networkEndpointGroupName string, namer negtypes.NetworkEndpointGroupNamer, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, serviceLister cache.Indexer, endpointLister cache.Indexer, endpointSliceLister cache.Indexer, podLister cache.Indexer, reflector readiness.Reflector) *batchSyncer {
 	klog.V(2).Infof("New syncer for service %s/%s Port %s NEG %q", svcPort.Namespace, svcPort.Name, svcPort.TargetPort, networkEndpointGroupName)
 	return &batchSyncer{
-		NegSyncerKey:   svcPort,
-		negName:        networkEndpointGroupName,
-		recorder:       recorder,
-		serviceLister:  serviceLister,
-		cloud:          cloud,
-		endpointLister: endpointLister,
-		podLister:      podLister,
-		zoneGetter:     zoneGetter,
-		stopped:        true,
-		shuttingDown:   false,
-		clock:          clock.RealClock{},
-		lastRetryDelay: time.Duration(0),
-		retryCount:     0,
+		NegSyncerKey:        svcPort,
+		negName:             networkEndpointGroupName,
+		namer:               namer,
+		recorder:            recorder,
+		serviceLister:       serviceLister,
+		cloud:               cloud,
+		endpointLister:      endpointLister,
+		endpointSliceLister: endpointSliceLister,
+		podLister:           podLister,
+		zoneGetter:          zoneGetter,
+		reflector:           reflector,
+		stopped:             true,
+		shuttingDown:        false,
+		clock:               clock.RealClock{},
+		lastRetryDelay:      time.Duration(0),
+		retryCount:          0,
+		endpointPods:        map[string]types.NamespacedName{},
+		status:              syncStatus{negName: networkEndpointGroupName},
 	}
 }
 
@@ -102,6 +124,7 @@ func (s *batchSyncer) Start() error {
 			// equivalent to never retry
 			retryCh := make(<-chan time.Time)
 			err := s.sync()
+			s.status.recordSync(s.clock.Now(), err)
 			if err != nil {
 				retryMesg := ""
 				if s.retryCount > maxRetries {
@@ -161,6 +184,29 @@ func (s *batchSyncer) Sync() bool {
 	}
 }
 
+func (s *batchSyncer) Status() negtypes.NegSyncerStatus {
+	return s.status.get()
+}
+
+func (s *batchSyncer) State() negtypes.NegSyncerState {
+	s.stateLock.Lock()
+	state := negtypes.NegSyncerState{
+		Key:        s.NegSyncerKey,
+		SyncerType: "Batch",
+		NegName:    s.negName,
+		Backoff: negtypes.NegBackoffState{
+			RetryCount:     s.retryCount,
+			MaxRetries:     maxRetries,
+			LastRetryDelay: s.lastRetryDelay.String(),
+		},
+		Stopped:      s.stopped,
+		ShuttingDown: s.shuttingDown,
+	}
+	s.stateLock.Unlock()
+	s.status.fillState(&state)
+	return state
+}
+
 func (s *batchSyncer) IsStopped() bool {
 	s.stateLock.Lock()
 	defer s.stateLock.Unlock()
@@ -181,14 +227,22 @@ func (s *batchSyncer) sync() (err error) {
 	klog.V(2).Infof("Sync NEG %q for %s.", s.negName, s.NegSyncerKey.String())
 	start := time.Now()
 	defer metrics.ObserveNegSync(s.negName, metrics.AttachSync, err, start)
-	ep, exists, err := s.endpointLister.Get(
-		&apiv1.Endpoints{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      s.Name,
-				Namespace: s.Namespace,
+	var ep interface{}
+	var slices []*negtypes.EndpointSlice
+	exists := false
+	if s.endpointSliceLister != nil {
+		slices, err = negtypes.ListEndpointSlices(s.endpointSliceLister, s.Namespace, s.Name)
+		exists = len(slices) > 0
+	} else {
+		ep, exists, err = s.endpointLister.Get(
+			&apiv1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.Name,
+					Namespace: s.Namespace,
+				},
 			},
-		},
-	)
+		)
+	}
 	if err != nil {
 		return err
 	}
@@ -203,7 +257,13 @@ func (s *batchSyncer) sync() (err error) {
 		return err
 	}
 
-	targetMap, err := s.toZoneNetworkEndpointMap(ep.(*apiv1.Endpoints), s.NegSyncerKey.SubsetLabels)
+	var targetMap map[string]sets.String
+	var endpointPods map[string]types.NamespacedName
+	if slices != nil {
+		targetMap, endpointPods, err = s.toZoneNetworkEndpointMapFromSlices(slices, s.NegSyncerKey.SubsetLabels)
+	} else {
+		targetMap, endpointPods, err = s.toZoneNetworkEndpointMap(ep.(*apiv1.Endpoints), s.NegSyncerKey.SubsetLabels)
+	}
 	if err != nil {
 		return err
 	}
@@ -213,13 +273,20 @@ func (s *batchSyncer) sync() (err error) {
 		return err
 	}
 
+	s.updateEndpointPods(endpointPods, targetMap, currentMap)
+	s.commitPods(targetMap, currentMap)
 	addEndpoints, removeEndpoints := calculateDifference(targetMap, currentMap)
 	if len(addEndpoints) == 0 && len(removeEndpoints) == 0 {
 		klog.V(4).Infof("No endpoint change for %s/%s, skip syncing NEG. ", s.Namespace, s.Name)
+		s.status.setEndpointCounts(zoneEndpointCounts(currentMap))
 		return nil
 	}
 
-	return s.syncNetworkEndpoints(addEndpoints, removeEndpoints)
+	if err := s.syncNetworkEndpoints(addEndpoints, removeEndpoints); err != nil {
+		return err
+	}
+	s.status.setEndpointCounts(zoneEndpointCounts(targetMap))
+	return nil
 }
 
 // ensureNetworkEndpointGroups ensures negs are created in the related zones.
@@ -230,9 +297,10 @@ func (s *batchSyncer) ensureNetworkEndpointGroups() error {
 		return err
 	}
 
+	s.status.setZones(zones)
 	var errList []error
 	for _, zone := range zones {
-		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.cloud, s.serviceLister, s.recorder); err != nil {
+		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.Port, negtypes.VmIpPortEndpointType, s.namer, s.cloud, s.serviceLister, s.recorder); err != nil {
 			errList = append(errList, err)
 		}
 	}
@@ -240,9 +308,11 @@ func (s *batchSyncer) ensureNetworkEndpointGroups() error {
 }
 
 // toZoneNetworkEndpointMap translates addresses in endpoints object and Istio:DestinationRule subset into zone and endpoints map
+// It also returns the pods of the encoded endpoints.
 // TODO: migrate to use the util function instead
-func (s *batchSyncer) toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, subsetLabels string) (map[string]sets.String, error) {
+func (s *batchSyncer) toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, subsetLabels string) (map[string]sets.String, map[string]types.NamespacedName, error) {
 	zoneNetworkEndpointMap := map[string]sets.String{}
+	endpointPods := map[string]types.NamespacedName{}
 	targetPort, _ := strconv.Atoi(s.TargetPort)
 	for _, subset := range endpoints.Subsets {
 		matchPort := ""
@@ -287,15 +357,52 @@ func (s *batchSyncer) toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, subse
 			}
 			zone, err := s.zoneGetter.GetZoneForNode(*address.NodeName)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			if zoneNetworkEndpointMap[zone] == nil {
 				zoneNetworkEndpointMap[zone] = sets.String{}
 			}
-			zoneNetworkEndpointMap[zone].Insert(encodeEndpoint(address.IP, *address.NodeName, matchPort))
+			endpoint := encodeEndpoint(address.IP, *address.NodeName, matchPort)
+			zoneNetworkEndpointMap[zone].Insert(endpoint)
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+				endpointPods[endpoint] = types.NamespacedName{Namespace: address.TargetRef.Namespace, Name: address.TargetRef.Name}
+			}
 		}
 	}
-	return zoneNetworkEndpointMap, nil
+	return zoneNetworkEndpointMap, endpointPods, nil
+}
+
+// toZoneNetworkEndpointMapFromSlices translates the ready endpoints of EndpointSlices and Istio:DestinationRule subset into zone and endpoints map
+// It also returns the pods of the encoded endpoints.
+func (s *batchSyncer) toZoneNetworkEndpointMapFromSlices(slices []*negtypes.EndpointSlice, subsetLabels string) (map[string]sets.String, map[string]types.NamespacedName, error) {
+	// Like with Endpoints, only ready endpoints are synced.
+	var readySlices []*negtypes.EndpointSlice
+	for _, slice := range slices {
+		readySlice := *slice
+		readySlice.Endpoints = nil
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.IsReady() {
+				readySlice.Endpoints = append(readySlice.Endpoints, endpoint)
+			}
+		}
+		readySlices = append(readySlices, &readySlice)
+	}
+	endpointMap, endpointPodMap, err := toZoneNetworkEndpointMapFromSlices(readySlices, s.zoneGetter, s.TargetPort, s.podLister, subsetLabels, !s.reflector.DrainEnabled())
+	if err != nil {
+		return nil, nil, err
+	}
+	zoneNetworkEndpointMap := map[string]sets.String{}
+	for zone, endpoints := range endpointMap {
+		zoneNetworkEndpointMap[zone] = sets.String{}
+		for endpoint := range endpoints {
+			zoneNetworkEndpointMap[zone].Insert(encodeEndpoint(endpoint.IP, endpoint.Node, endpoint.Port))
+		}
+	}
+	endpointPods := map[string]types.NamespacedName{}
+	for endpoint, podName := range endpointPodMap {
+		endpointPods[encodeEndpoint(endpoint.IP, endpoint.Node, endpoint.Port)] = podName
+	}
+	return zoneNetworkEndpointMap, endpointPods, nil
 }
 
 // retrieveExistingZoneNetworkEndpointMap lists existing network endpoints in the neg and return the zone and endpoints map
@@ -413,9 +520,17 @@ func (s *batchSyncer) detachNetworkEndpoints(wg *sync.WaitGroup, zone string, ne
 
 func (s *batchSyncer) operationInternal(wg *sync.WaitGroup, zone string, networkEndpoints []*compute.NetworkEndpoint, errList *ErrorList, syncFunc func(name, zone string, endpoints []*compute.NetworkEndpoint) error, operationName string) {
 	defer wg.Done()
+	operation := metrics.AttachSync
+	if operationName == "Detach" {
+		operation = metrics.DetachSync
+	}
+	start := time.Now()
 	err := syncFunc(s.negName, zone, networkEndpoints)
+	metrics.ObserveNegOperation(operation, len(networkEndpoints), err, start)
 	if err != nil {
 		errList.Add(err)
+	} else if operation == metrics.DetachSync {
+		s.commitDetachedPods(zone, networkEndpoints)
 	}
 	if svc := getService(s.serviceLister, s.Namespace, s.Name); svc != nil {
 		if err == nil {
@@ -426,7 +541,71 @@ func (s *batchSyncer) operationInternal(wg *sync.WaitGroup, zone string, network
 	}
 }
 
+// updateEndpointPods records the pods of the target endpoints and forgets the
+// endpoints which are neither targeted nor in the NEG.
+func (s *batchSyncer) updateEndpointPods(endpointPods map[string]types.NamespacedName, targetMap, currentMap map[string]sets.String) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	for endpoint, podName := range endpointPods {
+		s.endpointPods[endpoint] = podName
+	}
+	for endpoint := range s.endpointPods {
+		if encodedEndpointInZoneMap(endpoint, targetMap) || encodedEndpointInZoneMap(endpoint, currentMap) {
+			continue
+		}
+		delete(s.endpointPods, endpoint)
+	}
+}
+
+// commitPods signals the readiness reflector the pods of the target endpoints
+// which are already in the NEG.
+func (s *batchSyncer) commitPods(targetMap, currentMap map[string]sets.String) {
+	s.stateLock.Lock()
+	zoneEndpointMaps := map[string]negtypes.EndpointPodMap{}
+	for zone, endpointSet := range targetMap {
+		zoneEndpointMap := negtypes.EndpointPodMap{}
+		for _, endpoint := range endpointSet.Intersection(currentMap[zone]).List() {
+			if podName, ok := s.endpointPods[endpoint]; ok {
+				ip, node, port := decodeEndpoint(endpoint)
+				zoneEndpointMap[negtypes.NetworkEndpoint{IP: ip, Node: node, Port: port}] = podName
+			}
+		}
+		zoneEndpointMaps[zone] = zoneEndpointMap
+	}
+	s.stateLock.Unlock()
+	for zone, zoneEndpointMap := range zoneEndpointMaps {
+		s.reflector.CommitPods(s.NegSyncerKey, s.negName, zone, zoneEndpointMap)
+	}
+}
+
+// commitDetachedPods signals the readiness reflector that the pods of the endpoints were detached from the NEG
+func (s *batchSyncer) commitDetachedPods(zone string, networkEndpoints []*compute.NetworkEndpoint) {
+	s.stateLock.Lock()
+	zoneEndpointMap := negtypes.EndpointPodMap{}
+	for _, ne := range networkEndpoints {
+		endpoint := encodeEndpoint(ne.IpAddress, ne.Instance, strconv.FormatInt(ne.Port, 10))
+		if podName, ok := s.endpointPods[endpoint]; ok {
+			zoneEndpointMap[negtypes.NetworkEndpoint{IP: ne.IpAddress, Node: ne.Instance, Port: strconv.FormatInt(ne.Port, 10)}] = podName
+			delete(s.endpointPods, endpoint)
+		}
+	}
+	s.stateLock.Unlock()
+	s.reflector.CommitDetachedPods(s.NegSyncerKey, s.negName, zone, zoneEndpointMap)
+}
+
+// encodedEndpointInZoneMap returns true if the encoded endpoint is in any zone of the map
+func encodedEndpointInZoneMap(endpoint string, zoneMap map[string]sets.String) bool {
+	for _, endpointSet := range zoneMap {
+		if endpointSet.Has(endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *batchSyncer) nextRetryDelay() time.Duration {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
 	s.retryCount += 1
 	s.lastRetryDelay *= 2
 	if s.lastRetryDelay < minRetryDelay {
@@ -438,6 +617,17 @@ func (s *batchSyncer) nextRetryDelay() time.Duration {
 }
 
 func (s *batchSyncer) resetRetryDelay() {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
 	s.retryCount = 0
 	s.lastRetryDelay = time.Duration(0)
 }
+
+// zoneEndpointCounts returns the number of endpoints in each zone.
+func zoneEndpointCounts(zoneNetworkEndpointMap map[string]sets.String) map[string]int {
+	counts := make(map[string]int, len(zoneNetworkEndpointMap))
+	for zone, endpoints := range zoneNetworkEndpointMap {
+		counts[zone] = endpoints.Len()
+	}
+	return counts
+}
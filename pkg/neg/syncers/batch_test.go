@@ -16,6 +16,7 @@ import (
 	"k8s.io/client-go/tools/record"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
 	"k8s.io/ingress-gce/pkg/context"
+	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/ingress-gce/pkg/utils"
 )
@@ -50,7 +51,7 @@ func NewTestSyncer() *batchSyncer {
 		ResyncPeriod:          1 * time.Second,
 		DefaultBackendSvcPort: defaultBackend,
 	}
-	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, namer, ctxConfig)
+	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, nil, namer, ctxConfig)
 	svcPort := negtypes.NegSyncerKey{
 		Namespace:  testServiceNamespace,
 		Name:       testServiceName,
@@ -60,12 +61,15 @@ func NewTestSyncer() *batchSyncer {
 
 	return NewBatchSyncer(svcPort,
 		testNegName,
+		namer,
 		record.NewFakeRecorder(100),
 		negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-newtork"),
 		negtypes.NewFakeZoneGetter(),
 		context.ServiceInformer.GetIndexer(),
 		context.EndpointInformer.GetIndexer(),
-		context.PodInformer.GetIndexer())
+		nil,
+		context.PodInformer.GetIndexer(),
+		&readiness.NoopReflector{})
 }
 
 func TestStartAndStopSyncer(t *testing.T) {
@@ -163,7 +167,7 @@ func TestToZoneNetworkEndpointMap(t *testing.T) {
 
 	for _, tc := range testCases {
 		syncer.TargetPort = tc.targetPort
-		res, _ := syncer.toZoneNetworkEndpointMap(getDefaultEndpoint(), "")
+		res, _, _ := syncer.toZoneNetworkEndpointMap(getDefaultEndpoint(), "")
 
 		if !reflect.DeepEqual(res, tc.expect) {
 			t.Errorf("Expect %v, but got %v.", tc.expect, res)
@@ -226,6 +230,52 @@ func TestSyncNetworkEndpoints(t *testing.T) {
 	}
 }
 
+func TestBatchSyncerCommitPods(t *testing.T) {
+	syncer := NewTestSyncer()
+	reflector := &testReflector{}
+	reflector.Flush()
+	syncer.reflector = reflector
+	if err := syncer.ensureNetworkEndpointGroups(); err != nil {
+		t.Fatalf("Failed to ensure NEG: %v", err)
+	}
+
+	pod1 := types.NamespacedName{Namespace: testServiceNamespace, Name: "pod1"}
+	pod2 := types.NamespacedName{Namespace: testServiceNamespace, Name: "pod2"}
+	endpointPods := map[string]types.NamespacedName{
+		"10.100.1.1||instance1||80": pod1,
+		"10.100.1.2||instance1||80": pod2,
+	}
+	targetMap := map[string]sets.String{negtypes.TestZone1: sets.NewString("10.100.1.1||instance1||80", "10.100.1.2||instance1||80")}
+	syncer.updateEndpointPods(endpointPods, targetMap, map[string]sets.String{})
+	if err := syncer.syncNetworkEndpoints(map[string]sets.String{negtypes.TestZone1: sets.NewString(targetMap[negtypes.TestZone1].List()...)}, nil); err != nil {
+		t.Fatalf("Failed to sync network endpoints: %v", err)
+	}
+
+	// Only the endpoints in the NEG are committed.
+	currentMap := map[string]sets.String{negtypes.TestZone1: sets.NewString("10.100.1.1||instance1||80")}
+	syncer.commitPods(targetMap, currentMap)
+	expectCommitted := negtypes.EndpointPodMap{negtypes.NetworkEndpoint{IP: "10.100.1.1", Node: "instance1", Port: "80"}: pod1}
+	if !reflect.DeepEqual(reflector.endpointMaps[negtypes.TestZone1], expectCommitted) {
+		t.Errorf("Expect committed endpoint map to be %v, but got %v", expectCommitted, reflector.endpointMaps[negtypes.TestZone1])
+	}
+
+	// The pods of endpoints removed from the target are still known when they are detached.
+	targetMap = map[string]sets.String{negtypes.TestZone1: sets.NewString("10.100.1.1||instance1||80")}
+	currentMap = map[string]sets.String{negtypes.TestZone1: sets.NewString("10.100.1.1||instance1||80", "10.100.1.2||instance1||80")}
+	syncer.updateEndpointPods(map[string]types.NamespacedName{"10.100.1.1||instance1||80": pod1}, targetMap, currentMap)
+	if err := syncer.syncNetworkEndpoints(nil, map[string]sets.String{negtypes.TestZone1: sets.NewString("10.100.1.2||instance1||80")}); err != nil {
+		t.Fatalf("Failed to sync network endpoints: %v", err)
+	}
+	expectDetached := negtypes.EndpointPodMap{negtypes.NetworkEndpoint{IP: "10.100.1.2", Node: "instance1", Port: "80"}: pod2}
+	if !reflect.DeepEqual(reflector.detachedEndpointMaps[negtypes.TestZone1], expectDetached) {
+		t.Errorf("Expect detached endpoint map to be %v, but got %v", expectDetached, reflector.detachedEndpointMaps[negtypes.TestZone1])
+	}
+	expectEndpointPods := map[string]types.NamespacedName{"10.100.1.1||instance1||80": pod1}
+	if !reflect.DeepEqual(syncer.endpointPods, expectEndpointPods) {
+		t.Errorf("Expect endpoint pods to be %v, but got %v", expectEndpointPods, syncer.endpointPods)
+	}
+}
+
 func examineNetworkEndpoints(expectSet map[string]sets.String, syncer *batchSyncer, t *testing.T) {
 	for zone, endpoints := range expectSet {
 		expectEndpoints, err := syncer.toNetworkEndpointBatch(endpoints)
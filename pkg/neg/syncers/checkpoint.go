@@ -0,0 +1,323 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/klog"
+)
+
+const (
+	// checkpointMaxAge is the age after which a checkpoint is not trusted anymore.
+	checkpointMaxAge = time.Hour
+	// checkpointRefreshPeriod is the period after which an unchanged checkpoint is rewritten
+	// to keep it fresh.
+	checkpointRefreshPeriod = checkpointMaxAge / 2
+	// checkpointFlushDelay is the delay after which the checkpoints stored by the syncers are
+	// written together.
+	checkpointFlushDelay = 5 * time.Second
+	// checkpointMaxRetryDelay is the maximum delay after which checkpoints are written again
+	// after the write failed repeatedly.
+	checkpointMaxRetryDelay = 5 * time.Minute
+	// checkpointMaxSize is the maximum size of the checkpoint of a NEG. Larger checkpoints
+	// are not stored, and those NEGs are listed as usual after a restart.
+	checkpointMaxSize = 128 * 1024
+	// checkpointMaxTotalSize is the maximum size of all checkpoints, below the 1MB limit
+	// of a config map. Checkpoints which do not fit are not stored.
+	checkpointMaxTotalSize = 900 * 1024
+)
+
+// Checkpointer stores the checkpoints of NEGs by NEG name.
+// storage.ConfigMapVault implements Checkpointer.
+type Checkpointer interface {
+	Get(key string) (string, bool, error)
+	Put(key, val string) error
+	Remove(key string) error
+	GetAll() (map[string]string, error)
+}
+
+// CheckpointStore is a Checkpointer which can store several checkpoints with a single write.
+// storage.ConfigMapVault implements CheckpointStore.
+type CheckpointStore interface {
+	Checkpointer
+	PutAll(data map[string]string) error
+}
+
+// batchingCheckpointer is a Checkpointer which queues the checkpoints stored by the syncers
+// and writes them to the underlying store together after checkpointFlushDelay, so that the
+// syncers never wait for the store and the shared config map is updated once per batch.
+type batchingCheckpointer struct {
+	store CheckpointStore
+	// flushDelay is the delay after which queued checkpoints are written.
+	flushDelay time.Duration
+	// maxSize is the maximum size of a checkpoint.
+	maxSize int
+	// maxTotalSize is the maximum size of all checkpoints in the store.
+	maxTotalSize int
+
+	// lock protects pending, scheduled and retryDelay.
+	lock sync.Mutex
+	// pending are the checkpoints not written yet by key.
+	pending map[string]string
+	// scheduled indicates if a flush is scheduled.
+	scheduled bool
+	// retryDelay is the delay of the next flush after failed writes. It is doubled after
+	// every failure up to checkpointMaxRetryDelay, and reset once a write succeeds.
+	retryDelay time.Duration
+
+	// flushLock serializes the writes to the store.
+	flushLock sync.Mutex
+}
+
+// NewBatchingCheckpointer returns a Checkpointer which batches the checkpoints written to store.
+func NewBatchingCheckpointer(store CheckpointStore) Checkpointer {
+	return &batchingCheckpointer{
+		store:        store,
+		flushDelay:   checkpointFlushDelay,
+		maxSize:      checkpointMaxSize,
+		maxTotalSize: checkpointMaxTotalSize,
+		pending:      map[string]string{},
+	}
+}
+
+// Get returns the checkpoint queued for key if any, or the stored one otherwise.
+func (c *batchingCheckpointer) Get(key string) (string, bool, error) {
+	c.lock.Lock()
+	val, ok := c.pending[key]
+	c.lock.Unlock()
+	if ok {
+		return val, true, nil
+	}
+	return c.store.Get(key)
+}
+
+// Put queues the checkpoint of key. It is written by the next flush.
+func (c *batchingCheckpointer) Put(key, val string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending[key] = val
+	c.scheduleLocked()
+	return nil
+}
+
+// Remove drops the queued checkpoint of key and removes the stored one.
+func (c *batchingCheckpointer) Remove(key string) error {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+	c.lock.Lock()
+	delete(c.pending, key)
+	c.lock.Unlock()
+	return c.store.Remove(key)
+}
+
+// GetAll returns the stored checkpoints overlaid with the queued ones.
+func (c *batchingCheckpointer) GetAll() (map[string]string, error) {
+	data, err := c.store.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, val := range c.pending {
+		data[key] = val
+	}
+	return data, nil
+}
+
+// scheduleLocked schedules a flush if none is scheduled. Must be called with the lock held.
+func (c *batchingCheckpointer) scheduleLocked() {
+	if c.scheduled {
+		return
+	}
+	c.scheduled = true
+	delay := c.flushDelay
+	if c.retryDelay > delay {
+		delay = c.retryDelay
+	}
+	time.AfterFunc(delay, c.flush)
+}
+
+// flush writes the queued checkpoints to the store. Checkpoints which exceed the size
+// budget are not written and their stored checkpoints are removed. If the write fails,
+// the checkpoints which were not queued again in the meantime are requeued and another
+// flush is scheduled with backoff.
+func (c *batchingCheckpointer) flush() {
+	c.flushLock.Lock()
+	defer c.flushLock.Unlock()
+	c.lock.Lock()
+	data := c.pending
+	c.pending = map[string]string{}
+	c.scheduled = false
+	c.lock.Unlock()
+
+	err := c.write(data)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err == nil {
+		c.retryDelay = 0
+		return
+	}
+	klog.Warningf("Failed to store %d NEG checkpoints: %v", len(data), err)
+	for key, val := range data {
+		if _, ok := c.pending[key]; !ok {
+			c.pending[key] = val
+		}
+	}
+	if c.retryDelay < c.flushDelay {
+		c.retryDelay = c.flushDelay
+	}
+	c.retryDelay *= 2
+	if c.retryDelay > checkpointMaxRetryDelay {
+		c.retryDelay = checkpointMaxRetryDelay
+	}
+	c.scheduleLocked()
+}
+
+// write stores the checkpoints which fit in the size budget, and removes the stored
+// checkpoints of the others so that they are not restored from stale data.
+func (c *batchingCheckpointer) write(data map[string]string) error {
+	if len(data) == 0 {
+		return nil
+	}
+	stored, err := c.store.GetAll()
+	if err != nil {
+		return err
+	}
+	total := 0
+	for key, val := range stored {
+		if _, ok := data[key]; !ok {
+			total += len(key) + len(val)
+		}
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fitting := map[string]string{}
+	for _, key := range keys {
+		val := data[key]
+		size := len(key) + len(val)
+		if len(val) > c.maxSize || total+size > c.maxTotalSize {
+			klog.V(2).Infof("Checkpoint of NEG %q of %d bytes exceeds the size budget, not storing it", key, len(val))
+			if _, ok := stored[key]; ok {
+				if err := c.store.Remove(key); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		fitting[key] = val
+		total += size
+	}
+	return c.store.PutAll(fitting)
+}
+
+// negCheckpoint is the last known state of a NEG, which lets a restarted syncer skip
+// listing the zones where the NEG was not being changed.
+type negCheckpoint struct {
+	// Timestamp is the time the checkpoint was taken.
+	Timestamp time.Time `json:"timestamp"`
+	// Endpoints are the endpoints of the NEG by zone once the transactions completed.
+	Endpoints map[string][]negtypes.NetworkEndpoint `json:"endpoints"`
+	// Transactions are the transactions in flight. Their outcome is unknown after a
+	// restart, so their zones are listed again.
+	Transactions []checkpointTransaction `json:"transactions,omitempty"`
+}
+
+// checkpointTransaction is a transaction in flight.
+type checkpointTransaction struct {
+	Endpoint  negtypes.NetworkEndpoint `json:"endpoint"`
+	Operation string                   `json:"operation"`
+	Zone      string                   `json:"zone"`
+}
+
+// newNegCheckpoint returns the checkpoint of the endpoints and the transactions in the table.
+func newNegCheckpoint(timestamp time.Time, endpointMap map[string]negtypes.NetworkEndpointSet, table networkEndpointTransactionTable) *negCheckpoint {
+	checkpoint := &negCheckpoint{
+		Timestamp: timestamp,
+		Endpoints: map[string][]negtypes.NetworkEndpoint{},
+	}
+	for zone, endpointSet := range endpointMap {
+		endpoints := endpointSet.List()
+		sortNetworkEndpoints(endpoints)
+		checkpoint.Endpoints[zone] = endpoints
+	}
+	keys := table.Keys()
+	sortNetworkEndpoints(keys)
+	for _, key := range keys {
+		if entry, ok := table.Get(key); ok {
+			checkpoint.Transactions = append(checkpoint.Transactions, checkpointTransaction{Endpoint: key, Operation: entry.Operation.String(), Zone: entry.Zone})
+		}
+	}
+	return checkpoint
+}
+
+// decodeNegCheckpoint decodes a checkpoint encoded by encode.
+func decodeNegCheckpoint(data string) (*negCheckpoint, error) {
+	checkpoint := &negCheckpoint{}
+	if err := json.Unmarshal([]byte(data), checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// encode returns the checkpoint as JSON.
+func (c *negCheckpoint) encode() (string, error) {
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+// sameState returns true if both checkpoints have the same endpoints and transactions.
+func (c *negCheckpoint) sameState(other *negCheckpoint) bool {
+	if other == nil {
+		return false
+	}
+	a, b := *c, *other
+	a.Timestamp, b.Timestamp = time.Time{}, time.Time{}
+	aData, aErr := a.encode()
+	bData, bErr := b.encode()
+	return aErr == nil && bErr == nil && aData == bData
+}
+
+// pendingZones returns the zones with transactions in flight.
+func (c *negCheckpoint) pendingZones() sets.String {
+	zones := sets.NewString()
+	for _, transaction := range c.Transactions {
+		zones.Insert(transaction.Zone)
+	}
+	return zones
+}
+
+// sortNetworkEndpoints sorts endpoints so that checkpoints are stable.
+func sortNetworkEndpoints(endpoints []negtypes.NetworkEndpoint) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].IP != endpoints[j].IP {
+			return endpoints[i].IP < endpoints[j].IP
+		}
+		if endpoints[i].Port != endpoints[j].Port {
+			return endpoints[i].Port < endpoints[j].Port
+		}
+		return endpoints[i].Node < endpoints[j].Node
+	})
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/storage"
+)
+
+// countingNegCloud counts the calls to list network endpoints by zone
+type countingNegCloud struct {
+	negtypes.NetworkEndpointGroupCloud
+
+	mu    sync.Mutex
+	zones []string
+}
+
+func (c *countingNegCloud) ListNetworkEndpoints(name, zone string, showHealthStatus bool) ([]*compute.NetworkEndpointWithHealthStatus, error) {
+	c.mu.Lock()
+	c.zones = append(c.zones, zone)
+	c.mu.Unlock()
+	return c.NetworkEndpointGroupCloud.ListNetworkEndpoints(name, zone, showHealthStatus)
+}
+
+func (c *countingNegCloud) listedZones() sets.String {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := sets.NewString(c.zones...)
+	c.zones = nil
+	return ret
+}
+
+func TestNegCheckpoint(t *testing.T) {
+	t.Parallel()
+	endpointSet1 := generateEndpointSet(net.ParseIP("1.1.1.1"), 5, testInstance1, "8080")
+	endpointSet2 := generateEndpointSet(net.ParseIP("1.1.2.1"), 5, testInstance3, "8080")
+	table := NewTransactionTable()
+	generateTransaction(table, transactionEntry{Operation: detachOp, Zone: testZone2}, net.ParseIP("1.1.3.1"), 2, testInstance3, "8080")
+
+	timestamp := metav1.Now().Rfc3339Copy().Time
+	checkpoint := newNegCheckpoint(timestamp, map[string]negtypes.NetworkEndpointSet{testZone1: endpointSet1, testZone2: endpointSet2}, table)
+	if got := checkpoint.pendingZones(); !got.Equal(sets.NewString(testZone2)) {
+		t.Errorf("Expect pending zones to be %v, but got %v", []string{testZone2}, got.List())
+	}
+
+	data, err := checkpoint.encode()
+	if err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	decoded, err := decodeNegCheckpoint(data)
+	if err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if !reflect.DeepEqual(decoded, checkpoint) {
+		t.Errorf("Expect decoded checkpoint to be %+v, but got %+v", checkpoint, decoded)
+	}
+
+	// The order of endpoints and the timestamp do not change the state.
+	reordered := newNegCheckpoint(timestamp.Add(time.Minute), map[string]negtypes.NetworkEndpointSet{testZone2: negtypes.NewNetworkEndpointSet(endpointSet2.List()...), testZone1: endpointSet1}, table)
+	if !checkpoint.sameState(reordered) {
+		t.Errorf("Expect checkpoints %+v and %+v to have the same state", checkpoint, reordered)
+	}
+	table.Delete(table.Keys()[0])
+	if checkpoint.sameState(newNegCheckpoint(timestamp, map[string]negtypes.NetworkEndpointSet{testZone1: endpointSet1, testZone2: endpointSet2}, table)) {
+		t.Errorf("Expect checkpoints with different transactions to have different states")
+	}
+	if _, err := decodeNegCheckpoint("{"); err == nil {
+		t.Errorf("Expect invalid checkpoint to fail decoding")
+	}
+}
+
+func TestTransactionSyncerCheckpoint(t *testing.T) {
+	t.Parallel()
+	fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	cloud := &countingNegCloud{NetworkEndpointGroupCloud: fakeCloud}
+	_, s := newTestTransactionSyncer(cloud)
+	vault := storage.NewFakeConfigMapVault("kube-system", "neg-checkpoint")
+	s.checkpoint = vault
+
+	// The NEG has changed in zone1 since the checkpoint was taken, which is only
+	// noticed once the zone is listed.
+	cloudEndpoints := map[string]negtypes.NetworkEndpointSet{
+		testZone1: generateEndpointSet(net.ParseIP("1.1.1.1"), 3, testInstance1, "8080"),
+		testZone2: generateEndpointSet(net.ParseIP("1.1.2.1"), 3, testInstance3, "8080"),
+	}
+	for zone, endpointSet := range cloudEndpoints {
+		var endpoints []*compute.NetworkEndpoint
+		for _, ne := range generateEndpointBatch(negtypes.NewNetworkEndpointSet(endpointSet.List()...)) {
+			endpoints = append(endpoints, ne)
+		}
+		fakeCloud.AttachNetworkEndpoints(testNegName, zone, endpoints)
+	}
+	checkpointEndpoints := map[string]negtypes.NetworkEndpointSet{
+		testZone1: generateEndpointSet(net.ParseIP("1.1.1.1"), 2, testInstance1, "8080"),
+		testZone2: generateEndpointSet(net.ParseIP("1.1.2.1"), 2, testInstance3, "8080"),
+	}
+	table := NewTransactionTable()
+	generateTransaction(table, transactionEntry{Operation: attachOp, Zone: testZone2}, net.ParseIP("1.1.2.3"), 1, testInstance3, "8080")
+
+	for _, tc := range []struct {
+		desc        string
+		timestamp   time.Time
+		restored    bool
+		expectMap   map[string]negtypes.NetworkEndpointSet
+		expectZones sets.String
+	}{
+		{
+			desc:        "zones without transactions in flight are restored from the checkpoint",
+			timestamp:   time.Now(),
+			expectMap:   map[string]negtypes.NetworkEndpointSet{testZone1: checkpointEndpoints[testZone1], testZone2: cloudEndpoints[testZone2]},
+			expectZones: sets.NewString(testZone2),
+		},
+		{
+			desc:        "the checkpoint is only restored once",
+			timestamp:   time.Now(),
+			restored:    true,
+			expectMap:   cloudEndpoints,
+			expectZones: sets.NewString(testZone1, testZone2),
+		},
+		{
+			desc:        "stale checkpoint is ignored",
+			timestamp:   time.Now().Add(-2 * checkpointMaxAge),
+			expectMap:   cloudEndpoints,
+			expectZones: sets.NewString(testZone1, testZone2),
+		},
+	} {
+		data, _ := newNegCheckpoint(tc.timestamp, checkpointEndpoints, table).encode()
+		vault.Put(testNegName, data)
+		s.checkpointRestored = tc.restored
+
+		out, err := s.retrieveExistingZoneNetworkEndpointMap()
+		if err != nil {
+			t.Errorf("For case %q, expect err to be nil, but got %v", tc.desc, err)
+		}
+		if !reflect.DeepEqual(out, tc.expectMap) {
+			t.Errorf("For case %q, expect endpoints to be %v, but got %v", tc.desc, tc.expectMap, out)
+		}
+		if zones := cloud.listedZones(); !zones.Equal(tc.expectZones) {
+			t.Errorf("For case %q, expect listed zones to be %v, but got %v", tc.desc, tc.expectZones.List(), zones.List())
+		}
+	}
+
+	// saveCheckpoint stores the eventual endpoints and the transactions in flight,
+	// and skips unchanged checkpoints.
+	s.lastCheckpoint = nil
+	s.checkpointEndpoints = cloudEndpoints
+	s.transactions = table
+	s.saveCheckpoint()
+	data, ok, err := vault.Get(testNegName)
+	if err != nil || !ok {
+		t.Fatalf("Expect checkpoint to be stored, but got %v, %v", ok, err)
+	}
+	saved, err := decodeNegCheckpoint(data)
+	if err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if expect := newNegCheckpoint(saved.Timestamp, cloudEndpoints, table); !saved.sameState(expect) {
+		t.Errorf("Expect stored checkpoint to be %+v, but got %+v", expect, saved)
+	}
+	last := s.lastCheckpoint
+	s.saveCheckpoint()
+	if s.lastCheckpoint != last {
+		t.Errorf("Expect unchanged checkpoint not to be stored again")
+	}
+
+	// Unknown endpoints are not stored.
+	vault.Remove(testNegName)
+	s.checkpointEndpoints = nil
+	s.lastCheckpoint = nil
+	s.saveCheckpoint()
+	if _, ok, _ := vault.Get(testNegName); ok {
+		t.Errorf("Expect no checkpoint to be stored when the endpoints are unknown")
+	}
+}
+
+// failingCheckpointStore fails to store checkpoints while failing is set.
+type failingCheckpointStore struct {
+	*storage.ConfigMapVault
+	failing bool
+	puts    int
+}
+
+func (s *failingCheckpointStore) PutAll(data map[string]string) error {
+	s.puts++
+	if s.failing {
+		return fmt.Errorf("failed to store checkpoints")
+	}
+	return s.ConfigMapVault.PutAll(data)
+}
+
+func TestBatchingCheckpointer(t *testing.T) {
+	t.Parallel()
+	store := &failingCheckpointStore{ConfigMapVault: storage.NewFakeConfigMapVault("kube-system", "neg-checkpoint"), failing: true}
+	c := NewBatchingCheckpointer(store).(*batchingCheckpointer)
+	c.flushDelay = time.Hour
+
+	c.Put("neg1", "a")
+	c.Put("neg1", "b")
+	c.Put("neg2", "c")
+	if store.puts != 0 {
+		t.Errorf("Expect checkpoints to be queued, got %d writes", store.puts)
+	}
+	if val, exists, err := c.Get("neg1"); !exists || err != nil || val != "b" {
+		t.Errorf("c.Get(neg1) = %q, %v, %v, want %q, true, nil", val, exists, err, "b")
+	}
+
+	// A failed write requeues the checkpoints which were not queued again.
+	c.flush()
+	c.Put("neg2", "d")
+	if !c.scheduled {
+		t.Errorf("Expect another flush to be scheduled after a failed write")
+	}
+	if expect := map[string]string{"neg1": "b", "neg2": "d"}; !reflect.DeepEqual(c.pending, expect) {
+		t.Errorf("Expect pending checkpoints %v, got %v", expect, c.pending)
+	}
+
+	// All queued checkpoints are written with a single write.
+	store.failing = false
+	store.puts = 0
+	c.flush()
+	if store.puts != 1 {
+		t.Errorf("Expect 1 write, got %d", store.puts)
+	}
+	data, err := store.GetAll()
+	if expect := map[string]string{"neg1": "b", "neg2": "d"}; err != nil || !reflect.DeepEqual(data, expect) {
+		t.Errorf("store.GetAll() = %v, %v, want %v, nil", data, err, expect)
+	}
+	if len(c.pending) != 0 || c.scheduled || c.retryDelay != 0 {
+		t.Errorf("Expect no pending checkpoints, no scheduled flush and no retry delay, got %v, %v, %v", c.pending, c.scheduled, c.retryDelay)
+	}
+
+	// Removing a checkpoint drops its queued value too.
+	c.Put("neg1", "e")
+	if err := c.Remove("neg1"); err != nil {
+		t.Errorf("c.Remove(neg1) = %v, want nil", err)
+	}
+	if _, exists, _ := c.Get("neg1"); exists {
+		t.Errorf("Expect checkpoint of neg1 to be removed")
+	}
+	data, err = c.GetAll()
+	if expect := map[string]string{"neg2": "d"}; err != nil || !reflect.DeepEqual(data, expect) {
+		t.Errorf("c.GetAll() = %v, %v, want %v, nil", data, err, expect)
+	}
+}
+
+func TestBatchingCheckpointerBackoff(t *testing.T) {
+	t.Parallel()
+	store := &failingCheckpointStore{ConfigMapVault: storage.NewFakeConfigMapVault("kube-system", "neg-checkpoint"), failing: true}
+	c := NewBatchingCheckpointer(store).(*batchingCheckpointer)
+	c.flushDelay = time.Minute
+
+	// The delay of the next flush doubles after every failed write, up to checkpointMaxRetryDelay.
+	c.Put("neg1", "a")
+	for _, expect := range []time.Duration{2 * time.Minute, 4 * time.Minute, checkpointMaxRetryDelay, checkpointMaxRetryDelay} {
+		c.flush()
+		if c.retryDelay != expect {
+			t.Errorf("Expect the next flush to be delayed by %v, got %v", expect, c.retryDelay)
+		}
+	}
+	if store.puts != 4 {
+		t.Errorf("Expect 4 writes, got %d", store.puts)
+	}
+}
+
+func TestBatchingCheckpointerSizeBudget(t *testing.T) {
+	t.Parallel()
+	store := &failingCheckpointStore{ConfigMapVault: storage.NewFakeConfigMapVault("kube-system", "neg-checkpoint")}
+	c := NewBatchingCheckpointer(store).(*batchingCheckpointer)
+	c.flushDelay = time.Hour
+	c.maxSize = 10
+	c.maxTotalSize = 20
+
+	c.Put("neg1", "small")
+	c.Put("neg2", "oversized checkpoint")
+	c.flush()
+	data, err := store.GetAll()
+	if expect := map[string]string{"neg1": "small"}; err != nil || !reflect.DeepEqual(data, expect) {
+		t.Errorf("store.GetAll() = %v, %v, want %v, nil", data, err, expect)
+	}
+
+	// An oversized checkpoint removes the stored checkpoint of the NEG, which is stale.
+	c.Put("neg1", "oversized checkpoint")
+	c.flush()
+	data, err = store.GetAll()
+	if err != nil || len(data) != 0 {
+		t.Errorf("store.GetAll() = %v, %v, want no checkpoint", data, err)
+	}
+
+	// Checkpoints which do not fit in the total budget are not stored.
+	c.Put("neg1", "0123456")
+	c.Put("neg2", "0123456")
+	c.flush()
+	data, err = store.GetAll()
+	if expect := map[string]string{"neg1": "0123456"}; err != nil || !reflect.DeepEqual(data, expect) {
+		t.Errorf("store.GetAll() = %v, %v, want %v, nil", data, err, expect)
+	}
+	if len(c.pending) != 0 || c.scheduled {
+		t.Errorf("Expect skipped checkpoints not to be retried, got %v, %v", c.pending, c.scheduled)
+	}
+}
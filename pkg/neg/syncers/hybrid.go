@@ -0,0 +1,188 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/klog"
+)
+
+// hybridSyncer syncs a NON_GCP_PRIVATE_IP_PORT NEG with the endpoints of a service without
+// selector. The endpoints are taken as they are from the Endpoints object of the service,
+// which is managed by hand, and are all in the NEG of a single zone.
+type hybridSyncer struct {
+	negtypes.NegSyncerKey
+	negName string
+	zone    string
+	namer   negtypes.NetworkEndpointGroupNamer
+
+	// syncer provides syncer life cycle interfaces
+	syncer negtypes.NegSyncer
+	// status is the status of the syncer, shared with the syncer skeleton.
+	status *syncStatus
+
+	serviceLister  cache.Indexer
+	endpointLister cache.Indexer
+	recorder       record.EventRecorder
+	cloud          negtypes.NetworkEndpointGroupCloud
+}
+
+func NewHybridSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName, zone string, namer negtypes.NetworkEndpointGroupNamer, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, serviceLister cache.Indexer, endpointLister cache.Indexer) negtypes.NegSyncer {
+	hs := &hybridSyncer{
+		NegSyncerKey:   negSyncerKey,
+		negName:        networkEndpointGroupName,
+		zone:           zone,
+		namer:          namer,
+		serviceLister:  serviceLister,
+		endpointLister: endpointLister,
+		recorder:       recorder,
+		cloud:          cloud,
+	}
+	syncer := newSyncer(negSyncerKey, networkEndpointGroupName, serviceLister, recorder, hs)
+	hs.syncer = syncer
+	hs.status = syncer.status
+	hs.status.setZones([]string{zone})
+	return syncer
+}
+
+func (s *hybridSyncer) sync() (err error) {
+	if s.syncer.IsStopped() || s.syncer.IsShuttingDown() {
+		klog.V(4).Infof("Skip syncing NEG %q for %s.", s.negName, s.NegSyncerKey.String())
+		return nil
+	}
+	klog.V(2).Infof("Sync NEG %q for %s in %q.", s.negName, s.NegSyncerKey.String(), s.zone)
+	start := time.Now()
+	defer func() {
+		metrics.ObserveNegSync(s.negName, metrics.AttachSync, err, start)
+	}()
+
+	if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, s.zone, s.NegSyncerKey.String(), s.Port, negtypes.NonGCPPrivateEndpointType, s.namer, s.cloud, s.serviceLister, s.recorder); err != nil {
+		return err
+	}
+
+	ep, exists, err := s.endpointLister.Get(
+		&apiv1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.Name,
+				Namespace: s.Namespace,
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		klog.Warningf("Endpoint %s/%s does not exist. Skipping NEG sync", s.Namespace, s.Name)
+		return nil
+	}
+
+	targetEndpoints := toNonGCPNetworkEndpointSet(ep.(*apiv1.Endpoints), s.TargetPort)
+	currentEndpoints, err := retrieveExistingNetworkEndpoints(s.negName, negtypes.NonGCPPrivateEndpointType, s.zone, s.cloud)
+	if err != nil {
+		return err
+	}
+
+	addEndpoints := targetEndpoints.Difference(currentEndpoints)
+	removeEndpoints := currentEndpoints.Difference(targetEndpoints)
+	if addEndpoints.Len() == 0 && removeEndpoints.Len() == 0 {
+		klog.V(4).Infof("No endpoint change for %s/%s, skip syncing NEG. ", s.Namespace, s.Name)
+		s.status.setEndpointCounts(map[string]int{s.zone: currentEndpoints.Len()})
+		return nil
+	}
+
+	// Detach endpoints first so that the endpoints removed from the Endpoints object stop receiving traffic as soon as possible.
+	for removeEndpoints.Len() > 0 {
+		batch, err := makeEndpointBatch(removeEndpoints)
+		if err != nil {
+			return err
+		}
+		operationStart := time.Now()
+		err = s.cloud.DetachNetworkEndpoints(s.negName, s.zone, networkEndpointList(batch))
+		metrics.ObserveNegOperation(metrics.DetachSync, len(batch), err, operationStart)
+		if err != nil {
+			s.recordEvent(apiv1.EventTypeWarning, "DetachFailed", fmt.Sprintf("Failed to detach %d network endpoint(s) (NEG %q in zone %q): %v", len(batch), s.negName, s.zone, err))
+			return err
+		}
+		s.recordEvent(apiv1.EventTypeNormal, "Detach", fmt.Sprintf("Detach %d network endpoint(s) (NEG %q in zone %q)", len(batch), s.negName, s.zone))
+	}
+	for addEndpoints.Len() > 0 {
+		batch, err := makeEndpointBatch(addEndpoints)
+		if err != nil {
+			return err
+		}
+		operationStart := time.Now()
+		err = s.cloud.AttachNetworkEndpoints(s.negName, s.zone, networkEndpointList(batch))
+		metrics.ObserveNegOperation(metrics.AttachSync, len(batch), err, operationStart)
+		if err != nil {
+			s.recordEvent(apiv1.EventTypeWarning, "AttachFailed", fmt.Sprintf("Failed to attach %d network endpoint(s) (NEG %q in zone %q): %v", len(batch), s.negName, s.zone, err))
+			return err
+		}
+		s.recordEvent(apiv1.EventTypeNormal, "Attach", fmt.Sprintf("Attach %d network endpoint(s) (NEG %q in zone %q)", len(batch), s.negName, s.zone))
+	}
+	s.status.setEndpointCounts(map[string]int{s.zone: targetEndpoints.Len()})
+	return nil
+}
+
+// fillState adds the syncer type to state.
+func (s *hybridSyncer) fillState(state *negtypes.NegSyncerState) {
+	state.SyncerType = "Hybrid"
+}
+
+func (s *hybridSyncer) recordEvent(eventType, reason, eventDesc string) {
+	if svc := getService(s.serviceLister, s.Namespace, s.Name); svc != nil {
+		s.recorder.Eventf(svc, eventType, reason, eventDesc)
+	}
+}
+
+// toNonGCPNetworkEndpointSet returns the endpoints of the Endpoints object for the target port.
+// Addresses which are not ready are left out, as there is no readiness feedback for them.
+func toNonGCPNetworkEndpointSet(endpoints *apiv1.Endpoints, targetPort string) negtypes.NetworkEndpointSet {
+	endpointSet := negtypes.NewNetworkEndpointSet()
+	for _, subset := range endpoints.Subsets {
+		matchPort := ""
+		for _, port := range subset.Ports {
+			if matchPort = matchTargetPort(targetPort, port.Name, port.Port); len(matchPort) > 0 {
+				break
+			}
+		}
+		if len(matchPort) == 0 {
+			continue
+		}
+		for _, address := range subset.Addresses {
+			endpointSet.Insert(negtypes.NetworkEndpoint{IP: address.IP, Port: matchPort})
+		}
+	}
+	return endpointSet
+}
+
+// networkEndpointList returns the GCE network endpoints of a batch.
+func networkEndpointList(networkEndpointMap map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint) []*compute.NetworkEndpoint {
+	networkEndpoints := []*compute.NetworkEndpoint{}
+	for _, ne := range networkEndpointMap {
+		networkEndpoints = append(networkEndpoints, ne)
+	}
+	return networkEndpoints
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
+	"k8s.io/ingress-gce/pkg/context"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
+)
+
+const testHybridZone = "on-prem-zone"
+
+func newTestHybridSyncer(fakeGCE negtypes.NetworkEndpointGroupCloud) (negtypes.NegSyncer, *hybridSyncer, *context.ControllerContext) {
+	kubeClient := fake.NewSimpleClientset()
+	backendConfigClient := backendconfigclient.NewSimpleClientset()
+	namer := utils.NewNamer(clusterID, "")
+	ctxConfig := context.ControllerContextConfig{
+		Namespace:             apiv1.NamespaceAll,
+		ResyncPeriod:          1 * time.Second,
+		DefaultBackendSvcPort: defaultBackend,
+	}
+	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, nil, namer, ctxConfig)
+	svcPort := negtypes.NegSyncerKey{
+		Namespace:  testServiceNamespace,
+		Name:       testServiceName,
+		Port:       80,
+		TargetPort: "8080",
+		NegType:    negtypes.NonGCPPrivateEndpointType,
+	}
+
+	negsyncer := NewHybridSyncer(svcPort,
+		testNegName,
+		testHybridZone,
+		namer,
+		record.NewFakeRecorder(100),
+		fakeGCE,
+		context.ServiceInformer.GetIndexer(),
+		context.EndpointInformer.GetIndexer())
+	return negsyncer, negsyncer.(*syncer).core.(*hybridSyncer), context
+}
+
+func TestHybridSyncerSync(t *testing.T) {
+	t.Parallel()
+
+	fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	negsyncer, hybridSyncer, context := newTestHybridSyncer(fakeCloud)
+	// Mark the syncer as running so that the core does not skip syncing.
+	negsyncer.(*syncer).stopped = false
+
+	// The endpoints of a service without selector are not backed by pods or nodes.
+	endpoints := &apiv1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testServiceName,
+			Namespace: testServiceNamespace,
+		},
+		Subsets: []apiv1.EndpointSubset{
+			{
+				Addresses: []apiv1.EndpointAddress{
+					{IP: "192.168.0.1"},
+					{IP: "192.168.0.2"},
+				},
+				NotReadyAddresses: []apiv1.EndpointAddress{
+					{IP: "192.168.0.3"},
+				},
+				Ports: []apiv1.EndpointPort{
+					{Port: 8080, Protocol: apiv1.ProtocolTCP},
+				},
+			},
+			{
+				Addresses: []apiv1.EndpointAddress{
+					{IP: "192.168.1.1"},
+				},
+				Ports: []apiv1.EndpointPort{
+					{Port: 9090, Protocol: apiv1.ProtocolTCP},
+				},
+			},
+		},
+	}
+	context.EndpointInformer.GetIndexer().Add(endpoints)
+
+	if err := hybridSyncer.sync(); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	neg, err := fakeCloud.GetNetworkEndpointGroup(testNegName, testHybridZone)
+	if err != nil {
+		t.Fatalf("Expect NEG %q to be created in zone %q, but got %v", testNegName, testHybridZone, err)
+	}
+	if neg.NetworkEndpointType != string(negtypes.NonGCPPrivateEndpointType) {
+		t.Errorf("Expect NEG type to be %q, but got %q", negtypes.NonGCPPrivateEndpointType, neg.NetworkEndpointType)
+	}
+	if neg.Subnetwork != "" {
+		t.Errorf("Expect NEG to have no subnetwork, but got %q", neg.Subnetwork)
+	}
+
+	expectEndpoints := negtypes.NewNetworkEndpointSet(
+		negtypes.NetworkEndpoint{IP: "192.168.0.1", Port: "8080"},
+		negtypes.NetworkEndpoint{IP: "192.168.0.2", Port: "8080"},
+	)
+	examineHybridNetworkEndpoints(t, fakeCloud, expectEndpoints)
+	if counts := hybridSyncer.status.get().EndpointCounts; counts[testHybridZone] != 2 {
+		t.Errorf("Expect 2 endpoints to be counted in zone %q, but got %v", testHybridZone, counts)
+	}
+
+	// Endpoints removed from the Endpoints object are detached.
+	endpoints.Subsets[0].Addresses = []apiv1.EndpointAddress{{IP: "192.168.0.2"}, {IP: "192.168.0.4"}}
+	context.EndpointInformer.GetIndexer().Update(endpoints)
+	if err := hybridSyncer.sync(); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	expectEndpoints = negtypes.NewNetworkEndpointSet(
+		negtypes.NetworkEndpoint{IP: "192.168.0.2", Port: "8080"},
+		negtypes.NetworkEndpoint{IP: "192.168.0.4", Port: "8080"},
+	)
+	examineHybridNetworkEndpoints(t, fakeCloud, expectEndpoints)
+}
+
+func examineHybridNetworkEndpoints(t *testing.T, fakeCloud negtypes.NetworkEndpointGroupCloud, expectEndpoints negtypes.NetworkEndpointSet) {
+	t.Helper()
+	endpoints, err := retrieveExistingNetworkEndpoints(testNegName, negtypes.NonGCPPrivateEndpointType, testHybridZone, fakeCloud)
+	if err != nil {
+		t.Fatalf("Failed to list network endpoints: %v", err)
+	}
+	if !endpoints.Equal(expectEndpoints) {
+		t.Errorf("Expect endpoints to be %v, but got %v", expectEndpoints.List(), endpoints.List())
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	"k8s.io/apimachinery/pkg/util/clock"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 )
 
 var ErrHandlerRetrying = fmt.Errorf("retry handler is retrying")
@@ -31,6 +32,8 @@ type retryHandler interface {
 	Retry() error
 	// Reset resets handler internals
 	Reset()
+	// BackoffState returns the back off state of the retries
+	BackoffState() negtypes.NegBackoffState
 }
 
 // backoffRetryHandler handles retry with back off delay
@@ -91,3 +94,8 @@ func (h *backoffRetryHandler) Retry() error {
 func (h *backoffRetryHandler) Reset() {
 	h.backoff.ResetRetryDelay()
 }
+
+// BackoffState returns the state of the internal back off delay handler
+func (h *backoffRetryHandler) BackoffState() negtypes.NegBackoffState {
+	return h.backoff.State()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/ingress-gce/pkg/neg/metrics"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// syncStatus keeps track of the result of the last sync of a syncer.
+type syncStatus struct {
+	// negName is the name of the NEG, whose endpoint count metrics are published.
+	negName string
+
+	lock   sync.Mutex
+	status negtypes.NegSyncerStatus
+	// zones are the zones NEGs were ensured in during the last sync.
+	zones []string
+}
+
+// get returns a copy of the status.
+func (s *syncStatus) get() negtypes.NegSyncerStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := s.status
+	if s.status.EndpointCounts != nil {
+		ret.EndpointCounts = make(map[string]int, len(s.status.EndpointCounts))
+		for zone, count := range s.status.EndpointCounts {
+			ret.EndpointCounts[zone] = count
+		}
+	}
+	return ret
+}
+
+// recordSync records the time and the error of a sync.
+func (s *syncStatus) recordSync(timestamp time.Time, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status.LastSyncTime = timestamp
+	s.status.LastSyncError = err
+}
+
+// setEndpointCounts records the number of endpoints of the NEG in each zone.
+func (s *syncStatus) setEndpointCounts(counts map[string]int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status.EndpointCounts = counts
+	metrics.SetNegEndpoints(s.negName, counts)
+}
+
+// setZones records the zones NEGs were ensured in.
+func (s *syncStatus) setZones(zones []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.zones = zones
+}
+
+// getZones returns a copy of the zones.
+func (s *syncStatus) getZones() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.zones...)
+}
+
+// fillState adds the status to the syncer state.
+func (s *syncStatus) fillState(state *negtypes.NegSyncerState) {
+	status := s.get()
+	state.Zones = s.getZones()
+	state.EndpointCounts = status.EndpointCounts
+	state.LastSyncTime = status.LastSyncTime
+	if status.LastSyncError != nil {
+		state.LastSyncError = status.LastSyncError.Error()
+	}
+}
@@ -33,6 +33,12 @@ type syncerCore interface {
 	sync() error
 }
 
+// syncerCoreState is implemented by syncer cores with internal state worth reporting.
+type syncerCoreState interface {
+	// fillState adds the syncer type and the internal state of the core to state.
+	fillState(state *negtypes.NegSyncerState)
+}
+
 // syncer is a NEG syncer skeleton.
 // It handles state transitions and backoff retry operations.
 type syncer struct {
@@ -56,6 +62,9 @@ type syncer struct {
 	syncCh  chan interface{}
 	clock   clock.Clock
 	backoff backoffHandler
+
+	// status of the last sync
+	status *syncStatus
 }
 
 func newSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName string, serviceLister cache.Indexer, recorder record.EventRecorder, core syncerCore) *syncer {
@@ -69,6 +78,7 @@ func newSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName stri
 		shuttingDown:  false,
 		clock:         clock.RealClock{},
 		backoff:       NewExponentialBackendOffHandler(maxRetries, minRetryDelay, maxRetryDelay),
+		status:        &syncStatus{negName: networkEndpointGroupName},
 	}
 }
 
@@ -87,6 +97,7 @@ func (s *syncer) Start() error {
 			// equivalent to never retry
 			retryCh := make(<-chan time.Time)
 			err := s.core.sync()
+			s.status.recordSync(s.clock.Now(), err)
 			if err != nil {
 				delay, retryErr := s.backoff.NextRetryDelay()
 				retryMesg := ""
@@ -121,6 +132,25 @@ func (s *syncer) Start() error {
 	return nil
 }
 
+func (s *syncer) Status() negtypes.NegSyncerStatus {
+	return s.status.get()
+}
+
+func (s *syncer) State() negtypes.NegSyncerState {
+	state := negtypes.NegSyncerState{
+		Key:          s.NegSyncerKey,
+		NegName:      s.negName,
+		Backoff:      s.backoff.State(),
+		Stopped:      s.IsStopped(),
+		ShuttingDown: s.IsShuttingDown(),
+	}
+	s.status.fillState(&state)
+	if core, ok := s.core.(syncerCoreState); ok {
+		core.fillState(&state)
+	}
+	return state
+}
+
 func (s *syncer) init() {
 	s.stateLock.Lock()
 	defer s.stateLock.Unlock()
@@ -65,7 +65,7 @@ func newSyncerTester() *syncerTester {
 		ResyncPeriod:          1 * time.Second,
 		DefaultBackendSvcPort: defaultBackend,
 	}
-	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, namer, ctxConfig)
+	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, nil, namer, ctxConfig)
 	negSyncerKey := negtypes.NegSyncerKey{
 		Namespace:  testServiceNamespace,
 		Name:       testServiceName,
@@ -165,4 +165,7 @@ func TestRetryOnSyncError(t *testing.T) {
 	if syncerTester.syncCount != maxRetry+1 {
 		t.Errorf("Expect sync count to be %v, but got %v", maxRetry+1, syncerTester.syncCount)
 	}
+	if status := syncerTester.syncer.Status(); status.LastSyncTime.IsZero() || status.LastSyncError == nil {
+		t.Errorf("Expect status to record the failed sync, but got %+v", status)
+	}
 }
@@ -17,9 +17,11 @@ limitations under the License.
 package syncers
 
 import (
+	"sort"
 	"sync"
 
 	"fmt"
+	"time"
 
 	"google.golang.org/api/compute/v1"
 	apiv1 "k8s.io/api/core/v1"
@@ -27,6 +29,7 @@ import (
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/neg/metrics"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
 	"k8s.io/klog"
@@ -36,6 +39,7 @@ type transactionSyncer struct {
 	// metadata
 	negtypes.NegSyncerKey
 	negName string
+	namer   negtypes.NetworkEndpointGroupNamer
 
 	// syncer provides syncer life cycle interfaces
 	syncer negtypes.NegSyncer
@@ -50,40 +54,65 @@ type transactionSyncer struct {
 	needInit bool
 	// transactions stores each transaction
 	transactions networkEndpointTransactionTable
+	// endpointPods maps the endpoints in the NEG, or to be attached to it, to their pods.
+	// Endpoints are removed from Endpoints before they are detached, so this is how the
+	// pods of detached endpoints are known.
+	endpointPods negtypes.EndpointPodMap
 
 	podLister      cache.Indexer
 	serviceLister  cache.Indexer
 	endpointLister cache.Indexer
-	recorder       record.EventRecorder
-	cloud          negtypes.NetworkEndpointGroupCloud
-	zoneGetter     negtypes.ZoneGetter
+	// endpointSliceLister is set if endpoints are read from EndpointSlices
+	// instead of endpointLister.
+	endpointSliceLister cache.Indexer
+	recorder            record.EventRecorder
+	cloud               negtypes.NetworkEndpointGroupCloud
+	zoneGetter          negtypes.ZoneGetter
 
 	// retry handles back off retry for NEG API operations
 	retry retryHandler
 
 	// reflector handles NEG readiness gate and conditions for pods in NEG.
 	reflector readiness.Reflector
+
+	// checkpoint stores the checkpoint of the NEG if set.
+	checkpoint Checkpointer
+	// checkpointRestored indicates if the checkpoint was already considered after the syncer was created.
+	checkpointRestored bool
+	// checkpointEndpoints are the endpoints of the NEG by zone once the transactions complete.
+	// It is nil if unknown, for example after an operation failed.
+	checkpointEndpoints map[string]negtypes.NetworkEndpointSet
+	// lastCheckpoint is the last checkpoint stored.
+	lastCheckpoint *negCheckpoint
+
+	// status is the status of the syncer, shared with the syncer skeleton.
+	status *syncStatus
 }
 
-func NewTransactionSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName string, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, serviceLister cache.Indexer, endpointLister cache.Indexer, reflector readiness.Reflector) negtypes.NegSyncer {
+func NewTransactionSyncer(negSyncerKey negtypes.NegSyncerKey, networkEndpointGroupName string, namer negtypes.NetworkEndpointGroupNamer, recorder record.EventRecorder, cloud negtypes.NetworkEndpointGroupCloud, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, serviceLister cache.Indexer, endpointLister cache.Indexer, endpointSliceLister cache.Indexer, reflector readiness.Reflector, checkpoint Checkpointer) negtypes.NegSyncer {
 	// TransactionSyncer implements the syncer core
 	ts := &transactionSyncer{
-		NegSyncerKey:   negSyncerKey,
-		negName:        networkEndpointGroupName,
-		needInit:       true,
-		transactions:   NewTransactionTable(),
-		podLister:      podLister,
-		serviceLister:  serviceLister,
-		endpointLister: endpointLister,
-		recorder:       recorder,
-		cloud:          cloud,
-		zoneGetter:     zoneGetter,
-		reflector:      reflector,
+		NegSyncerKey:        negSyncerKey,
+		negName:             networkEndpointGroupName,
+		namer:               namer,
+		needInit:            true,
+		transactions:        NewTransactionTable(),
+		endpointPods:        negtypes.EndpointPodMap{},
+		podLister:           podLister,
+		serviceLister:       serviceLister,
+		endpointLister:      endpointLister,
+		endpointSliceLister: endpointSliceLister,
+		recorder:            recorder,
+		cloud:               cloud,
+		zoneGetter:          zoneGetter,
+		reflector:           reflector,
+		checkpoint:          checkpoint,
 	}
 	// Syncer implements life cycle logic
 	syncer := newSyncer(negSyncerKey, networkEndpointGroupName, serviceLister, recorder, ts)
 	// transactionSyncer needs syncer interface for internals
 	ts.syncer = syncer
+	ts.status = syncer.status
 	ts.retry = NewDelayRetryHandler(func() { syncer.Sync() }, NewExponentialBackendOffHandler(maxRetries, minRetryDelay, maxRetryDelay))
 	return syncer
 }
@@ -113,14 +142,7 @@ func (s *transactionSyncer) syncInternal() error {
 	}
 	klog.V(2).Infof("Sync NEG %q for %s.", s.negName, s.NegSyncerKey.String())
 
-	ep, exists, err := s.endpointLister.Get(
-		&apiv1.Endpoints{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      s.Name,
-				Namespace: s.Namespace,
-			},
-		},
-	)
+	targetMap, endpointPodMap, exists, err := s.toZoneNetworkEndpointMap()
 	if err != nil {
 		return err
 	}
@@ -130,12 +152,7 @@ func (s *transactionSyncer) syncInternal() error {
 		return nil
 	}
 
-	targetMap, endpointPodMap, err := toZoneNetworkEndpointMap(ep.(*apiv1.Endpoints), s.zoneGetter, s.TargetPort, s.podLister, s.NegSyncerKey.SubsetLabels)
-	if err != nil {
-		return err
-	}
-
-	currentMap, err := retrieveExistingZoneNetworkEndpointMap(s.negName, s.zoneGetter, s.cloud)
+	currentMap, err := s.retrieveExistingZoneNetworkEndpointMap()
 	if err != nil {
 		return err
 	}
@@ -143,6 +160,7 @@ func (s *transactionSyncer) syncInternal() error {
 	// Merge the current state from cloud with the transaction table together
 	// The combined state represents the eventual result when all transactions completed
 	mergeTransactionIntoZoneEndpointMap(currentMap, s.transactions)
+	s.updateEndpointPods(endpointPodMap, targetMap, currentMap)
 	// Find transaction entries that needs to be reconciled
 	reconcileTransactions(targetMap, s.transactions)
 	// Calculate the endpoints to add and delete to transform the current state to desire state
@@ -158,14 +176,147 @@ func (s *transactionSyncer) syncInternal() error {
 	// filter out the endpoints that are in transaction
 	filterEndpointByTransaction(committedEndpoints, s.transactions)
 
-	s.commitPods(committedEndpoints, endpointPodMap)
+	// The endpoints of GCE_VM_IP NEGs are nodes, there are no pods to signal.
+	if s.negType() != negtypes.VmIpEndpointType {
+		s.commitPods(committedEndpoints, endpointPodMap)
+	}
+
+	s.checkpointEndpoints = eventualZoneNetworkEndpointMap(currentMap, addEndpoints, removeEndpoints)
+	// The transactions are in the table once syncNetworkEndpoints returns.
+	defer s.saveCheckpoint()
 
 	if len(addEndpoints) == 0 && len(removeEndpoints) == 0 {
 		klog.V(4).Infof("No endpoint change for %s/%s, skip syncing NEG. ", s.Namespace, s.Name)
+		s.status.setEndpointCounts(networkEndpointCounts(s.checkpointEndpoints))
+		return nil
+	}
+
+	if err := s.syncNetworkEndpoints(addEndpoints, removeEndpoints); err != nil {
+		s.checkpointEndpoints = nil
+		return err
+	}
+	s.status.setEndpointCounts(networkEndpointCounts(s.checkpointEndpoints))
+	return nil
+}
+
+// retrieveExistingZoneNetworkEndpointMap lists the existing endpoints of the NEG by zone. After the syncer was
+// created, the zones of a fresh checkpoint without transactions in flight are restored from it instead.
+func (s *transactionSyncer) retrieveExistingZoneNetworkEndpointMap() (map[string]negtypes.NetworkEndpointSet, error) {
+	if s.checkpoint == nil || s.checkpointRestored {
+		return retrieveExistingZoneNetworkEndpointMap(s.negName, s.negType(), s.zoneGetter, s.cloud)
+	}
+	s.checkpointRestored = true
+	checkpoint := s.loadCheckpoint()
+	if checkpoint == nil {
+		return retrieveExistingZoneNetworkEndpointMap(s.negName, s.negType(), s.zoneGetter, s.cloud)
+	}
+
+	zones, err := s.zoneGetter.ListZones()
+	if err != nil {
+		return nil, err
+	}
+	pendingZones := checkpoint.pendingZones()
+	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
+	for _, zone := range zones {
+		if endpoints, ok := checkpoint.Endpoints[zone]; ok && !pendingZones.Has(zone) {
+			zoneNetworkEndpointMap[zone] = negtypes.NewNetworkEndpointSet(endpoints...)
+			continue
+		}
+		zoneNetworkEndpointMap[zone], err = retrieveExistingNetworkEndpoints(s.negName, s.negType(), zone, s.cloud)
+		if err != nil {
+			return nil, err
+		}
+	}
+	klog.V(2).Infof("Restored endpoints of NEG %q for %s from checkpoint of %v, listed zones %v.", s.negName, s.NegSyncerKey.String(), checkpoint.Timestamp, pendingZones.List())
+	return zoneNetworkEndpointMap, nil
+}
+
+// loadCheckpoint returns the checkpoint of the NEG, or nil if there is no usable checkpoint.
+func (s *transactionSyncer) loadCheckpoint() *negCheckpoint {
+	data, exists, err := s.checkpoint.Get(s.negName)
+	if err != nil || !exists {
+		if err != nil {
+			klog.Warningf("Failed to get checkpoint of NEG %q: %v", s.negName, err)
+		}
+		return nil
+	}
+	checkpoint, err := decodeNegCheckpoint(data)
+	if err != nil {
+		klog.Warningf("Ignoring invalid checkpoint of NEG %q: %v", s.negName, err)
+		return nil
+	}
+	if age := time.Since(checkpoint.Timestamp); age > checkpointMaxAge {
+		klog.V(2).Infof("Ignoring checkpoint of NEG %q taken %v ago.", s.negName, age)
 		return nil
 	}
+	s.lastCheckpoint = checkpoint
+	return checkpoint
+}
+
+// saveCheckpoint stores the checkpoint of the NEG if its state changed or it needs to be refreshed.
+// The Checkpointer is expected to queue the write, as this is called after every transaction.
+// Must be called with the syncLock held.
+func (s *transactionSyncer) saveCheckpoint() {
+	if s.checkpoint == nil || s.checkpointEndpoints == nil {
+		return
+	}
+	checkpoint := newNegCheckpoint(time.Now(), s.checkpointEndpoints, s.transactions)
+	if checkpoint.sameState(s.lastCheckpoint) && time.Since(s.lastCheckpoint.Timestamp) < checkpointRefreshPeriod {
+		return
+	}
+	data, err := checkpoint.encode()
+	if err == nil {
+		err = s.checkpoint.Put(s.negName, data)
+	}
+	if err != nil {
+		klog.Warningf("Failed to store checkpoint of NEG %q: %v", s.negName, err)
+		return
+	}
+	s.lastCheckpoint = checkpoint
+}
+
+// toZoneNetworkEndpointMap returns the desired endpoints of the NEG by zone from the EndpointSlices of
+// the service if enabled, or from its Endpoints otherwise. The endpoints of GCE_VM_IP NEGs are the nodes
+// hosting the endpoints. Returns false if the service has no endpoints object.
+func (s *transactionSyncer) toZoneNetworkEndpointMap() (map[string]negtypes.NetworkEndpointSet, negtypes.EndpointPodMap, bool, error) {
+	if s.endpointSliceLister != nil {
+		slices, err := negtypes.ListEndpointSlices(s.endpointSliceLister, s.Namespace, s.Name)
+		if err != nil || len(slices) == 0 {
+			return nil, nil, false, err
+		}
+		if s.negType() == negtypes.VmIpEndpointType {
+			targetMap, err := toZoneVmIpNetworkEndpointMap(endpointSliceAddresses(slices), s.zoneGetter)
+			return targetMap, negtypes.EndpointPodMap{}, true, err
+		}
+		targetMap, endpointPodMap, err := toZoneNetworkEndpointMapFromSlices(slices, s.zoneGetter, s.TargetPort, s.podLister, s.NegSyncerKey.SubsetLabels, !s.reflector.DrainEnabled())
+		return targetMap, endpointPodMap, true, err
+	}
+
+	ep, exists, err := s.endpointLister.Get(
+		&apiv1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.Name,
+				Namespace: s.Namespace,
+			},
+		},
+	)
+	if err != nil || !exists {
+		return nil, nil, false, err
+	}
+	if s.negType() == negtypes.VmIpEndpointType {
+		targetMap, err := toZoneVmIpNetworkEndpointMap(endpointsAddresses(ep.(*apiv1.Endpoints)), s.zoneGetter)
+		return targetMap, negtypes.EndpointPodMap{}, true, err
+	}
+	targetMap, endpointPodMap, err := toZoneNetworkEndpointMap(ep.(*apiv1.Endpoints), s.zoneGetter, s.TargetPort, s.podLister, s.NegSyncerKey.SubsetLabels)
+	return targetMap, endpointPodMap, true, err
+}
 
-	return s.syncNetworkEndpoints(addEndpoints, removeEndpoints)
+// negType returns the type of the NEG.
+func (s *transactionSyncer) negType() negtypes.NetworkEndpointType {
+	if s.NegType == "" {
+		return negtypes.VmIpPortEndpointType
+	}
+	return s.NegType
 }
 
 // ensureNetworkEndpointGroups ensures NEGs are created and configured correctly in the corresponding zones.
@@ -176,9 +327,10 @@ func (s *transactionSyncer) ensureNetworkEndpointGroups() error {
 		return err
 	}
 
+	s.status.setZones(zones)
 	var errList []error
 	for _, zone := range zones {
-		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.cloud, s.serviceLister, s.recorder); err != nil {
+		if err := ensureNetworkEndpointGroup(s.Namespace, s.Name, s.negName, zone, s.NegSyncerKey.String(), s.Port, s.negType(), s.namer, s.cloud, s.serviceLister, s.recorder); err != nil {
 			errList = append(errList, err)
 		}
 	}
@@ -220,11 +372,13 @@ func (s *transactionSyncer) syncNetworkEndpoints(addEndpoints, removeEndpoints m
 		return nil
 	}
 
-	if err := syncFunc(addEndpoints, attachOp); err != nil {
+	// Detach first, as removed endpoints are mostly those of terminating pods,
+	// which keep receiving traffic until they are detached.
+	if err := syncFunc(removeEndpoints, detachOp); err != nil {
 		return err
 	}
 
-	if err := syncFunc(removeEndpoints, detachOp); err != nil {
+	if err := syncFunc(addEndpoints, attachOp); err != nil {
 		return err
 	}
 	return nil
@@ -252,15 +406,22 @@ func (s *transactionSyncer) operationInternal(operation transactionOp, zone stri
 		networkEndpoints = append(networkEndpoints, ne)
 	}
 
+	start := time.Now()
+	operationType := metrics.AttachSync
 	if operation == attachOp {
 		err = s.cloud.AttachNetworkEndpoints(s.negName, zone, networkEndpoints)
 	}
 	if operation == detachOp {
+		operationType = metrics.DetachSync
 		err = s.cloud.DetachNetworkEndpoints(s.negName, zone, networkEndpoints)
 	}
+	metrics.ObserveNegOperation(operationType, len(networkEndpoints), err, start)
 
 	if err == nil {
 		s.recordEvent(apiv1.EventTypeNormal, operation.String(), fmt.Sprintf("%s %d network endpoint(s) (NEG %q in zone %q)", operation.String(), len(networkEndpointMap), s.negName, zone))
+		if operation == detachOp {
+			s.commitDetachedPods(zone, networkEndpointMap)
+		}
 	} else {
 		s.recordEvent(apiv1.EventTypeWarning, operation.String()+"Failed", fmt.Sprintf("Failed to %s %d network endpoint(s) (NEG %q in zone %q): %v", operation.String(), len(networkEndpointMap), s.negName, zone, err))
 	}
@@ -269,6 +430,32 @@ func (s *transactionSyncer) operationInternal(operation transactionOp, zone stri
 	s.commitTransaction(err, networkEndpointMap)
 }
 
+// fillState adds the transactions in flight and the operation back off to state.
+func (s *transactionSyncer) fillState(state *negtypes.NegSyncerState) {
+	state.SyncerType = "Transaction"
+	for _, endpoint := range s.transactions.Keys() {
+		entry, ok := s.transactions.Get(endpoint)
+		if !ok {
+			continue
+		}
+		state.Transactions = append(state.Transactions, negtypes.NegTransactionState{
+			Endpoint:      endpoint,
+			Zone:          entry.Zone,
+			Operation:     entry.Operation.String(),
+			NeedReconcile: entry.NeedReconcile,
+		})
+	}
+	sort.Slice(state.Transactions, func(i, j int) bool {
+		a, b := state.Transactions[i].Endpoint, state.Transactions[j].Endpoint
+		if a.IP != b.IP {
+			return a.IP < b.IP
+		}
+		return a.Port < b.Port
+	})
+	backoff := s.retry.BackoffState()
+	state.OperationBackoff = &backoff
+}
+
 func (s *transactionSyncer) recordEvent(eventType, reason, eventDesc string) {
 	if svc := getService(s.serviceLister, s.Namespace, s.Name); svc != nil {
 		s.recorder.Eventf(svc, eventType, reason, eventDesc)
@@ -293,6 +480,9 @@ func (s *transactionSyncer) commitTransaction(err error, networkEndpointMap map[
 		// This is to prevent if the NEG object is deleted or misconfigured by user
 		s.needInit = true
 		needRetry = true
+		// The endpoints of the NEG are unknown until the next sync. The last checkpoint still
+		// has the failed transactions in flight.
+		s.checkpointEndpoints = nil
 	}
 
 	for networkEndpoint := range networkEndpointMap {
@@ -309,6 +499,8 @@ func (s *transactionSyncer) commitTransaction(err error, networkEndpointMap map[
 		s.transactions.Delete(networkEndpoint)
 	}
 
+	s.saveCheckpoint()
+
 	if needRetry {
 		if retryErr := s.retry.Retry(); retryErr != nil {
 			s.recordEvent(apiv1.EventTypeWarning, "RetryFailed", fmt.Sprintf("Failed to retry NEG sync for %q: %v", s.NegSyncerKey.String(), retryErr))
@@ -336,6 +528,48 @@ func (s *transactionSyncer) commitPods(endpointMap map[string]negtypes.NetworkEn
 	}
 }
 
+// commitDetachedPods signals the readiness reflector that the pods of the endpoints were detached from the NEG
+func (s *transactionSyncer) commitDetachedPods(zone string, networkEndpointMap map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint) {
+	s.syncLock.Lock()
+	zoneEndpointMap := negtypes.EndpointPodMap{}
+	for endpoint := range networkEndpointMap {
+		if podName, ok := s.endpointPods[endpoint]; ok {
+			zoneEndpointMap[endpoint] = podName
+			delete(s.endpointPods, endpoint)
+		}
+	}
+	s.syncLock.Unlock()
+	s.reflector.CommitDetachedPods(s.NegSyncerKey, s.negName, zone, zoneEndpointMap)
+}
+
+// updateEndpointPods records the pods of the target endpoints and forgets the endpoints
+// which are neither targeted, in the NEG nor in transaction.
+// Must be called with the syncLock held.
+func (s *transactionSyncer) updateEndpointPods(endpointPodMap negtypes.EndpointPodMap, targetMap, currentMap map[string]negtypes.NetworkEndpointSet) {
+	for endpoint, podName := range endpointPodMap {
+		s.endpointPods[endpoint] = podName
+	}
+	for endpoint := range s.endpointPods {
+		if _, ok := s.transactions.Get(endpoint); ok {
+			continue
+		}
+		if endpointInZoneMap(endpoint, targetMap) || endpointInZoneMap(endpoint, currentMap) {
+			continue
+		}
+		delete(s.endpointPods, endpoint)
+	}
+}
+
+// endpointInZoneMap returns true if the endpoint is in any zone of the map
+func endpointInZoneMap(endpoint negtypes.NetworkEndpoint, zoneMap map[string]negtypes.NetworkEndpointSet) bool {
+	for _, endpointSet := range zoneMap {
+		if endpointSet.Has(endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
 // filterEndpointByTransaction removes the all endpoints from endpoint map if they exists in the transaction table
 func filterEndpointByTransaction(endpointMap map[string]negtypes.NetworkEndpointSet, table networkEndpointTransactionTable) {
 	for _, endpointSet := range endpointMap {
@@ -26,15 +26,21 @@ import (
 
 	"google.golang.org/api/compute/v1"
 	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/ingress-gce/pkg/annotations"
+	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 	backendconfigclient "k8s.io/ingress-gce/pkg/backendconfig/client/clientset/versioned/fake"
 	"k8s.io/ingress-gce/pkg/context"
 	"k8s.io/ingress-gce/pkg/neg/readiness"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/neg/types/shared"
 	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/legacy-cloud-providers/gce"
 )
@@ -175,6 +181,93 @@ func TestTransactionSyncNetworkEndpoints(t *testing.T) {
 	}
 }
 
+func TestTransactionSyncVmIpNetworkEndpoints(t *testing.T) {
+	t.Parallel()
+
+	fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	negsyncer, transactionSyncer := newTestTransactionSyncer(fakeCloud)
+	transactionSyncer.NegType = negtypes.VmIpEndpointType
+	// Mark the syncer as running so that the core does not skip syncing.
+	negsyncer.(*syncer).stopped = false
+
+	instance1, instance2, instance3 := testInstance1, testInstance2, testInstance3
+	endpoints := &apiv1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testService},
+		Subsets: []apiv1.EndpointSubset{
+			{
+				Addresses: []apiv1.EndpointAddress{
+					{IP: "10.100.1.1", NodeName: &instance1},
+					{IP: "10.100.1.2", NodeName: &instance1},
+				},
+				NotReadyAddresses: []apiv1.EndpointAddress{
+					{IP: "10.100.2.1", NodeName: &instance2},
+				},
+				Ports: []apiv1.EndpointPort{{Name: "http", Port: 8080}},
+			},
+			{
+				Addresses: []apiv1.EndpointAddress{
+					{IP: "10.100.3.1", NodeName: &instance3},
+				},
+				Ports: []apiv1.EndpointPort{{Name: "dns", Port: 53}},
+			},
+		},
+	}
+	transactionSyncer.endpointLister.Add(endpoints)
+
+	if err := transactionSyncer.syncInternal(); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if err := waitForTransactions(transactionSyncer); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+
+	// The NEGs contain the nodes hosting ready endpoints on any port, once.
+	expectEndpoints := map[string]negtypes.NetworkEndpointSet{
+		testZone1: negtypes.NewNetworkEndpointSet(negtypes.NetworkEndpoint{Node: testInstance1}),
+		testZone2: negtypes.NewNetworkEndpointSet(negtypes.NetworkEndpoint{Node: testInstance3}),
+	}
+	for zone, expect := range expectEndpoints {
+		neg, err := fakeCloud.GetNetworkEndpointGroup(transactionSyncer.negName, zone)
+		if err != nil {
+			t.Fatalf("Expect NEG to be created in zone %q, but got %v", zone, err)
+		}
+		if neg.NetworkEndpointType != string(negtypes.VmIpEndpointType) {
+			t.Errorf("Expect NEG type in zone %q to be %q, but got %q", zone, negtypes.VmIpEndpointType, neg.NetworkEndpointType)
+		}
+		list, err := fakeCloud.ListNetworkEndpoints(transactionSyncer.negName, zone, false)
+		if err != nil {
+			t.Fatalf("Expect err to be nil, but got %v", err)
+		}
+		endpointSet := negtypes.NewNetworkEndpointSet()
+		for _, ep := range list {
+			if ep.NetworkEndpoint.Port != 0 || ep.NetworkEndpoint.IpAddress != "" {
+				t.Errorf("Expect endpoint %+v to only have an instance", ep.NetworkEndpoint)
+			}
+			endpointSet.Insert(negtypes.NetworkEndpoint{Node: ep.NetworkEndpoint.Instance})
+		}
+		if !endpointSet.Equal(expect) {
+			t.Errorf("Expect endpoints in zone %q to be %v, but got %v", zone, expect.List(), endpointSet.List())
+		}
+	}
+
+	// The node is detached once it does not host any ready endpoint.
+	endpoints.Subsets = endpoints.Subsets[:1]
+	transactionSyncer.endpointLister.Update(endpoints)
+	if err := transactionSyncer.syncInternal(); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if err := waitForTransactions(transactionSyncer); err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	current, err := retrieveExistingNetworkEndpoints(transactionSyncer.negName, negtypes.VmIpEndpointType, testZone2, fakeCloud)
+	if err != nil {
+		t.Fatalf("Expect err to be nil, but got %v", err)
+	}
+	if current.Len() != 0 {
+		t.Errorf("Expect no endpoint in zone %q, but got %v", testZone2, current.List())
+	}
+}
+
 func TestCommitTransaction(t *testing.T) {
 	t.Parallel()
 	s, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
@@ -1050,6 +1143,41 @@ func TestCommitPods(t *testing.T) {
 	}
 }
 
+func TestCommitDetachedPods(t *testing.T) {
+	t.Parallel()
+	_, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
+	reflector := &testReflector{}
+	reflector.Flush()
+	transactionSyncer.reflector = reflector
+
+	targetSet, targetPodMap := generateEndpointSetAndMap(net.ParseIP("1.1.1.1"), 10, testInstance1, "8080")
+	staleSet, stalePodMap := generateEndpointSetAndMap(net.ParseIP("1.1.2.1"), 5, testInstance2, "8080")
+	currentMap := map[string]negtypes.NetworkEndpointSet{testZone1: targetSet.Union(staleSet)}
+	targetMap := map[string]negtypes.NetworkEndpointSet{testZone1: targetSet}
+
+	// The pods of endpoints removed from the target are remembered while they are still in the NEG.
+	transactionSyncer.updateEndpointPods(unionEndpointMap(negtypes.EndpointPodMap{}, stalePodMap), targetMap, currentMap)
+	transactionSyncer.updateEndpointPods(targetPodMap, targetMap, currentMap)
+	expectEndpointPods := unionEndpointMap(unionEndpointMap(negtypes.EndpointPodMap{}, targetPodMap), stalePodMap)
+	if !reflect.DeepEqual(transactionSyncer.endpointPods, expectEndpointPods) {
+		t.Errorf("Expect endpoint pods to be %v, but got %v", expectEndpointPods, transactionSyncer.endpointPods)
+	}
+
+	transactionSyncer.commitDetachedPods(testZone1, generateEndpointBatch(staleSet))
+	if !reflect.DeepEqual(reflector.detachedEndpointMaps[testZone1], stalePodMap) {
+		t.Errorf("Expect detached endpoint map to be %v, but got %v", stalePodMap, reflector.detachedEndpointMaps[testZone1])
+	}
+	if !reflect.DeepEqual(transactionSyncer.endpointPods, targetPodMap) {
+		t.Errorf("Expect endpoint pods to be %v, but got %v", targetPodMap, transactionSyncer.endpointPods)
+	}
+
+	// Endpoints which are neither targeted nor in the NEG are forgotten.
+	transactionSyncer.updateEndpointPods(negtypes.EndpointPodMap{}, map[string]negtypes.NetworkEndpointSet{}, map[string]negtypes.NetworkEndpointSet{})
+	if len(transactionSyncer.endpointPods) != 0 {
+		t.Errorf("Expect endpoint pods to be empty, but got %v", transactionSyncer.endpointPods)
+	}
+}
+
 func newTestTransactionSyncer(fakeGCE negtypes.NetworkEndpointGroupCloud) (negtypes.NegSyncer, *transactionSyncer) {
 	kubeClient := fake.NewSimpleClientset()
 	backendConfigClient := backendconfigclient.NewSimpleClientset()
@@ -1059,7 +1187,7 @@ func newTestTransactionSyncer(fakeGCE negtypes.NetworkEndpointGroupCloud) (negty
 		ResyncPeriod:          1 * time.Second,
 		DefaultBackendSvcPort: defaultBackend,
 	}
-	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, namer, ctxConfig)
+	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, nil, namer, ctxConfig)
 	svcPort := negtypes.NegSyncerKey{
 		Namespace:  testNamespace,
 		Name:       testService,
@@ -1072,13 +1200,16 @@ func newTestTransactionSyncer(fakeGCE negtypes.NetworkEndpointGroupCloud) (negty
 
 	negsyncer := NewTransactionSyncer(svcPort,
 		testNegName,
+		namer,
 		record.NewFakeRecorder(100),
 		fakeGCE,
 		negtypes.NewFakeZoneGetter(),
 		context.PodInformer.GetIndexer(),
 		context.ServiceInformer.GetIndexer(),
 		context.EndpointInformer.GetIndexer(),
-		reflector)
+		nil,
+		reflector,
+		nil)
 	transactionSyncer := negsyncer.(*syncer).core.(*transactionSyncer)
 	return negsyncer, transactionSyncer
 }
@@ -1157,18 +1288,24 @@ func (r *testRetryHandler) Reset() {
 	return
 }
 
+func (r *testRetryHandler) BackoffState() negtypes.NegBackoffState {
+	return negtypes.NegBackoffState{RetryCount: r.RetryCount}
+}
+
 type testReflector struct {
 	*readiness.NoopReflector
 	keys     []negtypes.NegSyncerKey
 	negNames []string
 
-	endpointMaps map[string]negtypes.EndpointPodMap
+	endpointMaps         map[string]negtypes.EndpointPodMap
+	detachedEndpointMaps map[string]negtypes.EndpointPodMap
 }
 
 func (tr *testReflector) Flush() {
 	tr.keys = []negtypes.NegSyncerKey{}
 	tr.negNames = []string{}
 	tr.endpointMaps = map[string]negtypes.EndpointPodMap{}
+	tr.detachedEndpointMaps = map[string]negtypes.EndpointPodMap{}
 }
 
 func (tr *testReflector) CommitPods(syncerKey negtypes.NegSyncerKey, negName string, zone string, endpointMap negtypes.EndpointPodMap) {
@@ -1177,6 +1314,10 @@ func (tr *testReflector) CommitPods(syncerKey negtypes.NegSyncerKey, negName str
 	tr.endpointMaps[zone] = endpointMap
 }
 
+func (tr *testReflector) CommitDetachedPods(syncerKey negtypes.NegSyncerKey, negName string, zone string, endpointMap negtypes.EndpointPodMap) {
+	tr.detachedEndpointMaps[zone] = endpointMap
+}
+
 func validateTransactionTableEquality(t *testing.T, desc string, table, expectTable networkEndpointTransactionTable) {
 	for _, key := range table.Keys() {
 		expectEntry, ok := expectTable.Get(key)
@@ -1209,3 +1350,184 @@ func waitForTransactions(syncer *transactionSyncer) error {
 		return false, nil
 	})
 }
+
+func TestTransactionSyncerState(t *testing.T) {
+	t.Parallel()
+	syncer, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
+
+	endpoint1 := negtypes.NetworkEndpoint{IP: "1.1.1.1", Port: "8080", Node: testInstance1}
+	endpoint2 := negtypes.NetworkEndpoint{IP: "1.1.1.2", Port: "8080", Node: testInstance1}
+	transactionSyncer.transactions.Put(endpoint2, transactionEntry{Operation: detachOp, Zone: testZone1, NeedReconcile: true})
+	transactionSyncer.transactions.Put(endpoint1, transactionEntry{Operation: attachOp, Zone: testZone1})
+	transactionSyncer.status.setZones([]string{testZone1, testZone2})
+	transactionSyncer.status.setEndpointCounts(map[string]int{testZone1: 2})
+	now := time.Now()
+	transactionSyncer.status.recordSync(now, fmt.Errorf("sync failed"))
+
+	state := syncer.State()
+	expectTransactions := []negtypes.NegTransactionState{
+		{Endpoint: endpoint1, Zone: testZone1, Operation: "Attach"},
+		{Endpoint: endpoint2, Zone: testZone1, Operation: "Detach", NeedReconcile: true},
+	}
+	if state.SyncerType != "Transaction" || state.NegName != testNegName || state.Key.Name != testService {
+		t.Errorf("Expect transaction syncer %q of service %q, but got %+v", testNegName, testService, state)
+	}
+	if !reflect.DeepEqual(state.Transactions, expectTransactions) {
+		t.Errorf("Expect transactions %+v, but got %+v", expectTransactions, state.Transactions)
+	}
+	if !reflect.DeepEqual(state.Zones, []string{testZone1, testZone2}) || !reflect.DeepEqual(state.EndpointCounts, map[string]int{testZone1: 2}) {
+		t.Errorf("Expect zones %v and endpoint counts %v, but got %v and %v", []string{testZone1, testZone2}, map[string]int{testZone1: 2}, state.Zones, state.EndpointCounts)
+	}
+	if !state.LastSyncTime.Equal(now) || state.LastSyncError != "sync failed" {
+		t.Errorf("Expect last sync at %v with error %q, but got %v with %q", now, "sync failed", state.LastSyncTime, state.LastSyncError)
+	}
+	expectBackoff := negtypes.NegBackoffState{MaxRetries: maxRetries, LastRetryDelay: "0s"}
+	if state.Backoff != expectBackoff || state.OperationBackoff == nil || *state.OperationBackoff != expectBackoff {
+		t.Errorf("Expect back off %+v, but got %+v and operation back off %+v", expectBackoff, state.Backoff, state.OperationBackoff)
+	}
+	if !state.Stopped {
+		t.Errorf("Expect syncer to be stopped")
+	}
+}
+
+func TestTransactionSyncerDrainsTerminatingPod(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := fake.NewSimpleClientset()
+	backendConfigClient := backendconfigclient.NewSimpleClientset()
+	namer := utils.NewNamer(clusterID, "")
+	ctxConfig := context.ControllerContextConfig{
+		Namespace:             apiv1.NamespaceAll,
+		ResyncPeriod:          1 * time.Second,
+		DefaultBackendSvcPort: defaultBackend,
+	}
+	context := context.NewControllerContext(kubeClient, nil, backendConfigClient, nil, nil, gce.NewFakeGCECloud(gce.DefaultTestClusterValues()), namer, ctxConfig)
+	reflector := readiness.NewReadinessReflector(context, &fakeNegLookup{}, true)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go reflector.Run(stopCh)
+
+	context.ServiceInformer.GetIndexer().Add(&apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   testNamespace,
+			Name:        testService,
+			Annotations: map[string]string{annotations.BackendConfigKey: `{"default":"config"}`},
+		},
+		Spec: apiv1.ServiceSpec{Ports: []apiv1.ServicePort{{Port: 80}}},
+	})
+	context.BackendConfigInformer.GetIndexer().Add(&backendconfigv1beta1.BackendConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "config"},
+		Spec: backendconfigv1beta1.BackendConfigSpec{
+			ConnectionDraining: &backendconfigv1beta1.ConnectionDrainingConfig{DrainingTimeoutSec: 1},
+		},
+	})
+	pod := &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "pod1"}}
+	context.PodInformer.GetIndexer().Add(pod)
+	if _, err := kubeClient.CoreV1().Pods(testNamespace).Create(pod); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+
+	endpointSliceLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{negtypes.EndpointSliceByServiceIndex: negtypes.EndpointSliceByServiceIndexFunc})
+	newSlice := func(conditions map[string]interface{}) *unstructured.Unstructured {
+		slice := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion":  "discovery.k8s.io/v1beta1",
+			"kind":        "EndpointSlice",
+			"addressType": "IPv4",
+			"metadata": map[string]interface{}{
+				"namespace": testNamespace,
+				"name":      testService + "-abc",
+			},
+			"ports": []interface{}{
+				map[string]interface{}{"name": "http", "port": int64(8080), "protocol": "TCP"},
+			},
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"addresses":  []interface{}{"10.100.1.1"},
+					"conditions": conditions,
+					"nodeName":   testInstance1,
+					"targetRef":  map[string]interface{}{"kind": "Pod", "namespace": testNamespace, "name": "pod1"},
+				},
+			},
+		}}
+		slice.SetLabels(map[string]string{negtypes.EndpointSliceServiceNameLabel: testService})
+		return slice
+	}
+	endpointSliceLister.Add(newSlice(map[string]interface{}{"ready": true}))
+
+	fakeCloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+	negsyncer := NewTransactionSyncer(negtypes.NegSyncerKey{Namespace: testNamespace, Name: testService, Port: 80, TargetPort: "8080"},
+		testNegName,
+		namer,
+		record.NewFakeRecorder(100),
+		fakeCloud,
+		negtypes.NewFakeZoneGetter(),
+		context.PodInformer.GetIndexer(),
+		context.ServiceInformer.GetIndexer(),
+		context.EndpointInformer.GetIndexer(),
+		endpointSliceLister,
+		reflector,
+		nil)
+	transactionSyncer := negsyncer.(*syncer).core.(*transactionSyncer)
+	// Mark the syncer as running so that the core does not skip syncing.
+	negsyncer.(*syncer).stopped = false
+
+	sync := func() negtypes.NetworkEndpointSet {
+		if err := transactionSyncer.syncInternal(); err != nil {
+			t.Fatalf("Expect err to be nil, but got %v", err)
+		}
+		if err := waitForTransactions(transactionSyncer); err != nil {
+			t.Fatalf("Expect err to be nil, but got %v", err)
+		}
+		current, err := retrieveExistingNetworkEndpoints(testNegName, negtypes.VmIpPortEndpointType, testZone1, fakeCloud)
+		if err != nil {
+			t.Fatalf("Expect err to be nil, but got %v", err)
+		}
+		return current
+	}
+	endpoint := negtypes.NetworkEndpoint{IP: "10.100.1.1", Port: "8080", Node: testInstance1}
+	if current := sync(); !current.Has(endpoint) {
+		t.Fatalf("Expect endpoint %v to be attached, but got %v", endpoint, current.List())
+	}
+	// The NEG was created by the first sync, skip ensuring it so that it is not recreated in the fake cloud.
+	transactionSyncer.needInit = false
+
+	// The pod starts terminating. Its endpoint is still serving, but is detached so that it is drained.
+	terminating := pod.DeepCopy()
+	deletionTimestamp := metav1.Now()
+	terminating.DeletionTimestamp = &deletionTimestamp
+	context.PodInformer.GetIndexer().Update(terminating)
+	endpointSliceLister.Update(newSlice(map[string]interface{}{"ready": false, "serving": true, "terminating": true}))
+	detachTime := time.Now()
+	if current := sync(); current.Has(endpoint) {
+		t.Fatalf("Expect endpoint %v to be detached, but got %v", endpoint, current.List())
+	}
+
+	// The pod is marked as drained once the draining timeout of its BackendConfig has passed.
+	if err := wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+		pod, err := kubeClient.CoreV1().Pods(testNamespace).Get("pod1", metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == shared.NegDrainedCondition && condition.Status == apiv1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	}); err != nil {
+		t.Fatalf("Expect pod to be marked as drained, but got %v", err)
+	}
+	if elapsed := time.Since(detachTime); elapsed < time.Second {
+		t.Errorf("Expect pod to be marked as drained after the draining timeout of 1s, but it was marked after %v", elapsed)
+	}
+}
+
+type fakeNegLookup struct{}
+
+func (*fakeNegLookup) ReadinessGateEnabledNegs(string, map[string]string) []string {
+	return nil
+}
+
+func (*fakeNegLookup) ReadinessGateEnabled(negtypes.NegSyncerKey) bool {
+	return false
+}
@@ -39,11 +39,10 @@ const (
 	MAX_NETWORK_ENDPOINTS_PER_BATCH = 500
 	// For each NEG, only retries 15 times to process it.
 	// This is a convention in kube-controller-manager.
-	maxRetries                   = 15
-	minRetryDelay                = 5 * time.Second
-	maxRetryDelay                = 600 * time.Second
-	separator                    = "||"
-	negIPPortNetworkEndpointType = "GCE_VM_IP_PORT"
+	maxRetries    = 15
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 600 * time.Second
+	separator     = "||"
 )
 
 // encodeEndpoint encodes ip and instance into a single string
@@ -113,20 +112,41 @@ func getService(serviceLister cache.Indexer, namespace, name string) *apiv1.Serv
 }
 
 // ensureNetworkEndpointGroup ensures corresponding NEG is configured correctly in the specified zone.
-func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negServicePortName string, cloud negtypes.NetworkEndpointGroupCloud, serviceLister cache.Indexer, recorder record.EventRecorder) error {
+// NEGs with custom names are only adopted if their description shows that they were created for
+// the same service port by this cluster. NON_GCP_PRIVATE_IP_PORT NEGs are not in a subnetwork.
+func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negServicePortName string, svcPort int32, negType negtypes.NetworkEndpointType, namer negtypes.NetworkEndpointGroupNamer, cloud negtypes.NetworkEndpointGroupCloud, serviceLister cache.Indexer, recorder record.EventRecorder) error {
 	neg, err := cloud.GetNetworkEndpointGroup(negName, zone)
 	if err != nil {
 		// Most likely to be caused by non-existed NEG
 		klog.V(4).Infof("Error while retriving %q in zone %q: %v", negName, zone, err)
 	}
 
+	negDescription := utils.NegDescription{
+		ClusterUID:  namer.UID(),
+		Namespace:   svcNamespace,
+		ServiceName: svcName,
+		Port:        strconv.Itoa(int(svcPort)),
+	}
+	if neg != nil && !namer.IsNEG(negName) {
+		desc := utils.NegDescriptionFromString(neg.Description)
+		if desc.ClusterUID != negDescription.ClusterUID || desc.Namespace != svcNamespace || desc.ServiceName != svcName || desc.Port != negDescription.Port {
+			return fmt.Errorf("NEG %q in %q was not created for port %d of %s/%s by this cluster, refusing to adopt it", negName, zone, svcPort, svcNamespace, svcName)
+		}
+	}
+
+	subnetworkURL := cloud.SubnetworkURL()
+	if negType == negtypes.NonGCPPrivateEndpointType {
+		subnetworkURL = ""
+	}
+
 	needToCreate := false
 	if neg == nil {
 		needToCreate = true
 	} else if !utils.EqualResourceIDs(neg.Network, cloud.NetworkURL()) ||
-		!utils.EqualResourceIDs(neg.Subnetwork, cloud.SubnetworkURL()) {
+		!utils.EqualResourceIDs(neg.Subnetwork, subnetworkURL) ||
+		neg.NetworkEndpointType != string(negType) {
 		needToCreate = true
-		klog.V(2).Infof("NEG %q in %q does not match network and subnetwork of the cluster. Deleting NEG.", negName, zone)
+		klog.V(2).Infof("NEG %q in %q does not match network, subnetwork and type %q of the cluster. Deleting NEG.", negName, zone, negType)
 		err = cloud.DeleteNetworkEndpointGroup(negName, zone)
 		if err != nil {
 			return err
@@ -143,9 +163,10 @@ func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negService
 		klog.V(2).Infof("Creating NEG %q for %s in %q.", negName, negServicePortName, zone)
 		err = cloud.CreateNetworkEndpointGroup(&compute.NetworkEndpointGroup{
 			Name:                negName,
-			NetworkEndpointType: negIPPortNetworkEndpointType,
+			Description:         negDescription.String(),
+			NetworkEndpointType: string(negType),
 			Network:             cloud.NetworkURL(),
-			Subnetwork:          cloud.SubnetworkURL(),
+			Subnetwork:          subnetworkURL,
 		}, zone)
 		if err != nil {
 			return err
@@ -160,6 +181,25 @@ func ensureNetworkEndpointGroup(svcNamespace, svcName, negName, zone, negService
 	return nil
 }
 
+// endpointAddress is an address of an Endpoints object or an endpoint of an
+// EndpointSlice.
+type endpointAddress struct {
+	ip        string
+	nodeName  *string
+	targetRef *v1.ObjectReference
+	// zone is the zone of the endpoint if known, which saves looking up the
+	// zone of its node.
+	zone  string
+	ready bool
+	// terminating is the terminating condition of the endpoint if known.
+	// Otherwise it is looked up from the pod.
+	terminating *bool
+	// serving is the serving condition of the endpoint if known. Unlike
+	// ready, it stays true while a terminating endpoint passes its
+	// readiness probe.
+	serving *bool
+}
+
 // toZoneNetworkEndpointMap translates addresses in endpoints object and Istio:DestinationRule subset into zone and endpoints map
 func toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, zoneGetter negtypes.ZoneGetter, targetPort string, podLister cache.Indexer, subsetLables string) (map[string]negtypes.NetworkEndpointSet, negtypes.EndpointPodMap, error) {
 	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
@@ -168,24 +208,12 @@ func toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, zoneGetter negtypes.Zo
 		klog.Errorf("Endpoint object is nil")
 		return zoneNetworkEndpointMap, networkEndpointPodMap, nil
 	}
-	targetPortNum, _ := strconv.Atoi(targetPort)
 	for _, subset := range endpoints.Subsets {
 		matchPort := ""
 		// service spec allows target Port to be a named Port.
 		// support both explicit Port and named Port.
 		for _, port := range subset.Ports {
-			if targetPortNum != 0 {
-				// TargetPort is int
-				if int(port.Port) == targetPortNum {
-					matchPort = targetPort
-				}
-			} else {
-				// TargetPort is string
-				if port.Name == targetPort {
-					matchPort = strconv.Itoa(int(port.Port))
-				}
-			}
-			if len(matchPort) > 0 {
+			if matchPort = matchTargetPort(targetPort, port.Name, port.Port); len(matchPort) > 0 {
 				break
 			}
 		}
@@ -195,57 +223,215 @@ func toZoneNetworkEndpointMap(endpoints *apiv1.Endpoints, zoneGetter negtypes.Zo
 			continue
 		}
 
-		// processAddressFunc adds the qualified endpoints from the input list into the endpointSet group by zone
-		processAddressFunc := func(addresses []v1.EndpointAddress, includeAllEndpoints bool) error {
-			for _, address := range addresses {
-				// Apply the selector if Istio:DestinationRule subset labels provided.
-				if subsetLables != "" {
-					if address.TargetRef == nil || address.TargetRef.Kind != "Pod" {
-						klog.V(2).Infof("Endpoint %q in Endpoints %s/%s does not have a Pod as the TargetRef object. Skipping", address.IP, endpoints.Namespace, endpoints.Name)
-						continue
-					}
-					// Skip if the endpoint's pod not matching the subset lables.
-					if !shouldPodBeInDestinationRuleSubset(podLister, address.TargetRef.Namespace, address.TargetRef.Name, subsetLables) {
-						continue
-					}
-				}
-				if address.NodeName == nil {
-					klog.V(2).Infof("Endpoint %q in Endpoints %s/%s does not have an associated node. Skipping", address.IP, endpoints.Namespace, endpoints.Name)
-					continue
-				}
-				if address.TargetRef == nil {
-					klog.V(2).Infof("Endpoint %q in Endpoints %s/%s does not have an associated pod. Skipping", address.IP, endpoints.Namespace, endpoints.Name)
-					continue
-				}
-				zone, err := zoneGetter.GetZoneForNode(*address.NodeName)
-				if err != nil {
-					return fmt.Errorf("failed to retrieve associated zone of node %q: %v", *address.NodeName, err)
-				}
-				if zoneNetworkEndpointMap[zone] == nil {
-					zoneNetworkEndpointMap[zone] = negtypes.NewNetworkEndpointSet()
-				}
+		var addresses []endpointAddress
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, endpointAddress{ip: address.IP, nodeName: address.NodeName, targetRef: address.TargetRef, ready: true})
+		}
+		for _, address := range subset.NotReadyAddresses {
+			addresses = append(addresses, endpointAddress{ip: address.IP, nodeName: address.NodeName, targetRef: address.TargetRef})
+		}
+		source := fmt.Sprintf("Endpoints %s/%s", endpoints.Namespace, endpoints.Name)
+		// Endpoints do not tell whether terminating pods are serving.
+		if err := addEndpointAddresses(zoneNetworkEndpointMap, networkEndpointPodMap, addresses, matchPort, source, zoneGetter, podLister, subsetLables, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	return zoneNetworkEndpointMap, networkEndpointPodMap, nil
+}
 
-				if includeAllEndpoints || shouldPodBeInNeg(podLister, address.TargetRef.Namespace, address.TargetRef.Name) {
-					networkEndpoint := negtypes.NetworkEndpoint{IP: address.IP, Port: matchPort, Node: *address.NodeName}
-					zoneNetworkEndpointMap[zone].Insert(networkEndpoint)
-					networkEndpointPodMap[networkEndpoint] = types.NamespacedName{Namespace: address.TargetRef.Namespace, Name: address.TargetRef.Name}
-				}
+// toZoneNetworkEndpointMapFromSlices translates the endpoints of the
+// EndpointSlices of a service and Istio:DestinationRule subset into zone and
+// endpoints map. Zones are taken from the topology of the endpoints if known.
+// Terminating endpoints which are still serving are only kept if keepServingTerminating is set.
+func toZoneNetworkEndpointMapFromSlices(slices []*negtypes.EndpointSlice, zoneGetter negtypes.ZoneGetter, targetPort string, podLister cache.Indexer, subsetLables string, keepServingTerminating bool) (map[string]negtypes.NetworkEndpointSet, negtypes.EndpointPodMap, error) {
+	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
+	networkEndpointPodMap := negtypes.EndpointPodMap{}
+	for _, slice := range slices {
+		if !slice.IsIP() {
+			klog.V(4).Infof("Skipping EndpointSlice %s/%s with address type %q", slice.Namespace, slice.Name, slice.AddressType)
+			continue
+		}
+		matchPort := ""
+		for _, port := range slice.Ports {
+			if port.Port == nil {
+				continue
 			}
-			return nil
+			name := ""
+			if port.Name != nil {
+				name = *port.Name
+			}
+			if matchPort = matchTargetPort(targetPort, name, *port.Port); len(matchPort) > 0 {
+				break
+			}
+		}
+		if len(matchPort) == 0 {
+			continue
 		}
 
-		if err := processAddressFunc(subset.Addresses, true); err != nil {
-			return nil, nil, err
+		var addresses []endpointAddress
+		for _, endpoint := range slice.Endpoints {
+			// All addresses of an endpoint are fungible, only the first one is used.
+			if len(endpoint.Addresses) == 0 {
+				continue
+			}
+			addresses = append(addresses, endpointAddress{
+				ip:          endpoint.Addresses[0],
+				nodeName:    endpoint.Node(),
+				targetRef:   endpoint.TargetRef,
+				zone:        endpoint.ZoneHint(),
+				ready:       endpoint.IsReady(),
+				terminating: endpoint.Conditions.Terminating,
+				serving:     endpoint.Conditions.Serving,
+			})
 		}
-		if err := processAddressFunc(subset.NotReadyAddresses, false); err != nil {
+		source := fmt.Sprintf("EndpointSlice %s/%s", slice.Namespace, slice.Name)
+		if err := addEndpointAddresses(zoneNetworkEndpointMap, networkEndpointPodMap, addresses, matchPort, source, zoneGetter, podLister, subsetLables, keepServingTerminating); err != nil {
 			return nil, nil, err
 		}
 	}
 	return zoneNetworkEndpointMap, networkEndpointPodMap, nil
 }
 
+// toZoneVmIpNetworkEndpointMap translates the endpoints of a service into zone and endpoints map
+// of its GCE_VM_IP NEGs, whose endpoints are the nodes hosting ready endpoints on any port.
+func toZoneVmIpNetworkEndpointMap(addresses []endpointAddress, zoneGetter negtypes.ZoneGetter) (map[string]negtypes.NetworkEndpointSet, error) {
+	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
+	for _, address := range addresses {
+		if !address.ready || address.nodeName == nil {
+			continue
+		}
+		zone := address.zone
+		if zone == "" {
+			var err error
+			if zone, err = zoneGetter.GetZoneForNode(*address.nodeName); err != nil {
+				return nil, fmt.Errorf("failed to retrieve associated zone of node %q: %v", *address.nodeName, err)
+			}
+		}
+		if zoneNetworkEndpointMap[zone] == nil {
+			zoneNetworkEndpointMap[zone] = negtypes.NewNetworkEndpointSet()
+		}
+		zoneNetworkEndpointMap[zone].Insert(negtypes.NetworkEndpoint{Node: *address.nodeName})
+	}
+	return zoneNetworkEndpointMap, nil
+}
+
+// endpointsAddresses returns the addresses of the Endpoints object for any port.
+func endpointsAddresses(endpoints *apiv1.Endpoints) []endpointAddress {
+	var addresses []endpointAddress
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, endpointAddress{ip: address.IP, nodeName: address.NodeName, targetRef: address.TargetRef, ready: true})
+		}
+		for _, address := range subset.NotReadyAddresses {
+			addresses = append(addresses, endpointAddress{ip: address.IP, nodeName: address.NodeName, targetRef: address.TargetRef})
+		}
+	}
+	return addresses
+}
+
+// endpointSliceAddresses returns the addresses of the IP EndpointSlices for any port.
+func endpointSliceAddresses(slices []*negtypes.EndpointSlice) []endpointAddress {
+	var addresses []endpointAddress
+	for _, slice := range slices {
+		if !slice.IsIP() {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if len(endpoint.Addresses) == 0 {
+				continue
+			}
+			addresses = append(addresses, endpointAddress{
+				ip:          endpoint.Addresses[0],
+				nodeName:    endpoint.Node(),
+				targetRef:   endpoint.TargetRef,
+				zone:        endpoint.ZoneHint(),
+				ready:       endpoint.IsReady(),
+				terminating: endpoint.Conditions.Terminating,
+				serving:     endpoint.Conditions.Serving,
+			})
+		}
+	}
+	return addresses
+}
+
+// matchTargetPort returns the port number to use if the endpoint port with
+// the name and port matches targetPort, or "" otherwise. The target port of
+// a service may be a port number or a named port.
+func matchTargetPort(targetPort, name string, port int32) string {
+	if targetPortNum, _ := strconv.Atoi(targetPort); targetPortNum != 0 {
+		// TargetPort is int
+		if int(port) == targetPortNum {
+			return targetPort
+		}
+		return ""
+	}
+	// TargetPort is string
+	if name == targetPort {
+		return strconv.Itoa(int(port))
+	}
+	return ""
+}
+
+// addEndpointAddresses adds the qualified addresses into the endpointSet group by zone.
+// Addresses are qualified if they are ready or their pod is not terminating, see shouldEndpointBeInNeg.
+func addEndpointAddresses(zoneNetworkEndpointMap map[string]negtypes.NetworkEndpointSet, networkEndpointPodMap negtypes.EndpointPodMap, addresses []endpointAddress, matchPort, source string, zoneGetter negtypes.ZoneGetter, podLister cache.Indexer, subsetLables string, keepServingTerminating bool) error {
+	for _, address := range addresses {
+		// Apply the selector if Istio:DestinationRule subset labels provided.
+		if subsetLables != "" {
+			if address.targetRef == nil || address.targetRef.Kind != "Pod" {
+				klog.V(2).Infof("Endpoint %q in %s does not have a Pod as the TargetRef object. Skipping", address.ip, source)
+				continue
+			}
+			// Skip if the endpoint's pod not matching the subset lables.
+			if !shouldPodBeInDestinationRuleSubset(podLister, address.targetRef.Namespace, address.targetRef.Name, subsetLables) {
+				continue
+			}
+		}
+		if address.nodeName == nil {
+			klog.V(2).Infof("Endpoint %q in %s does not have an associated node. Skipping", address.ip, source)
+			continue
+		}
+		if address.targetRef == nil {
+			klog.V(2).Infof("Endpoint %q in %s does not have an associated pod. Skipping", address.ip, source)
+			continue
+		}
+		zone := address.zone
+		if zone == "" {
+			var err error
+			if zone, err = zoneGetter.GetZoneForNode(*address.nodeName); err != nil {
+				return fmt.Errorf("failed to retrieve associated zone of node %q: %v", *address.nodeName, err)
+			}
+		}
+		if zoneNetworkEndpointMap[zone] == nil {
+			zoneNetworkEndpointMap[zone] = negtypes.NewNetworkEndpointSet()
+		}
+
+		if shouldEndpointBeInNeg(podLister, address, keepServingTerminating) {
+			networkEndpoint := negtypes.NetworkEndpoint{IP: address.ip, Port: matchPort, Node: *address.nodeName}
+			zoneNetworkEndpointMap[zone].Insert(networkEndpoint)
+			networkEndpointPodMap[networkEndpoint] = types.NamespacedName{Namespace: address.targetRef.Namespace, Name: address.targetRef.Name}
+		}
+	}
+	return nil
+}
+
+// shouldEndpointBeInNeg returns true if the endpoint is ready, or its pod is
+// not in graceful termination state. Terminating endpoints are detached, so that
+// the load balancer stops sending them new connections and they are drained.
+// Only if keepServingTerminating is set, which is when pods are not marked as
+// drained, a terminating endpoint is kept as long as it is known to be serving.
+func shouldEndpointBeInNeg(podLister cache.Indexer, address endpointAddress, keepServingTerminating bool) bool {
+	if address.terminating != nil && *address.terminating {
+		return keepServingTerminating && address.serving != nil && *address.serving
+	}
+	if address.ready || address.terminating != nil {
+		return true
+	}
+	return shouldPodBeInNeg(podLister, address.targetRef.Namespace, address.targetRef.Name)
+}
+
 // retrieveExistingZoneNetworkEndpointMap lists existing network endpoints in the neg and return the zone and endpoints map
-func retrieveExistingZoneNetworkEndpointMap(negName string, zoneGetter negtypes.ZoneGetter, cloud negtypes.NetworkEndpointGroupCloud) (map[string]negtypes.NetworkEndpointSet, error) {
+func retrieveExistingZoneNetworkEndpointMap(negName string, negType negtypes.NetworkEndpointType, zoneGetter negtypes.ZoneGetter, cloud negtypes.NetworkEndpointGroupCloud) (map[string]negtypes.NetworkEndpointSet, error) {
 	zones, err := zoneGetter.ListZones()
 	if err != nil {
 		return nil, err
@@ -253,18 +439,61 @@ func retrieveExistingZoneNetworkEndpointMap(negName string, zoneGetter negtypes.
 
 	zoneNetworkEndpointMap := map[string]negtypes.NetworkEndpointSet{}
 	for _, zone := range zones {
-		zoneNetworkEndpointMap[zone] = negtypes.NewNetworkEndpointSet()
-		networkEndpointsWithHealthStatus, err := cloud.ListNetworkEndpoints(negName, zone, false)
+		zoneNetworkEndpointMap[zone], err = retrieveExistingNetworkEndpoints(negName, negType, zone, cloud)
 		if err != nil {
 			return nil, err
 		}
-		for _, ne := range networkEndpointsWithHealthStatus {
-			zoneNetworkEndpointMap[zone].Insert(negtypes.NetworkEndpoint{IP: ne.NetworkEndpoint.IpAddress, Node: ne.NetworkEndpoint.Instance, Port: strconv.FormatInt(ne.NetworkEndpoint.Port, 10)})
-		}
 	}
 	return zoneNetworkEndpointMap, nil
 }
 
+// retrieveExistingNetworkEndpoints lists existing network endpoints in the neg in the zone.
+// The endpoints of GCE_VM_IP NEGs are only identified by their instance.
+func retrieveExistingNetworkEndpoints(negName string, negType negtypes.NetworkEndpointType, zone string, cloud negtypes.NetworkEndpointGroupCloud) (negtypes.NetworkEndpointSet, error) {
+	networkEndpointsWithHealthStatus, err := cloud.ListNetworkEndpoints(negName, zone, false)
+	if err != nil {
+		return nil, err
+	}
+	endpointSet := negtypes.NewNetworkEndpointSet()
+	for _, ne := range networkEndpointsWithHealthStatus {
+		if negType == negtypes.VmIpEndpointType {
+			endpointSet.Insert(negtypes.NetworkEndpoint{Node: ne.NetworkEndpoint.Instance})
+			continue
+		}
+		endpointSet.Insert(negtypes.NetworkEndpoint{IP: ne.NetworkEndpoint.IpAddress, Node: ne.NetworkEndpoint.Instance, Port: strconv.FormatInt(ne.NetworkEndpoint.Port, 10)})
+	}
+	return endpointSet, nil
+}
+
+// eventualZoneNetworkEndpointMap returns the endpoints by zone once the endpoints are added and removed
+func eventualZoneNetworkEndpointMap(currentMap, addEndpoints, removeEndpoints map[string]negtypes.NetworkEndpointSet) map[string]negtypes.NetworkEndpointSet {
+	result := map[string]negtypes.NetworkEndpointSet{}
+	for zone, endpointSet := range currentMap {
+		result[zone] = negtypes.NewNetworkEndpointSet().Union(endpointSet)
+	}
+	for zone, endpointSet := range addEndpoints {
+		if _, ok := result[zone]; !ok {
+			result[zone] = negtypes.NewNetworkEndpointSet()
+		}
+		result[zone].Insert(endpointSet.List()...)
+	}
+	for zone, endpointSet := range removeEndpoints {
+		if _, ok := result[zone]; ok {
+			result[zone].Delete(endpointSet.List()...)
+		}
+	}
+	return result
+}
+
+// networkEndpointCounts returns the number of endpoints in each zone.
+func networkEndpointCounts(zoneNetworkEndpointMap map[string]negtypes.NetworkEndpointSet) map[string]int {
+	counts := make(map[string]int, len(zoneNetworkEndpointMap))
+	for zone, endpointSet := range zoneNetworkEndpointMap {
+		counts[zone] = endpointSet.Len()
+	}
+	return counts
+}
+
 // makeEndpointBatch return a batch of endpoint from the input and remove the endpoints from input set
 // The return map has the encoded endpoint as key and GCE network endpoint object as value
 func makeEndpointBatch(endpoints negtypes.NetworkEndpointSet) (map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint, error) {
@@ -276,9 +505,13 @@ func makeEndpointBatch(endpoints negtypes.NetworkEndpointSet) (map[negtypes.Netw
 			break
 		}
 
-		portNum, err := strconv.Atoi(networkEndpoint.Port)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode endpoint port %v: %v", networkEndpoint, err)
+		// Endpoints of GCE_VM_IP NEGs do not have a port.
+		portNum := 0
+		if networkEndpoint.Port != "" {
+			var err error
+			if portNum, err = strconv.Atoi(networkEndpoint.Port); err != nil {
+				return nil, fmt.Errorf("failed to decode endpoint port %v: %v", networkEndpoint, err)
+			}
 		}
 
 		endpointBatch[networkEndpoint] = &compute.NetworkEndpoint{
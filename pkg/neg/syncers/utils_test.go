@@ -28,7 +28,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
 	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+	"k8s.io/ingress-gce/pkg/utils"
 	"k8s.io/legacy-cloud-providers/gce"
 )
 
@@ -533,7 +535,7 @@ func TestRetrieveExistingZoneNetworkEndpointMap(t *testing.T) {
 
 	for _, tc := range testCases {
 		tc.mutate(negCloud)
-		out, err := retrieveExistingZoneNetworkEndpointMap(negName, zoneGetter, negCloud)
+		out, err := retrieveExistingZoneNetworkEndpointMap(negName, negtypes.VmIpPortEndpointType, zoneGetter, negCloud)
 
 		if tc.expectErr {
 			if err == nil {
@@ -700,6 +702,49 @@ func TestShouldPodBeInNeg(t *testing.T) {
 
 }
 
+func TestShouldEndpointBeInNeg(t *testing.T) {
+	t.Parallel()
+
+	_, transactionSyncer := newTestTransactionSyncer(negtypes.NewAdapter(gce.NewFakeGCECloud(gce.DefaultTestClusterValues())))
+	podLister := transactionSyncer.podLister
+	podLister.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "running"}})
+	podLister.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "deleted", DeletionTimestamp: &metav1.Time{}}})
+	boolPtr := func(b bool) *bool { return &b }
+
+	for _, tc := range []struct {
+		desc        string
+		pod         string
+		ready       bool
+		serving     *bool
+		terminating *bool
+		keepServing bool
+		want        bool
+	}{
+		{desc: "ready", pod: "deleted", ready: true, want: true},
+		{desc: "ready and serving", pod: "deleted", ready: true, serving: boolPtr(true), terminating: boolPtr(false), want: true},
+		{desc: "not ready and not terminating", pod: "deleted", serving: boolPtr(false), terminating: boolPtr(false), want: true},
+		{desc: "terminating and serving while pods are drained", pod: "deleted", serving: boolPtr(true), terminating: boolPtr(true), want: false},
+		{desc: "ready, terminating and serving while pods are drained", pod: "deleted", ready: true, serving: boolPtr(true), terminating: boolPtr(true), want: false},
+		{desc: "terminating and serving while pods are not drained", pod: "deleted", serving: boolPtr(true), terminating: boolPtr(true), keepServing: true, want: true},
+		{desc: "terminating and not serving", pod: "running", serving: boolPtr(false), terminating: boolPtr(true), keepServing: true, want: false},
+		{desc: "terminating with unknown serving", pod: "running", terminating: boolPtr(true), keepServing: true, want: false},
+		{desc: "unknown conditions of a running pod", pod: "running", want: true},
+		{desc: "unknown conditions of a deleted pod", pod: "deleted", want: false},
+		{desc: "unknown conditions of a missing pod", pod: "missing", want: false},
+	} {
+		address := endpointAddress{
+			ip:          "10.100.1.1",
+			targetRef:   &v1.ObjectReference{Kind: "Pod", Namespace: testNamespace, Name: tc.pod},
+			ready:       tc.ready,
+			serving:     tc.serving,
+			terminating: tc.terminating,
+		}
+		if got := shouldEndpointBeInNeg(podLister, address, tc.keepServing); got != tc.want {
+			t.Errorf("%s: shouldEndpointBeInNeg() = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
 func genTestEndpoints(num int) (negtypes.NetworkEndpointSet, map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint) {
 	endpointSet := negtypes.NewNetworkEndpointSet()
 	endpointMap := map[negtypes.NetworkEndpoint]*compute.NetworkEndpoint{}
@@ -721,3 +766,163 @@ func networkEndpointFromEncodedEndpoint(encodedEndpoint string) negtypes.Network
 	ip, node, port := decodeEndpoint(encodedEndpoint)
 	return negtypes.NetworkEndpoint{IP: ip, Node: node, Port: port}
 }
+
+func TestToZoneNetworkEndpointMapFromSlices(t *testing.T) {
+	t.Parallel()
+	podLister := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := 1; i <= 4; i++ {
+		podLister.Add(&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testServiceNamespace,
+				Name:      fmt.Sprintf("pod%v", i),
+			},
+		})
+	}
+	// pod4 is deleted
+	podLister.Update(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         testServiceNamespace,
+			Name:              "pod4",
+			DeletionTimestamp: &metav1.Time{},
+		},
+	})
+
+	boolPtr := func(b bool) *bool { return &b }
+	stringPtr := func(s string) *string { return &s }
+	int32Ptr := func(i int32) *int32 { return &i }
+	podRef := func(name string) *v1.ObjectReference {
+		return &v1.ObjectReference{Kind: "Pod", Namespace: testServiceNamespace, Name: name}
+	}
+	slices := []*negtypes.EndpointSlice{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: "slice1"},
+			Ports:      []negtypes.EndpointSlicePort{{Name: stringPtr("http"), Port: int32Ptr(80)}},
+			Endpoints: []negtypes.EndpointSliceEndpoint{
+				// The zone hint is used instead of the zone of the node.
+				{Addresses: []string{"10.100.1.1"}, NodeName: stringPtr(negtypes.TestInstance1), TargetRef: podRef("pod1"), Topology: map[string]string{"topology.kubernetes.io/zone": negtypes.TestZone2}},
+				{Addresses: []string{"10.100.1.2"}, Conditions: negtypes.EndpointConditions{Ready: boolPtr(false), Terminating: boolPtr(false)}, TargetRef: podRef("pod2"), Topology: map[string]string{"kubernetes.io/hostname": negtypes.TestInstance2}},
+				{Addresses: []string{"10.100.3.1"}, Conditions: negtypes.EndpointConditions{Ready: boolPtr(false), Terminating: boolPtr(true)}, NodeName: stringPtr(negtypes.TestInstance3), TargetRef: podRef("pod3")},
+				{Addresses: []string{"10.100.3.2"}, Conditions: negtypes.EndpointConditions{Ready: boolPtr(false)}, NodeName: stringPtr(negtypes.TestInstance3), TargetRef: podRef("pod4")},
+				{Addresses: []string{"10.100.3.3"}, TargetRef: podRef("pod5")},
+				// Terminating endpoints are kept while they are serving, unless pods are drained.
+				{Addresses: []string{"10.100.1.3"}, Conditions: negtypes.EndpointConditions{Ready: boolPtr(false), Serving: boolPtr(true), Terminating: boolPtr(true)}, NodeName: stringPtr(negtypes.TestInstance2), TargetRef: podRef("pod6")},
+			},
+		},
+		{
+			ObjectMeta:  metav1.ObjectMeta{Namespace: testServiceNamespace, Name: "slice2"},
+			AddressType: "FQDN",
+			Ports:       []negtypes.EndpointSlicePort{{Name: stringPtr("http"), Port: int32Ptr(80)}},
+			Endpoints:   []negtypes.EndpointSliceEndpoint{{Addresses: []string{"example.com"}, NodeName: stringPtr(negtypes.TestInstance1), TargetRef: podRef("pod1")}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testServiceNamespace, Name: "slice3"},
+			Ports:      []negtypes.EndpointSlicePort{{Name: stringPtr("metrics"), Port: int32Ptr(8080)}},
+			Endpoints:  []negtypes.EndpointSliceEndpoint{{Addresses: []string{"10.100.4.1"}, NodeName: stringPtr(negtypes.TestInstance1), TargetRef: podRef("pod1")}},
+		},
+	}
+
+	endpointSets, endpointPodMap, err := toZoneNetworkEndpointMapFromSlices(slices, negtypes.NewFakeZoneGetter(), "http", podLister, "", true)
+	if err != nil {
+		t.Fatalf("toZoneNetworkEndpointMapFromSlices() = %v", err)
+	}
+	expectSets := map[string]negtypes.NetworkEndpointSet{
+		negtypes.TestZone1: negtypes.NewNetworkEndpointSet(
+			networkEndpointFromEncodedEndpoint("10.100.1.2||instance2||80"),
+			networkEndpointFromEncodedEndpoint("10.100.1.3||instance2||80")),
+		negtypes.TestZone2: negtypes.NewNetworkEndpointSet(networkEndpointFromEncodedEndpoint("10.100.1.1||instance1||80")),
+	}
+	if !reflect.DeepEqual(endpointSets, expectSets) {
+		t.Errorf("got endpoint sets %v, want %v", endpointSets, expectSets)
+	}
+	expectMap := negtypes.EndpointPodMap{
+		networkEndpointFromEncodedEndpoint("10.100.1.1||instance1||80"): types.NamespacedName{Namespace: testServiceNamespace, Name: "pod1"},
+		networkEndpointFromEncodedEndpoint("10.100.1.2||instance2||80"): types.NamespacedName{Namespace: testServiceNamespace, Name: "pod2"},
+		networkEndpointFromEncodedEndpoint("10.100.1.3||instance2||80"): types.NamespacedName{Namespace: testServiceNamespace, Name: "pod6"},
+	}
+	if !reflect.DeepEqual(endpointPodMap, expectMap) {
+		t.Errorf("got endpoint pod map %v, want %v", endpointPodMap, expectMap)
+	}
+
+	// The serving terminating endpoint is detached if pods are drained.
+	endpointSets, endpointPodMap, err = toZoneNetworkEndpointMapFromSlices(slices, negtypes.NewFakeZoneGetter(), "http", podLister, "", false)
+	if err != nil {
+		t.Fatalf("toZoneNetworkEndpointMapFromSlices() = %v", err)
+	}
+	expectSets[negtypes.TestZone1].Delete(networkEndpointFromEncodedEndpoint("10.100.1.3||instance2||80"))
+	delete(expectMap, networkEndpointFromEncodedEndpoint("10.100.1.3||instance2||80"))
+	if !reflect.DeepEqual(endpointSets, expectSets) {
+		t.Errorf("got endpoint sets %v, want %v", endpointSets, expectSets)
+	}
+	if !reflect.DeepEqual(endpointPodMap, expectMap) {
+		t.Errorf("got endpoint pod map %v, want %v", endpointPodMap, expectMap)
+	}
+}
+
+func TestEnsureNetworkEndpointGroupCustomName(t *testing.T) {
+	t.Parallel()
+	namer := utils.NewNamer(clusterID, "")
+	ownedDescription := utils.NegDescription{ClusterUID: namer.UID(), Namespace: testServiceNamespace, ServiceName: testServiceName, Port: "80"}
+	for _, tc := range []struct {
+		desc        string
+		negName     string
+		existingNeg *compute.NetworkEndpointGroup
+		expectErr   bool
+	}{
+		{
+			desc:    "NEG with custom name is created with its description",
+			negName: "custom-neg",
+		},
+		{
+			desc:        "NEG with custom name created by this cluster for the service is adopted",
+			negName:     "custom-neg",
+			existingNeg: &compute.NetworkEndpointGroup{Name: "custom-neg", Description: ownedDescription.String()},
+		},
+		{
+			desc:        "NEG with custom name created by another cluster is not adopted",
+			negName:     "custom-neg",
+			existingNeg: &compute.NetworkEndpointGroup{Name: "custom-neg", Description: utils.NegDescription{ClusterUID: "other", Namespace: testServiceNamespace, ServiceName: testServiceName, Port: "80"}.String()},
+			expectErr:   true,
+		},
+		{
+			desc:        "NEG with custom name created for another service is not adopted",
+			negName:     "custom-neg",
+			existingNeg: &compute.NetworkEndpointGroup{Name: "custom-neg", Description: utils.NegDescription{ClusterUID: namer.UID(), Namespace: testServiceNamespace, ServiceName: "other", Port: "80"}.String()},
+			expectErr:   true,
+		},
+		{
+			desc:        "NEG with custom name created for another port of the service is not adopted",
+			negName:     "custom-neg",
+			existingNeg: &compute.NetworkEndpointGroup{Name: "custom-neg", Description: utils.NegDescription{ClusterUID: namer.UID(), Namespace: testServiceNamespace, ServiceName: testServiceName, Port: "443"}.String()},
+			expectErr:   true,
+		},
+		{
+			desc:        "NEG with custom name without description is not adopted",
+			negName:     "custom-neg",
+			existingNeg: &compute.NetworkEndpointGroup{Name: "custom-neg"},
+			expectErr:   true,
+		},
+		{
+			desc:        "NEG with generated name is adopted",
+			negName:     namer.NEG(testServiceNamespace, testServiceName, 80),
+			existingNeg: &compute.NetworkEndpointGroup{Name: namer.NEG(testServiceNamespace, testServiceName, 80)},
+		},
+	} {
+		cloud := negtypes.NewFakeNetworkEndpointGroupCloud("test-subnetwork", "test-network")
+		if tc.existingNeg != nil {
+			tc.existingNeg.Network = cloud.NetworkURL()
+			tc.existingNeg.Subnetwork = cloud.SubnetworkURL()
+			cloud.CreateNetworkEndpointGroup(tc.existingNeg, negtypes.TestZone1)
+		}
+		err := ensureNetworkEndpointGroup(testServiceNamespace, testServiceName, tc.negName, negtypes.TestZone1, "", 80, negtypes.VmIpPortEndpointType, namer, cloud, nil, nil)
+		if tc.expectErr != (err != nil) {
+			t.Errorf("For case %q, expect error to be %v, but got %v", tc.desc, tc.expectErr, err)
+		}
+		neg, err := cloud.GetNetworkEndpointGroup(tc.negName, negtypes.TestZone1)
+		if err != nil {
+			t.Fatalf("For case %q, expect NEG to exist, but got %v", tc.desc, err)
+		}
+		if tc.existingNeg == nil && neg.Description != ownedDescription.String() {
+			t.Errorf("For case %q, expect NEG description to be %q, but got %q", tc.desc, ownedDescription.String(), neg.Description)
+		}
+	}
+}
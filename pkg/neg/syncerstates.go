@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// SyncerStatesHandler serves the internal states of the NEG syncers of a syncer
+// manager. The handler is registered before the NEG controller is created, which
+// sets the manager.
+type SyncerStatesHandler struct {
+	lock    sync.Mutex
+	manager negtypes.NegSyncerManager
+}
+
+// NewSyncerStatesHandler returns a SyncerStatesHandler without manager.
+func NewSyncerStatesHandler() *SyncerStatesHandler {
+	return &SyncerStatesHandler{}
+}
+
+// SetManager sets the syncer manager whose syncer states are served.
+func (h *SyncerStatesHandler) SetManager(manager negtypes.NegSyncerManager) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.manager = manager
+}
+
+// ServeHTTP writes the syncer states as JSON.
+func (h *SyncerStatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	manager := h.manager
+	h.lock.Unlock()
+	if manager == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("NEG controller is not running"))
+		return
+	}
+	b, err := json.MarshalIndent(manager.SyncerStates(), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
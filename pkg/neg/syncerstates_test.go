@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package neg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+	negtypes "k8s.io/ingress-gce/pkg/neg/types"
+)
+
+// fakeStateSyncer is a syncer with a fixed state.
+type fakeStateSyncer struct {
+	negtypes.NegSyncer
+	state negtypes.NegSyncerState
+}
+
+func (s *fakeStateSyncer) State() negtypes.NegSyncerState { return s.state }
+
+func TestSyncerStatesHandlerServeHTTP(t *testing.T) {
+	h := NewSyncerStatesHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/neg-syncers", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeHTTP() without manager = %v, want %v", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	manager := NewTestSyncerManager(fake.NewSimpleClientset())
+	key1 := negtypes.NegSyncerKey{Namespace: "ns", Name: "svc1", Port: 80, TargetPort: "8080"}
+	key2 := negtypes.NegSyncerKey{Namespace: "ns", Name: "svc2", Port: 80, TargetPort: "8080"}
+	state1 := negtypes.NegSyncerState{Key: key1, SyncerType: "Transaction", NegName: "neg1", Zones: []string{negtypes.TestZone1}, EndpointCounts: map[string]int{negtypes.TestZone1: 3}}
+	state2 := negtypes.NegSyncerState{Key: key2, SyncerType: "Transaction", NegName: "neg2", LastSyncError: "sync failed"}
+	manager.syncerMap[key2] = &fakeStateSyncer{state: state2}
+	manager.syncerMap[key1] = &fakeStateSyncer{state: state1}
+	h.SetManager(manager)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/neg-syncers", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() = %v, want %v", rec.Code, http.StatusOK)
+	}
+	var states []negtypes.NegSyncerState
+	if err := json.Unmarshal(rec.Body.Bytes(), &states); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if expectStates := []negtypes.NegSyncerState{state1, state2}; !reflect.DeepEqual(states, expectStates) {
+		t.Errorf("ServeHTTP() states = %+v, want %+v", states, expectStates)
+	}
+}
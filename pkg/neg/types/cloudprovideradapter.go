@@ -23,6 +23,7 @@ import (
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"google.golang.org/api/compute/v1"
+	"k8s.io/ingress-gce/pkg/ratelimit"
 	"k8s.io/klog"
 	"k8s.io/legacy-cloud-providers/gce"
 )
@@ -32,6 +33,8 @@ const (
 	aggregatedListZonalKeyPrefix = "zones"
 	// aggregatedListGlobalKey is the global key from AggregatedList
 	aggregatedListGlobalKey = "global"
+	// negService is the service of the rate limit keys of NEG calls.
+	negService = "NetworkEndpointGroups"
 )
 
 // NewAdapter takes a Cloud and returns a NetworkEndpointGroupCloud.
@@ -40,6 +43,7 @@ func NewAdapter(g *gce.Cloud) NetworkEndpointGroupCloud {
 		c:             g.Compute(),
 		networkURL:    g.NetworkURL(),
 		subnetworkURL: g.SubnetworkURL(),
+		region:        g.Region(),
 	}
 }
 
@@ -49,6 +53,7 @@ type cloudProviderAdapter struct {
 	c             cloud.Cloud
 	networkURL    string
 	subnetworkURL string
+	region        string
 }
 
 // GetNetworkEndpointGroup inmplements NetworkEndpointGroupCloud.
@@ -56,7 +61,8 @@ func (a *cloudProviderAdapter) GetNetworkEndpointGroup(name string, zone string)
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
-	return a.c.NetworkEndpointGroups().Get(ctx, meta.ZonalKey(name, zone))
+	neg, err := a.c.NetworkEndpointGroups().Get(ctx, meta.ZonalKey(name, zone))
+	return neg, observe("Get", err)
 }
 
 // ListNetworkEndpointGroup implements NetworkEndpointGroupCloud.
@@ -64,7 +70,8 @@ func (a *cloudProviderAdapter) ListNetworkEndpointGroup(zone string) ([]*compute
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
-	return a.c.NetworkEndpointGroups().List(ctx, zone, filter.None)
+	negs, err := a.c.NetworkEndpointGroups().List(ctx, zone, filter.None)
+	return negs, observe("List", err)
 }
 
 // AggregatedListNetworkEndpointGroup returns a map of zone -> endpoint group.
@@ -74,7 +81,7 @@ func (a *cloudProviderAdapter) AggregatedListNetworkEndpointGroup() (map[string]
 
 	// TODO: filter for the region the cluster is in.
 	all, err := a.c.NetworkEndpointGroups().AggregatedList(ctx, filter.None)
-	if err != nil {
+	if err := observe("AggregatedList", err); err != nil {
 		return nil, err
 	}
 	ret := map[string][]*compute.NetworkEndpointGroup{}
@@ -104,7 +111,7 @@ func (a *cloudProviderAdapter) CreateNetworkEndpointGroup(neg *compute.NetworkEn
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
-	return a.c.NetworkEndpointGroups().Insert(ctx, meta.ZonalKey(neg.Name, zone), neg)
+	return observe("Insert", a.c.NetworkEndpointGroups().Insert(ctx, meta.ZonalKey(neg.Name, zone), neg))
 }
 
 // DeleteNetworkEndpointGroup implements NetworkEndpointGroupCloud.
@@ -112,7 +119,7 @@ func (a *cloudProviderAdapter) DeleteNetworkEndpointGroup(name string, zone stri
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
-	return a.c.NetworkEndpointGroups().Delete(ctx, meta.ZonalKey(name, zone))
+	return observe("Delete", a.c.NetworkEndpointGroups().Delete(ctx, meta.ZonalKey(name, zone)))
 }
 
 // AttachNetworkEndpoints implements NetworkEndpointGroupCloud.
@@ -121,7 +128,7 @@ func (a cloudProviderAdapter) AttachNetworkEndpoints(name, zone string, endpoint
 	defer cancel()
 
 	req := &compute.NetworkEndpointGroupsAttachEndpointsRequest{NetworkEndpoints: endpoints}
-	return a.c.NetworkEndpointGroups().AttachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req)
+	return observe("AttachNetworkEndpoints", a.c.NetworkEndpointGroups().AttachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req))
 }
 
 // DetachNetworkEndpoints implements NetworkEndpointGroupCloud.
@@ -130,7 +137,7 @@ func (a *cloudProviderAdapter) DetachNetworkEndpoints(name, zone string, endpoin
 	defer cancel()
 
 	req := &compute.NetworkEndpointGroupsDetachEndpointsRequest{NetworkEndpoints: endpoints}
-	return a.c.NetworkEndpointGroups().DetachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req)
+	return observe("DetachNetworkEndpoints", a.c.NetworkEndpointGroups().DetachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req))
 }
 
 // ListNetworkEndpoints implements NetworkEndpointGroupCloud.
@@ -143,7 +150,24 @@ func (a *cloudProviderAdapter) ListNetworkEndpoints(name, zone string, showHealt
 		healthStatus = "SHOW"
 	}
 	req := &compute.NetworkEndpointGroupsListEndpointsRequest{HealthStatus: healthStatus}
-	return a.c.NetworkEndpointGroups().ListNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req, filter.None)
+	endpoints, err := a.c.NetworkEndpointGroups().ListNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req, filter.None)
+	return endpoints, observe("ListNetworkEndpoints", err)
+}
+
+// ListBackendServices implements NetworkEndpointGroupCloud.
+func (a *cloudProviderAdapter) ListBackendServices() ([]*compute.BackendService, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	global, err := a.c.BackendServices().List(ctx, filter.None)
+	if err != nil {
+		return nil, err
+	}
+	regional, err := a.c.RegionBackendServices().List(ctx, a.region, filter.None)
+	if err != nil {
+		return nil, err
+	}
+	return append(global, regional...), nil
 }
 
 // NetworkURL implements NetworkEndpointGroupCloud.
@@ -155,3 +179,8 @@ func (a *cloudProviderAdapter) NetworkURL() string {
 func (a *cloudProviderAdapter) SubnetworkURL() string {
 	return a.subnetworkURL
 }
+
+// observe reports the result of a NEG call to the rate limiter.
+func observe(operation string, err error) error {
+	return ratelimit.Observe(&cloud.RateLimitKey{Operation: operation, Version: meta.VersionGA, Service: negService}, err)
+}
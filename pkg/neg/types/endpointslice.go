@@ -0,0 +1,173 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// EndpointSliceServiceNameLabel is the label of an EndpointSlice with the
+	// name of its Service.
+	EndpointSliceServiceNameLabel = "kubernetes.io/service-name"
+	// EndpointSliceByServiceIndex is the name of the index of EndpointSlices
+	// by the key of their Service.
+	EndpointSliceByServiceIndex = "endpointSliceByService"
+
+	// Topology keys of EndpointSlice endpoints.
+	endpointSliceHostnameKey   = "kubernetes.io/hostname"
+	endpointSliceZoneKey       = "topology.kubernetes.io/zone"
+	endpointSliceZoneBetaKey   = "failure-domain.beta.kubernetes.io/zone"
+	endpointSliceAddressTypeIP = "IPv4"
+)
+
+// EndpointSliceGVR is the resource of the EndpointSlices read by the NEG
+// controller. The vendored client-go predates EndpointSlices, so they are
+// read through the dynamic client and converted to the types below.
+var EndpointSliceGVR = schema.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1beta1", Resource: "endpointslices"}
+
+// EndpointSlice is the subset of discovery.k8s.io EndpointSlice used by the
+// NEG syncers.
+type EndpointSlice struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	AddressType       string                  `json:"addressType"`
+	Endpoints         []EndpointSliceEndpoint `json:"endpoints"`
+	Ports             []EndpointSlicePort     `json:"ports"`
+}
+
+// EndpointSliceEndpoint is an endpoint of an EndpointSlice.
+type EndpointSliceEndpoint struct {
+	Addresses  []string               `json:"addresses"`
+	Conditions EndpointConditions     `json:"conditions"`
+	TargetRef  *apiv1.ObjectReference `json:"targetRef,omitempty"`
+	Topology   map[string]string      `json:"topology,omitempty"`
+	NodeName   *string                `json:"nodeName,omitempty"`
+	Zone       *string                `json:"zone,omitempty"`
+}
+
+// EndpointConditions are the conditions of an EndpointSlice endpoint. A nil
+// condition is unknown.
+type EndpointConditions struct {
+	Ready       *bool `json:"ready,omitempty"`
+	Serving     *bool `json:"serving,omitempty"`
+	Terminating *bool `json:"terminating,omitempty"`
+}
+
+// EndpointSlicePort is a port of an EndpointSlice.
+type EndpointSlicePort struct {
+	Name     *string         `json:"name,omitempty"`
+	Protocol *apiv1.Protocol `json:"protocol,omitempty"`
+	Port     *int32          `json:"port,omitempty"`
+}
+
+// IsIP returns true if the addresses of the EndpointSlice are IPv4 addresses.
+func (s *EndpointSlice) IsIP() bool {
+	return s.AddressType == "" || s.AddressType == endpointSliceAddressTypeIP
+}
+
+// IsReady returns true if the endpoint is ready. Unknown readiness is
+// interpreted as ready.
+func (e *EndpointSliceEndpoint) IsReady() bool {
+	return e.Conditions.Ready == nil || *e.Conditions.Ready
+}
+
+// Node returns the name of the node of the endpoint, or nil if unknown.
+func (e *EndpointSliceEndpoint) Node() *string {
+	if e.NodeName != nil {
+		return e.NodeName
+	}
+	if hostname, ok := e.Topology[endpointSliceHostnameKey]; ok {
+		return &hostname
+	}
+	return nil
+}
+
+// ZoneHint returns the zone of the endpoint, or "" if unknown.
+func (e *EndpointSliceEndpoint) ZoneHint() string {
+	if e.Zone != nil {
+		return *e.Zone
+	}
+	if zone, ok := e.Topology[endpointSliceZoneKey]; ok {
+		return zone
+	}
+	return e.Topology[endpointSliceZoneBetaKey]
+}
+
+// ToEndpointSlice converts an object of the EndpointSlice informer.
+func ToEndpointSlice(obj interface{}) (*EndpointSlice, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected EndpointSlice object of type %T", obj)
+	}
+	slice := &EndpointSlice{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), slice); err != nil {
+		return nil, fmt.Errorf("failed to convert EndpointSlice %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+	}
+	return slice, nil
+}
+
+// EndpointSliceServiceKey returns the key of the Service of an EndpointSlice,
+// or "" if it does not belong to a Service.
+func EndpointSliceServiceKey(obj metav1.Object) string {
+	name := obj.GetLabels()[EndpointSliceServiceNameLabel]
+	if name == "" {
+		return ""
+	}
+	return obj.GetNamespace() + "/" + name
+}
+
+// EndpointSliceByServiceIndexFunc indexes EndpointSlices by the key of their
+// Service.
+func EndpointSliceByServiceIndexFunc(obj interface{}) ([]string, error) {
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if key := EndpointSliceServiceKey(o); key != "" {
+		return []string{key}, nil
+	}
+	return []string{}, nil
+}
+
+// ListEndpointSlices returns the EndpointSlices of a Service from an indexer
+// with EndpointSliceByServiceIndex.
+func ListEndpointSlices(indexer cache.Indexer, namespace, name string) ([]*EndpointSlice, error) {
+	objs, err := indexer.ByIndex(EndpointSliceByServiceIndex, namespace+"/"+name)
+	if err != nil {
+		return nil, err
+	}
+	var slices []*EndpointSlice
+	for _, obj := range objs {
+		slice, err := ToEndpointSlice(obj)
+		if err != nil {
+			return nil, err
+		}
+		slices = append(slices, slice)
+	}
+	return slices, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestListEndpointSlices(t *testing.T) {
+	newSlice := func(name, service string) *unstructured.Unstructured {
+		slice := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion":  "discovery.k8s.io/v1beta1",
+			"kind":        "EndpointSlice",
+			"addressType": "IPv4",
+			"metadata": map[string]interface{}{
+				"namespace": "ns",
+				"name":      name,
+			},
+			"ports": []interface{}{
+				map[string]interface{}{"name": "http", "port": int64(8080), "protocol": "TCP"},
+			},
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"addresses":  []interface{}{"10.0.0.1"},
+					"conditions": map[string]interface{}{"ready": false, "terminating": true},
+					"targetRef":  map[string]interface{}{"kind": "Pod", "namespace": "ns", "name": "pod1"},
+					"topology": map[string]interface{}{
+						"kubernetes.io/hostname":      "node1",
+						"topology.kubernetes.io/zone": "zone1",
+					},
+				},
+			},
+		}}
+		if service != "" {
+			slice.SetLabels(map[string]string{EndpointSliceServiceNameLabel: service})
+		}
+		return slice
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{EndpointSliceByServiceIndex: EndpointSliceByServiceIndexFunc})
+	indexer.Add(newSlice("svc1-abc", "svc1"))
+	indexer.Add(newSlice("svc2-abc", "svc2"))
+	indexer.Add(newSlice("other", ""))
+
+	slices, err := ListEndpointSlices(indexer, "ns", "svc1")
+	if err != nil {
+		t.Fatalf("ListEndpointSlices() = %v", err)
+	}
+	if len(slices) != 1 || slices[0].Name != "svc1-abc" {
+		t.Fatalf("ListEndpointSlices() = %v, want slice svc1-abc", slices)
+	}
+	slice := slices[0]
+	if !slice.IsIP() || len(slice.Ports) != 1 || *slice.Ports[0].Name != "http" || *slice.Ports[0].Port != 8080 {
+		t.Errorf("got slice %+v, want an IPv4 slice with port http:8080", slice)
+	}
+	if len(slice.Endpoints) != 1 {
+		t.Fatalf("got endpoints %+v, want 1 endpoint", slice.Endpoints)
+	}
+	endpoint := slice.Endpoints[0]
+	if endpoint.IsReady() || endpoint.Conditions.Terminating == nil || !*endpoint.Conditions.Terminating {
+		t.Errorf("got conditions %+v, want not ready and terminating", endpoint.Conditions)
+	}
+	if node := endpoint.Node(); node == nil || *node != "node1" {
+		t.Errorf("Node() = %v, want node1", node)
+	}
+	if zone := endpoint.ZoneHint(); zone != "zone1" {
+		t.Errorf("ZoneHint() = %q, want zone1", zone)
+	}
+	if !reflect.DeepEqual(endpoint.Addresses, []string{"10.0.0.1"}) || endpoint.TargetRef == nil || endpoint.TargetRef.Name != "pod1" {
+		t.Errorf("got endpoint %+v, want address 10.0.0.1 of pod1", endpoint)
+	}
+	if key := EndpointSliceServiceKey(slice); key != "ns/svc1" {
+		t.Errorf("EndpointSliceServiceKey() = %q, want ns/svc1", key)
+	}
+}
@@ -68,6 +68,7 @@ func (f *fakeZoneGetter) GetZoneForNode(name string) (string, error) {
 type FakeNetworkEndpointGroupCloud struct {
 	NetworkEndpointGroups map[string][]*compute.NetworkEndpointGroup
 	NetworkEndpoints      map[string][]*compute.NetworkEndpoint
+	BackendServices       []*compute.BackendService
 	Subnetwork            string
 	Network               string
 	mu                    sync.Mutex
@@ -189,6 +190,12 @@ func (f *FakeNetworkEndpointGroupCloud) ListNetworkEndpoints(name, zone string,
 	return ret, nil
 }
 
+func (f *FakeNetworkEndpointGroupCloud) ListBackendServices() ([]*compute.BackendService, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.BackendServices, nil
+}
+
 func (f *FakeNetworkEndpointGroupCloud) NetworkURL() string {
 	return f.Network
 }
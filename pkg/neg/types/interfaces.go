@@ -36,6 +36,8 @@ type NetworkEndpointGroupCloud interface {
 	AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error
 	DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error
 	ListNetworkEndpoints(name, zone string, showHealthStatus bool) ([]*compute.NetworkEndpointWithHealthStatus, error)
+	// ListBackendServices returns the global backend services and the ones in the region of the cluster.
+	ListBackendServices() ([]*compute.BackendService, error)
 	NetworkURL() string
 	SubnetworkURL() string
 }
@@ -45,6 +47,8 @@ type NetworkEndpointGroupNamer interface {
 	NEG(namespace, name string, port int32) string
 	NEGWithSubset(namespace, name, subset string, port int32) string
 	IsNEG(name string) bool
+	// UID returns the UID of the cluster, which is recorded in the description of NEGs.
+	UID() string
 }
 
 // NegSyncer is an interface to interact with syncer
@@ -59,6 +63,10 @@ type NegSyncer interface {
 	IsStopped() bool
 	// IsShuttingDown returns true if syncer is shutting down
 	IsShuttingDown() bool
+	// Status returns the result of the last sync of the syncer
+	Status() NegSyncerStatus
+	// State returns a snapshot of the internal state of the syncer
+	State() NegSyncerState
 }
 
 // NegSyncerManager is an interface for controllers to manage syncer
@@ -68,10 +76,16 @@ type NegSyncerManager interface {
 	EnsureSyncers(namespace, name string, portMap PortInfoMap) error
 	// StopSyncer stops all syncers related to the service. This call is asynchronous. It will not wait for all syncers to stop.
 	StopSyncer(namespace, name string)
+	// StopSyncers stops the syncers of the services selected by the filter. It returns true once none of them is syncing anymore.
+	StopSyncers(filter func(namespace, name string) bool) bool
 	// Sync signals all syncers related to the service to sync. This call is asynchronous.
 	Sync(namespace, name string)
 	// GC garbage collects network endpoint group and syncers
 	GC() error
+	// SyncNegCRs reports the status of NEGs in ServiceNetworkEndpointGroups
+	SyncNegCRs() error
+	// SyncerStates returns snapshots of the internal states of all syncers
+	SyncerStates() []NegSyncerState
 	// ShutDown shuts down the manager
 	ShutDown()
 }
@@ -0,0 +1,210 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"sync"
+
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// maxEndpointsPerOperation is the maximum number of endpoints GCE accepts
+	// in one attach or detach call.
+	maxEndpointsPerOperation = 500
+)
+
+type operationType string
+
+const (
+	attachOperation = operationType("Attach")
+	detachOperation = operationType("Detach")
+)
+
+// endpointOperation is an attach or detach call for a NEG in a zone, which
+// may carry the endpoints of several callers.
+type endpointOperation struct {
+	opType    operationType
+	name      string
+	zone      string
+	endpoints []*compute.NetworkEndpoint
+	// done is closed once the operation finished with err.
+	done chan struct{}
+	err  error
+}
+
+// operationQueue is a round robin queue of operations grouped by NEG, so that
+// a NEG with many pending operations does not starve the others.
+type operationQueue struct {
+	// negs are the NEGs with pending operations, in round robin order.
+	negs []string
+	// operations are the pending operations of each NEG in FIFO order. Only
+	// the last one may still take more endpoints.
+	operations map[string][]*endpointOperation
+}
+
+func newOperationQueue() *operationQueue {
+	return &operationQueue{operations: map[string][]*endpointOperation{}}
+}
+
+// push adds the endpoints to the last pending operation of the NEG if it has
+// room for them, or queues a new operation otherwise. Returns the operation
+// the endpoints were added to.
+func (q *operationQueue) push(opType operationType, name, zone string, endpoints []*compute.NetworkEndpoint) *endpointOperation {
+	ops := q.operations[name]
+	if len(ops) > 0 {
+		last := ops[len(ops)-1]
+		if len(last.endpoints)+len(endpoints) <= maxEndpointsPerOperation {
+			last.endpoints = append(last.endpoints, endpoints...)
+			return last
+		}
+	} else {
+		q.negs = append(q.negs, name)
+	}
+	op := &endpointOperation{
+		opType:    opType,
+		name:      name,
+		zone:      zone,
+		endpoints: append([]*compute.NetworkEndpoint{}, endpoints...),
+		done:      make(chan struct{}),
+	}
+	q.operations[name] = append(ops, op)
+	return op
+}
+
+// pop returns the first pending operation of the next NEG, or nil if there
+// is none.
+func (q *operationQueue) pop() *endpointOperation {
+	if len(q.negs) == 0 {
+		return nil
+	}
+	name := q.negs[0]
+	q.negs = q.negs[1:]
+	ops := q.operations[name]
+	op := ops[0]
+	if len(ops) == 1 {
+		delete(q.operations, name)
+	} else {
+		q.operations[name] = ops[1:]
+		q.negs = append(q.negs, name)
+	}
+	return op
+}
+
+// zoneScheduler schedules the operations of a zone.
+type zoneScheduler struct {
+	running  int
+	detaches *operationQueue
+	attaches *operationQueue
+}
+
+// operationScheduler implements NetworkEndpointGroupCloud. It schedules the
+// attach and detach calls of all syncers through per zone queues:
+//   - Calls for the same NEG which are queued at the same time, for example
+//     from consecutive syncs, are coalesced into one GCE call, up to the
+//     maximum number of endpoints per call.
+//   - At most zoneConcurrency calls run at the same time in a zone.
+//   - Detaches run before attaches, since detached endpoints are mostly those
+//     of terminating pods, which keep receiving traffic until detached.
+//   - NEGs, and therefore services, take turns in each queue.
+//
+// Reordering is safe as a syncer never has more than one call pending for
+// the same endpoint. All other calls are passed through.
+type operationScheduler struct {
+	NetworkEndpointGroupCloud
+	zoneConcurrency int
+
+	lock  sync.Mutex
+	zones map[string]*zoneScheduler
+}
+
+// NewOperationScheduler returns a NetworkEndpointGroupCloud which schedules
+// the attach and detach calls to cloud with at most zoneConcurrency calls
+// running in each zone.
+func NewOperationScheduler(cloud NetworkEndpointGroupCloud, zoneConcurrency int) NetworkEndpointGroupCloud {
+	return &operationScheduler{
+		NetworkEndpointGroupCloud: cloud,
+		zoneConcurrency:           zoneConcurrency,
+		zones:                     map[string]*zoneScheduler{},
+	}
+}
+
+// AttachNetworkEndpoints implements NetworkEndpointGroupCloud.
+func (s *operationScheduler) AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return s.schedule(attachOperation, name, zone, endpoints)
+}
+
+// DetachNetworkEndpoints implements NetworkEndpointGroupCloud.
+func (s *operationScheduler) DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return s.schedule(detachOperation, name, zone, endpoints)
+}
+
+// schedule queues the endpoints and waits for the operation they were added
+// to. All callers of a coalesced operation get its error.
+func (s *operationScheduler) schedule(opType operationType, name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	if len(endpoints) == 0 {
+		return nil
+	}
+	s.lock.Lock()
+	zs, ok := s.zones[zone]
+	if !ok {
+		zs = &zoneScheduler{detaches: newOperationQueue(), attaches: newOperationQueue()}
+		s.zones[zone] = zs
+	}
+	queue := zs.attaches
+	if opType == detachOperation {
+		queue = zs.detaches
+	}
+	op := queue.push(opType, name, zone, endpoints)
+	s.dispatch(zs)
+	s.lock.Unlock()
+
+	<-op.done
+	return op.err
+}
+
+// dispatch starts queued operations of the zone while it has capacity.
+// Must be called with the lock held.
+func (s *operationScheduler) dispatch(zs *zoneScheduler) {
+	for zs.running < s.zoneConcurrency {
+		op := zs.detaches.pop()
+		if op == nil {
+			op = zs.attaches.pop()
+		}
+		if op == nil {
+			return
+		}
+		zs.running++
+		go s.run(zs, op)
+	}
+}
+
+func (s *operationScheduler) run(zs *zoneScheduler, op *endpointOperation) {
+	klog.V(4).Infof("%s %d network endpoint(s) for NEG %q in zone %q", op.opType, len(op.endpoints), op.name, op.zone)
+	if op.opType == attachOperation {
+		op.err = s.NetworkEndpointGroupCloud.AttachNetworkEndpoints(op.name, op.zone, op.endpoints)
+	} else {
+		op.err = s.NetworkEndpointGroupCloud.DetachNetworkEndpoints(op.name, op.zone, op.endpoints)
+	}
+	close(op.done)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	zs.running--
+	s.dispatch(zs)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// blockingCloud records attach and detach calls and blocks them until
+// released.
+type blockingCloud struct {
+	NetworkEndpointGroupCloud
+	release chan struct{}
+
+	mu      sync.Mutex
+	calls   []string
+	running int
+	maxRun  int
+}
+
+func (c *blockingCloud) call(op, name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	c.mu.Lock()
+	var ips []string
+	for _, ep := range endpoints {
+		ips = append(ips, ep.IpAddress)
+	}
+	c.calls = append(c.calls, fmt.Sprintf("%s/%s/%s/%v", op, name, zone, ips))
+	c.running++
+	if c.running > c.maxRun {
+		c.maxRun = c.running
+	}
+	c.mu.Unlock()
+
+	<-c.release
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+	if name == "fail" {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func (c *blockingCloud) AttachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return c.call("Attach", name, zone, endpoints)
+}
+
+func (c *blockingCloud) DetachNetworkEndpoints(name, zone string, endpoints []*compute.NetworkEndpoint) error {
+	return c.call("Detach", name, zone, endpoints)
+}
+
+func (c *blockingCloud) numCalls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.calls)
+}
+
+func endpoints(ips ...string) []*compute.NetworkEndpoint {
+	var ret []*compute.NetworkEndpoint
+	for _, ip := range ips {
+		ret = append(ret, &compute.NetworkEndpoint{IpAddress: ip})
+	}
+	return ret
+}
+
+// queued returns the number of operations queued in the zone.
+func queued(s *operationScheduler, zone string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	zs, ok := s.zones[zone]
+	if !ok {
+		return 0
+	}
+	n := 0
+	for _, q := range []*operationQueue{zs.detaches, zs.attaches} {
+		for _, ops := range q.operations {
+			n += len(ops)
+		}
+	}
+	return n
+}
+
+func TestOperationScheduler(t *testing.T) {
+	cloud := &blockingCloud{release: make(chan struct{})}
+	s := NewOperationScheduler(cloud, 1).(*operationScheduler)
+
+	errs := make(chan error, 10)
+	schedule := func(f func(name, zone string, endpoints []*compute.NetworkEndpoint) error, name, zone string, ips ...string) {
+		go func() { errs <- f(name, zone, endpoints(ips...)) }()
+	}
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		if err := wait.Poll(time.Millisecond, 5*time.Second, func() (bool, error) { return cond(), nil }); err != nil {
+			t.Fatalf("timed out waiting for the scheduler")
+		}
+	}
+
+	// The first call runs right away and blocks the zone.
+	schedule(s.AttachNetworkEndpoints, "neg1", TestZone1, "1")
+	waitFor(func() bool { return cloud.numCalls() == 1 })
+
+	// Queued calls are coalesced per NEG, detaches run first and NEGs take
+	// turns. Other zones are not blocked.
+	schedule(s.AttachNetworkEndpoints, "neg1", TestZone1, "2")
+	waitFor(func() bool { return queued(s, TestZone1) == 1 })
+	schedule(s.AttachNetworkEndpoints, "neg2", TestZone1, "3")
+	waitFor(func() bool { return queued(s, TestZone1) == 2 })
+	schedule(s.AttachNetworkEndpoints, "neg1", TestZone1, "4")
+	schedule(s.DetachNetworkEndpoints, "neg3", TestZone1, "5")
+	waitFor(func() bool { return queued(s, TestZone1) == 3 })
+	schedule(s.DetachNetworkEndpoints, "fail", TestZone2, "6")
+	waitFor(func() bool { return cloud.numCalls() == 2 })
+
+	for i := 0; i < 5; i++ {
+		cloud.release <- struct{}{}
+	}
+	var failed int
+	for i := 0; i < 6; i++ {
+		if err := <-errs; err != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("got %d failed calls, want 1", failed)
+	}
+
+	want := []string{
+		"Attach/neg1/zone1/[1]",
+		"Detach/fail/zone2/[6]",
+		"Detach/neg3/zone1/[5]",
+		"Attach/neg1/zone1/[2 4]",
+		"Attach/neg2/zone1/[3]",
+	}
+	if !reflect.DeepEqual(cloud.calls, want) {
+		t.Errorf("got calls %v, want %v", cloud.calls, want)
+	}
+	if cloud.maxRun != 2 {
+		t.Errorf("got %d concurrent calls, want 2 (one per zone)", cloud.maxRun)
+	}
+}
+
+func TestOperationQueue(t *testing.T) {
+	q := newOperationQueue()
+	var ips []string
+	for i := 0; i < maxEndpointsPerOperation; i++ {
+		ips = append(ips, fmt.Sprintf("%d", i))
+	}
+	first := q.push(attachOperation, "neg1", TestZone1, endpoints(ips[:300]...))
+	if op := q.push(attachOperation, "neg1", TestZone1, endpoints(ips[300:]...)); op != first {
+		t.Errorf("push() did not coalesce operations within the limit")
+	}
+	second := q.push(attachOperation, "neg1", TestZone1, endpoints("a"))
+	if second == first {
+		t.Errorf("push() coalesced operations beyond the limit")
+	}
+	other := q.push(attachOperation, "neg2", TestZone1, endpoints("b"))
+
+	for _, want := range []*endpointOperation{first, other, second, nil} {
+		if got := q.pop(); got != want {
+			t.Errorf("pop() = %v, want %v", got, want)
+		}
+	}
+}
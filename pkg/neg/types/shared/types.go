@@ -18,4 +18,8 @@ package shared
 
 const (
 	NegReadinessGate = "cloud.google.com/load-balancer-neg-ready"
+	// NegDrainedCondition is the pod condition set on terminating pods once
+	// they were detached from their NEGs and connections to them were
+	// drained. A preStop hook may wait for it before shutting down.
+	NegDrainedCondition = "cloud.google.com/load-balancer-neg-drained"
 )
@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	istioV1alpha3 "istio.io/api/networking/v1alpha3"
 	"k8s.io/apimachinery/pkg/labels"
@@ -29,6 +30,23 @@ import (
 	"k8s.io/ingress-gce/pkg/annotations"
 )
 
+// NetworkEndpointType is the type of the network endpoints of a NEG.
+type NetworkEndpointType string
+
+const (
+	// VmIpPortEndpointType is the type of NEGs of pods running on GCE VMs.
+	VmIpPortEndpointType = NetworkEndpointType("GCE_VM_IP_PORT")
+	// NonGCPPrivateEndpointType is the type of NEGs of endpoints outside of GCP,
+	// reachable over hybrid connectivity.
+	NonGCPPrivateEndpointType = NetworkEndpointType("NON_GCP_PRIVATE_IP_PORT")
+	// VmIpEndpointType is the type of NEGs of GCE VMs, used as backends of L4 internal load balancers.
+	VmIpEndpointType = NetworkEndpointType("GCE_VM_IP")
+
+	// VmIpServicePort is the service port of the GCE_VM_IP NEG of a service in a PortInfoMap.
+	// The NEG is not specific to a service port, it is reported under this port in the NEG status.
+	VmIpServicePort = int32(0)
+)
+
 // SvcPortMap is a map of ServicePort:TargetPort
 type SvcPortMap map[int32]string
 
@@ -47,6 +65,8 @@ type PortInfo struct {
 
 	// NegName is the name of the NEG
 	NegName string
+	// NegType is the type of the NEG. It is GCE_VM_IP_PORT if empty.
+	NegType NetworkEndpointType
 	// ReadinessGate indicates if the NEG associated with the port has NEG readiness gate enabled
 	// This is enabled with service port is reference by ingress.
 	// If the service port is only exposed as stand alone NEG, it should not be enbled.
@@ -76,6 +96,16 @@ func NewPortInfoMap(namespace, name string, svcPortMap SvcPortMap, namer Network
 	return ret
 }
 
+// NewPortInfoMapForVmIpNEG creates PortInfoMap with the GCE_VM_IP NEG of the service.
+func NewPortInfoMapForVmIpNEG(namespace, name string, namer NetworkEndpointGroupNamer) PortInfoMap {
+	return PortInfoMap{
+		PortInfoMapKey{VmIpServicePort, ""}: PortInfo{
+			NegName: namer.NEG(namespace, name, VmIpServicePort),
+			NegType: VmIpEndpointType,
+		},
+	}
+}
+
 // NewPortInfoMapWithDestinationRule create PortInfoMap based on a gaven DesinationRule.
 // Return error message if the DestinationRule contains duplicated subsets.
 func NewPortInfoMapWithDestinationRule(namespace, name string, svcPortMap SvcPortMap, namer NetworkEndpointGroupNamer, readinessGate bool,
@@ -121,6 +151,9 @@ func (p1 PortInfoMap) Merge(p2 PortInfoMap) error {
 			if existingPortInfo.Subset != portInfo.Subset {
 				return fmt.Errorf("for service port %v, Subset name in existing map is %q, but the merge map has %q", mapKey, existingPortInfo.Subset, portInfo.Subset)
 			}
+			if existingPortInfo.NegType != portInfo.NegType {
+				return fmt.Errorf("for service port %v, NEG type in existing map is %q, but the merge map has %q", mapKey, existingPortInfo.NegType, portInfo.NegType)
+			}
 			mergedInfo.ReadinessGate = existingPortInfo.ReadinessGate
 		}
 		mergedInfo.TargetPort = portInfo.TargetPort
@@ -128,6 +161,7 @@ func (p1 PortInfoMap) Merge(p2 PortInfoMap) error {
 		mergedInfo.ReadinessGate = mergedInfo.ReadinessGate || portInfo.ReadinessGate
 		mergedInfo.Subset = portInfo.Subset
 		mergedInfo.SubsetLabels = portInfo.SubsetLabels
+		mergedInfo.NegType = portInfo.NegType
 
 		p1[mapKey] = mergedInfo
 	}
@@ -180,6 +214,54 @@ func (p1 PortInfoMap) NegsWithReadinessGate() sets.String {
 	return ret
 }
 
+// NegSyncerStatus is the result of the last sync of a NEG syncer.
+type NegSyncerStatus struct {
+	// LastSyncTime is the time the last sync finished. It is zero if the syncer has not synced yet.
+	LastSyncTime time.Time
+	// LastSyncError is the error of the last sync, nil if it succeeded.
+	LastSyncError error
+	// EndpointCounts are the numbers of endpoints of the NEG by zone as of the last successful sync.
+	EndpointCounts map[string]int
+}
+
+// NegSyncerState is a snapshot of the internal state of a NEG syncer, used for debugging.
+type NegSyncerState struct {
+	Key NegSyncerKey `json:"key"`
+	// SyncerType is the implementation of the syncer, e.g. Transaction, Batch or Hybrid.
+	SyncerType string `json:"syncerType"`
+	NegName    string `json:"negName"`
+	// Zones are the zones the syncer ensured NEGs in during its last sync.
+	Zones []string `json:"zones,omitempty"`
+	// EndpointCounts are the numbers of target endpoints of the NEG by zone.
+	EndpointCounts map[string]int `json:"endpointCounts,omitempty"`
+	// Transactions are the NEG API operations in flight, sorted by endpoint.
+	Transactions []NegTransactionState `json:"transactions,omitempty"`
+	// Backoff is the back off state of the sync retries.
+	Backoff NegBackoffState `json:"backoff"`
+	// OperationBackoff is the back off state of the NEG API operation retries, if the syncer retries them separately.
+	OperationBackoff *NegBackoffState `json:"operationBackoff,omitempty"`
+	Stopped          bool             `json:"stopped"`
+	ShuttingDown     bool             `json:"shuttingDown"`
+	// LastSyncTime is zero if the syncer has not synced yet.
+	LastSyncTime  time.Time `json:"lastSyncTime"`
+	LastSyncError string    `json:"lastSyncError,omitempty"`
+}
+
+// NegTransactionState is a NEG API operation in flight for a network endpoint.
+type NegTransactionState struct {
+	Endpoint      NetworkEndpoint `json:"endpoint"`
+	Zone          string          `json:"zone"`
+	Operation     string          `json:"operation"`
+	NeedReconcile bool            `json:"needReconcile"`
+}
+
+// NegBackoffState is the state of an exponential back off.
+type NegBackoffState struct {
+	RetryCount     int    `json:"retryCount"`
+	MaxRetries     int    `json:"maxRetries"`
+	LastRetryDelay string `json:"lastRetryDelay"`
+}
+
 // NegSyncerKey includes information to uniquely identify a NEG syncer
 type NegSyncerKey struct {
 	// Namespace of service
@@ -197,6 +279,9 @@ type NegSyncerKey struct {
 
 	// Subset label, should set together with Subset.
 	SubsetLabels string
+
+	// NegType is the type of the NEG. It is GCE_VM_IP_PORT if empty.
+	NegType NetworkEndpointType
 }
 
 func (key NegSyncerKey) String() string {
@@ -40,6 +40,10 @@ func (*negNamer) IsNEG(name string) bool {
 	return false
 }
 
+func (*negNamer) UID() string {
+	return ""
+}
+
 func createDestinationRule(host string, subsets ...string) *istioV1alpha3.DestinationRule {
 	ds := istioV1alpha3.DestinationRule{
 		Host: host,
@@ -17,12 +17,9 @@ limitations under the License.
 package neg
 
 import (
-	"encoding/json"
 	"fmt"
-	"strings"
+	"regexp"
 
-	istioV1alpha3 "istio.io/api/networking/v1alpha3"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/ingress-gce/pkg/annotations"
 	"k8s.io/ingress-gce/pkg/neg/types"
@@ -36,6 +33,48 @@ const (
 // NegSyncerType represents the the neg syncer type
 type NegSyncerType string
 
+// negNameRegexp matches the names of GCE resources.
+var negNameRegexp = regexp.MustCompile("^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$")
+
+// customNegNames returns the custom NEG names of the exposed ports in the annotation.
+// It returns an error if a name is not a valid GCE resource name or is used for several ports.
+func customNegNames(ann *annotations.NegAnnotation) (map[int32]string, error) {
+	ret := map[int32]string{}
+	ports := map[string]int32{}
+	var errList []error
+	for port, attr := range ann.ExposedPorts {
+		if attr.Name == "" {
+			continue
+		}
+		if !negNameRegexp.MatchString(attr.Name) {
+			errList = append(errList, fmt.Errorf("NEG name %q of port %v specified in %q is not a valid GCE resource name", attr.Name, port, annotations.NEGAnnotationKey))
+			continue
+		}
+		if otherPort, ok := ports[attr.Name]; ok {
+			errList = append(errList, fmt.Errorf("NEG name %q specified in %q is used for ports %v and %v", attr.Name, annotations.NEGAnnotationKey, otherPort, port))
+			continue
+		}
+		ports[attr.Name] = port
+		ret[port] = attr.Name
+	}
+	return ret, utilerrors.NewAggregate(errList)
+}
+
+// customNegNamer returns the custom NEG names of the service ports of a service, and the
+// names generated by the cluster namer otherwise.
+type customNegNamer struct {
+	types.NetworkEndpointGroupNamer
+	// names maps service ports to custom NEG names.
+	names map[int32]string
+}
+
+func (n *customNegNamer) NEG(namespace, name string, port int32) string {
+	if negName, ok := n.names[port]; ok {
+		return negName
+	}
+	return n.NetworkEndpointGroupNamer.NEG(namespace, name, port)
+}
+
 // negServicePorts returns the parsed ServicePorts from the annotation.
 // knownPorts represents the known Port:TargetPort attributes of servicePorts
 // that already exist on the service. This function returns an error if
@@ -54,34 +93,6 @@ func negServicePorts(ann *annotations.NegAnnotation, knownPorts types.SvcPortMap
 	return portSet, utilerrors.NewAggregate(errList)
 }
 
-// castToDestinationRule cast Unstructured obj to istioV1alpha3.DestinationRule
-// Return targetServiceNamespace, targetSeriveName(DestinationRule.Host), DestionationRule and error.
-func castToDestinationRule(drus *unstructured.Unstructured) (string, string, *istioV1alpha3.DestinationRule, error) {
-	drJSON, err := json.Marshal(drus.Object["spec"])
-	if err != nil {
-		return "", "", nil, err
-	}
-
-	dr := &istioV1alpha3.DestinationRule{}
-	if err := json.Unmarshal(drJSON, &dr); err != nil {
-		return "", "", nil, err
-	}
-
-	targetServiceNamespace := drus.GetNamespace()
-	drHost := dr.Host
-	if strings.Contains(dr.Host, ".") {
-		// If the Host is using a full service name, Istio will ignore the destination rule
-		// namespace and use the namespace in the full name. (e.g. "reviews"
-		// instead of "reviews.default.svc.cluster.local")
-		// For more info, please go to https://github.com/istio/api/blob/1.2.4/networking/v1alpha3/destination_rule.pb.go#L186
-		rsl := strings.Split(dr.Host, ".")
-		targetServiceNamespace = rsl[1]
-		drHost = rsl[0]
-	}
-
-	return targetServiceNamespace, drHost, dr, nil
-}
-
 func contains(ss []string, target string) bool {
 	for _, s := range ss {
 		if s == target {
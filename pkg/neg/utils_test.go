@@ -92,3 +92,69 @@ func TestNEGServicePorts(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomNegNames(t *testing.T) {
+	testcases := []struct {
+		desc          string
+		exposedPorts  map[int32]annotations.NegAttributes
+		expectedNames map[int32]string
+		expectErr     bool
+	}{
+		{
+			desc:          "no custom name",
+			exposedPorts:  map[int32]annotations.NegAttributes{80: {}, 443: {}},
+			expectedNames: map[int32]string{},
+		},
+		{
+			desc:          "custom names",
+			exposedPorts:  map[int32]annotations.NegAttributes{80: {Name: "neg-80"}, 443: {}, 8080: {Name: "n"}},
+			expectedNames: map[int32]string{80: "neg-80", 8080: "n"},
+		},
+		{
+			desc:          "invalid name",
+			exposedPorts:  map[int32]annotations.NegAttributes{80: {Name: "Neg_80"}, 443: {Name: "neg-443"}},
+			expectedNames: map[int32]string{443: "neg-443"},
+			expectErr:     true,
+		},
+		{
+			desc:          "name too long",
+			exposedPorts:  map[int32]annotations.NegAttributes{80: {Name: "n123456789012345678901234567890123456789012345678901234567890123"}},
+			expectedNames: map[int32]string{},
+			expectErr:     true,
+		},
+		{
+			desc:         "duplicate names",
+			exposedPorts: map[int32]annotations.NegAttributes{80: {Name: "neg"}, 443: {Name: "neg"}},
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			names, err := customNegNames(&annotations.NegAnnotation{ExposedPorts: tc.exposedPorts})
+			if tc.expectErr != (err != nil) {
+				t.Errorf("Expect error to be %v, but got %v", tc.expectErr, err)
+			}
+			if tc.expectedNames != nil && !reflect.DeepEqual(names, tc.expectedNames) {
+				t.Errorf("Expect names to be %v, but got %v", tc.expectedNames, names)
+			}
+		})
+	}
+
+	namer := &customNegNamer{NetworkEndpointGroupNamer: &fakeNamer{}, names: map[int32]string{80: "neg-80"}}
+	if got := namer.NEG("ns", "svc", 80); got != "neg-80" {
+		t.Errorf("Expect custom NEG name %q, but got %q", "neg-80", got)
+	}
+	if got := namer.NEG("ns", "svc", 443); got != "ns-svc-443" {
+		t.Errorf("Expect generated NEG name %q, but got %q", "ns-svc-443", got)
+	}
+}
+
+// fakeNamer generates NEG names from the service and port.
+type fakeNamer struct {
+	types.NetworkEndpointGroupNamer
+}
+
+func (*fakeNamer) NEG(namespace, name string, port int32) string {
+	return fmt.Sprintf("%s-%s-%d", namespace, name, port)
+}
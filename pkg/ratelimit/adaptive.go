@@ -0,0 +1,354 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/klog"
+)
+
+const (
+	// sharedKey is the metric label of the budget shared by all calls.
+	sharedKey = "shared"
+	// minBackoffInterval is the minimum time between two backoffs of a
+	// limiter, so that a burst of concurrent quota errors backs off once.
+	minBackoffInterval = time.Second
+)
+
+// AdaptiveConfig configures an AdaptiveRateLimiter.
+type AdaptiveConfig struct {
+	// QPS and Burst are the budget shared by all calls.
+	QPS   float64
+	Burst int
+	// MinQPS is the lowest rate a limiter backs off to.
+	MinQPS float64
+	// BackoffFactor multiplies the rate of a limiter on a quota error.
+	BackoffFactor float64
+	// RecoveryInterval is the time without quota errors after which the rate
+	// of a limiter is increased by RecoveryStep times its base rate.
+	RecoveryInterval time.Duration
+	RecoveryStep     float64
+}
+
+// DefaultAdaptiveConfig returns the config with the given shared budget
+// which halves rates on quota errors and recovers them within two minutes.
+func DefaultAdaptiveConfig(qps float64, burst int) AdaptiveConfig {
+	return AdaptiveConfig{
+		QPS:              qps,
+		Burst:            burst,
+		MinQPS:           0.1,
+		BackoffFactor:    0.5,
+		RecoveryInterval: 10 * time.Second,
+		RecoveryStep:     0.1,
+	}
+}
+
+// AdaptiveRateLimiter implements cloud.RateLimiter. Like GCERateLimiter, it
+// limits calls by RateLimitKey, but backs off the rate of a key when GCE
+// reports that a quota was exceeded for it and recovers gradually once the
+// errors stop. All calls also take from a shared budget, which backs off on
+// every quota error, since the L7 controller and the NEG syncers use the same
+// project quota. Results of calls are reported to it through Observe.
+type AdaptiveRateLimiter struct {
+	config AdaptiveConfig
+	// Minimum polling interval for getting operations.
+	operationPollInterval time.Duration
+	clock                 clock.Clock
+
+	lock   sync.Mutex
+	shared *adaptiveLimiter
+	// limiters are keyed by RateLimitKey without ProjectID. Keys without a
+	// spec only have a limiter while they are backed off.
+	limiters map[cloud.RateLimitKey]*adaptiveLimiter
+}
+
+// adaptiveLimiter is a token bucket whose rate changes with quota errors.
+type adaptiveLimiter struct {
+	name string
+	// base is the rate the limiter recovers to.
+	base    rate.Limit
+	limiter *rate.Limiter
+	// spec is true if the base rate was given by a spec.
+	spec bool
+	// lastBackoff is the time the rate was last decreased, lastChange the
+	// time it was last decreased or increased.
+	lastBackoff time.Time
+	lastChange  time.Time
+}
+
+// NewAdaptiveRateLimiter returns an AdaptiveRateLimiter with the rates of the
+// given specs as base rates. The format of the specs is the same as for
+// NewGCERateLimiter.
+func NewAdaptiveRateLimiter(specs []string, config AdaptiveConfig, operationPollInterval time.Duration) (*AdaptiveRateLimiter, error) {
+	if config.QPS <= 0 || config.Burst < 1 {
+		return nil, fmt.Errorf("invalid shared budget of %v qps with a burst of %d", config.QPS, config.Burst)
+	}
+	RegisterMetrics()
+	l := &AdaptiveRateLimiter{
+		config:                config,
+		operationPollInterval: operationPollInterval,
+		clock:                 clock.RealClock{},
+		limiters:              map[cloud.RateLimitKey]*adaptiveLimiter{},
+	}
+	l.shared = l.newLimiter(sharedKey, config.QPS, config.Burst)
+	for _, spec := range specs {
+		params := strings.Split(spec, ",")
+		if len(params) < 2 {
+			return nil, fmt.Errorf("must at least specify operation and rate limiter type.")
+		}
+		key, err := constructRateLimitKey(params[0])
+		if err != nil {
+			return nil, err
+		}
+		qps, burst, err := parseQPSParams(params[1:])
+		if err != nil {
+			return nil, err
+		}
+		key = keyWithoutProject(&key)
+		lim := l.newLimiter(keyName(key), qps, burst)
+		lim.spec = true
+		l.limiters[key] = lim
+		klog.Infof("Configured adaptive rate limiting for: %v", key)
+	}
+	return l, nil
+}
+
+// Accept waits on the limiter of the key, if any, and the shared budget.
+func (l *AdaptiveRateLimiter) Accept(ctx context.Context, key *cloud.RateLimitKey) error {
+	var rl cloud.RateLimiter = acceptFunc(l.accept)
+	if key.Operation == "Get" && key.Service == "Operations" {
+		// Wait a minimum amount of time regardless of rate limiter.
+		rl = &cloud.MinimumRateLimiter{
+			RateLimiter: rl,
+			Minimum:     l.operationPollInterval,
+		}
+	}
+	return rl.Accept(ctx, key)
+}
+
+func (l *AdaptiveRateLimiter) accept(ctx context.Context, key *cloud.RateLimitKey) error {
+	for _, lim := range l.limitersFor(key) {
+		if err := lim.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitersFor returns the limiters a call with the key waits on, after
+// recovering their rates.
+func (l *AdaptiveRateLimiter) limitersFor(key *cloud.RateLimitKey) []*rate.Limiter {
+	now := l.clock.Now()
+	k := keyWithoutProject(key)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var result []*rate.Limiter
+	if lim, ok := l.limiters[k]; ok {
+		if lim.recover(now, l.config) && !lim.spec {
+			delete(l.limiters, k)
+			RateLimitQPS.DeleteLabelValues(lim.name)
+		} else {
+			result = append(result, lim.limiter)
+		}
+	}
+	// The shared budget is taken last, so that it is not held while
+	// waiting on a backed off key.
+	l.shared.recover(now, l.config)
+	return append(result, l.shared.limiter)
+}
+
+// Observe backs off the rate of the key and the shared budget if err is a
+// quota error.
+func (l *AdaptiveRateLimiter) Observe(key *cloud.RateLimitKey, err error) {
+	if !IsQuotaError(err) {
+		return
+	}
+	now := l.clock.Now()
+	k := keyWithoutProject(key)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	lim, ok := l.limiters[k]
+	if !ok {
+		lim = l.newLimiter(keyName(k), float64(l.shared.base), l.config.Burst)
+		l.limiters[k] = lim
+	}
+	klog.Warningf("GCE quota exceeded for %v, backing off: %v", lim.name, err)
+	lim.backoff(now, l.config)
+	l.shared.backoff(now, l.config)
+}
+
+// EffectiveQPS returns the current rate of the key, or of the shared budget
+// if key is nil. The rate of a key without a limiter is unlimited.
+func (l *AdaptiveRateLimiter) EffectiveQPS(key *cloud.RateLimitKey) float64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if key == nil {
+		return float64(l.shared.limiter.Limit())
+	}
+	lim, ok := l.limiters[keyWithoutProject(key)]
+	if !ok {
+		return float64(rate.Inf)
+	}
+	return float64(lim.limiter.Limit())
+}
+
+func (l *AdaptiveRateLimiter) newLimiter(name string, qps float64, burst int) *adaptiveLimiter {
+	lim := &adaptiveLimiter{
+		name:    name,
+		base:    rate.Limit(qps),
+		limiter: rate.NewLimiter(rate.Limit(qps), burst),
+	}
+	RateLimitQPS.WithLabelValues(name).Set(qps)
+	return lim
+}
+
+// backoff decreases the rate of the limiter by the backoff factor.
+func (a *adaptiveLimiter) backoff(now time.Time, config AdaptiveConfig) {
+	if now.Sub(a.lastBackoff) < minBackoffInterval {
+		return
+	}
+	limit := a.limiter.Limit() * rate.Limit(config.BackoffFactor)
+	if limit < rate.Limit(config.MinQPS) {
+		limit = rate.Limit(config.MinQPS)
+	}
+	a.setLimit(limit)
+	a.lastBackoff = now
+	a.lastChange = now
+}
+
+// recover increases the rate of the limiter by a step for every recovery
+// interval since it last changed. Returns true if the limiter is at its base
+// rate.
+func (a *adaptiveLimiter) recover(now time.Time, config AdaptiveConfig) bool {
+	limit := a.limiter.Limit()
+	if limit >= a.base {
+		return true
+	}
+	steps := int(now.Sub(a.lastChange) / config.RecoveryInterval)
+	if steps == 0 {
+		return false
+	}
+	limit += rate.Limit(float64(steps)*config.RecoveryStep) * a.base
+	if limit > a.base {
+		limit = a.base
+	}
+	a.setLimit(limit)
+	a.lastChange = a.lastChange.Add(time.Duration(steps) * config.RecoveryInterval)
+	return limit >= a.base
+}
+
+func (a *adaptiveLimiter) setLimit(limit rate.Limit) {
+	klog.V(2).Infof("Rate limit of %v changed from %v to %v qps", a.name, a.limiter.Limit(), limit)
+	a.limiter.SetLimit(limit)
+	RateLimitQPS.WithLabelValues(a.name).Set(float64(limit))
+}
+
+// IsQuotaError returns true if err means that a GCE rate limit or quota was
+// exceeded.
+func IsQuotaError(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	for _, e := range apiErr.Errors {
+		switch e.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// acceptFunc adapts a function to cloud.RateLimiter.
+type acceptFunc func(ctx context.Context, key *cloud.RateLimitKey) error
+
+func (f acceptFunc) Accept(ctx context.Context, key *cloud.RateLimitKey) error {
+	return f(ctx, key)
+}
+
+func keyWithoutProject(key *cloud.RateLimitKey) cloud.RateLimitKey {
+	return cloud.RateLimitKey{
+		Operation: NormalizeOperation(key.Operation),
+		Version:   key.Version,
+		Service:   key.Service,
+	}
+}
+
+// NormalizeOperation returns the operation in the UpperCamelCase of the GCE
+// API, e.g. "SetUrlMap" for "setUrlMap" or "set_url_map", so that keys are
+// matched regardless of how the caller spells the operation.
+func NormalizeOperation(operation string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(operation, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]))
+		b.WriteString(part[1:])
+	}
+	return b.String()
+}
+
+// keyName returns the key in the [version].[service].[operation] format of
+// the specs.
+func keyName(key cloud.RateLimitKey) string {
+	return fmt.Sprintf("%v.%v.%v", key.Version, key.Service, key.Operation)
+}
+
+// Observer is notified of the results of GCE API calls.
+type Observer interface {
+	Observe(key *cloud.RateLimitKey, err error)
+}
+
+var (
+	observerLock sync.RWMutex
+	observer     Observer
+)
+
+// SetObserver sets the observer notified by Observe.
+func SetObserver(o Observer) {
+	observerLock.Lock()
+	defer observerLock.Unlock()
+	observer = o
+}
+
+// Observe notifies the observer, if any, of the result of a GCE API call
+// and returns err.
+func Observe(key *cloud.RateLimitKey, err error) error {
+	observerLock.RLock()
+	o := observer
+	observerLock.RUnlock()
+	if o != nil && err != nil {
+		o.Observe(key, err)
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func newTestAdaptiveRateLimiter(t *testing.T, specs []string) (*AdaptiveRateLimiter, *clock.FakeClock) {
+	l, err := NewAdaptiveRateLimiter(specs, DefaultAdaptiveConfig(20, 20), time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewAdaptiveRateLimiter() = %v", err)
+	}
+	fakeClock := clock.NewFakeClock(time.Now())
+	l.clock = fakeClock
+	return l, fakeClock
+}
+
+func checkQPS(t *testing.T, l *AdaptiveRateLimiter, key *cloud.RateLimitKey, want float64) {
+	t.Helper()
+	// Rates are only recovered when a call is accepted.
+	if err := l.Accept(context.Background(), &cloud.RateLimitKey{Version: meta.VersionGA, Service: "Other", Operation: "Get"}); err != nil {
+		t.Fatalf("Accept() = %v", err)
+	}
+	if key != nil {
+		l.limitersFor(key)
+	}
+	if got := l.EffectiveQPS(key); math.Abs(got-want) > 1e-9 {
+		t.Errorf("EffectiveQPS(%v) = %v, want %v", key, got, want)
+	}
+}
+
+func TestAdaptiveRateLimiterBackoff(t *testing.T) {
+	l, fakeClock := newTestAdaptiveRateLimiter(t, nil)
+	key := &cloud.RateLimitKey{ProjectID: "p", Version: meta.VersionGA, Service: "NetworkEndpointGroups", Operation: "AttachNetworkEndpoints"}
+	quotaErr := &googleapi.Error{Code: http.StatusTooManyRequests}
+
+	checkQPS(t, l, key, float64(rate.Inf))
+
+	// Other errors are ignored.
+	l.Observe(key, fmt.Errorf("other error"))
+	l.Observe(key, &googleapi.Error{Code: http.StatusNotFound})
+	checkQPS(t, l, key, float64(rate.Inf))
+	checkQPS(t, l, nil, 20)
+
+	// A burst of quota errors backs off once.
+	for i := 0; i < 3; i++ {
+		l.Observe(key, quotaErr)
+	}
+	checkQPS(t, l, key, 10)
+	checkQPS(t, l, nil, 10)
+
+	fakeClock.Step(minBackoffInterval)
+	l.Observe(key, quotaErr)
+	checkQPS(t, l, key, 5)
+	checkQPS(t, l, nil, 5)
+
+	// Rates recover by a tenth of the base rate every recovery interval.
+	fakeClock.Step(10 * time.Second)
+	checkQPS(t, l, key, 7)
+	checkQPS(t, l, nil, 7)
+
+	// Fully recovered keys without a spec are no longer limited.
+	fakeClock.Step(2 * time.Minute)
+	checkQPS(t, l, key, float64(rate.Inf))
+	checkQPS(t, l, nil, 20)
+}
+
+func TestAdaptiveRateLimiterSpecs(t *testing.T) {
+	l, fakeClock := newTestAdaptiveRateLimiter(t, []string{"ga.Addresses.Get,qps,4,5"})
+	key := &cloud.RateLimitKey{Version: meta.VersionGA, Service: "Addresses", Operation: "Get"}
+	quotaErr := &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}
+
+	checkQPS(t, l, key, 4)
+	l.Observe(key, quotaErr)
+	checkQPS(t, l, key, 2)
+
+	// Keys with a spec recover to their spec.
+	fakeClock.Step(10 * time.Minute)
+	checkQPS(t, l, key, 4)
+
+	// Rates never drop below the minimum.
+	for i := 0; i < 10; i++ {
+		fakeClock.Step(minBackoffInterval)
+		l.Observe(key, quotaErr)
+	}
+	checkQPS(t, l, key, 0.1)
+
+	if _, err := NewAdaptiveRateLimiter([]string{"ga.Addresses.Get,qps,0,5"}, DefaultAdaptiveConfig(20, 20), time.Second); err == nil {
+		t.Errorf("NewAdaptiveRateLimiter() = nil, want error for invalid spec")
+	}
+	if _, err := NewAdaptiveRateLimiter(nil, DefaultAdaptiveConfig(0, 20), time.Second); err == nil {
+		t.Errorf("NewAdaptiveRateLimiter() = nil, want error for invalid shared budget")
+	}
+}
+
+func TestObserve(t *testing.T) {
+	l, _ := newTestAdaptiveRateLimiter(t, nil)
+	SetObserver(l)
+	defer SetObserver(nil)
+
+	key := &cloud.RateLimitKey{Version: meta.VersionGA, Service: "UrlMaps", Operation: "Update"}
+	quotaErr := &googleapi.Error{Code: http.StatusTooManyRequests}
+	if err := Observe(key, quotaErr); err != quotaErr {
+		t.Errorf("Observe() = %v, want %v", err, quotaErr)
+	}
+	if err := Observe(key, nil); err != nil {
+		t.Errorf("Observe() = %v, want nil", err)
+	}
+	if got := l.EffectiveQPS(key); got != 10 {
+		t.Errorf("EffectiveQPS(%v) = %v, want 10", key, got)
+	}
+}
+
+func TestAdaptiveRateLimiterNormalizesOperations(t *testing.T) {
+	l, _ := newTestAdaptiveRateLimiter(t, []string{"ga.TargetHttpProxies.setUrlMap,qps,4,5"})
+	quotaErr := &googleapi.Error{Code: http.StatusTooManyRequests}
+
+	// The spec applies to the key of the GCE API call.
+	setUrlMap := &cloud.RateLimitKey{Version: meta.VersionGA, Service: "TargetHttpProxies", Operation: "SetUrlMap"}
+	checkQPS(t, l, setUrlMap, 4)
+
+	// A quota error observed under another spelling of the operation backs
+	// off the limiter the GCE API call waits on.
+	l.Observe(&cloud.RateLimitKey{Version: meta.VersionGA, Service: "NetworkEndpointGroups", Operation: "attachNetworkEndpoints"}, quotaErr)
+	checkQPS(t, l, &cloud.RateLimitKey{Version: meta.VersionGA, Service: "NetworkEndpointGroups", Operation: "AttachNetworkEndpoints"}, 10)
+}
+
+func TestNormalizeOperation(t *testing.T) {
+	for _, tc := range []struct {
+		operation, want string
+	}{
+		{"Get", "Get"},
+		{"get", "Get"},
+		{"setUrlMap", "SetUrlMap"},
+		{"set_url_map", "SetUrlMap"},
+		{"AttachNetworkEndpoints", "AttachNetworkEndpoints"},
+		{"", ""},
+	} {
+		if got := NormalizeOperation(tc.operation); got != tc.want {
+			t.Errorf("NormalizeOperation(%q) = %q, want %q", tc.operation, got, tc.want)
+		}
+	}
+}
+
+func TestIsQuotaError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fmt.Errorf("rateLimitExceeded"), false},
+		{&googleapi.Error{Code: http.StatusNotFound}, false},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, false},
+		{&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, true},
+		{&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}, true},
+	} {
+		if got := IsQuotaError(tc.err); got != tc.want {
+			t.Errorf("IsQuotaError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
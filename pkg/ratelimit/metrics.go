@@ -0,0 +1,53 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-gce/pkg/metrics"
+)
+
+const (
+	rateLimitSubsystem = "gce_ratelimit"
+	effectiveQPSKey    = "effective_qps"
+)
+
+var (
+	// RateLimitQPS is the current rate of the adaptive rate limiters.
+	RateLimitQPS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.GLBC_NAMESPACE,
+			Subsystem: rateLimitSubsystem,
+			Name:      effectiveQPSKey,
+			Help:      "Current rate in qps of GCE API calls allowed by the adaptive rate limiter",
+		},
+		[]string{
+			"key", // [version].[service].[operation], or "shared" for all calls.
+		},
+	)
+)
+
+var register sync.Once
+
+// RegisterMetrics registers the rate limiter metrics.
+func RegisterMetrics() {
+	register.Do(func() {
+		prometheus.MustRegister(RateLimitQPS)
+	})
+}
@@ -139,22 +139,32 @@ func constructRateLimitKey(param string) (cloud.RateLimitKey, error) {
 // constructRateLimitImpl parses the slice and returns a flowcontrol.RateLimiter
 // Expected format is [type],[param1],[param2],...
 func constructRateLimitImpl(params []string) (flowcontrol.RateLimiter, error) {
-	// For now, only the "qps" type is supported.
+	qps, burst, err := parseQPSParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst), nil
+}
+
+// parseQPSParams parses the qps and burst of a rate limiter.
+// Expected format is [type],[qps],[burst] where only the "qps" type is
+// supported.
+func parseQPSParams(params []string) (float64, int, error) {
 	rlType := params[0]
 	implArgs := params[1:]
-	if rlType == "qps" {
-		if len(implArgs) != 2 {
-			return nil, fmt.Errorf("invalid number of args for rate limiter type %v. Expected %d, Got %v", rlType, 2, len(implArgs))
-		}
-		qps, err := strconv.ParseFloat(implArgs[0], 32)
-		if err != nil || qps <= 0 {
-			return nil, fmt.Errorf("invalid argument for rate limiter type %v. Either %v is not a float or not greater than 0.", rlType, implArgs[0])
-		}
-		burst, err := strconv.Atoi(implArgs[1])
-		if err != nil {
-			return nil, fmt.Errorf("invalid argument for rate limiter type %v. Expected %v to be a int.", rlType, implArgs[1])
-		}
-		return flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst), nil
+	if rlType != "qps" {
+		return 0, 0, fmt.Errorf("invalid rate limiter type provided: %v", rlType)
+	}
+	if len(implArgs) != 2 {
+		return 0, 0, fmt.Errorf("invalid number of args for rate limiter type %v. Expected %d, Got %v", rlType, 2, len(implArgs))
+	}
+	qps, err := strconv.ParseFloat(implArgs[0], 32)
+	if err != nil || qps <= 0 {
+		return 0, 0, fmt.Errorf("invalid argument for rate limiter type %v. Either %v is not a float or not greater than 0.", rlType, implArgs[0])
+	}
+	burst, err := strconv.Atoi(implArgs[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid argument for rate limiter type %v. Expected %v to be a int.", rlType, implArgs[1])
 	}
-	return nil, fmt.Errorf("invalid rate limiter type provided: %v", rlType)
+	return qps, burst, nil
 }
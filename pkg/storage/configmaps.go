@@ -28,6 +28,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 )
 
 const (
@@ -64,7 +65,7 @@ func (c *ConfigMapVault) Get(key string) (string, bool, error) {
 	if k, ok := data[key]; ok {
 		return k, true, nil
 	}
-	klog.Infof("Found config map %v but it doesn't contain key %v: %+v", keyStore, key, data)
+	klog.V(3).Infof("Found config map %v but it doesn't contain key %v: %+v", keyStore, key, data)
 	return "", false, nil
 }
 
@@ -92,9 +93,9 @@ func (c *ConfigMapVault) Put(key, val string) error {
 		data[key] = val
 		apiObj.Data = data
 		if existingVal != val {
-			klog.Infof("Configmap %v has key %v but wrong value %v, updating to %v", cfgMapKey, key, existingVal, val)
+			klog.V(3).Infof("Configmap %v has key %v but wrong value %v, updating to %v", cfgMapKey, key, existingVal, val)
 		} else {
-			klog.Infof("Configmap %v will be updated with %v = %v", cfgMapKey, key, val)
+			klog.V(3).Infof("Configmap %v will be updated with %v = %v", cfgMapKey, key, val)
 		}
 		if err := c.configMapStore.Update(apiObj); err != nil {
 			return fmt.Errorf("failed to update %v: %v", cfgMapKey, err)
@@ -105,7 +106,111 @@ func (c *ConfigMapVault) Put(key, val string) error {
 			return fmt.Errorf("failed to add %v: %v", cfgMapKey, err)
 		}
 	}
-	klog.Infof("Successfully stored key %v = %v in config map %v", key, val, cfgMapKey)
+	klog.V(3).Infof("Successfully stored key %v = %v in config map %v", key, val, cfgMapKey)
+	return nil
+}
+
+// PutAll inserts the given key/value pairs in the cluster config map with a single
+// update. The update is retried if the config map was changed concurrently, so keys
+// written by other writers are preserved.
+func (c *ConfigMapVault) PutAll(data map[string]string) error {
+	if len(data) == 0 {
+		return nil
+	}
+	c.storeLock.Lock()
+	defer c.storeLock.Unlock()
+	cfgMapKey := fmt.Sprintf("%v/%v", c.namespace, c.name)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		item, exists, err := c.configMapStore.GetByKey(cfgMapKey)
+		if err != nil {
+			return fmt.Errorf("failed to get %v: %v", cfgMapKey, err)
+		}
+		if !exists {
+			apiObj := &api_v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      c.name,
+					Namespace: c.namespace,
+				},
+				Data: map[string]string{},
+			}
+			for k, v := range data {
+				apiObj.Data[k] = v
+			}
+			return c.configMapStore.Add(apiObj)
+		}
+		apiObj := item.(*api_v1.ConfigMap).DeepCopy()
+		if apiObj.Data == nil {
+			apiObj.Data = map[string]string{}
+		}
+		changed := false
+		for k, v := range data {
+			if existingVal, ok := apiObj.Data[k]; !ok || existingVal != v {
+				apiObj.Data[k] = v
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		if err := c.configMapStore.Update(apiObj); err != nil {
+			if errors.IsConflict(err) {
+				return err
+			}
+			return fmt.Errorf("failed to update %v: %v", cfgMapKey, err)
+		}
+		klog.V(3).Infof("Successfully stored %d keys in config map %v", len(data), cfgMapKey)
+		return nil
+	})
+}
+
+// GetAll retrieves every key/value pair stored in the cluster config map.
+// A missing config map is reported as an empty map and a nil error.
+func (c *ConfigMapVault) GetAll() (map[string]string, error) {
+	keyStore := fmt.Sprintf("%v/%v", c.namespace, c.name)
+	item, found, err := c.configMapStore.GetByKey(keyStore)
+	if err != nil || !found {
+		return map[string]string{}, err
+	}
+	c.storeLock.Lock()
+	defer c.storeLock.Unlock()
+	data := map[string]string{}
+	for k, v := range item.(*api_v1.ConfigMap).Data {
+		data[k] = v
+	}
+	return data, nil
+}
+
+// Remove deletes the given key from the cluster config map. Removing a key
+// which does not exist is a no-op.
+func (c *ConfigMapVault) Remove(key string) error {
+	c.storeLock.Lock()
+	defer c.storeLock.Unlock()
+	cfgMapKey := fmt.Sprintf("%v/%v", c.namespace, c.name)
+
+	item, exists, err := c.configMapStore.GetByKey(cfgMapKey)
+	if err != nil {
+		return fmt.Errorf("failed to get %v: %v", cfgMapKey, err)
+	}
+	if !exists {
+		return nil
+	}
+	data := item.(*api_v1.ConfigMap).Data
+	if _, ok := data[key]; !ok {
+		return nil
+	}
+	delete(data, key)
+	apiObj := &api_v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.name,
+			Namespace: c.namespace,
+		},
+		Data: data,
+	}
+	if err := c.configMapStore.Update(apiObj); err != nil {
+		return fmt.Errorf("failed to update %v: %v", cfgMapKey, err)
+	}
+	klog.Infof("Successfully removed key %v from config map %v", key, cfgMapKey)
 	return nil
 }
 
@@ -72,3 +72,48 @@ func TestFakeConfigMapVaule(t *testing.T) {
 		t.Errorf("Found uid but expected none after deletion")
 	}
 }
+
+func TestFakeConfigMapVaultRemove(t *testing.T) {
+	vault := NewFakeConfigMapVault(api.NamespaceSystem, "ingress-uid")
+	// Removing from an empty vault is a no-op.
+	if err := vault.Remove("foo"); err != nil {
+		t.Errorf("vault.Remove(%q) = %v, want nil", "foo", err)
+	}
+
+	vault.Put("foo", "1")
+	vault.Put("bar", "2")
+	all, err := vault.GetAll()
+	if err != nil || len(all) != 2 || all["foo"] != "1" || all["bar"] != "2" {
+		t.Errorf("vault.GetAll() = %v, %v, want map[bar:2 foo:1], nil", all, err)
+	}
+
+	if err := vault.Remove("foo"); err != nil {
+		t.Errorf("vault.Remove(%q) = %v, want nil", "foo", err)
+	}
+	if _, exists, _ := vault.Get("foo"); exists {
+		t.Errorf("Found key %q but expected none after removal", "foo")
+	}
+	if val, exists, _ := vault.Get("bar"); !exists || val != "2" {
+		t.Errorf("vault.Get(%q) = %q, %v, want %q, true", "bar", val, exists, "2")
+	}
+}
+
+func TestFakeConfigMapVaultPutAll(t *testing.T) {
+	vault := NewFakeConfigMapVault(api.NamespaceSystem, "ingress-uid")
+	// Storing in an empty vault creates the config map.
+	if err := vault.PutAll(map[string]string{"foo": "1", "bar": "2"}); err != nil {
+		t.Fatalf("vault.PutAll() = %v, want nil", err)
+	}
+	if err := vault.Put(UIDDataKey, "uid"); err != nil {
+		t.Fatalf("vault.Put() = %v, want nil", err)
+	}
+	// Storing again updates the given keys and keeps the others.
+	if err := vault.PutAll(map[string]string{"foo": "3"}); err != nil {
+		t.Fatalf("vault.PutAll() = %v, want nil", err)
+	}
+	for key, want := range map[string]string{"foo": "3", "bar": "2", UIDDataKey: "uid"} {
+		if val, exists, err := vault.Get(key); !exists || err != nil || val != want {
+			t.Errorf("vault.Get(%q) = %q, %v, %v, want %q, true, nil", key, val, exists, err, want)
+		}
+	}
+}
@@ -24,11 +24,13 @@ import (
 type Syncer interface {
 	// Sync creates a full GCLB given some state related to an Ingress.
 	Sync(state interface{}) error
-	// GC cleans up GCLB resources for all Ingresses and can optionally
-	// use some arbitrary to help with the process.
-	// TODO(rramkumar): Do we need to rethink the strategy of GC'ing
-	// all Ingresses at once?
+	// GC cleans up GCLB resources for all Ingresses. It lists all GCLB
+	// resources and is meant to be run periodically rather than per sync.
 	GC(ings []*v1beta1.Ingress) error
+	// GCIngress cleans up the GCLB resources of a single Ingress given all
+	// Ingresses in the cluster. ing is nil if the Ingress with the given key
+	// no longer exists.
+	GCIngress(key string, ing *v1beta1.Ingress, ings []*v1beta1.Ingress) error
 }
 
 // Controller is an interface for ingress controllers and declares methods
@@ -38,10 +40,14 @@ type Controller interface {
 	SyncBackends(state interface{}) error
 	// GCBackends garbage collects backends for all ingresses given a list of ingresses to exclude from GC.
 	GCBackends(toKeep []*v1beta1.Ingress) error
+	// GCIngressBackends garbage collects the backends of a single Ingress which are not used by the given list of ingresses.
+	GCIngressBackends(ing *v1beta1.Ingress, toKeep []*v1beta1.Ingress) error
 	// SyncLoadBalancer syncs the front-end load balancer resources for a GCLB given some existing state.
 	SyncLoadBalancer(state interface{}) error
 	// GCLoadBalancers garbage collects front-end load balancer resources for all ingresses given a list of ingresses to exclude from GC.
 	GCLoadBalancers(toKeep []*v1beta1.Ingress) error
+	// GCLoadBalancer garbage collects the front-end load balancer resources of a single ingress.
+	GCLoadBalancer(key string, ing *v1beta1.Ingress) error
 	// PostProcess allows for doing some post-processing after an Ingress is synced to a GCLB.
 	PostProcess(state interface{}) error
 	// MaybeRemoveFinalizers removes finalizers from a list of ingresses one by one after all of its associated resources are deleted.
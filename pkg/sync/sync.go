@@ -79,3 +79,31 @@ func (s *IngressSyncer) GC(ings []*v1beta1.Ingress) error {
 
 	return s.controller.MaybeRemoveFinalizers(toCleanup.AsList())
 }
+
+// GCIngress implements Syncer.
+func (s *IngressSyncer) GCIngress(key string, ing *v1beta1.Ingress, ings []*v1beta1.Ingress) error {
+	_, toKeep := operator.Ingresses(ings).Partition(utils.NeedsCleanup)
+	toKeepIngresses := toKeep.AsList()
+
+	// An Ingress which is kept may only have stopped using some backends.
+	if ing != nil && !utils.NeedsCleanup(ing) {
+		if err := s.controller.GCIngressBackends(ing, toKeepIngresses); err != nil {
+			return fmt.Errorf("error running backend garbage collection routine: %v", err)
+		}
+		return nil
+	}
+
+	lbErr := s.controller.GCLoadBalancer(key, ing)
+	beErr := s.controller.GCIngressBackends(ing, toKeepIngresses)
+	if lbErr != nil {
+		return fmt.Errorf("error running load balancer garbage collection routine: %v", lbErr)
+	}
+	if beErr != nil {
+		return fmt.Errorf("error running backend garbage collection routine: %v", beErr)
+	}
+
+	if ing == nil {
+		return nil
+	}
+	return s.controller.MaybeRemoveFinalizers([]*v1beta1.Ingress{ing})
+}
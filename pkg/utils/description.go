@@ -22,16 +22,19 @@ import (
 	"k8s.io/klog"
 )
 
-// Description stores the description for a BackendService.
+// Description stores the description for a BackendService, or for a load
+// balancer resource owned by an Ingress.
 type Description struct {
-	ServiceName string   `json:"kubernetes.io/service-name"`
-	ServicePort string   `json:"kubernetes.io/service-port"`
+	ServiceName string   `json:"kubernetes.io/service-name,omitempty"`
+	ServicePort string   `json:"kubernetes.io/service-port,omitempty"`
 	XFeatures   []string `json:"x-features,omitempty"`
+	// IngressName is the namespace/name of the Ingress owning the resource.
+	IngressName string `json:"kubernetes.io/ingress-name,omitempty"`
 }
 
 // String returns the string representation of a Description.
 func (desc Description) String() string {
-	if desc.ServiceName == "" || desc.ServicePort == "" {
+	if (desc.ServiceName == "" || desc.ServicePort == "") && desc.IngressName == "" {
 		return ""
 	}
 
@@ -55,3 +58,34 @@ func DescriptionFromString(descString string) *Description {
 	}
 	return &desc
 }
+
+// NegDescription stores the description of a NEG created by the NEG controller.
+type NegDescription struct {
+	ClusterUID  string `json:"cluster-uid,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	ServiceName string `json:"service-name,omitempty"`
+	Port        string `json:"port,omitempty"`
+}
+
+// String returns the string representation of a NegDescription.
+func (desc NegDescription) String() string {
+	descJson, err := json.Marshal(desc)
+	if err != nil {
+		klog.Errorf("Failed to generate NEG description string: %v, falling back to empty string", err)
+		return ""
+	}
+	return string(descJson)
+}
+
+// NegDescriptionFromString gets a NegDescription from string.
+func NegDescriptionFromString(descString string) *NegDescription {
+	if descString == "" {
+		return &NegDescription{}
+	}
+	var desc NegDescription
+	if err := json.Unmarshal([]byte(descString), &desc); err != nil {
+		klog.V(4).Infof("Failed to parse NEG description: %s, falling back to empty description", descString)
+		return &NegDescription{}
+	}
+	return &desc
+}
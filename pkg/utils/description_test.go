@@ -57,6 +57,11 @@ func TestString(t *testing.T) {
 			},
 			expectedString: `{"kubernetes.io/service-name":"my-service","kubernetes.io/service-port":"my-port","x-features":["feature1","feature2"]}`,
 		},
+		{
+			desc:           "ingress",
+			description:    Description{IngressName: "my-ns/my-ingress"},
+			expectedString: `{"kubernetes.io/ingress-name":"my-ns/my-ingress"}`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -97,6 +102,11 @@ func TestDescriptionFromString(t *testing.T) {
 			backendServiceDesc: `{"kubernetes.io/service-name":"my-service","kubernetes.io/service-port":"my-port","x-features":["feature1","feature2"]}`,
 			expectedDesc:       Description{ServiceName: "my-service", ServicePort: "my-port", XFeatures: []string{"feature1", "feature2"}},
 		},
+		{
+			desc:               "ingress",
+			backendServiceDesc: `{"kubernetes.io/ingress-name": "my-ns/my-ingress"}`,
+			expectedDesc:       Description{IngressName: "my-ns/my-ingress"},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -106,3 +116,19 @@ func TestDescriptionFromString(t *testing.T) {
 		}
 	}
 }
+
+func TestNegDescription(t *testing.T) {
+	desc := NegDescription{ClusterUID: "uid1", Namespace: "ns", ServiceName: "svc", Port: "80"}
+	expectedString := `{"cluster-uid":"uid1","namespace":"ns","service-name":"svc","port":"80"}`
+	if got := desc.String(); got != expectedString {
+		t.Errorf("String()=%s, want %s", got, expectedString)
+	}
+	if got := NegDescriptionFromString(expectedString); !reflect.DeepEqual(*got, desc) {
+		t.Errorf("NegDescriptionFromString(%s)=%+v, want %+v", expectedString, *got, desc)
+	}
+	for _, descString := range []string{"", "invalid"} {
+		if got := NegDescriptionFromString(descString); !reflect.DeepEqual(*got, NegDescription{}) {
+			t.Errorf("NegDescriptionFromString(%q)=%+v, want empty description", descString, *got)
+		}
+	}
+}
@@ -41,7 +41,15 @@ const (
 	// TODO: this should really be "fr" and "frs".
 	forwardingRulePrefix      = "fw"
 	httpsForwardingRulePrefix = "fws"
-	urlMapPrefix              = "um"
+	// IPv6 forwarding rules of a dual-stack loadbalancer.
+	ipv6ForwardingRulePrefix      = "fw6"
+	ipv6HTTPSForwardingRulePrefix = "fws6"
+	// Forwarding rules of additional listener ports. The port follows the
+	// prefix after a delimiter, so that the names do not collide with the
+	// IPv6 forwarding rules for port 6.
+	listenerForwardingRulePrefix      = "fwl"
+	listenerHTTPSForwardingRulePrefix = "fwsl"
+	urlMapPrefix                      = "um"
 
 	// This allows sharing of backends across loadbalancers.
 	backendPrefix = "be"
@@ -400,6 +408,54 @@ func (n *Namer) ForwardingRule(lbName string, protocol NamerProtocol) string {
 	return "invalid"
 }
 
+// IPv6ForwardingRule returns the name of the IPv6 forwarding rule of a
+// dual-stack load balancer.
+func (n *Namer) IPv6ForwardingRule(lbName string, protocol NamerProtocol) string {
+	switch protocol {
+	case HTTPProtocol:
+		return truncate(fmt.Sprintf("%v-%v-%v", n.prefix, ipv6ForwardingRulePrefix, lbName))
+	case HTTPSProtocol:
+		return truncate(fmt.Sprintf("%v-%v-%v", n.prefix, ipv6HTTPSForwardingRulePrefix, lbName))
+	}
+	klog.Fatalf("invalid IPv6ForwardingRule protocol: %q", protocol)
+	return "invalid"
+}
+
+// ListenerForwardingRule returns the name of the forwarding rule serving an
+// additional listener port of a load balancer.
+func (n *Namer) ListenerForwardingRule(lbName string, protocol NamerProtocol, port int64) string {
+	switch protocol {
+	case HTTPProtocol:
+		return truncate(fmt.Sprintf("%v-%v-%d-%v", n.prefix, listenerForwardingRulePrefix, port, lbName))
+	case HTTPSProtocol:
+		return truncate(fmt.Sprintf("%v-%v-%d-%v", n.prefix, listenerHTTPSForwardingRulePrefix, port, lbName))
+	}
+	klog.Fatalf("invalid ListenerForwardingRule protocol: %q", protocol)
+	return "invalid"
+}
+
+// IsListenerForwardingRule returns true if name is the forwarding rule of an
+// additional listener port of the given load balancer.
+func (n *Namer) IsListenerForwardingRule(lbName, name string) bool {
+	for protocol, resource := range map[NamerProtocol]string{
+		HTTPProtocol:  listenerForwardingRulePrefix,
+		HTTPSProtocol: listenerHTTPSForwardingRulePrefix,
+	} {
+		prefix := fmt.Sprintf("%v-%v-", n.prefix, resource)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		port, err := strconv.ParseInt(strings.SplitN(name[len(prefix):], "-", 2)[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if name == n.ListenerForwardingRule(lbName, protocol, port) {
+			return true
+		}
+	}
+	return false
+}
+
 // UrlMap returns the name for the UrlMap for a given load balancer.
 func (n *Namer) UrlMap(lbName string) string {
 	return truncate(fmt.Sprintf("%v-%v-%v", n.prefix, urlMapPrefix, lbName))
@@ -109,6 +109,10 @@ func TestNamerParseName(t *testing.T) {
 		{namer.SSLCertName("default/my-ing", secretHash), &NameComponents{ClusterName: uid, Resource: "ssl"}},
 		{namer.ForwardingRule(lbName, HTTPProtocol), &NameComponents{ClusterName: uid, Resource: "fw"}},
 		{namer.ForwardingRule(lbName, HTTPSProtocol), &NameComponents{ClusterName: uid, Resource: "fws"}},
+		{namer.IPv6ForwardingRule(lbName, HTTPProtocol), &NameComponents{ClusterName: uid, Resource: "fw6"}},
+		{namer.IPv6ForwardingRule(lbName, HTTPSProtocol), &NameComponents{ClusterName: uid, Resource: "fws6"}},
+		{namer.ListenerForwardingRule(lbName, HTTPProtocol, 8080), &NameComponents{ClusterName: uid, Resource: "fwl"}},
+		{namer.ListenerForwardingRule(lbName, HTTPSProtocol, 8443), &NameComponents{ClusterName: uid, Resource: "fwsl"}},
 		{namer.UrlMap(lbName), &NameComponents{ClusterName: uid, Resource: "um", LbName: "key1"}},
 	} {
 		nc := namer.ParseName(tc.in)
@@ -138,6 +142,10 @@ func TestNameBelongsToCluster(t *testing.T) {
 			namer.SSLCertName("default/my-ing", secretHash),
 			namer.ForwardingRule(lbName, HTTPProtocol),
 			namer.ForwardingRule(lbName, HTTPSProtocol),
+			namer.IPv6ForwardingRule(lbName, HTTPProtocol),
+			namer.IPv6ForwardingRule(lbName, HTTPSProtocol),
+			namer.ListenerForwardingRule(lbName, HTTPProtocol, 8080),
+			namer.ListenerForwardingRule(lbName, HTTPSProtocol, 8443),
 			namer.UrlMap(lbName),
 			namer.NEG("ns", "n", int32(80)),
 			// long names that are truncated
@@ -146,6 +154,10 @@ func TestNameBelongsToCluster(t *testing.T) {
 			namer.SSLCertName(longLBName, secretHash),
 			namer.ForwardingRule(longLBName, HTTPProtocol),
 			namer.ForwardingRule(longLBName, HTTPSProtocol),
+			namer.IPv6ForwardingRule(longLBName, HTTPProtocol),
+			namer.IPv6ForwardingRule(longLBName, HTTPSProtocol),
+			namer.ListenerForwardingRule(longLBName, HTTPProtocol, 8080),
+			namer.ListenerForwardingRule(longLBName, HTTPSProtocol, 8443),
 			namer.UrlMap(longLBName),
 			namer.NEG(strings.Repeat(longKey, 3), strings.Repeat(longKey, 3), int32(88888)),
 		} {
@@ -300,6 +312,10 @@ func TestNamerLoadBalancer(t *testing.T) {
 		sslCert             string
 		forwardingRuleHTTP  string
 		forwardingRuleHTTPS string
+		ipv6RuleHTTP        string
+		ipv6RuleHTTPS       string
+		listenerRuleHTTP    string
+		listenerRuleHTTPS   string
 		urlMap              string
 	}{
 		{
@@ -310,6 +326,10 @@ func TestNamerLoadBalancer(t *testing.T) {
 			"k8s-ssl-%s-%s--uid1",
 			"k8s-fw-key1--uid1",
 			"k8s-fws-key1--uid1",
+			"k8s-fw6-key1--uid1",
+			"k8s-fws6-key1--uid1",
+			"k8s-fwl-8080-key1--uid1",
+			"k8s-fwsl-8443-key1--uid1",
 			"k8s-um-key1--uid1",
 		},
 		{
@@ -320,6 +340,10 @@ func TestNamerLoadBalancer(t *testing.T) {
 			"mci-ssl-%s-%s--uid1",
 			"mci-fw-key1--uid1",
 			"mci-fws-key1--uid1",
+			"mci-fw6-key1--uid1",
+			"mci-fws6-key1--uid1",
+			"mci-fwl-8080-key1--uid1",
+			"mci-fwsl-8443-key1--uid1",
 			"mci-um-key1--uid1",
 		},
 	} {
@@ -353,6 +377,22 @@ func TestNamerLoadBalancer(t *testing.T) {
 		if name != tc.forwardingRuleHTTPS {
 			t.Errorf("namer.ForwardingRule(%q, HTTPSProtocol) = %q, want %q", lbName, name, tc.forwardingRuleHTTPS)
 		}
+		name = namer.IPv6ForwardingRule(lbName, HTTPProtocol)
+		if name != tc.ipv6RuleHTTP {
+			t.Errorf("namer.IPv6ForwardingRule(%q, HTTPProtocol) = %q, want %q", lbName, name, tc.ipv6RuleHTTP)
+		}
+		name = namer.IPv6ForwardingRule(lbName, HTTPSProtocol)
+		if name != tc.ipv6RuleHTTPS {
+			t.Errorf("namer.IPv6ForwardingRule(%q, HTTPSProtocol) = %q, want %q", lbName, name, tc.ipv6RuleHTTPS)
+		}
+		name = namer.ListenerForwardingRule(lbName, HTTPProtocol, 8080)
+		if name != tc.listenerRuleHTTP {
+			t.Errorf("namer.ListenerForwardingRule(%q, HTTPProtocol, 8080) = %q, want %q", lbName, name, tc.listenerRuleHTTP)
+		}
+		name = namer.ListenerForwardingRule(lbName, HTTPSProtocol, 8443)
+		if name != tc.listenerRuleHTTPS {
+			t.Errorf("namer.ListenerForwardingRule(%q, HTTPSProtocol, 8443) = %q, want %q", lbName, name, tc.listenerRuleHTTPS)
+		}
 		name = namer.UrlMap(lbName)
 		if name != tc.urlMap {
 			t.Errorf("namer.UrlMap(%q) = %q, want %q", lbName, name, tc.urlMap)
@@ -361,6 +401,37 @@ func TestNamerLoadBalancer(t *testing.T) {
 }
 
 // Ensure that a valid cert name is created if clusterName is empty.
+func TestNamerIsListenerForwardingRule(t *testing.T) {
+	namer := NewNamerWithPrefix("k8s", "uid1", "fw1")
+	lbName := namer.LoadBalancer("key1")
+	otherLbName := namer.LoadBalancer("key2")
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{namer.ListenerForwardingRule(lbName, HTTPProtocol, 8080), true},
+		{namer.ListenerForwardingRule(lbName, HTTPSProtocol, 8443), true},
+		// Listener rules on port 6 do not collide with the IPv6 forwarding rules.
+		{namer.ListenerForwardingRule(lbName, HTTPProtocol, 6), true},
+		{namer.ListenerForwardingRule(lbName, HTTPSProtocol, 6), true},
+		{namer.IPv6ForwardingRule(lbName, HTTPProtocol), false},
+		{namer.IPv6ForwardingRule(lbName, HTTPSProtocol), false},
+		{namer.ForwardingRule(lbName, HTTPProtocol), false},
+		{namer.ForwardingRule(lbName, HTTPSProtocol), false},
+		{namer.ListenerForwardingRule(otherLbName, HTTPProtocol, 8080), false},
+		{"k8s-fwl-port-key1--uid1", false},
+	} {
+		if got := namer.IsListenerForwardingRule(lbName, tc.name); got != tc.want {
+			t.Errorf("namer.IsListenerForwardingRule(%q, %q) = %v, want %v", lbName, tc.name, got, tc.want)
+		}
+	}
+	for _, protocol := range []NamerProtocol{HTTPProtocol, HTTPSProtocol} {
+		if listenerRule, ipv6Rule := namer.ListenerForwardingRule(lbName, protocol, 6), namer.IPv6ForwardingRule(lbName, protocol); listenerRule == ipv6Rule {
+			t.Errorf("namer.ListenerForwardingRule(%q, %v, 6) = %q collides with the IPv6 forwarding rule", lbName, protocol, listenerRule)
+		}
+	}
+}
+
 func TestNamerSSLCertName(t *testing.T) {
 	secretHash := fmt.Sprintf("%x", sha256.Sum256([]byte("test123")))[:16]
 	namer := NewNamerWithPrefix("k8s", "", "fw1")
@@ -23,6 +23,7 @@ import (
 
 	"fmt"
 
+	istioV1alpha3 "istio.io/api/networking/v1alpha3"
 	"k8s.io/ingress-gce/pkg/annotations"
 	backendconfigv1beta1 "k8s.io/ingress-gce/pkg/apis/backendconfig/v1beta1"
 )
@@ -50,6 +51,9 @@ type ServicePort struct {
 	NEGEnabled    bool
 	L7ILBEnabled  bool
 	BackendConfig *backendconfigv1beta1.BackendConfig
+	// TrafficPolicy is the traffic policy that Istio DestinationRules apply to the
+	// service port, only set when --enable-csm=true.
+	TrafficPolicy *istioV1alpha3.TrafficPolicy
 }
 
 // GetDescription returns a Description for this ServicePort.
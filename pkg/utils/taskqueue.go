@@ -17,6 +17,8 @@ limitations under the License.
 package utils
 
 import (
+	"sync"
+
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
@@ -35,7 +37,9 @@ type TaskQueue interface {
 
 // PeriodicTaskQueue invokes the given sync function for every work item
 // inserted. If the sync() function results in an error, the item is put on
-// the work queue after a rate-limit.
+// the work queue after a rate-limit. Items are processed by a pool of
+// workers; the work queue guarantees that a key is never processed by more
+// than one worker at a time.
 type PeriodicTaskQueue struct {
 	// resource is used for logging to distinguish the queue being used.
 	resource string
@@ -45,16 +49,31 @@ type PeriodicTaskQueue struct {
 	queue workqueue.RateLimitingInterface
 	// sync is called for each item in the queue.
 	sync func(string) error
-	// workerDone is closed when the worker exits.
+	// numWorkers is the number of workers processing the queue.
+	numWorkers int
+	// workerDone is closed when all workers exit.
 	workerDone chan struct{}
 }
 
 // Run the task queue. This will block until the Shutdown() has been called.
 func (t *PeriodicTaskQueue) Run() {
+	var wg sync.WaitGroup
+	for i := 0; i < t.numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.worker()
+		}()
+	}
+	wg.Wait()
+	close(t.workerDone)
+}
+
+// worker processes items until the queue is shut down.
+func (t *PeriodicTaskQueue) worker() {
 	for {
 		key, quit := t.queue.Get()
 		if quit {
-			close(t.workerDone)
 			return
 		}
 		klog.V(4).Infof("Syncing %v (%v)", key, t.resource)
@@ -82,7 +101,7 @@ func (t *PeriodicTaskQueue) Enqueue(objs ...interface{}) {
 	}
 }
 
-// Shutdown shuts down the work queue and waits for the worker to ACK
+// Shutdown shuts down the work queue and waits for the workers to ACK
 func (t *PeriodicTaskQueue) Shutdown() {
 	klog.V(2).Infof("Shutdown")
 	t.queue.ShutDown()
@@ -95,9 +114,23 @@ func NewPeriodicTaskQueue(name, resource string, syncFn func(string) error) *Per
 	return NewPeriodicTaskQueueWithLimiter(name, resource, syncFn, rl)
 }
 
+// NewPeriodicTaskQueueWithMultipleWorkers creates a new task queue with the
+// default rate limiter, processed by numWorkers workers.
+func NewPeriodicTaskQueueWithMultipleWorkers(name, resource string, numWorkers int, syncFn func(string) error) *PeriodicTaskQueue {
+	rl := workqueue.DefaultControllerRateLimiter()
+	return newPeriodicTaskQueue(name, resource, numWorkers, syncFn, rl)
+}
+
 // NewPeriodicTaskQueueWithLimiter creates a new task queue with the given sync function
 // and rate limiter. The sync function is called for every element inserted into the queue.
 func NewPeriodicTaskQueueWithLimiter(name, resource string, syncFn func(string) error, rl workqueue.RateLimiter) *PeriodicTaskQueue {
+	return newPeriodicTaskQueue(name, resource, 1, syncFn, rl)
+}
+
+func newPeriodicTaskQueue(name, resource string, numWorkers int, syncFn func(string) error, rl workqueue.RateLimiter) *PeriodicTaskQueue {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
 	var queue workqueue.RateLimitingInterface
 	if name == "" {
 		queue = workqueue.NewRateLimitingQueue(rl)
@@ -110,6 +143,7 @@ func NewPeriodicTaskQueueWithLimiter(name, resource string, syncFn func(string)
 		keyFunc:    KeyFunc,
 		queue:      queue,
 		sync:       syncFn,
+		numWorkers: numWorkers,
 		workerDone: make(chan struct{}),
 	}
 }
@@ -19,6 +19,7 @@ package utils
 import (
 	"errors"
 	"reflect"
+	"sync"
 	"testing"
 
 	"k8s.io/client-go/tools/cache"
@@ -67,3 +68,58 @@ func TestPeriodicTaskQueue(t *testing.T) {
 		t.Errorf("task queue synced %+v, want %+v", synced, expected)
 	}
 }
+
+func TestPeriodicTaskQueueMultipleWorkers(t *testing.T) {
+	t.Parallel()
+	var (
+		lock     sync.Mutex
+		inFlight = map[string]int{}
+		synced   = map[string]int{}
+	)
+	slowStarted := make(chan struct{}, 2)
+	releaseSlow := make(chan struct{})
+	fastDone := make(chan struct{}, 1)
+
+	syncFn := func(key string) error {
+		lock.Lock()
+		inFlight[key]++
+		if inFlight[key] > 1 {
+			t.Errorf("key %q synced by more than one worker at a time", key)
+		}
+		lock.Unlock()
+
+		switch key {
+		case "slow":
+			slowStarted <- struct{}{}
+			<-releaseSlow
+		case "fast":
+			fastDone <- struct{}{}
+		}
+
+		lock.Lock()
+		inFlight[key]--
+		synced[key]++
+		lock.Unlock()
+		return nil
+	}
+	tq := NewPeriodicTaskQueueWithMultipleWorkers("", "test", 3, syncFn)
+	go tq.Run()
+
+	tq.Enqueue(cache.ExplicitKey("slow"))
+	<-slowStarted
+	// Enqueued while "slow" is being processed; must wait for it to finish.
+	tq.Enqueue(cache.ExplicitKey("slow"))
+	// Another worker processes "fast" while "slow" is blocked.
+	tq.Enqueue(cache.ExplicitKey("fast"))
+	<-fastDone
+
+	close(releaseSlow)
+	<-slowStarted
+	tq.Shutdown()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if synced["slow"] != 2 || synced["fast"] != 1 {
+		t.Errorf("task queue synced %+v, want slow: 2, fast: 1", synced)
+	}
+}
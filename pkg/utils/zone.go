@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	api_v1 "k8s.io/api/core/v1"
+	"k8s.io/ingress-gce/pkg/annotations"
+)
+
+// gceProviderIDPrefix is the prefix of the provider ID of GCE nodes, which has
+// the format gce://<project>/<zone>/<instance>.
+const gceProviderIDPrefix = "gce://"
+
+// GetZone returns the zone of the node. The topology zone label takes precedence
+// over the deprecated failure domain zone label, and the zone in the provider ID of
+// the node is used if the node has neither.
+func GetZone(node *api_v1.Node) (string, error) {
+	for _, key := range []string{annotations.TopologyZoneKey, annotations.ZoneKey} {
+		if zone, ok := node.Labels[key]; ok && zone != "" {
+			return zone, nil
+		}
+	}
+	if zone, ok := zoneFromProviderID(node.Spec.ProviderID); ok {
+		return zone, nil
+	}
+	return "", fmt.Errorf("node %q has neither zone label %q nor %q, nor a GCE provider ID (%q)", node.Name, annotations.TopologyZoneKey, annotations.ZoneKey, node.Spec.ProviderID)
+}
+
+func zoneFromProviderID(providerID string) (string, bool) {
+	if !strings.HasPrefix(providerID, gceProviderIDPrefix) {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(providerID, gceProviderIDPrefix), "/")
+	if len(parts) != 3 || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// ZoneCache caches the zone of nodes by name. Entries must be forgotten when the
+// zone of a node may have changed, see ForgetIfChanged.
+type ZoneCache struct {
+	lock  sync.RWMutex
+	zones map[string]string
+}
+
+// NewZoneCache returns an empty ZoneCache.
+func NewZoneCache() *ZoneCache {
+	return &ZoneCache{zones: map[string]string{}}
+}
+
+// GetZone returns the zone of the node, resolving it with GetZone on a cache miss.
+func (c *ZoneCache) GetZone(node *api_v1.Node) (string, error) {
+	c.lock.RLock()
+	zone, ok := c.zones[node.Name]
+	c.lock.RUnlock()
+	if ok {
+		return zone, nil
+	}
+
+	zone, err := GetZone(node)
+	if err != nil {
+		return "", err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.zones[node.Name] = zone
+	return zone, nil
+}
+
+// Forget removes the cached zone of the node.
+func (c *ZoneCache) Forget(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.zones, name)
+}
+
+// ForgetIfChanged removes the cached zone of the node if the labels or provider ID
+// the zone is resolved from changed between old and cur.
+func (c *ZoneCache) ForgetIfChanged(old, cur *api_v1.Node) {
+	if old.Labels[annotations.TopologyZoneKey] != cur.Labels[annotations.TopologyZoneKey] ||
+		old.Labels[annotations.ZoneKey] != cur.Labels[annotations.ZoneKey] ||
+		old.Spec.ProviderID != cur.Spec.ProviderID {
+		c.Forget(cur.Name)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	api_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-gce/pkg/annotations"
+)
+
+func newZoneTestNode(labels map[string]string, providerID string) *api_v1.Node {
+	return &api_v1.Node{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "node", Labels: labels},
+		Spec:       api_v1.NodeSpec{ProviderID: providerID},
+	}
+}
+
+func TestGetZone(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		labels     map[string]string
+		providerID string
+		expectZone string
+		expectErr  bool
+	}{
+		{
+			desc:       "failure domain label",
+			labels:     map[string]string{annotations.ZoneKey: "zone1"},
+			expectZone: "zone1",
+		},
+		{
+			desc:       "topology label",
+			labels:     map[string]string{annotations.TopologyZoneKey: "zone1"},
+			expectZone: "zone1",
+		},
+		{
+			desc:       "topology label takes precedence",
+			labels:     map[string]string{annotations.TopologyZoneKey: "zone1", annotations.ZoneKey: "zone2"},
+			providerID: "gce://project/zone3/node",
+			expectZone: "zone1",
+		},
+		{
+			desc:       "provider ID",
+			providerID: "gce://project/zone3/node",
+			expectZone: "zone3",
+		},
+		{
+			desc:       "empty label falls back to provider ID",
+			labels:     map[string]string{annotations.ZoneKey: ""},
+			providerID: "gce://project/zone3/node",
+			expectZone: "zone3",
+		},
+		{
+			desc:       "provider ID of another cloud",
+			providerID: "aws:///us-east-1a/i-123",
+			expectErr:  true,
+		},
+		{
+			desc:       "malformed provider ID",
+			providerID: "gce://project/node",
+			expectErr:  true,
+		},
+		{
+			desc:      "no label nor provider ID",
+			expectErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			zone, err := GetZone(newZoneTestNode(tc.labels, tc.providerID))
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("GetZone() = _, %v, want error %v", err, tc.expectErr)
+			}
+			if zone != tc.expectZone {
+				t.Errorf("GetZone() = %q, want %q", zone, tc.expectZone)
+			}
+		})
+	}
+}
+
+func TestZoneCache(t *testing.T) {
+	c := NewZoneCache()
+	node := newZoneTestNode(map[string]string{annotations.ZoneKey: "zone1"}, "")
+	if zone, err := c.GetZone(node); err != nil || zone != "zone1" {
+		t.Fatalf("GetZone() = %q, %v, want %q, nil", zone, err, "zone1")
+	}
+
+	// The cached zone is returned as long as the zone of the node does not change.
+	updated := node.DeepCopy()
+	updated.Labels[annotations.ZoneKey] = "zone2"
+	if zone, _ := c.GetZone(updated); zone != "zone1" {
+		t.Errorf("GetZone() = %q, want cached %q", zone, "zone1")
+	}
+	c.ForgetIfChanged(node, node.DeepCopy())
+	if zone, _ := c.GetZone(updated); zone != "zone1" {
+		t.Errorf("GetZone() = %q, want cached %q", zone, "zone1")
+	}
+	c.ForgetIfChanged(node, updated)
+	if zone, _ := c.GetZone(updated); zone != "zone2" {
+		t.Errorf("GetZone() = %q, want %q", zone, "zone2")
+	}
+
+	c.Forget(node.Name)
+	if _, err := c.GetZone(newZoneTestNode(nil, "")); err == nil {
+		t.Errorf("GetZone() = _, nil, want error for a node without zone")
+	}
+}